@@ -0,0 +1,28 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package v1beta1 contains API Schema definitions for the proxy.projectcapsule.dev v1beta1 API group,
+// served by capsule-proxy itself rather than by the API server.
+// +kubebuilder:object:generate=true
+// +kubebuilder:skipversion
+// +groupName=proxy.projectcapsule.dev
+package v1beta1
+
+import (
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/scheme"
+)
+
+var (
+	// GroupVersion is group version used to register these objects.
+	//nolint:gochecknoglobals
+	GroupVersion = schema.GroupVersion{Group: "proxy.projectcapsule.dev", Version: "v1beta1"}
+
+	// SchemeBuilder is used to add go types to the GroupVersionKind scheme.
+	//nolint:gochecknoglobals,staticcheck
+	SchemeBuilder = &scheme.Builder{GroupVersion: GroupVersion}
+
+	// AddToScheme adds the types in this group-version to the given scheme.
+	//nolint:gochecknoglobals
+	AddToScheme = SchemeBuilder.AddToScheme
+)
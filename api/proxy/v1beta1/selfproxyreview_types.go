@@ -0,0 +1,86 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package v1beta1
+
+import (
+	capsulerbac "github.com/projectcapsule/capsule/pkg/api/rbac"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	capsuleproxyv1beta1 "github.com/projectcapsule/capsule-proxy/api/v1beta1"
+)
+
+const (
+	// SelfProxyReviewKind is the kind of the SelfProxyReview.
+	SelfProxyReviewKind = "SelfProxyReview"
+	// SelfProxyReviewResource is the resource the SelfProxyReview is created with.
+	SelfProxyReviewResource = "selfproxyreviews"
+)
+
+// SelfProxyReviewSource tells how a Tenant is granted to the user.
+type SelfProxyReviewSource string
+
+const (
+	// SourceTenantOwner grants the Tenants the user is an owner of.
+	SourceTenantOwner SelfProxyReviewSource = "TenantOwner"
+	// SourceProxySetting grants the Tenant of a ProxySetting the user is a subject of.
+	SourceProxySetting SelfProxyReviewSource = "ProxySetting"
+	// SourceGlobalProxySettings grants the cluster resources of the GlobalProxySettings the user is a subject of.
+	SourceGlobalProxySettings SelfProxyReviewSource = "GlobalProxySettings"
+	// SourceRoleBindingReflection grants the Tenant namespaces the user is bound to by a reflected RoleBinding.
+	SourceRoleBindingReflection SelfProxyReviewSource = "RoleBindingReflection"
+)
+
+// SelfProxyReviewTenant is a grant of capsule-proxy to the user.
+type SelfProxyReviewTenant struct {
+	// Name of the Tenant, "global" for the GlobalProxySettings.
+	Name string `json:"name"`
+	// Source of the grant.
+	Source SelfProxyReviewSource `json:"source"`
+	// Name of the ProxySetting, as namespace/name, or of the GlobalProxySettings granting the Tenant.
+	// +optional
+	SourceName string `json:"sourceName,omitempty"`
+	// Namespaces of the Tenant the user can access.
+	// +optional
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Cluster Resources granted to the user.
+	// +optional
+	ClusterResources []capsuleproxyv1beta1.ClusterResource `json:"clusterResources,omitempty"`
+	// Legacy proxy operations granted to the Tenant owner.
+	// +optional
+	ProxyOperations []capsulerbac.ProxySettings `json:"proxySettings,omitempty"`
+}
+
+// SelfProxyReviewStatus is filled in by capsule-proxy with the effective permissions of the user.
+type SelfProxyReviewStatus struct {
+	// User information of the caller, as resolved by capsule-proxy.
+	UserInfo authenticationv1.UserInfo `json:"userInfo"`
+	// CapsuleUser tells whether the requests of the user are filtered by capsule-proxy.
+	CapsuleUser bool `json:"capsuleUser"`
+	// Ignored tells whether the user is an ignored identity, whose requests are forwarded as is.
+	Ignored bool `json:"ignored"`
+	// Tenants granted to the user.
+	// +optional
+	Tenants []SelfProxyReviewTenant `json:"tenants,omitempty"`
+	// Namespaces the user can list through capsule-proxy.
+	// +optional
+	Namespaces []string `json:"namespaces,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// SelfProxyReview returns the Tenants, namespaces and cluster resources capsule-proxy grants to the caller.
+// It is created only: capsule-proxy answers with the filled-in status without persisting anything.
+type SelfProxyReview struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// +optional
+	Status SelfProxyReviewStatus `json:"status,omitempty"`
+}
+
+//nolint:gochecknoinits
+func init() {
+	SchemeBuilder.Register(&SelfProxyReview{})
+}
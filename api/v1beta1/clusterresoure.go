@@ -7,7 +7,7 @@ import metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 // ClusterResourceOperation is an operation capsule-proxy can perform on a
 // selected cluster-scoped resource.
-// +kubebuilder:validation:Enum=List;Get
+// +kubebuilder:validation:Enum=List;Get;Update;Patch;Delete
 type ClusterResourceOperation string
 
 func (p ClusterResourceOperation) String() string {
@@ -15,8 +15,11 @@ func (p ClusterResourceOperation) String() string {
 }
 
 const (
-	ClusterResourceOperationList ClusterResourceOperation = "List"
-	ClusterResourceOperationGet  ClusterResourceOperation = "Get"
+	ClusterResourceOperationList   ClusterResourceOperation = "List"
+	ClusterResourceOperationGet    ClusterResourceOperation = "Get"
+	ClusterResourceOperationUpdate ClusterResourceOperation = "Update"
+	ClusterResourceOperationPatch  ClusterResourceOperation = "Patch"
+	ClusterResourceOperationDelete ClusterResourceOperation = "Delete"
 )
 
 // AllowsOperation reports whether this rule enables the requested operation.
@@ -39,9 +42,12 @@ func (r ClusterResource) AllowsOperation(operation ClusterResourceOperation) boo
 }
 
 // EffectiveOperations returns the normalized supported operations. Legacy
-// LIST rules include GET; omitted operations default to both.
+// LIST rules include GET; omitted operations default to both. Write
+// operations are never implied and must be listed explicitly.
 func (r ClusterResource) EffectiveOperations() []ClusterResourceOperation {
 	list, get := len(r.Operations) == 0, len(r.Operations) == 0
+	update, patch, del := false, false, false
+
 	for _, operation := range r.Operations {
 		switch operation {
 		case ClusterResourceOperationList:
@@ -49,10 +55,16 @@ func (r ClusterResource) EffectiveOperations() []ClusterResourceOperation {
 			get = true
 		case ClusterResourceOperationGet:
 			get = true
+		case ClusterResourceOperationUpdate:
+			update = true
+		case ClusterResourceOperationPatch:
+			patch = true
+		case ClusterResourceOperationDelete:
+			del = true
 		}
 	}
 
-	operations := make([]ClusterResourceOperation, 0, 2)
+	operations := make([]ClusterResourceOperation, 0, 5)
 	if list {
 		operations = append(operations, ClusterResourceOperationList)
 	}
@@ -61,6 +73,18 @@ func (r ClusterResource) EffectiveOperations() []ClusterResourceOperation {
 		operations = append(operations, ClusterResourceOperationGet)
 	}
 
+	if update {
+		operations = append(operations, ClusterResourceOperationUpdate)
+	}
+
+	if patch {
+		operations = append(operations, ClusterResourceOperationPatch)
+	}
+
+	if del {
+		operations = append(operations, ClusterResourceOperationDelete)
+	}
+
 	return operations
 }
 
@@ -73,9 +97,10 @@ type ClusterResource struct {
 	// Resources is a list of resources this rule applies to. '*' represents all resources.
 	Resources []string `json:"resources"`
 
-	// Operations which can be executed on the selected resources. Only GET and
-	// LIST are supported. When omitted, both operations are enabled. LIST also
-	// enables GET for backward compatibility with existing v1beta1 rules.
+	// Operations which can be executed on the selected resources. When omitted,
+	// GET and LIST are enabled. LIST also enables GET for backward compatibility
+	// with existing v1beta1 rules. UPDATE, PATCH and DELETE are only allowed on
+	// objects matching the selector, and writes must keep the object selected.
 	// +kubebuilder:default:={"List","Get"}
 	Operations []ClusterResourceOperation `json:"operations,omitempty"`
 
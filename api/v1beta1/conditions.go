@@ -0,0 +1,31 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package v1beta1
+
+// Condition types reported on ProxySetting and GlobalProxySettings status,
+// next to the Ready condition summarizing them.
+const (
+	// TenantResolvedCondition reports whether the ProxySetting namespace
+	// belongs to a Tenant. ProxySettings outside of a Tenant are ignored.
+	TenantResolvedCondition = "TenantResolved"
+	// SubjectsResolvedCondition reports whether the subjects are known
+	// Capsule users or groups from the CapsuleConfiguration.
+	SubjectsResolvedCondition = "SubjectsResolved"
+	// ResourcesResolvedCondition reports whether the clusterResources API
+	// groups and resources resolve through API discovery.
+	ResourcesResolvedCondition = "ResourcesResolved"
+	// SelectorsValidCondition reports whether the clusterResources selectors
+	// are valid and able to match objects.
+	SelectorsValidCondition = "SelectorsValid"
+)
+
+// Condition reasons reported on ProxySetting and GlobalProxySettings status.
+const (
+	ResolvedReason          = "Resolved"
+	TenantNotFoundReason    = "TenantNotFound"
+	SubjectsNotFoundReason  = "SubjectsNotFound"
+	ResourcesNotFoundReason = "ResourcesNotFound"
+	DiscoveryFailedReason   = "DiscoveryFailed"
+	InvalidSelectorReason   = "InvalidSelector"
+)
@@ -16,6 +16,9 @@ type GlobalProxySettingsSpec struct {
 	// However they must be part of the capsule-user groups.
 	// +kubebuilder:validation:MinItems=1
 	Rules []GlobalSubjectSpec `json:"rules"`
+	// Rate limit applied to the requests of the subjects of the rules.
+	// +optional
+	RateLimit *GlobalRateLimit `json:"rateLimit,omitempty"`
 }
 
 type GlobalSubjectSpec struct {
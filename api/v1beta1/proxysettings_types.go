@@ -28,6 +28,9 @@ type ProxySettingSpec struct {
 	// Subjects that should receive additional permissions.
 	// +kubebuilder:validation:MinItems=1
 	Subjects []OwnerSpec `json:"subjects"`
+	// Rate limit shared by the requests of every user of the Tenant.
+	// +optional
+	RateLimit *RateLimit `json:"rateLimit,omitempty"`
 }
 
 // ProxySettingStatus defines the observed state of ProxySetting.
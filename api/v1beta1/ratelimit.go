@@ -0,0 +1,52 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package v1beta1
+
+// RateLimitKey selects the requests sharing a rate limit.
+// +kubebuilder:validation:Enum=User;Group;Tenant
+type RateLimitKey string
+
+func (k RateLimitKey) String() string {
+	return string(k)
+}
+
+const (
+	RateLimitKeyUser   RateLimitKey = "User"
+	RateLimitKeyGroup  RateLimitKey = "Group"
+	RateLimitKeyTenant RateLimitKey = "Tenant"
+)
+
+// RateLimit bounds the requests served by capsule-proxy.
+// +kubebuilder:object:generate=true
+type RateLimit struct {
+	// QPS is the sustained number of requests per second. Requests are not
+	// rate limited when omitted.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	QPS int32 `json:"qps,omitempty"`
+
+	// Burst is the number of requests allowed at once above the sustained
+	// rate, QPS when omitted.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Burst int32 `json:"burst,omitempty"`
+
+	// MaxInflightWatches bounds the watches open at the same time. Watches
+	// are not limited when omitted.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxInflightWatches int32 `json:"maxInflightWatches,omitempty"`
+}
+
+// GlobalRateLimit bounds the requests of the subjects of GlobalProxySettings.
+// +kubebuilder:object:generate=true
+type GlobalRateLimit struct {
+	RateLimit `json:",inline"`
+
+	// Key selects the requests sharing the limit: the requests of each User,
+	// of each Group among the subjects, or of the users of each Tenant.
+	// +kubebuilder:default=User
+	// +optional
+	Key RateLimitKey `json:"key,omitempty"`
+}
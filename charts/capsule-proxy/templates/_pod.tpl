@@ -68,9 +68,33 @@ spec:
     - --zap-log-level={{ .Values.options.logLevel }}
     - --enable-ssl={{ .Values.options.enableSSL }}
     - --oidc-username-claim={{ .Values.options.oidcUsernameClaim }}
+    {{- range .Values.options.oidcIssuerURLs }}
+    - --oidc-issuer-url={{ . }}
+    {{- end }}
+    {{- range .Values.options.oidcAudiences }}
+    - --oidc-audience={{ . }}
+    {{- end }}
+    {{- with .Values.options.oidcGroupsClaim }}
+    - --oidc-groups-claim={{ . }}
+    {{- end }}
     - --enable-reflector={{ .Values.options.roleBindingReflector }}
     - --rolebindings-resync-period={{ .Values.options.rolebindingsResyncPeriod }}
     - --disable-caching={{ .Values.options.disableCaching }}
+    - --namespaced-list-strategy={{ .Values.options.namespacedListStrategy }}
+    - --review-cache-size={{ .Values.options.reviewCache.size }}
+    - --review-cache-positive-ttl={{ .Values.options.reviewCache.positiveTTL }}
+    - --review-cache-negative-ttl={{ .Values.options.reviewCache.negativeTTL }}
+    {{- with .Values.options.audit.logPath }}
+    - --audit-log-path={{ . }}
+    {{- end }}
+    {{- with .Values.options.audit.webhookURL }}
+    - --audit-webhook-url={{ . }}
+    {{- end }}
+    {{- with .Values.options.tracing.endpoint }}
+    - --tracing-endpoint={{ . }}
+    - --tracing-insecure={{ $.Values.options.tracing.insecure }}
+    - --tracing-sample-ratio={{ $.Values.options.tracing.sampleRatio }}
+    {{- end }}
     - --auth-preferred-types={{ .Values.options.authPreferredTypes }}
     {{- if .Values.options.enableSSL }}
     - --ssl-cert-path={{ .Values.options.SSLDirectory }}/{{ .Values.options.SSLCertFileName }}
@@ -89,6 +113,21 @@ spec:
     {{- with .Values.options.impersonationGroupRegexp }}
     - --impersonation-group-regexp={{.}}
     {{- end }}
+    {{- if and .Values.webhooks.enabled .Values.webhooks.proxysettings.enabled }}
+    - --webhooks=proxysettings
+    {{- end }}
+    {{- if and .Values.webhooks.enabled .Values.webhooks.labeler.enabled }}
+    - --webhooks=labeler
+    {{- end }}
+    {{- if and .Values.webhooks.enabled .Values.webhooks.watchdog.enabled }}
+    - --webhooks=watchdog
+    {{- range .Values.webhooks.watchdog.trustedUsernames }}
+    - --watchdog-trusted-username={{.}}
+    {{- end }}
+    {{- range .Values.webhooks.watchdog.adminGroups }}
+    - --watchdog-admin-group={{.}}
+    {{- end }}
+    {{- end }}
     {{- with .Values.options.extraArgs }}
     {{- toYaml . | nindent 4 }}
     {{- end }}
@@ -0,0 +1,207 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package audit
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	auditv1 "k8s.io/apiserver/pkg/apis/audit/v1"
+	apirequest "k8s.io/apiserver/pkg/endpoints/request"
+)
+
+const (
+	annotationPrefix = "proxy.projectcapsule.dev/"
+
+	// TenantsAnnotation lists the Tenants resolved for the user.
+	TenantsAnnotation = annotationPrefix + "tenants"
+	// ModuleAnnotation is the path of the module which handled the request.
+	ModuleAnnotation = annotationPrefix + "module"
+	// LabelSelectorAnnotation is the label selector injected by the proxy.
+	LabelSelectorAnnotation = annotationPrefix + "label-selector"
+	// ForwardingAnnotation tells whether the request was forwarded impersonating
+	// the user or with the proxy ServiceAccount.
+	ForwardingAnnotation = annotationPrefix + "forwarding"
+)
+
+//nolint:gochecknoglobals
+var requestInfoFactory = &apirequest.RequestInfoFactory{
+	APIPrefixes:          sets.NewString("api", "apis"),
+	GrouplessAPIPrefixes: sets.NewString("api"),
+}
+
+// Sink receives the audit events, one per proxied request.
+type Sink interface {
+	Write(ctx context.Context, event *auditv1.Event) error
+}
+
+// Auditor emits an audit.k8s.io/v1 Event for every request, recording the
+// real user along with the decisions taken by the proxy.
+type Auditor struct {
+	sink Sink
+	log  logr.Logger
+	now  func() time.Time
+}
+
+// NewAuditor returns an Auditor writing to sink, auditing is disabled with a nil sink.
+func NewAuditor(sink Sink, log logr.Logger) *Auditor {
+	return &Auditor{
+		sink: sink,
+		log:  log,
+		now:  time.Now,
+	}
+}
+
+// Middleware stores a Record in the request context, unless one is stored
+// already, and emits the matching event once the response has been written.
+func (a *Auditor) Middleware(next http.Handler) http.Handler {
+	if a == nil || a.sink == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		received := a.now()
+
+		ctx, record := request.Context(), RecordFrom(request.Context())
+		if record == nil {
+			ctx, record = WithRecord(ctx)
+		}
+
+		rw := &responseWriter{ResponseWriter: writer, statusCode: http.StatusOK}
+
+		next.ServeHTTP(rw, request.WithContext(ctx))
+
+		event := a.event(request, record, rw.statusCode, received)
+		if err := a.sink.Write(ctx, event); err != nil {
+			a.log.Error(err, "cannot write audit event", "auditID", event.AuditID)
+		}
+	})
+}
+
+func (a *Auditor) event(request *http.Request, record *Record, statusCode int, received time.Time) *auditv1.Event {
+	record.mu.Lock()
+	defer record.mu.Unlock()
+
+	auditID := types.UID(request.Header.Get(auditv1.HeaderAuditID))
+	if len(auditID) == 0 {
+		auditID = uuid.NewUUID()
+	}
+
+	event := &auditv1.Event{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: auditv1.SchemeGroupVersion.String(),
+			Kind:       "Event",
+		},
+		Level:      auditv1.LevelMetadata,
+		AuditID:    auditID,
+		Stage:      auditv1.StageResponseComplete,
+		RequestURI: request.RequestURI,
+		Verb:       strings.ToLower(request.Method),
+		User: authenticationv1.UserInfo{
+			Username: record.username,
+			Groups:   record.groups,
+		},
+		UserAgent: request.UserAgent(),
+		ResponseStatus: &metav1.Status{
+			Code: int32(statusCode), //nolint:gosec
+		},
+		RequestReceivedTimestamp: metav1.NewMicroTime(received),
+		StageTimestamp:           metav1.NewMicroTime(a.now()),
+		Annotations:              map[string]string{},
+	}
+
+	for _, ip := range utilnet.SourceIPs(request) {
+		event.SourceIPs = append(event.SourceIPs, ip.String())
+	}
+
+	if info, err := requestInfoFactory.NewRequestInfo(request); err == nil {
+		event.Verb = info.Verb
+
+		if info.IsResourceRequest {
+			event.ObjectRef = &auditv1.ObjectReference{
+				Resource:    info.Resource,
+				Namespace:   info.Namespace,
+				Name:        info.Name,
+				APIGroup:    info.APIGroup,
+				APIVersion:  info.APIVersion,
+				Subresource: info.Subresource,
+			}
+		}
+	}
+
+	if len(record.tenants) > 0 {
+		event.Annotations[TenantsAnnotation] = strings.Join(record.tenants, ",")
+	}
+
+	if len(record.module) > 0 {
+		event.Annotations[ModuleAnnotation] = record.module
+	}
+
+	if len(record.forwarding) > 0 {
+		event.Annotations[ForwardingAnnotation] = string(record.forwarding)
+	}
+
+	if len(record.selector) > 0 {
+		event.Annotations[LabelSelectorAnnotation] = record.selector
+	}
+
+	return event
+}
+
+// responseWriter records the status code, it keeps supporting the streaming
+// (watch) and upgraded (exec, port-forward) connections served by the proxy.
+type responseWriter struct {
+	http.ResponseWriter
+
+	statusCode  int
+	wroteHeader bool
+}
+
+func (r *responseWriter) WriteHeader(statusCode int) {
+	if !r.wroteHeader {
+		r.statusCode, r.wroteHeader = statusCode, true
+	}
+
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (r *responseWriter) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *responseWriter) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (r *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("writer is not http.Hijacker")
+	}
+
+	// Upgraded connections are reported with the protocol switch status.
+	r.statusCode, r.wroteHeader = http.StatusSwitchingProtocols, true
+
+	return hijacker.Hijack()
+}
+
+func (r *responseWriter) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,163 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package audit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/go-logr/logr"
+	auditv1 "k8s.io/apiserver/pkg/apis/audit/v1"
+)
+
+type recordingSink struct {
+	mu     sync.Mutex
+	events []*auditv1.Event
+}
+
+func (r *recordingSink) Write(_ context.Context, event *auditv1.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.events = append(r.events, event)
+
+	return nil
+}
+
+func TestAuditorMiddleware(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name            string
+		method          string
+		target          string
+		handler         http.HandlerFunc
+		wantVerb        string
+		wantCode        int32
+		wantResource    string
+		wantNamespace   string
+		wantAnnotations map[string]string
+	}{
+		{
+			name:   "filtered list forwarded with the ServiceAccount",
+			method: http.MethodGet,
+			target: "/api/v1/pods?limit=500",
+			handler: func(_ http.ResponseWriter, request *http.Request) {
+				record := RecordFrom(request.Context())
+				record.SetUser("alice", []string{"developers"})
+				record.SetTenants([]string{"solar", "wind"})
+				record.SetModule("/api/v1/pods")
+				record.SetForwarding(ForwardingServiceAccount, "capsule.clastix.io/tenant in (solar,wind)")
+			},
+			wantVerb:     "list",
+			wantCode:     http.StatusOK,
+			wantResource: "pods",
+			wantAnnotations: map[string]string{
+				TenantsAnnotation:       "solar,wind",
+				ModuleAnnotation:        "/api/v1/pods",
+				ForwardingAnnotation:    string(ForwardingServiceAccount),
+				LabelSelectorAnnotation: "capsule.clastix.io/tenant in (solar,wind)",
+			},
+		},
+		{
+			name:   "impersonated request",
+			method: http.MethodDelete,
+			target: "/api/v1/namespaces/solar-dev/pods/nginx",
+			handler: func(writer http.ResponseWriter, request *http.Request) {
+				record := RecordFrom(request.Context())
+				record.SetUser("alice", []string{"developers"})
+				record.SetForwarding(ForwardingImpersonation, "")
+
+				writer.WriteHeader(http.StatusNotFound)
+				writer.WriteHeader(http.StatusInternalServerError)
+			},
+			wantVerb:      "delete",
+			wantCode:      http.StatusNotFound,
+			wantResource:  "pods",
+			wantNamespace: "solar-dev",
+			wantAnnotations: map[string]string{
+				ForwardingAnnotation: string(ForwardingImpersonation),
+			},
+		},
+		{
+			name:            "non resource request",
+			method:          http.MethodGet,
+			target:          "/version",
+			handler:         func(http.ResponseWriter, *http.Request) {},
+			wantVerb:        "get",
+			wantCode:        http.StatusOK,
+			wantAnnotations: map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			sink := &recordingSink{}
+
+			request := httptest.NewRequest(tt.method, tt.target, nil)
+			request.Header.Set(auditv1.HeaderAuditID, "audit-id")
+
+			NewAuditor(sink, logr.Discard()).Middleware(tt.handler).ServeHTTP(httptest.NewRecorder(), request)
+
+			if len(sink.events) != 1 {
+				t.Fatalf("expected one event, got %d", len(sink.events))
+			}
+
+			event := sink.events[0]
+
+			if event.Kind != "Event" || event.APIVersion != "audit.k8s.io/v1" {
+				t.Fatalf("unexpected type %s/%s", event.APIVersion, event.Kind)
+			}
+
+			if event.AuditID != "audit-id" || event.Stage != auditv1.StageResponseComplete || event.RequestURI != tt.target {
+				t.Fatalf("unexpected event %+v", event)
+			}
+
+			if event.Verb != tt.wantVerb {
+				t.Fatalf("verb=%q, want %q", event.Verb, tt.wantVerb)
+			}
+
+			if event.ResponseStatus.Code != tt.wantCode {
+				t.Fatalf("code=%d, want %d", event.ResponseStatus.Code, tt.wantCode)
+			}
+
+			if len(tt.wantResource) > 0 && (event.ObjectRef == nil || event.ObjectRef.Resource != tt.wantResource || event.ObjectRef.Namespace != tt.wantNamespace) {
+				t.Fatalf("objectRef=%+v, want %s in %q", event.ObjectRef, tt.wantResource, tt.wantNamespace)
+			}
+
+			if len(event.Annotations) != len(tt.wantAnnotations) {
+				t.Fatalf("annotations=%v, want %v", event.Annotations, tt.wantAnnotations)
+			}
+
+			for k, v := range tt.wantAnnotations {
+				if event.Annotations[k] != v {
+					t.Fatalf("annotation %s=%q, want %q", k, event.Annotations[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestAuditorDisabled(t *testing.T) {
+	t.Parallel()
+
+	var record *Record
+
+	handler := http.HandlerFunc(func(_ http.ResponseWriter, request *http.Request) {
+		record = RecordFrom(request.Context())
+		// A nil Record must be usable by the handlers.
+		record.SetUser("alice", nil)
+	})
+
+	NewAuditor(nil, logr.Discard()).Middleware(handler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api", nil))
+
+	if record != nil {
+		t.Fatal("expected no audit record without a sink")
+	}
+}
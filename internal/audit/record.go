@@ -0,0 +1,159 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package audit
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// Forwarding describes the identity used to forward a request to the API server.
+type Forwarding string
+
+const (
+	// ForwardingImpersonation marks requests forwarded impersonating the user.
+	ForwardingImpersonation Forwarding = "impersonation"
+	// ForwardingServiceAccount marks requests forwarded with the proxy
+	// ServiceAccount along with an injected label selector: the API server
+	// audit log only records the proxy identity for them.
+	ForwardingServiceAccount Forwarding = "serviceaccount"
+)
+
+// Record collects the proxy decisions taken while handling a request. It is
+// stored in the request context by the audit or the metrics middleware, the
+// handlers fill it in and the middlewares report it once the response is
+// written.
+type Record struct {
+	mu sync.Mutex
+
+	username   string
+	groups     []string
+	authType   string
+	tenants    []string
+	module     string
+	selector   string
+	forwarding Forwarding
+}
+
+type recordContextKey struct{}
+
+// WithRecord returns a copy of ctx carrying a new Record.
+func WithRecord(ctx context.Context) (context.Context, *Record) {
+	record := &Record{}
+
+	return context.WithValue(ctx, recordContextKey{}, record), record
+}
+
+// RecordFrom returns the Record of the request context, nil when neither
+// auditing nor metrics are enabled. All the Record methods are safe to call
+// on a nil Record.
+func RecordFrom(ctx context.Context) *Record {
+	record, _ := ctx.Value(recordContextKey{}).(*Record)
+
+	return record
+}
+
+func (r *Record) SetUser(username string, groups []string) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.username, r.groups = username, slices.Clone(groups)
+}
+
+func (r *Record) SetTenants(tenants []string) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.tenants = slices.Clone(tenants)
+}
+
+// SetModule records the path of the module which handled the request.
+func (r *Record) SetModule(path string) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.module = path
+}
+
+// SetForwarding records how the request is forwarded, along with the label
+// selector injected when forwarded with the proxy ServiceAccount.
+func (r *Record) SetForwarding(forwarding Forwarding, selector string) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.forwarding, r.selector = forwarding, selector
+}
+
+// SetAuthType records the authentication method which resolved the user.
+func (r *Record) SetAuthType(authType string) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.authType = authType
+}
+
+func (r *Record) AuthType() string {
+	if r == nil {
+		return ""
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.authType
+}
+
+func (r *Record) Tenants() []string {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return slices.Clone(r.tenants)
+}
+
+func (r *Record) Module() string {
+	if r == nil {
+		return ""
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.module
+}
+
+func (r *Record) Forwarding() Forwarding {
+	if r == nil {
+		return ""
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.forwarding
+}
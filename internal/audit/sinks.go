@@ -0,0 +1,209 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	auditv1 "k8s.io/apiserver/pkg/apis/audit/v1"
+)
+
+const (
+	// StdoutPath selects the standard output as audit log file, as the API
+	// server --audit-log-path flag does.
+	StdoutPath = "-"
+
+	webhookQueueSize    = 1024
+	webhookMaxBatchSize = 100
+	webhookTimeout      = 10 * time.Second
+)
+
+// ErrQueueFull is returned when the webhook cannot keep up with the events.
+var ErrQueueFull = errors.New("audit webhook queue is full")
+
+// writerSink writes each event as a JSON line.
+type writerSink struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+func NewWriterSink(writer io.Writer) Sink {
+	return &writerSink{encoder: json.NewEncoder(writer)}
+}
+
+// NewFileSink appends the events to the file at path, StdoutPath writes them
+// to the standard output.
+func NewFileSink(path string) (Sink, error) {
+	if path == StdoutPath {
+		return NewWriterSink(os.Stdout), nil
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open audit log file: %w", err)
+	}
+
+	return NewWriterSink(file), nil
+}
+
+func (w *writerSink) Write(_ context.Context, event *auditv1.Event) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.encoder.Encode(event)
+}
+
+// WebhookSink posts the events as an audit.k8s.io/v1 EventList to a remote
+// endpoint, the same payload the API server sends to its audit webhook.
+// Events are queued and sent in batches by Start, which must be running.
+type WebhookSink struct {
+	url    string
+	client *http.Client
+	log    logr.Logger
+	queue  chan *auditv1.Event
+}
+
+func NewWebhookSink(url string, log logr.Logger) *WebhookSink {
+	return &WebhookSink{
+		url:    url,
+		client: &http.Client{Timeout: webhookTimeout},
+		log:    log,
+		queue:  make(chan *auditv1.Event, webhookQueueSize),
+	}
+}
+
+// Write queues the event, it never blocks the proxied request.
+func (w *WebhookSink) Write(_ context.Context, event *auditv1.Event) error {
+	select {
+	case w.queue <- event:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Start sends the queued events until ctx is done, the events still queued
+// are flushed before returning.
+func (w *WebhookSink) Start(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			for len(w.queue) > 0 {
+				w.send(context.Background(), w.batch(<-w.queue))
+			}
+
+			return nil
+		case event := <-w.queue:
+			w.send(ctx, w.batch(event))
+		}
+	}
+}
+
+// NeedLeaderElection sends the events of every replica.
+func (w *WebhookSink) NeedLeaderElection() bool {
+	return false
+}
+
+func (w *WebhookSink) batch(first *auditv1.Event) []auditv1.Event {
+	events := []auditv1.Event{*first}
+
+	for len(events) < webhookMaxBatchSize {
+		select {
+		case event := <-w.queue:
+			events = append(events, *event)
+		default:
+			return events
+		}
+	}
+
+	return events
+}
+
+func (w *WebhookSink) send(ctx context.Context, events []auditv1.Event) {
+	if err := w.post(ctx, events); err != nil {
+		w.log.Error(err, "cannot send audit events", "events", len(events))
+	}
+}
+
+func (w *WebhookSink) post(ctx context.Context, events []auditv1.Event) error {
+	body, err := json.Marshal(&auditv1.EventList{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: auditv1.SchemeGroupVersion.String(),
+			Kind:       "EventList",
+		},
+		Items: events,
+	})
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := w.client.Do(request)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_, _ = io.Copy(io.Discard, response.Body)
+		_ = response.Body.Close()
+	}()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("audit webhook responded with status %d", response.StatusCode)
+	}
+
+	return nil
+}
+
+// multiSink writes the events to several sinks.
+type multiSink []Sink
+
+// NewMultiSink returns a Sink writing to all the non-nil sinks, nil when there is none.
+func NewMultiSink(sinks ...Sink) Sink {
+	var multi multiSink
+
+	for _, sink := range sinks {
+		if sink != nil {
+			multi = append(multi, sink)
+		}
+	}
+
+	switch len(multi) {
+	case 0:
+		return nil
+	case 1:
+		return multi[0]
+	default:
+		return multi
+	}
+}
+
+func (m multiSink) Write(ctx context.Context, event *auditv1.Event) error {
+	var errs []error
+
+	for _, sink := range m {
+		if err := sink.Write(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,117 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/types"
+	auditv1 "k8s.io/apiserver/pkg/apis/audit/v1"
+)
+
+func TestFileSink(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	sink, err := NewFileSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"first", "second"} {
+		if err = sink.Write(context.Background(), &auditv1.Event{AuditID: types.UID(id)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := bytes.Split(bytes.TrimSpace(content), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("expected one line per event, got %q", content)
+	}
+
+	var event auditv1.Event
+	if err = json.Unmarshal(lines[1], &event); err != nil {
+		t.Fatal(err)
+	}
+
+	if event.AuditID != "second" {
+		t.Fatalf("auditID=%q, want second", event.AuditID)
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	t.Parallel()
+
+	received := make(chan auditv1.EventList, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		var list auditv1.EventList
+		if err := json.NewDecoder(request.Body).Decode(&list); err != nil {
+			writer.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		received <- list
+	}))
+	defer server.Close()
+
+	sink := NewWebhookSink(server.URL, logr.Discard())
+
+	for _, id := range []string{"first", "second", "third"} {
+		if err := sink.Write(context.Background(), &auditv1.Event{AuditID: types.UID(id)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		_ = sink.Start(ctx)
+	}()
+
+	list := <-received
+
+	if list.Kind != "EventList" || list.APIVersion != "audit.k8s.io/v1" {
+		t.Fatalf("unexpected type %s/%s", list.APIVersion, list.Kind)
+	}
+
+	// The events queued before the sink started are sent in a single batch.
+	if len(list.Items) != 3 || list.Items[0].AuditID != "first" || list.Items[2].AuditID != "third" {
+		t.Fatalf("unexpected events %+v", list.Items)
+	}
+}
+
+func TestMultiSink(t *testing.T) {
+	t.Parallel()
+
+	if NewMultiSink(nil, nil) != nil {
+		t.Fatal("expected a nil sink without any sink")
+	}
+
+	first, second := &recordingSink{}, &recordingSink{}
+
+	if err := NewMultiSink(first, nil, second).Write(context.Background(), &auditv1.Event{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(first.events) != 1 || len(second.events) != 1 {
+		t.Fatalf("expected the event in both sinks, got %d and %d", len(first.events), len(second.events))
+	}
+}
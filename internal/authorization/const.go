@@ -1,6 +1,27 @@
 package authorization
 
+import "strings"
+
 var Paths = []string{
 	"/apis/authorization.k8s.io/v1/selfsubjectaccessreviews",
 	"/apis/authorization.k8s.io/v1/selfsubjectrulesreviews",
 }
+
+// SubjectAccessReviewPath is the endpoint of the reviews created on behalf of
+// a user, LocalSubjectAccessReviews being created in a namespace.
+const SubjectAccessReviewPath = "/apis/authorization.k8s.io/v1/subjectaccessreviews"
+
+// IsSubjectReviewPath reports whether the path creates a SubjectAccessReview
+// or a LocalSubjectAccessReview.
+func IsSubjectReviewPath(path string) bool {
+	if path == SubjectAccessReviewPath {
+		return true
+	}
+
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+
+	return len(parts) == 6 &&
+		parts[0] == "apis" && parts[1] == "authorization.k8s.io" && parts[2] == "v1" &&
+		parts[3] == "namespaces" && len(parts[4]) > 0 &&
+		parts[5] == "localsubjectaccessreviews"
+}
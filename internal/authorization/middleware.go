@@ -38,75 +38,33 @@ func isCrossNamespaceListVerb(verb string) bool {
 }
 
 // MutateAuthorization augments the API server's answer to self review requests
-// (SelfSubjectAccessReview / SelfSubjectRulesReview) with the capabilities
-// capsule-proxy adds on top of native RBAC, so that clients such as
-// `kubectl auth can-i` reflect what actually works through the proxy.
+// (SelfSubjectAccessReview / SelfSubjectRulesReview), and to the access reviews
+// created on behalf of a user (SubjectAccessReview / LocalSubjectAccessReview),
+// with the capabilities capsule-proxy adds on top of native RBAC, so that
+// clients such as `kubectl auth can-i` reflect what actually works through the
+// proxy.
 func MutateAuthorization(proxyClusterScoped bool, proxyTenants []*tenant.ProxyTenant, namespacedResources sets.Set[string], obj *runtime.Object, gvk schema.GroupVersionKind) error {
 	switch gvk.Kind {
 	case "SelfSubjectAccessReview":
 		//nolint:forcetypeassert
 		accessReview := (*obj).(*authorizationv1.SelfSubjectAccessReview)
 
-		attributes := accessReview.Spec.ResourceAttributes
-		if attributes == nil {
-			return nil
-		}
-
-		// capsule-proxy always lets tenant owners list their own namespaces.
-		if attributes.Resource == types.Namespaces && strings.EqualFold(attributes.Verb, listVerb) {
-			grantAccess(accessReview)
-
-			return nil
-		}
-
-		// capsule-proxy serves cross-namespace (`-A`) list/watch of any proxied
-		// namespaced resource for tenant owners, transparently scoping the
-		// result to the tenant namespaces. The native API server denies such a
-		// cluster-scoped request, so advertise the capability here to reflect
-		// what actually works through the proxy (e.g. `kubectl get pods -A`).
-		if len(proxyTenants) > 0 &&
-			attributes.Namespace == "" &&
-			isCrossNamespaceListVerb(attributes.Verb) &&
-			namespacedResources.Has(NamespacedResourceKey(attributes.Group, attributes.Resource)) {
-			grantAccess(accessReview)
-
-			return nil
-		}
-
-		if !proxyClusterScoped {
-			return nil
-		}
-
-		accessReviewGvk := schema.GroupVersionKind{
-			Group:   attributes.Group,
-			Version: attributes.Version,
-			Kind:    attributes.Resource,
-		}
-
-		operation, supported := clusterResourceOperation(attributes.Verb)
-		if !supported {
-			return nil
-		}
-
-		requirements := clusterscoped.GetClusterScopeRequirements(&accessReviewGvk, operation, proxyTenants)
-		if len(requirements) > 0 {
-			grantAccess(accessReview)
-		}
+		mutateAccessReview(proxyClusterScoped, proxyTenants, namespacedResources, accessReview.Spec.ResourceAttributes, &accessReview.Status)
+	case "SubjectAccessReview":
+		//nolint:forcetypeassert
+		accessReview := (*obj).(*authorizationv1.SubjectAccessReview)
+
+		mutateAccessReview(proxyClusterScoped, proxyTenants, namespacedResources, accessReview.Spec.ResourceAttributes, &accessReview.Status)
+	case "LocalSubjectAccessReview":
+		//nolint:forcetypeassert
+		accessReview := (*obj).(*authorizationv1.LocalSubjectAccessReview)
+
+		mutateAccessReview(proxyClusterScoped, proxyTenants, namespacedResources, accessReview.Spec.ResourceAttributes, &accessReview.Status)
 	case "SelfSubjectRulesReview":
 		//nolint:forcetypeassert
 		rules := (*obj).(*authorizationv1.SelfSubjectRulesReview)
 
-		injectedRules := []authorizationv1.ResourceRule{
-			{
-				APIGroups: []string{""},
-				Resources: []string{types.Namespaces},
-				Verbs:     []string{listVerb},
-			},
-		}
-
-		if proxyClusterScoped {
-			injectedRules = append(injectedRules, getAllResourceRules(proxyTenants)...)
-		}
+		injectedRules := synthesizeResourceRules(proxyClusterScoped, proxyTenants, namespacedResources)
 
 		// The rules resolved by the apiserver are kept and capsule-proxy only appends,
 		// so passed-through and namespaced permissions remain visible to the client.
@@ -118,34 +76,80 @@ func MutateAuthorization(proxyClusterScoped bool, proxyTenants []*tenant.ProxyTe
 	return nil
 }
 
-// grantAccess marks a SelfSubjectAccessReview as allowed by capsule-proxy,
-// clearing any denial coming from the API server.
-func grantAccess(accessReview *authorizationv1.SelfSubjectAccessReview) {
-	accessReview.Status.Allowed = true
-	accessReview.Status.Denied = false
-	accessReview.Status.Reason = "granted by capsule-proxy"
+// mutateAccessReview grants the access the review asks for when
+// capsule-proxy allows it to the reviewed user.
+func mutateAccessReview(proxyClusterScoped bool, proxyTenants []*tenant.ProxyTenant, namespacedResources sets.Set[string], attributes *authorizationv1.ResourceAttributes, status *authorizationv1.SubjectAccessReviewStatus) {
+	if GrantsAccess(proxyClusterScoped, proxyTenants, namespacedResources, attributes) {
+		grantAccess(status)
+	}
 }
 
-func getAllResourceRules(proxyTenants []*tenant.ProxyTenant) []authorizationv1.ResourceRule {
-	resourceRules := []authorizationv1.ResourceRule{}
+// GrantsAccess reports whether capsule-proxy allows the access to the user on
+// top of native RBAC.
+func GrantsAccess(proxyClusterScoped bool, proxyTenants []*tenant.ProxyTenant, namespacedResources sets.Set[string], attributes *authorizationv1.ResourceAttributes) bool {
+	if attributes == nil {
+		return false
+	}
 
-	for _, pt := range proxyTenants {
-		for _, cr := range pt.ClusterResources {
-			verbs := []string{}
+	// capsule-proxy always lets tenant owners list their own namespaces.
+	if attributes.Resource == types.Namespaces && strings.EqualFold(attributes.Verb, listVerb) {
+		return true
+	}
 
-			for _, op := range cr.EffectiveOperations() {
-				verbs = append(verbs, strings.ToLower(op.String()))
-			}
+	// capsule-proxy serves cross-namespace (`-A`) list/watch of any proxied
+	// namespaced resource for tenant owners, transparently scoping the
+	// result to the tenant namespaces. The native API server denies such a
+	// cluster-scoped request, so advertise the capability here to reflect
+	// what actually works through the proxy (e.g. `kubectl get pods -A`).
+	if len(proxyTenants) > 0 &&
+		attributes.Namespace == "" &&
+		isCrossNamespaceListVerb(attributes.Verb) &&
+		namespacedResources.Has(NamespacedResourceKey(attributes.Group, attributes.Resource)) {
+		return true
+	}
+
+	// The legacy proxy operations are only set without cluster-scoped
+	// proxying, their resources being served by the legacy modules.
+	if grantsLegacyAccess(proxyTenants, attributes) {
+		return true
+	}
 
-			resourceRules = append(resourceRules, authorizationv1.ResourceRule{
-				APIGroups: cr.APIGroups,
-				Resources: cr.Resources,
-				Verbs:     verbs,
-			})
-		}
+	if !proxyClusterScoped {
+		return false
 	}
 
-	return resourceRules
+	accessReviewGvk := schema.GroupVersionKind{
+		Group:   attributes.Group,
+		Version: attributes.Version,
+		Kind:    attributes.Resource,
+	}
+
+	operation, supported := clusterResourceOperation(attributes.Verb)
+	if !supported {
+		return false
+	}
+
+	return len(clusterscoped.GetClusterScopeRequirements(&accessReviewGvk, operation, proxyTenants)) > 0
+}
+
+// grantAccess marks an access review as allowed by capsule-proxy, clearing
+// any denial coming from the API server.
+func grantAccess(status *authorizationv1.SubjectAccessReviewStatus) {
+	status.Allowed = true
+	status.Denied = false
+	status.Reason = "granted by capsule-proxy"
+}
+
+// ReviewedSubject returns the user an access review is created on behalf of.
+func ReviewedSubject(obj runtime.Object) (username string, groups []string, ok bool) {
+	switch review := obj.(type) {
+	case *authorizationv1.SubjectAccessReview:
+		return review.Spec.User, review.Spec.Groups, true
+	case *authorizationv1.LocalSubjectAccessReview:
+		return review.Spec.User, review.Spec.Groups, true
+	default:
+		return "", nil, false
+	}
 }
 
 func clusterResourceOperation(verb string) (v1beta1.ClusterResourceOperation, bool) {
@@ -154,6 +158,12 @@ func clusterResourceOperation(verb string) (v1beta1.ClusterResourceOperation, bo
 		return v1beta1.ClusterResourceOperationList, true
 	case strings.EqualFold(verb, "get"):
 		return v1beta1.ClusterResourceOperationGet, true
+	case strings.EqualFold(verb, "update"):
+		return v1beta1.ClusterResourceOperationUpdate, true
+	case strings.EqualFold(verb, "patch"):
+		return v1beta1.ClusterResourceOperationPatch, true
+	case strings.EqualFold(verb, "delete"):
+		return v1beta1.ClusterResourceOperationDelete, true
 	default:
 		return "", false
 	}
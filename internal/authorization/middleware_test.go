@@ -4,8 +4,10 @@
 package authorization
 
 import (
+	"reflect"
 	"testing"
 
+	capsulerbac "github.com/projectcapsule/capsule/pkg/api/rbac"
 	authorizationv1 "k8s.io/api/authorization/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -137,7 +139,11 @@ func TestMutateAuthorization_SelfSubjectAccessReviewClusterResourceOperations(t
 		{name: "explicit get", operations: []v1beta1.ClusterResourceOperation{v1beta1.ClusterResourceOperationGet}, verb: "get", want: true},
 		{name: "legacy list includes get", operations: []v1beta1.ClusterResourceOperation{v1beta1.ClusterResourceOperationList}, verb: "get", want: true},
 		{name: "list excluded by get-only rule", operations: []v1beta1.ClusterResourceOperation{v1beta1.ClusterResourceOperationGet}, verb: "list"},
-		{name: "mutation verbs are never granted", verb: "update"},
+		{name: "mutation verbs are not granted by default", verb: "update"},
+		{name: "explicit update", operations: []v1beta1.ClusterResourceOperation{v1beta1.ClusterResourceOperationUpdate}, verb: "update", want: true},
+		{name: "explicit delete", operations: []v1beta1.ClusterResourceOperation{v1beta1.ClusterResourceOperationDelete}, verb: "delete", want: true},
+		{name: "patch excluded by update-only rule", operations: []v1beta1.ClusterResourceOperation{v1beta1.ClusterResourceOperationUpdate}, verb: "patch"},
+		{name: "create is never granted", operations: []v1beta1.ClusterResourceOperation{v1beta1.ClusterResourceOperationUpdate}, verb: "create"},
 	}
 
 	for _, tt := range tests {
@@ -339,3 +345,189 @@ func TestMutateAuthorization_SelfSubjectAccessReviewNonProxiedResource(t *testin
 		t.Errorf("expected non-proxied resources to be left untouched, got %+v", review.Status)
 	}
 }
+
+func TestIsSubjectReviewPath(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{path: "/apis/authorization.k8s.io/v1/subjectaccessreviews", want: true},
+		{path: "/apis/authorization.k8s.io/v1/namespaces/solar-dev/localsubjectaccessreviews", want: true},
+		{path: "/apis/authorization.k8s.io/v1/namespaces//localsubjectaccessreviews"},
+		{path: "/apis/authorization.k8s.io/v1/selfsubjectaccessreviews"},
+		{path: "/apis/authorization.k8s.io/v1beta1/subjectaccessreviews"},
+		{path: "/api/v1/namespaces/solar-dev/pods"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			t.Parallel()
+
+			if got := IsSubjectReviewPath(tt.path); got != tt.want {
+				t.Fatalf("IsSubjectReviewPath(%q)=%t, want %t", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+//nolint:funlen
+func TestMutateAuthorization_SubjectAccessReviews(t *testing.T) {
+	t.Parallel()
+
+	proxyTenants := []*tenant.ProxyTenant{{ClusterResources: []v1beta1.ClusterResource{{
+		APIGroups: []string{"storage.k8s.io"},
+		Resources: []string{"storageclasses"},
+		Selector:  &metav1.LabelSelector{MatchLabels: map[string]string{"shared": "true"}},
+	}}}}
+	namespaced := sets.New[string](NamespacedResourceKey("", "pods"))
+
+	tests := []struct {
+		name   string
+		review runtime.Object
+		want   bool
+	}{
+		{
+			name: "cross-namespace list",
+			review: &authorizationv1.SubjectAccessReview{
+				Spec: authorizationv1.SubjectAccessReviewSpec{
+					User:               "alice",
+					ResourceAttributes: &authorizationv1.ResourceAttributes{Resource: "pods", Verb: "list"},
+				},
+			},
+			want: true,
+		},
+		{
+			name: "cluster resource",
+			review: &authorizationv1.SubjectAccessReview{
+				Spec: authorizationv1.SubjectAccessReviewSpec{
+					User:               "alice",
+					ResourceAttributes: &authorizationv1.ResourceAttributes{Group: "storage.k8s.io", Version: "v1", Resource: "storageclasses", Verb: "get"},
+				},
+			},
+			want: true,
+		},
+		{
+			name: "non resource attributes",
+			review: &authorizationv1.SubjectAccessReview{
+				Spec: authorizationv1.SubjectAccessReviewSpec{
+					User:                  "alice",
+					NonResourceAttributes: &authorizationv1.NonResourceAttributes{Path: "/healthz", Verb: "get"},
+				},
+			},
+		},
+		{
+			name: "namespaces list in a namespace",
+			review: &authorizationv1.LocalSubjectAccessReview{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "solar-dev"},
+				Spec: authorizationv1.SubjectAccessReviewSpec{
+					User:               "alice",
+					ResourceAttributes: &authorizationv1.ResourceAttributes{Namespace: "solar-dev", Resource: "namespaces", Verb: "list"},
+				},
+			},
+			want: true,
+		},
+		{
+			name: "namespaced list is answered by the API server",
+			review: &authorizationv1.LocalSubjectAccessReview{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "solar-dev"},
+				Spec: authorizationv1.SubjectAccessReviewSpec{
+					User:               "alice",
+					ResourceAttributes: &authorizationv1.ResourceAttributes{Namespace: "solar-dev", Resource: "pods", Verb: "list"},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			obj := tt.review
+			gvk := schema.GroupVersionKind{Kind: reflect.TypeOf(obj).Elem().Name()}
+
+			if username, _, ok := ReviewedSubject(obj); !ok || username != "alice" {
+				t.Fatalf("ReviewedSubject()=%q, %t", username, ok)
+			}
+
+			if err := MutateAuthorization(true, proxyTenants, namespaced, &obj, gvk); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var status authorizationv1.SubjectAccessReviewStatus
+
+			switch review := obj.(type) {
+			case *authorizationv1.SubjectAccessReview:
+				status = review.Status
+			case *authorizationv1.LocalSubjectAccessReview:
+				status = review.Status
+			}
+
+			if status.Allowed != tt.want {
+				t.Fatalf("allowed=%t, want %t", status.Allowed, tt.want)
+			}
+		})
+	}
+}
+
+func TestMutateAuthorization_AccessReviewsLegacyProxyOperations(t *testing.T) {
+	t.Parallel()
+
+	proxyTenants := []*tenant.ProxyTenant{{ProxySetting: map[capsulerbac.ProxyServiceKind]*tenant.Operations{
+		capsulerbac.NodesProxy: {List: true},
+	}}}
+
+	tests := []struct {
+		name   string
+		review runtime.Object
+		want   bool
+	}{
+		{
+			name: "self review of a listed kind",
+			review: &authorizationv1.SelfSubjectAccessReview{Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{Version: "v1", Resource: "nodes", Verb: "list"},
+			}},
+			want: true,
+		},
+		{
+			name: "review of a listed kind",
+			review: &authorizationv1.SubjectAccessReview{Spec: authorizationv1.SubjectAccessReviewSpec{
+				User:               "alice",
+				ResourceAttributes: &authorizationv1.ResourceAttributes{Version: "v1", Resource: "nodes", Verb: "get"},
+			}},
+			want: true,
+		},
+		{
+			name: "review of an operation not granted",
+			review: &authorizationv1.SubjectAccessReview{Spec: authorizationv1.SubjectAccessReviewSpec{
+				User:               "alice",
+				ResourceAttributes: &authorizationv1.ResourceAttributes{Version: "v1", Resource: "nodes", Verb: "delete"},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			obj := tt.review
+			if err := MutateAuthorization(false, proxyTenants, nil, &obj, schema.GroupVersionKind{Kind: reflect.TypeOf(obj).Elem().Name()}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var status authorizationv1.SubjectAccessReviewStatus
+
+			switch review := obj.(type) {
+			case *authorizationv1.SelfSubjectAccessReview:
+				status = review.Status
+			case *authorizationv1.SubjectAccessReview:
+				status = review.Status
+			}
+
+			if status.Allowed != tt.want {
+				t.Fatalf("allowed=%t, want %t", status.Allowed, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package authorization
+
+import (
+	"slices"
+	"strings"
+
+	capsulerbac "github.com/projectcapsule/capsule/pkg/api/rbac"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/projectcapsule/capsule-proxy/internal/tenant"
+	"github.com/projectcapsule/capsule-proxy/internal/types"
+)
+
+// legacyProxyResource is the resource served by a legacy ProxySetting kind.
+type legacyProxyResource struct {
+	group, resource string
+}
+
+//nolint:gochecknoglobals
+var legacyProxyResources = map[capsulerbac.ProxyServiceKind]legacyProxyResource{
+	capsulerbac.NodesProxy:             {group: "", resource: "nodes"},
+	capsulerbac.StorageClassesProxy:    {group: "storage.k8s.io", resource: "storageclasses"},
+	capsulerbac.IngressClassesProxy:    {group: "networking.k8s.io", resource: "ingressclasses"},
+	capsulerbac.PriorityClassesProxy:   {group: "scheduling.k8s.io", resource: "priorityclasses"},
+	capsulerbac.RuntimeClassesProxy:    {group: "node.k8s.io", resource: "runtimeclasses"},
+	capsulerbac.PersistentVolumesProxy: {group: "", resource: "persistentvolumes"},
+}
+
+// ruleSet collects ResourceRules, merging the verbs of the rules matching the
+// same API groups and resources.
+type ruleSet struct {
+	keys  []string
+	rules map[string]*authorizationv1.ResourceRule
+}
+
+func newRuleSet() *ruleSet {
+	return &ruleSet{rules: map[string]*authorizationv1.ResourceRule{}}
+}
+
+func (s *ruleSet) add(apiGroups, resources []string, verbs ...string) {
+	if len(resources) == 0 || len(verbs) == 0 {
+		return
+	}
+
+	if len(apiGroups) == 0 {
+		apiGroups = []string{""}
+	}
+
+	key := strings.Join(apiGroups, ",") + "/" + strings.Join(resources, ",")
+
+	rule, ok := s.rules[key]
+	if !ok {
+		rule = &authorizationv1.ResourceRule{
+			APIGroups: slices.Clone(apiGroups),
+			Resources: slices.Clone(resources),
+		}
+		s.rules[key] = rule
+		s.keys = append(s.keys, key)
+	}
+
+	for _, verb := range verbs {
+		if !slices.Contains(rule.Verbs, verb) {
+			rule.Verbs = append(rule.Verbs, verb)
+		}
+	}
+}
+
+func (s *ruleSet) list() []authorizationv1.ResourceRule {
+	rules := make([]authorizationv1.ResourceRule, 0, len(s.keys))
+	for _, key := range s.keys {
+		rules = append(rules, *s.rules[key])
+	}
+
+	return rules
+}
+
+// synthesizeResourceRules turns the capabilities capsule-proxy adds on top of
+// native RBAC into the ResourceRules of a SelfSubjectRulesReview, mirroring
+// the grants of the SelfSubjectAccessReview mutation.
+func synthesizeResourceRules(proxyClusterScoped bool, proxyTenants []*tenant.ProxyTenant, namespacedResources sets.Set[string]) []authorizationv1.ResourceRule {
+	rules := newRuleSet()
+
+	// capsule-proxy always lets tenant owners list their own namespaces.
+	rules.add([]string{""}, []string{types.Namespaces}, listVerb)
+
+	if len(proxyTenants) > 0 {
+		addCrossNamespaceRules(rules, namespacedResources)
+	}
+
+	for _, pt := range proxyTenants {
+		addLegacyProxySettingRules(rules, pt)
+	}
+
+	if proxyClusterScoped {
+		addClusterResourceRules(rules, proxyTenants)
+	}
+
+	return rules.list()
+}
+
+// addCrossNamespaceRules advertises the cross-namespace list and watch of the
+// proxied namespaced resources, one rule per API group.
+func addCrossNamespaceRules(rules *ruleSet, namespacedResources sets.Set[string]) {
+	byGroup := map[string][]string{}
+
+	for _, key := range sets.List(namespacedResources) {
+		group, resource, ok := strings.Cut(key, "/")
+		if !ok {
+			continue
+		}
+
+		byGroup[group] = append(byGroup[group], resource)
+	}
+
+	for _, group := range sets.List(sets.KeySet(byGroup)) {
+		rules.add([]string{group}, byGroup[group], listVerb, watchVerb)
+	}
+}
+
+// addLegacyProxySettingRules advertises the legacy proxy operations of the
+// Tenant owner.
+func addLegacyProxySettingRules(rules *ruleSet, pt *tenant.ProxyTenant) {
+	for _, kind := range sets.List(sets.KeySet(pt.ProxySetting)) {
+		proxied := legacyProxyResources[kind]
+		if len(proxied.resource) == 0 {
+			continue
+		}
+
+		rules.add([]string{proxied.group}, []string{proxied.resource}, legacyVerbs(pt.ProxySetting[kind])...)
+	}
+}
+
+// legacyVerbs returns the verbs enabled by legacy proxy operations: updating
+// and deleting are allowed only along with listing.
+func legacyVerbs(operations *tenant.Operations) []string {
+	if operations == nil || !operations.List {
+		return nil
+	}
+
+	verbs := []string{"get", listVerb, watchVerb}
+
+	if operations.Update {
+		verbs = append(verbs, "update", "patch")
+	}
+
+	if operations.Delete {
+		verbs = append(verbs, "delete")
+	}
+
+	return verbs
+}
+
+// addClusterResourceRules advertises the effective operations of every
+// ClusterResource granted to the user.
+func addClusterResourceRules(rules *ruleSet, proxyTenants []*tenant.ProxyTenant) {
+	for _, pt := range proxyTenants {
+		for _, cr := range pt.ClusterResources {
+			verbs := []string{}
+
+			for _, op := range cr.EffectiveOperations() {
+				verbs = append(verbs, strings.ToLower(op.String()))
+			}
+
+			rules.add(cr.APIGroups, cr.Resources, verbs...)
+		}
+	}
+}
+
+// grantsLegacyAccess reports whether the legacy proxy operations of a Tenant
+// owner enable the verb on the cluster resource.
+func grantsLegacyAccess(proxyTenants []*tenant.ProxyTenant, attributes *authorizationv1.ResourceAttributes) bool {
+	for _, pt := range proxyTenants {
+		for kind, operations := range pt.ProxySetting {
+			proxied := legacyProxyResources[kind]
+			if proxied.group != attributes.Group || proxied.resource != attributes.Resource {
+				continue
+			}
+
+			if slices.ContainsFunc(legacyVerbs(operations), func(verb string) bool { return strings.EqualFold(verb, attributes.Verb) }) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,270 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package authorization
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+
+	capsulerbac "github.com/projectcapsule/capsule/pkg/api/rbac"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/runtime/serializer/protobuf"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/projectcapsule/capsule-proxy/api/v1beta1"
+	"github.com/projectcapsule/capsule-proxy/internal/tenant"
+	"github.com/projectcapsule/capsule-proxy/internal/utils"
+)
+
+func ruleVerbs(rules []authorizationv1.ResourceRule, group, resource string) []string {
+	for _, r := range rules {
+		if len(r.APIGroups) == 1 && r.APIGroups[0] == group && sets.New(r.Resources...).Has(resource) {
+			return r.Verbs
+		}
+	}
+
+	return nil
+}
+
+//nolint:funlen
+func TestSynthesizeResourceRules(t *testing.T) {
+	t.Parallel()
+
+	namespaced := sets.New(
+		NamespacedResourceKey("", "pods"),
+		NamespacedResourceKey("", "secrets"),
+		NamespacedResourceKey("apps", "deployments"),
+	)
+	owner := &tenant.ProxyTenant{
+		ProxySetting: map[capsulerbac.ProxyServiceKind]*tenant.Operations{
+			capsulerbac.NodesProxy:          {List: true, Update: true},
+			capsulerbac.StorageClassesProxy: {List: true, Delete: true},
+			// Deleting without listing is not allowed by the proxy.
+			capsulerbac.PriorityClassesProxy: {Delete: true},
+		},
+		ClusterResources: []v1beta1.ClusterResource{
+			{
+				APIGroups:  []string{"rbac.authorization.k8s.io"},
+				Resources:  []string{"clusterroles"},
+				Operations: []v1beta1.ClusterResourceOperation{v1beta1.ClusterResourceOperationGet},
+			},
+		},
+	}
+	global := &tenant.ProxyTenant{
+		ClusterResources: []v1beta1.ClusterResource{
+			{
+				APIGroups:  []string{"rbac.authorization.k8s.io"},
+				Resources:  []string{"clusterroles"},
+				Operations: []v1beta1.ClusterResourceOperation{v1beta1.ClusterResourceOperationDelete},
+			},
+		},
+	}
+
+	testCases := []struct {
+		name               string
+		proxyClusterScoped bool
+		proxyTenants       []*tenant.ProxyTenant
+		want               map[schema.GroupResource][]string
+	}{
+		{
+			name: "not a tenant owner",
+			want: map[schema.GroupResource][]string{
+				{Resource: "namespaces"}: {"list"},
+				{Resource: "pods"}:       nil,
+			},
+		},
+		{
+			name:         "tenant owner",
+			proxyTenants: []*tenant.ProxyTenant{owner, global},
+			want: map[schema.GroupResource][]string{
+				{Resource: "namespaces"}:                                       {"list"},
+				{Resource: "pods"}:                                             {"list", "watch"},
+				{Resource: "secrets"}:                                          {"list", "watch"},
+				{Group: "apps", Resource: "deployments"}:                       {"list", "watch"},
+				{Resource: "nodes"}:                                            {"get", "list", "watch", "update", "patch"},
+				{Group: "storage.k8s.io", Resource: "storageclasses"}:          {"get", "list", "watch", "delete"},
+				{Group: "scheduling.k8s.io", Resource: "priorityclasses"}:      nil,
+				{Group: "rbac.authorization.k8s.io", Resource: "clusterroles"}: nil,
+			},
+		},
+		{
+			name:               "cluster scoped resources",
+			proxyClusterScoped: true,
+			proxyTenants:       []*tenant.ProxyTenant{owner, global},
+			want: map[schema.GroupResource][]string{
+				// The grants of the Tenant and of the GlobalProxySettings are merged.
+				{Group: "rbac.authorization.k8s.io", Resource: "clusterroles"}: {"get", "delete"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			rules := synthesizeResourceRules(tc.proxyClusterScoped, tc.proxyTenants, namespaced)
+
+			for gr, want := range tc.want {
+				if got := ruleVerbs(rules, gr.Group, gr.Resource); !reflect.DeepEqual(got, want) {
+					t.Errorf("%s: got verbs %v, want %v", gr, got, want)
+				}
+			}
+
+			for _, rule := range rules {
+				if len(rule.APIGroups) == 0 || len(rule.Resources) == 0 || len(rule.Verbs) == 0 {
+					t.Errorf("incomplete rule %+v", rule)
+				}
+			}
+		})
+	}
+}
+
+// TestSelfSubjectRulesReviewRoundTrip mutates the review the way the proxy
+// does: decoded from the API server answer, then encoded in the media type of
+// the client.
+func TestSelfSubjectRulesReviewRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	scheme := runtime.NewScheme()
+	if err := authorizationv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	protoEncoder := protobuf.NewSerializer(scheme, scheme)
+	decoder := serializer.NewCodecFactory(scheme).UniversalDeserializer()
+
+	proxyTenants := []*tenant.ProxyTenant{{
+		ProxySetting: map[capsulerbac.ProxyServiceKind]*tenant.Operations{
+			capsulerbac.NodesProxy: {List: true},
+		},
+		ClusterResources: []v1beta1.ClusterResource{{
+			APIGroups: []string{"storage.k8s.io"},
+			Resources: []string{"storageclasses"},
+		}},
+	}}
+	namespaced := sets.New(NamespacedResourceKey("", "pods"))
+
+	testCases := []struct {
+		name   string
+		encode func(runtime.Object) ([]byte, error)
+	}{
+		{
+			name: "protobuf",
+			encode: func(obj runtime.Object) ([]byte, error) {
+				return runtime.Encode(protoEncoder, obj)
+			},
+		},
+		{
+			name: "json",
+			encode: func(obj runtime.Object) ([]byte, error) {
+				return utils.JsonEncode(obj, scheme)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			upstream := &authorizationv1.SelfSubjectRulesReview{
+				Spec: authorizationv1.SelfSubjectRulesReviewSpec{Namespace: "solar-dev"},
+				Status: authorizationv1.SubjectRulesReviewStatus{
+					ResourceRules: []authorizationv1.ResourceRule{{
+						APIGroups: []string{"apps"},
+						Resources: []string{"deployments"},
+						Verbs:     []string{"get"},
+					}},
+					NonResourceRules: []authorizationv1.NonResourceRule{{Verbs: []string{"get"}, NonResourceURLs: []string{"/healthz"}}},
+				},
+			}
+			upstream.SetGroupVersionKind(authorizationv1.SchemeGroupVersion.WithKind("SelfSubjectRulesReview"))
+
+			body, err := tc.encode(upstream)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			obj, gvk, err := decoder.Decode(body, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err = MutateAuthorization(true, proxyTenants, namespaced, &obj, *gvk); err != nil {
+				t.Fatal(err)
+			}
+
+			if body, err = tc.encode(obj); err != nil {
+				t.Fatal(err)
+			}
+
+			decoded, _, err := decoder.Decode(body, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			//nolint:forcetypeassert
+			mutated, got := obj.(*authorizationv1.SelfSubjectRulesReview), decoded.(*authorizationv1.SelfSubjectRulesReview)
+			if !reflect.DeepEqual(got.Status, mutated.Status) || got.Spec != mutated.Spec {
+				t.Fatalf("round trip changed the review\ngot:  %+v\nwant: %+v", got, mutated)
+			}
+
+			rules := got.Status.ResourceRules
+			if !hasResourceRule(rules, "apps", "deployments", "get") ||
+				!hasResourceRule(rules, "", "pods", "watch") ||
+				!hasResourceRule(rules, "", "nodes", "list") ||
+				!hasResourceRule(rules, "storage.k8s.io", "storageclasses", "get") {
+				t.Errorf("unexpected rules after round trip %+v", rules)
+			}
+		})
+	}
+}
+
+func TestGrantsAccessLegacyProxyOperations(t *testing.T) {
+	t.Parallel()
+
+	proxyTenants := []*tenant.ProxyTenant{
+		{
+			ProxySetting: map[capsulerbac.ProxyServiceKind]*tenant.Operations{
+				capsulerbac.NodesProxy:           {List: true, Update: true},
+				capsulerbac.PriorityClassesProxy: {Delete: true},
+			},
+		},
+	}
+
+	tests := []struct {
+		name                  string
+		group, resource, verb string
+		expected              bool
+	}{
+		{name: "listed kind", group: "", resource: "nodes", verb: "list", expected: true},
+		{name: "watched kind", group: "", resource: "nodes", verb: "watch", expected: true},
+		{name: "updated kind", group: "", resource: "nodes", verb: "patch", expected: true},
+		{name: "operation not granted", group: "", resource: "nodes", verb: "delete"},
+		{name: "kind not listed", group: "scheduling.k8s.io", resource: "priorityclasses", verb: "delete"},
+		{name: "kind not granted", group: "storage.k8s.io", resource: "storageclasses", verb: "list"},
+		{name: "resource of another group", group: "metrics.k8s.io", resource: "nodes", verb: "list"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			attributes := &authorizationv1.ResourceAttributes{Group: tt.group, Resource: tt.resource, Verb: tt.verb}
+
+			if granted := GrantsAccess(false, proxyTenants, nil, attributes); granted != tt.expected {
+				t.Fatalf("expected %t, got %t", tt.expected, granted)
+			}
+
+			// The SelfSubjectRulesReview advertises the same verbs.
+			rules := synthesizeResourceRules(false, proxyTenants, nil)
+			if advertised := slices.Contains(ruleVerbs(rules, tt.group, tt.resource), tt.verb); advertised != tt.expected {
+				t.Fatalf("advertised %t, want %t", advertised, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// apiResourcesRequest is the single request every CustomResourceDefinition
+// and APIService event is mapped to: the bursts of events, as when an operator
+// installs its CRDs, collapse into a single refresh.
+//
+//nolint:gochecknoglobals
+var apiResourcesRequest = reconcile.Request{NamespacedName: types.NamespacedName{Name: "api-resources"}}
+
+// APIResources refreshes the routes of the proxy when the API resources served
+// by the cluster change: CustomResourceDefinitions and APIServices being
+// added, removed, or becoming available. A refresh failing, even for a single
+// group version, is retried with backoff.
+type APIResources struct {
+	Refresh func(ctx context.Context) error
+}
+
+func (a *APIResources) SetupWithManager(mgr ctrl.Manager) error {
+	// APIServices are watched by their metadata, their types not being part
+	// of the scheme.
+	apiService := &metav1.PartialObjectMetadata{}
+	apiService.SetGroupVersionKind(schema.GroupVersionKind{Group: "apiregistration.k8s.io", Version: "v1", Kind: "APIService"})
+
+	enqueue := handler.EnqueueRequestsFromMapFunc(func(context.Context, client.Object) []reconcile.Request {
+		return []reconcile.Request{apiResourcesRequest}
+	})
+
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("api-resources").
+		// Every replica serves requests, and refreshes its own routes.
+		WithOptions(controller.Options{NeedLeaderElection: ptr.To(false)}).
+		WatchesMetadata(&apiextensionsv1.CustomResourceDefinition{}, enqueue).
+		WatchesMetadata(apiService, enqueue).
+		Complete(a)
+}
+
+func (a *APIResources) Reconcile(ctx context.Context, _ reconcile.Request) (reconcile.Result, error) {
+	if err := a.Refresh(ctx); err != nil {
+		return reconcile.Result{}, err
+	}
+
+	return reconcile.Result{}, nil
+}
@@ -10,6 +10,7 @@ import (
 	capmeta "github.com/projectcapsule/capsule/pkg/api/meta"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/util/retry"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -19,11 +20,13 @@ import (
 	capsuleproxyv1beta1 "github.com/projectcapsule/capsule-proxy/api/v1beta1"
 )
 
-// GlobalProxySettingsReconciler reconciles GlobalProxySettings objects and keeps
-// status.observedGeneration in sync with metadata.generation.
+// GlobalProxySettingsReconciler reconciles GlobalProxySettings objects, keeps
+// status.observedGeneration in sync with metadata.generation and reports
+// whether the subjects and rules resolve as conditions.
 type GlobalProxySettingsReconciler struct {
-	Client client.Client
-	reader client.Reader
+	Client    client.Client
+	Discovery discovery.DiscoveryInterface
+	reader    client.Reader
 }
 
 func (r *GlobalProxySettingsReconciler) SetupWithManager(mgr ctrl.Manager) error {
@@ -35,7 +38,7 @@ func (r *GlobalProxySettingsReconciler) SetupWithManager(mgr ctrl.Manager) error
 		Complete(r)
 }
 
-func (r *GlobalProxySettingsReconciler) Reconcile(ctx context.Context, req reconcile.Request) (result reconcile.Result, err error) { //nolint:dupl
+func (r *GlobalProxySettingsReconciler) Reconcile(ctx context.Context, req reconcile.Request) (result reconcile.Result, err error) {
 	instance := &capsuleproxyv1beta1.GlobalProxySettings{}
 	if err = r.Client.Get(ctx, req.NamespacedName, instance); err != nil {
 		if apierrors.IsNotFound(err) {
@@ -45,16 +48,50 @@ func (r *GlobalProxySettingsReconciler) Reconcile(ctx context.Context, req recon
 		return reconcile.Result{}, err
 	}
 
+	conditions := r.evaluate(instance)
+
 	defer func() {
-		if uerr := r.updateStatus(ctx, instance); uerr != nil {
+		if uerr := r.updateStatus(ctx, instance, conditions); uerr != nil {
 			err = fmt.Errorf("cannot update GlobalProxySettings status: %w", uerr)
 		}
 	}()
 
+	if !conditionsResolved(conditions) {
+		return reconcile.Result{RequeueAfter: unresolvedRequeueInterval}, nil
+	}
+
 	return reconcile.Result{}, nil
 }
 
-func (r *GlobalProxySettingsReconciler) updateStatus(ctx context.Context, instance *capsuleproxyv1beta1.GlobalProxySettings) error {
+func (r *GlobalProxySettingsReconciler) evaluate(instance *capsuleproxyv1beta1.GlobalProxySettings) []capmeta.Condition {
+	generation := instance.GetGeneration()
+
+	var (
+		subjects []ruleSubject
+		rules    []ruleClusterResource
+	)
+
+	for ruleIndex, rule := range instance.Spec.Rules {
+		for _, subject := range rule.Subjects {
+			subjects = append(subjects, ruleSubject{kind: subject.Kind, name: subject.Name})
+		}
+
+		for resourceIndex, resource := range rule.ClusterResources {
+			rules = append(rules, ruleClusterResource{
+				path:     fmt.Sprintf("spec.rules[%d].clusterResources[%d]", ruleIndex, resourceIndex),
+				resource: resource,
+			})
+		}
+	}
+
+	return []capmeta.Condition{
+		subjectsCondition(generation, subjects),
+		resourcesCondition(generation, r.Discovery, rules),
+		selectorsCondition(generation, rules),
+	}
+}
+
+func (r *GlobalProxySettingsReconciler) updateStatus(ctx context.Context, instance *capsuleproxyv1beta1.GlobalProxySettings, conditions []capmeta.Condition) error {
 	return retry.RetryOnConflict(retry.DefaultBackoff, func() error {
 		latest := &capsuleproxyv1beta1.GlobalProxySettings{}
 		if err := r.reader.Get(ctx, types.NamespacedName{Name: instance.Name}, latest); err != nil {
@@ -67,7 +104,11 @@ func (r *GlobalProxySettingsReconciler) updateStatus(ctx context.Context, instan
 
 		latest.Status.ObservedGeneration = latest.GetGeneration()
 
-		readyCondition := capmeta.NewReadyCondition(latest)
+		for _, condition := range conditions {
+			latest.Status.Conditions.UpdateConditionByType(condition)
+		}
+
+		readyCondition := summarizeReadyCondition(capmeta.NewReadyCondition(latest), conditions)
 		readyCondition.ObservedGeneration = latest.GetGeneration()
 		latest.Status.Conditions.UpdateConditionByType(readyCondition)
 
@@ -0,0 +1,29 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	lookupNamespaces = "namespaces"
+	lookupTenants    = "tenants"
+)
+
+//nolint:gochecknoinits
+func init() {
+	metrics.Registry.MustRegister(reflectorLookupDuration)
+}
+
+//nolint:gochecknoglobals
+var reflectorLookupDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "capsule_proxy_reflector_lookup_duration_seconds",
+		Help:    "Duration of the lookups of the Namespaces and Tenants granted by reflected RoleBindings",
+		Buckets: prometheus.ExponentialBuckets(0.0001, 4, 8),
+	},
+	[]string{"lookup"},
+)
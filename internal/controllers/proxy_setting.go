@@ -7,35 +7,59 @@ import (
 	"context"
 	"fmt"
 
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
 	capmeta "github.com/projectcapsule/capsule/pkg/api/meta"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/util/retry"
+	"k8s.io/client-go/util/workqueue"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	capsuleproxyv1beta1 "github.com/projectcapsule/capsule-proxy/api/v1beta1"
+	"github.com/projectcapsule/capsule-proxy/internal/indexer"
 )
 
-// ProxySettingReconciler reconciles ProxySetting objects and keeps
-// status.observedGeneration in sync with metadata.generation.
+// ProxySettingReconciler reconciles ProxySetting objects, keeps
+// status.observedGeneration in sync with metadata.generation and reports
+// whether the subjects and rules resolve as conditions.
 type ProxySettingReconciler struct {
-	Client client.Client
-	reader client.Reader
+	Client    client.Client
+	Discovery discovery.DiscoveryInterface
+	reader    client.Reader
 }
 
 func (r *ProxySettingReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	r.reader = mgr.GetAPIReader()
 
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&capsuleproxyv1beta1.ProxySetting{}).
-		WithEventFilter(predicate.GenerationChangedPredicate{}).
+		For(&capsuleproxyv1beta1.ProxySetting{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&capsulev1beta2.Tenant{}, handler.Funcs{
+			CreateFunc: func(ctx context.Context, e event.CreateEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+				r.enqueueProxySettings(ctx, q, e.Object)
+			},
+			// The namespaces leaving the Tenant are only part of the old object.
+			UpdateFunc: func(ctx context.Context, e event.UpdateEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+				r.enqueueProxySettings(ctx, q, e.ObjectOld, e.ObjectNew)
+			},
+			DeleteFunc: func(ctx context.Context, e event.DeleteEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+				r.enqueueProxySettings(ctx, q, e.Object)
+			},
+			GenericFunc: func(ctx context.Context, e event.GenericEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+				r.enqueueProxySettings(ctx, q, e.Object)
+			},
+		}).
 		Complete(r)
 }
 
-func (r *ProxySettingReconciler) Reconcile(ctx context.Context, req reconcile.Request) (result reconcile.Result, err error) { //nolint:dupl
+func (r *ProxySettingReconciler) Reconcile(ctx context.Context, req reconcile.Request) (result reconcile.Result, err error) {
 	instance := &capsuleproxyv1beta1.ProxySetting{}
 	if err = r.Client.Get(ctx, req.NamespacedName, instance); err != nil {
 		if apierrors.IsNotFound(err) {
@@ -45,16 +69,98 @@ func (r *ProxySettingReconciler) Reconcile(ctx context.Context, req reconcile.Re
 		return reconcile.Result{}, err
 	}
 
+	conditions, err := r.evaluate(ctx, instance)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
 	defer func() {
-		if uerr := r.updateStatus(ctx, instance); uerr != nil {
+		if uerr := r.updateStatus(ctx, instance, conditions); uerr != nil {
 			err = fmt.Errorf("cannot update ProxySetting status: %w", uerr)
 		}
 	}()
 
+	if !conditionsResolved(conditions) {
+		return reconcile.Result{RequeueAfter: unresolvedRequeueInterval}, nil
+	}
+
 	return reconcile.Result{}, nil
 }
 
-func (r *ProxySettingReconciler) updateStatus(ctx context.Context, instance *capsuleproxyv1beta1.ProxySetting) error {
+func (r *ProxySettingReconciler) evaluate(ctx context.Context, instance *capsuleproxyv1beta1.ProxySetting) ([]capmeta.Condition, error) {
+	generation := instance.GetGeneration()
+
+	tenants := &capsulev1beta2.TenantList{}
+	if err := r.Client.List(ctx, tenants, client.MatchingFields{indexer.TenantNamespacesField: instance.GetNamespace()}); err != nil {
+		return nil, fmt.Errorf("cannot list Tenants for namespace %s: %w", instance.GetNamespace(), err)
+	}
+
+	var tenantErr error
+	if len(tenants.Items) == 0 {
+		tenantErr = fmt.Errorf("namespace %s does not belong to any Tenant, the ProxySetting is ignored", instance.GetNamespace())
+	}
+
+	subjects := make([]ruleSubject, 0, len(instance.Spec.Subjects))
+
+	var rules []ruleClusterResource
+
+	for subjectIndex, subject := range instance.Spec.Subjects {
+		subjects = append(subjects, ruleSubject{kind: subject.Kind, name: subject.Name})
+
+		for resourceIndex, resource := range subject.ClusterResources {
+			rules = append(rules, ruleClusterResource{
+				path:     fmt.Sprintf("spec.subjects[%d].clusterResources[%d]", subjectIndex, resourceIndex),
+				resource: resource,
+			})
+		}
+	}
+
+	return []capmeta.Condition{
+		newRuleCondition(capsuleproxyv1beta1.TenantResolvedCondition, generation, tenantErr, capsuleproxyv1beta1.TenantNotFoundReason, "namespace belongs to a Tenant"),
+		subjectsCondition(generation, subjects),
+		resourcesCondition(generation, r.Discovery, rules),
+		selectorsCondition(generation, rules),
+	}, nil
+}
+
+// enqueueProxySettings enqueues the ProxySettings of the Tenant namespaces,
+// since namespaces joining or leaving a Tenant change their resolution.
+func (r *ProxySettingReconciler) enqueueProxySettings(ctx context.Context, q workqueue.TypedRateLimitingInterface[reconcile.Request], objs ...client.Object) {
+	for _, request := range r.proxySettingsForTenants(ctx, objs...) {
+		q.Add(request)
+	}
+}
+
+// proxySettingsForTenants returns the requests of the ProxySettings in the
+// namespaces of any of the Tenants.
+func (r *ProxySettingReconciler) proxySettingsForTenants(ctx context.Context, objs ...client.Object) []reconcile.Request {
+	namespaces := sets.New[string]()
+
+	for _, obj := range objs {
+		if tnt, ok := obj.(*capsulev1beta2.Tenant); ok {
+			namespaces.Insert(tnt.Status.Namespaces...)
+		}
+	}
+
+	var requests []reconcile.Request
+
+	for _, namespace := range sets.List(namespaces) {
+		settings := &capsuleproxyv1beta1.ProxySettingList{}
+		if err := r.Client.List(ctx, settings, client.InNamespace(namespace)); err != nil {
+			ctrl.LoggerFrom(ctx).Error(err, "cannot list ProxySettings for Tenant namespace", "namespace", namespace)
+
+			continue
+		}
+
+		for _, setting := range settings.Items {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: setting.Namespace, Name: setting.Name}})
+		}
+	}
+
+	return requests
+}
+
+func (r *ProxySettingReconciler) updateStatus(ctx context.Context, instance *capsuleproxyv1beta1.ProxySetting, conditions []capmeta.Condition) error {
 	return retry.RetryOnConflict(retry.DefaultBackoff, func() error {
 		latest := &capsuleproxyv1beta1.ProxySetting{}
 		if err := r.reader.Get(ctx, types.NamespacedName{Name: instance.Name, Namespace: instance.Namespace}, latest); err != nil {
@@ -67,7 +173,11 @@ func (r *ProxySettingReconciler) updateStatus(ctx context.Context, instance *cap
 
 		latest.Status.ObservedGeneration = latest.GetGeneration()
 
-		readyCondition := capmeta.NewReadyCondition(latest)
+		for _, condition := range conditions {
+			latest.Status.Conditions.UpdateConditionByType(condition)
+		}
+
+		readyCondition := summarizeReadyCondition(capmeta.NewReadyCondition(latest), conditions)
 		readyCondition.ObservedGeneration = latest.GetGeneration()
 		latest.Status.Conditions.UpdateConditionByType(readyCondition)
 
@@ -0,0 +1,145 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	capmeta "github.com/projectcapsule/capsule/pkg/api/meta"
+	capsulerbac "github.com/projectcapsule/capsule/pkg/api/rbac"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/discovery"
+
+	capsuleproxyv1beta1 "github.com/projectcapsule/capsule-proxy/api/v1beta1"
+	"github.com/projectcapsule/capsule-proxy/internal/runtime/validation"
+)
+
+// unresolvedRequeueInterval is the delay after which rules with unresolved
+// conditions are evaluated again: Tenants, CapsuleConfiguration users and
+// discovered APIs can change without bumping the ProxySetting generation.
+const unresolvedRequeueInterval = time.Minute
+
+type ruleSubject struct {
+	kind capsulerbac.OwnerKind
+	name string
+}
+
+type ruleClusterResource struct {
+	path     string
+	resource capsuleproxyv1beta1.ClusterResource
+}
+
+func newRuleCondition(conditionType string, generation int64, err error, reason, resolvedMessage string) capmeta.Condition {
+	condition := capmeta.Condition{
+		Type:               conditionType,
+		Status:             metav1.ConditionTrue,
+		Reason:             capsuleproxyv1beta1.ResolvedReason,
+		Message:            resolvedMessage,
+		ObservedGeneration: generation,
+		LastTransitionTime: metav1.Now(),
+	}
+
+	if err != nil {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = reason
+		condition.Message = err.Error()
+	}
+
+	return condition
+}
+
+// subjectsCondition checks the subjects against the Capsule users and groups
+// collected from the CapsuleConfiguration: requests of other identities are
+// not filtered by capsule-proxy.
+func subjectsCondition(generation int64, subjects []ruleSubject) capmeta.Condition {
+	var unresolved []string
+
+	for _, subject := range subjects {
+		switch subject.kind {
+		case capsulerbac.GroupOwner:
+			if CapsuleUserGroups.Has(subject.name) {
+				continue
+			}
+		default:
+			if CapsuleUsers.Has(subject.name) {
+				continue
+			}
+		}
+
+		unresolved = append(unresolved, fmt.Sprintf("%s:%s", subject.kind, subject.name))
+	}
+
+	var err error
+	if len(unresolved) > 0 {
+		err = fmt.Errorf("subjects are not part of the CapsuleConfiguration users, their requests are only filtered when belonging to a Capsule group: %s", strings.Join(unresolved, ", "))
+	}
+
+	return newRuleCondition(capsuleproxyv1beta1.SubjectsResolvedCondition, generation, err, capsuleproxyv1beta1.SubjectsNotFoundReason, "all subjects are Capsule users or groups")
+}
+
+// resourcesCondition resolves the clusterResources API groups and resources
+// through API discovery.
+func resourcesCondition(generation int64, discoveryClient discovery.DiscoveryInterface, rules []ruleClusterResource) capmeta.Condition {
+	if len(rules) == 0 {
+		return newRuleCondition(capsuleproxyv1beta1.ResourcesResolvedCondition, generation, nil, "", "no clusterResources defined")
+	}
+
+	index, err := validation.DiscoverClusterResources(discoveryClient)
+	if err != nil {
+		return newRuleCondition(capsuleproxyv1beta1.ResourcesResolvedCondition, generation, fmt.Errorf("cannot discover cluster-scoped resources: %w", err), capsuleproxyv1beta1.DiscoveryFailedReason, "")
+	}
+
+	var errs []error
+
+	for _, rule := range rules {
+		if resolveErr := validation.ResolveClusterResourceBlock(rule.path, rule.resource, index); resolveErr != nil {
+			errs = append(errs, resolveErr)
+		}
+	}
+
+	return newRuleCondition(capsuleproxyv1beta1.ResourcesResolvedCondition, generation, errors.Join(errs...), capsuleproxyv1beta1.ResourcesNotFoundReason, "all clusterResources resolve to discovered resources")
+}
+
+func selectorsCondition(generation int64, rules []ruleClusterResource) capmeta.Condition {
+	var errs []error
+
+	for _, rule := range rules {
+		if selectorErr := validation.ValidateClusterResourceSelector(rule.path, rule.resource.Selector); selectorErr != nil {
+			errs = append(errs, selectorErr)
+		}
+	}
+
+	return newRuleCondition(capsuleproxyv1beta1.SelectorsValidCondition, generation, errors.Join(errs...), capsuleproxyv1beta1.InvalidSelectorReason, "all clusterResources selectors are valid")
+}
+
+// summarizeReadyCondition summarizes the rule conditions: the first unresolved one
+// determines the reason and message of the Ready condition.
+func summarizeReadyCondition(ready capmeta.Condition, conditions []capmeta.Condition) capmeta.Condition {
+	for _, condition := range conditions {
+		if condition.Status == metav1.ConditionTrue {
+			continue
+		}
+
+		ready.Status = metav1.ConditionFalse
+		ready.Reason = condition.Reason
+		ready.Message = fmt.Sprintf("%s: %s", condition.Type, condition.Message)
+
+		break
+	}
+
+	return ready
+}
+
+func conditionsResolved(conditions []capmeta.Condition) bool {
+	for _, condition := range conditions {
+		if condition.Status != metav1.ConditionTrue {
+			return false
+		}
+	}
+
+	return true
+}
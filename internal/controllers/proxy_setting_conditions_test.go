@@ -0,0 +1,86 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"strings"
+	"testing"
+
+	capmeta "github.com/projectcapsule/capsule/pkg/api/meta"
+	capsulerbac "github.com/projectcapsule/capsule/pkg/api/rbac"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	capsuleproxyv1beta1 "github.com/projectcapsule/capsule-proxy/api/v1beta1"
+)
+
+//nolint:paralleltest
+func TestSubjectsCondition(t *testing.T) {
+	CapsuleUsers = sets.New("alice", "system:serviceaccount:solar:robot")
+	CapsuleUserGroups = sets.New("projectcapsule.dev")
+
+	t.Cleanup(func() {
+		CapsuleUsers = nil
+		CapsuleUserGroups = nil
+	})
+
+	resolved := subjectsCondition(3, []ruleSubject{
+		{kind: capsulerbac.UserOwner, name: "alice"},
+		{kind: capsulerbac.ServiceAccountOwner, name: "system:serviceaccount:solar:robot"},
+		{kind: capsulerbac.GroupOwner, name: "projectcapsule.dev"},
+	})
+	if resolved.Status != metav1.ConditionTrue || resolved.ObservedGeneration != 3 {
+		t.Fatalf("expected resolved subjects condition, got %+v", resolved)
+	}
+
+	unresolved := subjectsCondition(3, []ruleSubject{
+		{kind: capsulerbac.UserOwner, name: "alice"},
+		{kind: capsulerbac.GroupOwner, name: "alice"},
+	})
+	if unresolved.Status != metav1.ConditionFalse || unresolved.Reason != capsuleproxyv1beta1.SubjectsNotFoundReason {
+		t.Fatalf("expected unresolved subjects condition, got %+v", unresolved)
+	}
+
+	if !strings.Contains(unresolved.Message, "Group:alice") || strings.Contains(unresolved.Message, "User:alice") {
+		t.Fatalf("expected only the group subject to be reported, got %q", unresolved.Message)
+	}
+}
+
+func TestSelectorsConditionAndReadySummary(t *testing.T) {
+	t.Parallel()
+
+	rules := []ruleClusterResource{
+		{path: "spec.rules[0].clusterResources[0]", resource: capsuleproxyv1beta1.ClusterResource{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"env": "prod"}},
+		}},
+		{path: "spec.rules[0].clusterResources[1]", resource: capsuleproxyv1beta1.ClusterResource{
+			Selector: &metav1.LabelSelector{},
+		}},
+	}
+
+	selectors := selectorsCondition(1, rules)
+	if selectors.Status != metav1.ConditionFalse || selectors.Reason != capsuleproxyv1beta1.InvalidSelectorReason {
+		t.Fatalf("expected invalid selectors condition, got %+v", selectors)
+	}
+
+	if !strings.Contains(selectors.Message, "spec.rules[0].clusterResources[1].selector") {
+		t.Fatalf("expected field path in message, got %q", selectors.Message)
+	}
+
+	resources := newRuleCondition(capsuleproxyv1beta1.ResourcesResolvedCondition, 1, nil, "", "resolved")
+	conditions := []capmeta.Condition{resources, selectors}
+
+	ready := summarizeReadyCondition(capmeta.Condition{Type: "Ready", Status: metav1.ConditionTrue}, conditions)
+	if ready.Status != metav1.ConditionFalse || ready.Reason != capsuleproxyv1beta1.InvalidSelectorReason {
+		t.Fatalf("expected Ready to report the invalid selector, got %+v", ready)
+	}
+
+	if conditionsResolved(conditions) {
+		t.Fatal("expected conditions not to be resolved")
+	}
+
+	if !conditionsResolved([]capmeta.Condition{resources}) {
+		t.Fatal("expected resolved conditions")
+	}
+}
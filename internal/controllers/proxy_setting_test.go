@@ -0,0 +1,56 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	capsuleproxyv1beta1 "github.com/projectcapsule/capsule-proxy/api/v1beta1"
+)
+
+func TestProxySettingsForTenantsEnqueuesLeavingNamespaces(t *testing.T) {
+	t.Parallel()
+
+	scheme := runtime.NewScheme()
+	if err := capsuleproxyv1beta1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	reconciler := &ProxySettingReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&capsuleproxyv1beta1.ProxySetting{ObjectMeta: metav1.ObjectMeta{Name: "sre", Namespace: "solar-dev"}},
+		&capsuleproxyv1beta1.ProxySetting{ObjectMeta: metav1.ObjectMeta{Name: "sre", Namespace: "solar-prod"}},
+		&capsuleproxyv1beta1.ProxySetting{ObjectMeta: metav1.ObjectMeta{Name: "sre", Namespace: "wind-dev"}},
+	).Build()}
+
+	oldTenant := &capsulev1beta2.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "solar"}}
+	oldTenant.Status.Namespaces = []string{"solar-dev", "solar-prod"}
+
+	newTenant := oldTenant.DeepCopy()
+	newTenant.Status.Namespaces = []string{"solar-prod"}
+
+	requests := reconciler.proxySettingsForTenants(context.Background(), oldTenant, newTenant)
+
+	want := []reconcile.Request{
+		{NamespacedName: types.NamespacedName{Namespace: "solar-dev", Name: "sre"}},
+		{NamespacedName: types.NamespacedName{Namespace: "solar-prod", Name: "sre"}},
+	}
+
+	if len(requests) != len(want) {
+		t.Fatalf("got requests %v, want %v", requests, want)
+	}
+
+	for i := range want {
+		if requests[i] != want[i] {
+			t.Fatalf("got requests %v, want %v", requests, want)
+		}
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/pkg/errors"
 	capsulemeta "github.com/projectcapsule/capsule/pkg/api/meta"
 	capsulerbac "github.com/projectcapsule/capsule/pkg/api/rbac"
+	"github.com/prometheus/client_golang/prometheus"
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
@@ -66,6 +67,9 @@ func NewRoleBindingReflector(ctx context.Context, cache crcache.Cache) (*RoleBin
 }
 
 func (r *RoleBindingReflector) GetUserNamespacesFromRequest(req request.Request) ([]string, error) {
+	timer := prometheus.NewTimer(reflectorLookupDuration.WithLabelValues(lookupNamespaces))
+	defer timer.ObserveDuration()
+
 	username, groups, _ := req.GetUserAndGroups()
 
 	bindings, err := r.getRoleBindingsForSubject(req.GetHTTPRequest().Context(), username, groups, subjectIndex)
@@ -107,6 +111,9 @@ func (r *RoleBindingReflector) Start(ctx context.Context) error {
 // GetUserTenantNamesForResource resolves reflected RBAC permissions directly
 // to tenant selector values using the cached Namespace objects.
 func (r *RoleBindingReflector) GetUserTenantNamesForResource(ctx context.Context, username string, groups []string, verb, apiGroup, resource string) ([]string, error) {
+	timer := prometheus.NewTimer(reflectorLookupDuration.WithLabelValues(lookupTenants))
+	defer timer.ObserveDuration()
+
 	cacheKey := reflectionResultKey(username, groups, verb, apiGroup, resource)
 	if result, ok := r.cachedResult(cacheKey); ok {
 		return result, nil
@@ -140,6 +147,30 @@ func (r *RoleBindingReflector) GetUserTenantNamesForResource(ctx context.Context
 	return result, nil
 }
 
+// GetTenantNamespaces returns the cached namespaces of the given Tenants,
+// resolved as GetUserTenantNamesForResource does, keyed by Tenant name.
+func (r *RoleBindingReflector) GetTenantNamespaces(ctx context.Context, tenantNames ...string) (map[string][]string, error) {
+	result := make(map[string][]string, len(tenantNames))
+	if len(tenantNames) == 0 {
+		return result, nil
+	}
+
+	namespaces := &corev1.NamespaceList{}
+	if err := r.reader.List(ctx, namespaces); err != nil {
+		return nil, errors.Wrap(err, "Unable to list namespaces in cache")
+	}
+
+	wanted := sets.New(tenantNames...)
+
+	for i := range namespaces.Items {
+		if tenantName := reflectedTenantName(&namespaces.Items[i]); wanted.Has(tenantName) {
+			result[tenantName] = append(result[tenantName], namespaces.Items[i].Name)
+		}
+	}
+
+	return result, nil
+}
+
 func reflectedTenantName(namespace *corev1.Namespace) string {
 	if value := namespace.Labels[capsulemeta.NewTenantLabel]; value != "" {
 		return value
@@ -210,7 +241,7 @@ func (r *RoleBindingReflector) GetUserNamespacesForResource(ctx context.Context,
 		}
 
 		for i := range rules {
-			if policyRuleAllows(rules[i], verb, apiGroup, resource) {
+			if PolicyRuleAllows(rules[i], verb, apiGroup, resource) {
 				namespaces.Insert(binding.Namespace)
 
 				break
@@ -261,7 +292,9 @@ func (r *RoleBindingReflector) getRoleBindingsForSubject(ctx context.Context, us
 	return result, nil
 }
 
-func policyRuleAllows(rule rbacv1.PolicyRule, verb, apiGroup, resource string) bool {
+// PolicyRuleAllows reports whether the rule grants the verb on every object of
+// the resource.
+func PolicyRuleAllows(rule rbacv1.PolicyRule, verb, apiGroup, resource string) bool {
 	// LIST requests have no resource name. Kubernetes does not grant an
 	// unfiltered list from a rule restricted with resourceNames.
 	return len(rule.ResourceNames) == 0 &&
@@ -68,6 +68,32 @@ func TestGetUserNamespacesForResource(t *testing.T) {
 	}
 }
 
+func TestGetTenantNamespaces(t *testing.T) {
+	t.Parallel()
+
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	reader := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "solar-dev", Labels: map[string]string{capsulemeta.NewTenantLabel: "solar"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "solar-prod", Labels: map[string]string{capsulemeta.TenantLabel: "solar"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "wind-dev", Labels: map[string]string{capsulemeta.TenantLabel: "wind"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+	).Build()
+	reflector := &RoleBindingReflector{reader: reader, results: map[string]cachedReflectionResult{}}
+
+	namespaces, err := reflector.GetTenantNamespaces(context.Background(), "solar")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(namespaces) != 1 || len(namespaces["solar"]) != 2 || namespaces["solar"][0] != "solar-dev" || namespaces["solar"][1] != "solar-prod" {
+		t.Fatalf("expected the solar namespaces, got %v", namespaces)
+	}
+}
+
 func TestPolicyRuleAllows(t *testing.T) {
 	t.Parallel()
 
@@ -86,8 +112,8 @@ func TestPolicyRuleAllows(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := policyRuleAllows(tt.rule, "list", "apps", "deployments"); got != tt.want {
-				t.Fatalf("policyRuleAllows() = %v, want %v", got, tt.want)
+			if got := PolicyRuleAllows(tt.rule, "list", "apps", "deployments"); got != tt.want {
+				t.Fatalf("PolicyRuleAllows() = %v, want %v", got, tt.want)
 			}
 		})
 	}
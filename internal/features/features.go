@@ -24,4 +24,22 @@ const (
 	// for all tenant users. Toggling this flags makes use Global Proxy Settings (https://projectcapsule.dev/docs/proxy/proxysettings/#globalproxysettings)
 	// instead of using ProxySettings from the Tenant Specification.
 	ProxyClusterScoped = "ProxyClusterScoped"
+
+	// ImpersonateFilteredRequests keeps impersonating the user for the
+	// cross-namespace lists and watches of namespaced resources instead of
+	// forwarding them with the proxy ServiceAccount and a label selector.
+	//
+	// Each Tenant namespace is listed or watched as the user and the results
+	// are merged, so the API server applies the user's own RBAC and the proxy
+	// ServiceAccount needs no cluster-wide read permission on namespaced
+	// resources.
+	ImpersonateFilteredRequests = "ImpersonateFilteredRequests"
+
+	// DiscoveryFilter removes from the discovery documents answered to the
+	// Capsule users the resources they cannot reach, judged from their
+	// Tenants, the ClusterResource rules and native RBAC.
+	//
+	// Each resource is judged with SubjectAccessReviews, cached by the review
+	// cache: the ETag of the filtered documents is computed by the proxy.
+	DiscoveryFilter = "DiscoveryFilter"
 )
@@ -12,6 +12,9 @@ import (
 
 const (
 	TenantOwnerKindField = ".status.owner.ownerkind"
+	// TenantNamespacesField is the Tenant field index populated by Capsule's
+	// NamespacesReference indexer.
+	TenantNamespacesField = ".status.namespaces"
 )
 
 // TenantOwnerReference indexes Tenants by their status.owners (Kind:Name).
@@ -4,12 +4,20 @@
 package clusterscoped
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"strconv"
 
 	"github.com/go-logr/logr"
 	"github.com/gorilla/mux"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -20,7 +28,7 @@ import (
 
 	v1beta1 "github.com/projectcapsule/capsule-proxy/api/v1beta1"
 	"github.com/projectcapsule/capsule-proxy/internal/modules"
-	"github.com/projectcapsule/capsule-proxy/internal/modules/errors"
+	moderrors "github.com/projectcapsule/capsule-proxy/internal/modules/errors"
 	"github.com/projectcapsule/capsule-proxy/internal/modules/utils"
 	"github.com/projectcapsule/capsule-proxy/internal/request"
 	"github.com/projectcapsule/capsule-proxy/internal/tenant"
@@ -63,46 +71,264 @@ func (g get) Methods() []string {
 func (g get) Handle(proxyTenants []*tenant.ProxyTenant, proxyRequest request.Request) (selector labels.Selector, err error) {
 	httpRequest := proxyRequest.GetHTTPRequest()
 
+	operation, supported := methodOperation(httpRequest.Method)
+	if !supported {
+		return nil, nil
+	}
+
 	gvk := utils.GetGVKFromURL(proxyRequest.GetHTTPRequest().URL.Path)
 
-	requirements := GetClusterScopeRequirements(gvk, v1beta1.ClusterResourceOperationGet, proxyTenants)
+	selectors := GetClusterScopeSelectors(gvk, proxyTenants)
+	if !allowsOperation(selectors, operation) {
+		return nil, nil
+	}
+
+	name := mux.Vars(httpRequest)["name"]
+	resource := schema.GroupResource{Group: gvk.Group, Resource: gvk.Kind}
 
-	if len(requirements) > 0 {
-		switch httpRequest.Method {
-		case http.MethodGet:
-			return g.handleSelector(httpRequest.Context(), gvk, requirements, mux.Vars(httpRequest)["name"])
-		default:
-			return nil, nil
-		}
+	obj, selector, err := g.selectedObject(httpRequest.Context(), gvk, selectors, operation, name)
+	if err != nil || selector == nil {
+		return nil, err
 	}
 
-	return
-}
+	// An evaluated write reports the rule selecting the current object, its
+	// body is not dry-run.
+	if modules.IsEvaluation(httpRequest.Context()) {
+		return selector, nil
+	}
+
+	// The writes are forwarded with the proxy ServiceAccount: they are pinned
+	// to the checked object, so a concurrent change cannot make them escape
+	// the selector.
+	switch operation { //nolint:exhaustive
+	case v1beta1.ClusterResourceOperationUpdate, v1beta1.ClusterResourceOperationPatch:
+		err = g.handleWrite(httpRequest, obj, resource, operation, selectors)
+	case v1beta1.ClusterResourceOperationDelete:
+		err = handleDelete(httpRequest, obj, resource)
+	}
 
-func (g get) handleSelector(ctx context.Context, gvk *schema.GroupVersionKind, requirements []labels.Requirement, name string) (selector labels.Selector, err error) {
-	err = utils.ReplacePluralWithKind(g.discovery, gvk)
 	if err != nil {
 		return nil, err
 	}
 
+	return selector, nil
+}
+
+func allowsOperation(selectors []ClusterScopeSelector, operation v1beta1.ClusterResourceOperation) bool {
+	for _, s := range selectors {
+		if s.AllowsOperation(operation) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// methodOperation maps the HTTP method of a named resource request to the
+// ClusterResource operation enabling it.
+func methodOperation(method string) (v1beta1.ClusterResourceOperation, bool) {
+	switch method {
+	case http.MethodGet:
+		return v1beta1.ClusterResourceOperationGet, true
+	case http.MethodPut:
+		return v1beta1.ClusterResourceOperationUpdate, true
+	case http.MethodPatch:
+		return v1beta1.ClusterResourceOperationPatch, true
+	case http.MethodDelete:
+		return v1beta1.ClusterResourceOperationDelete, true
+	default:
+		return "", false
+	}
+}
+
+// selectedObject retrieves the requested object and the selector of the first
+// rule enabling the operation whose requirements all match it: a nil selector
+// lets the request pass through impersonation.
+func (g get) selectedObject(ctx context.Context, gvk *schema.GroupVersionKind, selectors []ClusterScopeSelector, operation v1beta1.ClusterResourceOperation, name string) (*unstructured.Unstructured, labels.Selector, error) {
+	if err := utils.ReplacePluralWithKind(g.discovery, gvk); err != nil {
+		return nil, nil, err
+	}
+
 	obj := &unstructured.Unstructured{}
 	obj.SetGroupVersionKind(*gvk)
 
 	if err := g.reader.Get(ctx, types.NamespacedName{Name: name}, obj); err != nil {
 		if apierrors.IsNotFound(err) {
-			return nil, errors.NewNotFoundError(name, gvk.GroupKind())
+			return nil, nil, moderrors.NewNotFoundError(name, gvk.GroupKind())
 		}
 
-		return nil, err
+		return nil, nil, err
+	}
+
+	return obj, MatchingClusterScopeSelector(selectors, operation, obj.GetLabels()), nil
+}
+
+// handleWrite performs the update or patch as a server-side dry-run to
+// compute the resulting object: the write is rejected when its labels would
+// no longer be entirely selected by a rule enabling the operation. The request
+// is then forwarded as an update of the checked resourceVersion, a patch
+// being replaced with the object it dry-runs to.
+func (g get) handleWrite(httpRequest *http.Request, obj *unstructured.Unstructured, resource schema.GroupResource, operation v1beta1.ClusterResourceOperation, selectors []ClusterScopeSelector) error {
+	gk := obj.GroupVersionKind().GroupKind()
+	name := obj.GetName()
+
+	body, err := io.ReadAll(httpRequest.Body)
+	if err != nil {
+		return moderrors.NewBadRequest(fmt.Errorf("cannot read request body: %w", err), gk)
+	}
+
+	_ = httpRequest.Body.Close()
+	httpRequest.Body = io.NopCloser(bytes.NewReader(body))
+
+	mediaType, _, err := mime.ParseMediaType(httpRequest.Header.Get("Content-Type"))
+	if err != nil {
+		return moderrors.NewBadRequest(fmt.Errorf("cannot parse Content-Type: %w", err), gk)
+	}
+
+	ctx := httpRequest.Context()
+	query := httpRequest.URL.Query()
+	result := obj.DeepCopy()
+	forwarded := result
+
+	switch operation { //nolint:exhaustive
+	case v1beta1.ClusterResourceOperationUpdate:
+		if mediaType != "application/json" {
+			return moderrors.NewBadRequest(fmt.Errorf("unsupported Content-Type %q, only application/json is supported", mediaType), gk)
+		}
+
+		content := map[string]interface{}{}
+		if err = json.Unmarshal(body, &content); err != nil {
+			return moderrors.NewBadRequest(fmt.Errorf("cannot decode request body: %w", err), gk)
+		}
+
+		// The API server defaults the kind of an update from the URL.
+		result = &unstructured.Unstructured{Object: content}
+		if result.GetObjectKind().GroupVersionKind().Empty() {
+			result.SetGroupVersionKind(obj.GroupVersionKind())
+		}
+
+		if result.GetName() != name {
+			return moderrors.NewBadRequest(fmt.Errorf("the name of the object (%s) does not match the name on the URL (%s)", result.GetName(), name), gk)
+		}
+
+		if resourceVersion := result.GetResourceVersion(); len(resourceVersion) > 0 && resourceVersion != obj.GetResourceVersion() {
+			return conflict(resource, obj, fmt.Errorf("the resourceVersion %s is not the one of the object", resourceVersion))
+		}
+
+		result.SetResourceVersion(obj.GetResourceVersion())
+		forwarded = result.DeepCopy()
+
+		err = g.writer.Update(ctx, result, client.DryRunAll)
+	case v1beta1.ClusterResourceOperationPatch:
+		patchType := types.PatchType(mediaType)
+
+		opts := []client.PatchOption{client.DryRunAll}
+
+		switch patchType {
+		case types.JSONPatchType, types.MergePatchType, types.StrategicMergePatchType:
+		case types.ApplyPatchType:
+			opts = append(opts, client.FieldOwner(query.Get("fieldManager")))
+
+			if force, _ := strconv.ParseBool(query.Get("force")); force {
+				opts = append(opts, client.ForceOwnership)
+			}
+		default:
+			return moderrors.NewBadRequest(fmt.Errorf("unsupported patch type %q", mediaType), gk)
+		}
+
+		err = g.writer.Patch(ctx, result, client.RawPatch(patchType, body), opts...)
+	}
+
+	if err != nil {
+		var apiStatus apierrors.APIStatus
+		if errors.As(err, &apiStatus) {
+			return moderrors.NewStatusError(apiStatus.Status())
+		}
+
+		return err
+	}
+
+	if MatchingClusterScopeSelector(selectors, operation, result.GetLabels()) == nil {
+		g.log.V(4).Info("rejecting write removing the object from the selected resources", "name", name, "operation", operation)
+
+		return moderrors.NewForbiddenError(name, gk, fmt.Sprintf("%s would change labels so the object is no longer selected by the ClusterResource rules", operation))
+	}
+
+	forwarded.SetResourceVersion(obj.GetResourceVersion())
+
+	if body, err = json.Marshal(forwarded.Object); err != nil {
+		return err
+	}
+
+	if operation == v1beta1.ClusterResourceOperationPatch {
+		query.Del("force")
+
+		httpRequest.Method = http.MethodPut
+		httpRequest.URL.RawQuery = query.Encode()
+	}
+
+	setJSONBody(httpRequest, body)
+
+	return nil
+}
+
+// handleDelete forwards the deletion with the preconditions of the checked
+// object, read from the DeleteOptions of the body or of the query.
+func handleDelete(httpRequest *http.Request, obj *unstructured.Unstructured, resource schema.GroupResource) error {
+	gk := obj.GroupVersionKind().GroupKind()
+
+	body, err := io.ReadAll(httpRequest.Body)
+	if err != nil {
+		return moderrors.NewBadRequest(fmt.Errorf("cannot read request body: %w", err), gk)
 	}
 
-	selector = labels.NewSelector()
+	_ = httpRequest.Body.Close()
 
-	for _, requirement := range requirements {
-		if requirement.Matches(labels.Set(obj.GetLabels())) {
-			return selector.Add(requirement), nil
+	options := &metav1.DeleteOptions{}
+
+	if len(body) > 0 {
+		if mediaType, _, _ := mime.ParseMediaType(httpRequest.Header.Get("Content-Type")); mediaType != "application/json" {
+			return moderrors.NewBadRequest(fmt.Errorf("unsupported Content-Type %q, only application/json is supported", mediaType), gk)
+		}
+
+		if err = json.Unmarshal(body, options); err != nil {
+			return moderrors.NewBadRequest(fmt.Errorf("cannot decode request body: %w", err), gk)
 		}
+	} else if err = metav1.ParameterCodec.DecodeParameters(httpRequest.URL.Query(), metav1.SchemeGroupVersion, options); err != nil {
+		return moderrors.NewBadRequest(fmt.Errorf("cannot decode the delete options: %w", err), gk)
 	}
 
-	return nil, nil
+	uid, resourceVersion := obj.GetUID(), obj.GetResourceVersion()
+
+	if preconditions := options.Preconditions; preconditions != nil {
+		if preconditions.UID != nil && *preconditions.UID != uid {
+			return conflict(resource, obj, fmt.Errorf("the UID in the precondition (%s) does not match the UID of the object (%s)", *preconditions.UID, uid))
+		}
+
+		if preconditions.ResourceVersion != nil && *preconditions.ResourceVersion != resourceVersion {
+			return conflict(resource, obj, fmt.Errorf("the resourceVersion in the precondition (%s) does not match the resourceVersion of the object (%s)", *preconditions.ResourceVersion, resourceVersion))
+		}
+	}
+
+	options.TypeMeta = metav1.TypeMeta{APIVersion: metav1.SchemeGroupVersion.String(), Kind: "DeleteOptions"}
+	options.Preconditions = &metav1.Preconditions{UID: &uid, ResourceVersion: &resourceVersion}
+
+	if body, err = json.Marshal(options); err != nil {
+		return err
+	}
+
+	setJSONBody(httpRequest, body)
+
+	return nil
+}
+
+func conflict(resource schema.GroupResource, obj *unstructured.Unstructured, err error) error {
+	return moderrors.NewStatusError(apierrors.NewConflict(resource, obj.GetName(), err).ErrStatus)
+}
+
+func setJSONBody(httpRequest *http.Request, body []byte) {
+	httpRequest.Body = io.NopCloser(bytes.NewReader(body))
+	httpRequest.ContentLength = int64(len(body))
+	httpRequest.Header.Set("Content-Type", "application/json")
+	httpRequest.Header.Set("Content-Length", strconv.Itoa(len(body)))
 }
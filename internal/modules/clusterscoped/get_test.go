@@ -4,8 +4,13 @@
 package clusterscoped
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/gorilla/mux"
@@ -15,9 +20,13 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	discoveryfake "k8s.io/client-go/discovery/fake"
 	clienttesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
 
 	v1beta1 "github.com/projectcapsule/capsule-proxy/api/v1beta1"
+	"github.com/projectcapsule/capsule-proxy/internal/modules"
+	moderrors "github.com/projectcapsule/capsule-proxy/internal/modules/errors"
 	proxyrequest "github.com/projectcapsule/capsule-proxy/internal/request"
 	"github.com/projectcapsule/capsule-proxy/internal/tenant"
 )
@@ -94,6 +103,386 @@ func TestGetHandlesLegacyListForSelectedGroupedNamedResource(t *testing.T) {
 	}
 }
 
+func TestGetHandlesWritesOnSelectedResource(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		method      string
+		contentType string
+		body        string
+		operations  []v1beta1.ClusterResourceOperation
+		labels      map[string]string
+		wantFilter  bool
+		wantError   int32
+	}{
+		{
+			name:        "update keeping the selected labels",
+			method:      http.MethodPut,
+			contentType: "application/json",
+			body:        `{"apiVersion":"v1","kind":"PersistentVolume","metadata":{"name":"` + persistentVolumeName + `","labels":{"capsule.clastix.io/tenant":"solar","tier":"gold"}}}`,
+			operations:  []v1beta1.ClusterResourceOperation{v1beta1.ClusterResourceOperationUpdate},
+			labels:      map[string]string{"capsule.clastix.io/tenant": "solar"},
+			wantFilter:  true,
+		},
+		{
+			name:        "update removing the selected labels",
+			method:      http.MethodPut,
+			contentType: "application/json",
+			body:        `{"apiVersion":"v1","kind":"PersistentVolume","metadata":{"name":"` + persistentVolumeName + `","labels":{"tier":"gold"}}}`,
+			operations:  []v1beta1.ClusterResourceOperation{v1beta1.ClusterResourceOperationUpdate},
+			labels:      map[string]string{"capsule.clastix.io/tenant": "solar"},
+			wantError:   http.StatusForbidden,
+		},
+		{
+			name:        "update of another resourceVersion",
+			method:      http.MethodPut,
+			contentType: "application/json",
+			body:        `{"apiVersion":"v1","kind":"PersistentVolume","metadata":{"name":"` + persistentVolumeName + `","resourceVersion":"6","labels":{"capsule.clastix.io/tenant":"solar"}}}`,
+			operations:  []v1beta1.ClusterResourceOperation{v1beta1.ClusterResourceOperationUpdate},
+			labels:      map[string]string{"capsule.clastix.io/tenant": "solar"},
+			wantError:   http.StatusConflict,
+		},
+		{
+			name:        "update with a mismatching name",
+			method:      http.MethodPut,
+			contentType: "application/json",
+			body:        `{"apiVersion":"v1","kind":"PersistentVolume","metadata":{"name":"other","labels":{"capsule.clastix.io/tenant":"solar"}}}`,
+			operations:  []v1beta1.ClusterResourceOperation{v1beta1.ClusterResourceOperationUpdate},
+			labels:      map[string]string{"capsule.clastix.io/tenant": "solar"},
+			wantError:   http.StatusBadRequest,
+		},
+		{
+			name:        "merge patch keeping the selected labels",
+			method:      http.MethodPatch,
+			contentType: "application/merge-patch+json",
+			body:        `{"metadata":{"labels":{"tier":"gold"}}}`,
+			operations:  []v1beta1.ClusterResourceOperation{v1beta1.ClusterResourceOperationPatch},
+			labels:      map[string]string{"capsule.clastix.io/tenant": "solar"},
+			wantFilter:  true,
+		},
+		{
+			name:        "json patch removing the selected labels",
+			method:      http.MethodPatch,
+			contentType: "application/json-patch+json",
+			body:        `[{"op":"remove","path":"/metadata/labels/capsule.clastix.io~1tenant"}]`,
+			operations:  []v1beta1.ClusterResourceOperation{v1beta1.ClusterResourceOperationPatch},
+			labels:      map[string]string{"capsule.clastix.io/tenant": "solar"},
+			wantError:   http.StatusForbidden,
+		},
+		{
+			name:        "unsupported patch type",
+			method:      http.MethodPatch,
+			contentType: "application/yaml",
+			body:        `metadata: {}`,
+			operations:  []v1beta1.ClusterResourceOperation{v1beta1.ClusterResourceOperationPatch},
+			labels:      map[string]string{"capsule.clastix.io/tenant": "solar"},
+			wantError:   http.StatusBadRequest,
+		},
+		{
+			name:       "delete selected resource",
+			method:     http.MethodDelete,
+			operations: []v1beta1.ClusterResourceOperation{v1beta1.ClusterResourceOperationDelete},
+			labels:     map[string]string{"capsule.clastix.io/tenant": "solar"},
+			wantFilter: true,
+		},
+		{
+			name:        "delete selected resource with options",
+			method:      http.MethodDelete,
+			contentType: "application/json",
+			body:        `{"kind":"DeleteOptions","apiVersion":"v1","propagationPolicy":"Foreground"}`,
+			operations:  []v1beta1.ClusterResourceOperation{v1beta1.ClusterResourceOperationDelete},
+			labels:      map[string]string{"capsule.clastix.io/tenant": "solar"},
+			wantFilter:  true,
+		},
+		{
+			name:        "delete with another precondition",
+			method:      http.MethodDelete,
+			contentType: "application/json",
+			body:        `{"kind":"DeleteOptions","apiVersion":"v1","preconditions":{"resourceVersion":"6"}}`,
+			operations:  []v1beta1.ClusterResourceOperation{v1beta1.ClusterResourceOperationDelete},
+			labels:      map[string]string{"capsule.clastix.io/tenant": "solar"},
+			wantError:   http.StatusConflict,
+		},
+		{
+			name:       "delete not selected resource is impersonated",
+			method:     http.MethodDelete,
+			operations: []v1beta1.ClusterResourceOperation{v1beta1.ClusterResourceOperationDelete},
+			labels:     map[string]string{"capsule.clastix.io/tenant": "oil"},
+		},
+		{
+			name:       "delete without operation is impersonated",
+			method:     http.MethodDelete,
+			operations: []v1beta1.ClusterResourceOperation{v1beta1.ClusterResourceOperationUpdate},
+			labels:     map[string]string{"capsule.clastix.io/tenant": "solar"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			persistentVolume := &unstructured.Unstructured{}
+			persistentVolume.SetAPIVersion("v1")
+			persistentVolume.SetKind("PersistentVolume")
+			persistentVolume.SetName(persistentVolumeName)
+			persistentVolume.SetUID("0574499c")
+			persistentVolume.SetResourceVersion("7")
+			persistentVolume.SetLabels(tt.labels)
+
+			// The fake client ignores dry-run patches: apply them to compute
+			// the resulting object as the API server would.
+			resourceClient := fake.NewClientBuilder().WithScheme(runtime.NewScheme()).WithObjects(persistentVolume).
+				WithInterceptorFuncs(interceptor.Funcs{
+					Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, _ ...client.PatchOption) error {
+						return c.Patch(ctx, obj, patch)
+					},
+				}).Build()
+			discoveryClient := &discoveryfake.FakeDiscovery{Fake: &clienttesting.Fake{}}
+			discoveryClient.Resources = []*metav1.APIResourceList{{
+				GroupVersion: "v1",
+				APIResources: []metav1.APIResource{{Name: "persistentvolumes", Kind: "PersistentVolume"}},
+			}}
+			module := Get(discoveryClient, resourceClient, resourceClient, "/api/v1/persistentvolumes/{name}")
+
+			httpRequest := httptest.NewRequest(tt.method, "/api/v1/persistentvolumes/"+persistentVolumeName, strings.NewReader(tt.body))
+			httpRequest.Header.Set("Content-Type", tt.contentType)
+			httpRequest = mux.SetURLVars(httpRequest, map[string]string{"name": persistentVolumeName})
+
+			selector, err := module.Handle([]*tenant.ProxyTenant{{ClusterResources: []v1beta1.ClusterResource{{
+				APIGroups:  []string{""},
+				Resources:  []string{"persistentvolumes"},
+				Operations: tt.operations,
+				Selector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{"capsule.clastix.io/tenant": "solar"},
+				},
+			}}}}, staticRequest{Request: httpRequest})
+
+			if tt.wantError > 0 {
+				var statusErr moderrors.Error
+				if !errors.As(err, &statusErr) || statusErr.Status().Code != tt.wantError {
+					t.Fatalf("expected status %d, got %v", tt.wantError, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected handling error: %v", err)
+			}
+
+			if (selector != nil) != tt.wantFilter {
+				t.Fatalf("selector=%v, want filtered=%t", selector, tt.wantFilter)
+			}
+
+			body, err := io.ReadAll(httpRequest.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if selector == nil {
+				if string(body) != tt.body {
+					t.Fatalf("expected the request body to be restored, got %q", body)
+				}
+
+				return
+			}
+
+			assertPinnedWrite(t, httpRequest, body)
+		})
+	}
+}
+
+// assertPinnedWrite checks the write forwarded with the proxy ServiceAccount
+// applies to the checked object only.
+func assertPinnedWrite(t *testing.T, httpRequest *http.Request, body []byte) {
+	t.Helper()
+
+	if httpRequest.Method == http.MethodDelete {
+		options := &metav1.DeleteOptions{}
+		if err := json.Unmarshal(body, options); err != nil {
+			t.Fatalf("cannot decode the forwarded delete options %q: %v", body, err)
+		}
+
+		if preconditions := options.Preconditions; preconditions == nil || preconditions.UID == nil || *preconditions.UID != "0574499c" ||
+			preconditions.ResourceVersion == nil || *preconditions.ResourceVersion != "7" {
+			t.Fatalf("expected the preconditions of the checked object, got %s", body)
+		}
+
+		return
+	}
+
+	forwarded := &unstructured.Unstructured{}
+	if err := json.Unmarshal(body, &forwarded.Object); err != nil {
+		t.Fatalf("cannot decode the forwarded object %q: %v", body, err)
+	}
+
+	if httpRequest.Method != http.MethodPut || httpRequest.Header.Get("Content-Type") != "application/json" ||
+		forwarded.GetResourceVersion() != "7" || forwarded.GetLabels()["tier"] != "gold" {
+		t.Fatalf("expected an update of the checked resourceVersion, got %s %s", httpRequest.Method, body)
+	}
+}
+
+func TestGetRequiresEntireRuleSelector(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		method      string
+		contentType string
+		body        string
+		labels      map[string]string
+		wantFilter  bool
+		wantError   int32
+	}{
+		{
+			name:       "delete matching every requirement",
+			method:     http.MethodDelete,
+			labels:     map[string]string{"env": "prod", "team": "a"},
+			wantFilter: true,
+		},
+		{
+			name:   "delete matching a single requirement is impersonated",
+			method: http.MethodDelete,
+			labels: map[string]string{"env": "prod", "team": "b"},
+		},
+		{
+			name:        "merge patch keeping every requirement",
+			method:      http.MethodPatch,
+			contentType: "application/merge-patch+json",
+			body:        `{"metadata":{"labels":{"tier":"gold"}}}`,
+			labels:      map[string]string{"env": "prod", "team": "a"},
+			wantFilter:  true,
+		},
+		{
+			name:        "merge patch dropping a single requirement",
+			method:      http.MethodPatch,
+			contentType: "application/merge-patch+json",
+			body:        `{"metadata":{"labels":{"team":null}}}`,
+			labels:      map[string]string{"env": "prod", "team": "a"},
+			wantError:   http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			persistentVolume := &unstructured.Unstructured{}
+			persistentVolume.SetAPIVersion("v1")
+			persistentVolume.SetKind("PersistentVolume")
+			persistentVolume.SetName(persistentVolumeName)
+			persistentVolume.SetLabels(tt.labels)
+
+			resourceClient := fake.NewClientBuilder().WithScheme(runtime.NewScheme()).WithObjects(persistentVolume).
+				WithInterceptorFuncs(interceptor.Funcs{
+					Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, _ ...client.PatchOption) error {
+						return c.Patch(ctx, obj, patch)
+					},
+				}).Build()
+			discoveryClient := &discoveryfake.FakeDiscovery{Fake: &clienttesting.Fake{}}
+			discoveryClient.Resources = []*metav1.APIResourceList{{
+				GroupVersion: "v1",
+				APIResources: []metav1.APIResource{{Name: "persistentvolumes", Kind: "PersistentVolume"}},
+			}}
+			module := Get(discoveryClient, resourceClient, resourceClient, "/api/v1/persistentvolumes/{name}")
+
+			httpRequest := httptest.NewRequest(tt.method, "/api/v1/persistentvolumes/"+persistentVolumeName, strings.NewReader(tt.body))
+			httpRequest.Header.Set("Content-Type", tt.contentType)
+			httpRequest = mux.SetURLVars(httpRequest, map[string]string{"name": persistentVolumeName})
+
+			selector, err := module.Handle([]*tenant.ProxyTenant{{ClusterResources: []v1beta1.ClusterResource{{
+				APIGroups: []string{""},
+				Resources: []string{"persistentvolumes"},
+				Operations: []v1beta1.ClusterResourceOperation{
+					v1beta1.ClusterResourceOperationPatch,
+					v1beta1.ClusterResourceOperationDelete,
+				},
+				Selector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{"env": "prod", "team": "a"},
+				},
+			}}}}, staticRequest{Request: httpRequest})
+
+			if tt.wantError > 0 {
+				var statusErr moderrors.Error
+				if !errors.As(err, &statusErr) || statusErr.Status().Code != tt.wantError {
+					t.Fatalf("expected status %d, got %v", tt.wantError, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected handling error: %v", err)
+			}
+
+			if (selector != nil) != tt.wantFilter {
+				t.Fatalf("selector=%v, want filtered=%t", selector, tt.wantFilter)
+			}
+
+			if selector != nil && selector.Matches(labels.Set{"env": "prod"}) {
+				t.Fatalf("selector %v matches a single requirement of the rule", selector)
+			}
+		})
+	}
+}
+
+func TestGetEvaluatesWritesWithoutDryRun(t *testing.T) {
+	t.Parallel()
+
+	for _, method := range []string{http.MethodPut, http.MethodPatch} {
+		t.Run(method, func(t *testing.T) {
+			t.Parallel()
+
+			persistentVolume := &unstructured.Unstructured{}
+			persistentVolume.SetAPIVersion("v1")
+			persistentVolume.SetKind("PersistentVolume")
+			persistentVolume.SetName(persistentVolumeName)
+			persistentVolume.SetLabels(map[string]string{"env": "prod"})
+
+			resourceClient := fake.NewClientBuilder().WithScheme(runtime.NewScheme()).WithObjects(persistentVolume).
+				WithInterceptorFuncs(interceptor.Funcs{
+					Update: func(context.Context, client.WithWatch, client.Object, ...client.UpdateOption) error {
+						t.Fatal("evaluated update sent to the API server")
+
+						return nil
+					},
+					Patch: func(context.Context, client.WithWatch, client.Object, client.Patch, ...client.PatchOption) error {
+						t.Fatal("evaluated patch sent to the API server")
+
+						return nil
+					},
+				}).Build()
+			discoveryClient := &discoveryfake.FakeDiscovery{Fake: &clienttesting.Fake{}}
+			discoveryClient.Resources = []*metav1.APIResourceList{{
+				GroupVersion: "v1",
+				APIResources: []metav1.APIResource{{Name: "persistentvolumes", Kind: "PersistentVolume"}},
+			}}
+			module := Get(discoveryClient, resourceClient, resourceClient, "/api/v1/persistentvolumes/{name}")
+
+			httpRequest := httptest.NewRequestWithContext(modules.WithEvaluation(context.Background()), method, "/api/v1/persistentvolumes/"+persistentVolumeName, http.NoBody)
+			httpRequest = mux.SetURLVars(httpRequest, map[string]string{"name": persistentVolumeName})
+
+			selector, err := module.Handle([]*tenant.ProxyTenant{{ClusterResources: []v1beta1.ClusterResource{{
+				APIGroups: []string{""},
+				Resources: []string{"persistentvolumes"},
+				Operations: []v1beta1.ClusterResourceOperation{
+					v1beta1.ClusterResourceOperationUpdate,
+					v1beta1.ClusterResourceOperationPatch,
+				},
+				Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"env": "prod"}},
+			}}}}, staticRequest{Request: httpRequest})
+			if err != nil {
+				t.Fatalf("unexpected handling error: %v", err)
+			}
+
+			if selector == nil || !selector.Matches(labels.Set{"env": "prod"}) {
+				t.Fatalf("expected the selector of the rule, got %v", selector)
+			}
+		})
+	}
+}
+
 type staticRequest struct {
 	*http.Request
 }
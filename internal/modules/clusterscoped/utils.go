@@ -4,6 +4,7 @@
 package clusterscoped
 
 import (
+	"slices"
 	"strings"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -48,6 +49,60 @@ func GetClusterScopeRequirements(
 	return requirements
 }
 
+// ClusterScopeSelector is the label selector of a single ClusterResource rule
+// together with the operations the rule enables.
+type ClusterScopeSelector struct {
+	Selector   labels.Selector
+	Operations []v1beta1.ClusterResourceOperation
+}
+
+// AllowsOperation reports whether the rule enables the requested operation.
+func (s ClusterScopeSelector) AllowsOperation(operation v1beta1.ClusterResourceOperation) bool {
+	return slices.Contains(s.Operations, operation)
+}
+
+// GetClusterScopeSelectors returns one selector per ClusterResource rule
+// matching the given GroupVersionKind. Unlike GetClusterScopeRequirements the
+// requirements of a rule are never flattened: an object is selected by a rule
+// only when all of its requirements match.
+func GetClusterScopeSelectors(gvk *schema.GroupVersionKind, proxyTenants []*tenant.ProxyTenant) (selectors []ClusterScopeSelector) {
+	for _, pt := range proxyTenants {
+		for _, cr := range pt.ClusterResources {
+			if !matchResource(gvk, cr) {
+				continue
+			}
+
+			selector, err := metav1.LabelSelectorAsSelector(cr.Selector)
+			if err != nil {
+				continue
+			}
+
+			if _, selectable := selector.Requirements(); !selectable || selector.Empty() {
+				continue
+			}
+
+			selectors = append(selectors, ClusterScopeSelector{
+				Selector:   selector,
+				Operations: cr.EffectiveOperations(),
+			})
+		}
+	}
+
+	return selectors
+}
+
+// MatchingClusterScopeSelector returns the first selector enabling the
+// operation and matching the given labels, nil when none does.
+func MatchingClusterScopeSelector(selectors []ClusterScopeSelector, operation v1beta1.ClusterResourceOperation, objLabels map[string]string) labels.Selector {
+	for _, s := range selectors {
+		if s.AllowsOperation(operation) && s.Selector.Matches(labels.Set(objLabels)) {
+			return s.Selector
+		}
+	}
+
+	return nil
+}
+
 func matchResource(gvk *schema.GroupVersionKind, cr v1beta1.ClusterResource) bool {
 	if gvk == nil {
 		return false
@@ -33,7 +33,7 @@ func TestGetClusterScopeRequirementsFiltersByOperation(t *testing.T) {
 	}{
 		{name: "list includes default and list-only", operation: v1beta1.ClusterResourceOperationList, want: []string{"default", "list-only"}},
 		{name: "get includes default, legacy list, and get-only", operation: v1beta1.ClusterResourceOperationGet, want: []string{"default", "list-only", "get-only"}},
-		{name: "unsupported operation matches nothing", operation: "Update", want: nil},
+		{name: "update requires an explicit operation", operation: v1beta1.ClusterResourceOperationUpdate, want: nil},
 	}
 
 	for _, tt := range tests {
@@ -52,6 +52,54 @@ func TestGetClusterScopeRequirementsFiltersByOperation(t *testing.T) {
 	}
 }
 
+func TestGetClusterScopeSelectorsKeepsRulesApart(t *testing.T) {
+	t.Parallel()
+
+	gvk := &schema.GroupVersionKind{Group: "storage.k8s.io", Version: "v1", Kind: "storageclasses"}
+	proxyTenants := []*tenant.ProxyTenant{{
+		ClusterResources: []v1beta1.ClusterResource{
+			{
+				APIGroups:  []string{"storage.k8s.io"},
+				Resources:  []string{"storageclasses"},
+				Operations: []v1beta1.ClusterResourceOperation{v1beta1.ClusterResourceOperationDelete},
+				Selector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{"env": "prod", "team": "a"},
+				},
+			},
+			clusterResourceRule(nil, "default"),
+		},
+	}}
+
+	selectors := GetClusterScopeSelectors(gvk, proxyTenants)
+	if len(selectors) != 2 {
+		t.Fatalf("expected one selector per rule, got %d", len(selectors))
+	}
+
+	tests := []struct {
+		name      string
+		operation v1beta1.ClusterResourceOperation
+		labels    labels.Set
+		want      bool
+	}{
+		{name: "delete with every requirement", operation: v1beta1.ClusterResourceOperationDelete, labels: labels.Set{"env": "prod", "team": "a"}, want: true},
+		{name: "delete with a single requirement", operation: v1beta1.ClusterResourceOperationDelete, labels: labels.Set{"env": "prod"}, want: false},
+		{name: "delete with the labels of a get rule", operation: v1beta1.ClusterResourceOperationDelete, labels: labels.Set{"access": "default"}, want: false},
+		{name: "get with the labels of a delete rule", operation: v1beta1.ClusterResourceOperationGet, labels: labels.Set{"env": "prod", "team": "a"}, want: false},
+		{name: "get with the labels of a get rule", operation: v1beta1.ClusterResourceOperationGet, labels: labels.Set{"access": "default"}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := MatchingClusterScopeSelector(selectors, tt.operation, tt.labels) != nil
+			if got != tt.want {
+				t.Fatalf("matched=%t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
 func clusterResourceRule(operations []v1beta1.ClusterResourceOperation, access string) v1beta1.ClusterResource {
 	return v1beta1.ClusterResource{
 		APIGroups:  []string{"storage.k8s.io"},
@@ -0,0 +1,74 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package errors
+
+import (
+	"fmt"
+	"net/http"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/projectcapsule/capsule-proxy/internal/types"
+)
+
+type forbiddenError struct {
+	message string
+	details *metav1.StatusDetails
+}
+
+func NewForbiddenError(name string, gk schema.GroupKind, reason string) error {
+	message := fmt.Sprintf("%s.%s %q is forbidden: %s", gk.Kind, gk.Group, name, reason)
+
+	return &forbiddenError{
+		message: message,
+		details: &metav1.StatusDetails{
+			Name:  name,
+			Group: gk.Group,
+			Kind:  gk.Kind,
+		},
+	}
+}
+
+func (e forbiddenError) Error() string {
+	return e.message
+}
+
+func (e forbiddenError) Status() *metav1.Status {
+	return &metav1.Status{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       types.StatusKind,
+			APIVersion: types.V1,
+		},
+		Reason:  metav1.StatusReasonForbidden,
+		Message: e.message,
+		Status:  metav1.StatusFailure,
+		Code:    http.StatusForbidden,
+		Details: e.details,
+	}
+}
+
+// statusError exposes an API server status, e.g. returned by a dry-run
+// request, to the client unchanged.
+type statusError struct {
+	status metav1.Status
+}
+
+func NewStatusError(status metav1.Status) error {
+	return &statusError{status: status}
+}
+
+func (e statusError) Error() string {
+	return e.status.Message
+}
+
+func (e statusError) Status() *metav1.Status {
+	status := e.status
+	status.TypeMeta = metav1.TypeMeta{
+		Kind:       types.StatusKind,
+		APIVersion: types.V1,
+	}
+
+	return &status
+}
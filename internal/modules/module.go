@@ -4,6 +4,9 @@
 package modules
 
 import (
+	"context"
+	"fmt"
+
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 
@@ -18,3 +21,55 @@ type Module interface {
 	Methods() []string
 	Handle(proxyTenants []*tenant.ProxyTenant, proxyRequest request.Request) (selector labels.Selector, err error)
 }
+
+type evaluationContextKey struct{}
+
+// WithEvaluation marks the requests carrying the returned context as evaluated
+// only: modules return the selector they would enforce without sending the
+// request, even as a dry-run, to the API server.
+func WithEvaluation(ctx context.Context) context.Context {
+	return context.WithValue(ctx, evaluationContextKey{}, true)
+}
+
+// IsEvaluation reports whether the request is evaluated only.
+func IsEvaluation(ctx context.Context) bool {
+	evaluation, _ := ctx.Value(evaluationContextKey{}).(bool)
+
+	return evaluation
+}
+
+// ListStrategy is how a cross-namespace list of a namespaced resource is served.
+type ListStrategy string
+
+const (
+	// ListStrategyLabel forwards the list selecting the objects by their
+	// Tenant label.
+	ListStrategyLabel ListStrategy = "label"
+	// ListStrategyFanOut lists each allowed Tenant namespace and merges the
+	// results, objects are returned whether or not they carry the Tenant label.
+	ListStrategyFanOut ListStrategy = "fanout"
+)
+
+// ParseListStrategy validates the name of a ListStrategy.
+func ParseListStrategy(name string) (ListStrategy, error) {
+	switch strategy := ListStrategy(name); strategy {
+	case ListStrategyLabel, ListStrategyFanOut:
+		return strategy, nil
+	default:
+		return "", fmt.Errorf("unknown list strategy %q, expected %q or %q", name, ListStrategyLabel, ListStrategyFanOut)
+	}
+}
+
+// NamespacedModule is implemented by the modules serving a namespaced resource
+// across all the Tenant namespaces. It allows gathering the objects by listing
+// each namespace on its own.
+type NamespacedModule interface {
+	Module
+	// NamespacedPath returns the path listing the resource in the namespace.
+	NamespacedPath(namespace string) string
+	// AllowedNamespaces returns the Tenant namespaces the user can list the
+	// resource in.
+	AllowedNamespaces(proxyTenants []*tenant.ProxyTenant, proxyRequest request.Request) ([]string, error)
+	// ListStrategy returns how the cross-namespace lists are served.
+	ListStrategy() ListStrategy
+}
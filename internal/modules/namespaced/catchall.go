@@ -4,43 +4,64 @@
 package namespaced
 
 import (
+	"context"
 	"fmt"
+	"path"
 
 	capsulelabels "github.com/projectcapsule/capsule/pkg/api/meta"
 	v1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/projectcapsule/capsule-proxy/internal/controllers"
 	"github.com/projectcapsule/capsule-proxy/internal/modules"
+	"github.com/projectcapsule/capsule-proxy/internal/modules/utils"
 	"github.com/projectcapsule/capsule-proxy/internal/request"
 	"github.com/projectcapsule/capsule-proxy/internal/tenant"
 )
 
+// tenantReflector resolves the Tenants reflected RoleBindings grant access to.
+type tenantReflector interface {
+	GetUserTenantNamesForResource(ctx context.Context, username string, groups []string, verb, apiGroup, resource string) ([]string, error)
+	GetTenantNamespaces(ctx context.Context, tenantNames ...string) (map[string][]string, error)
+}
+
 type catchall struct {
 	path                  string
 	group                 string
 	version               string
+	kind                  string
 	resource              string
+	listStrategy          modules.ListStrategy
 	writer                client.Writer
-	roleBindingsReflector *controllers.RoleBindingReflector
+	roleBindingsReflector tenantReflector
 }
 
-func CatchAll(writer client.Writer, roleBindingsReflector *controllers.RoleBindingReflector, path, group, version, resource string) modules.Module {
-	return &catchall{
-		path:                  path,
-		group:                 group,
-		version:               version,
-		resource:              resource,
-		writer:                writer,
-		roleBindingsReflector: roleBindingsReflector,
+func CatchAll(writer client.Writer, roleBindingsReflector *controllers.RoleBindingReflector, listStrategy modules.ListStrategy, path, group, version, kind, resource string) modules.Module {
+	module := &catchall{
+		path:         path,
+		group:        group,
+		version:      version,
+		kind:         kind,
+		resource:     resource,
+		listStrategy: listStrategy,
+		writer:       writer,
 	}
+
+	// A nil reflector must not be stored as a non-nil interface.
+	if roleBindingsReflector != nil {
+		module.roleBindingsReflector = roleBindingsReflector
+	}
+
+	return module
 }
 
 func (l catchall) GroupVersionKind() schema.GroupVersionKind {
-	return schema.GroupVersionKind{}
+	return schema.GroupVersionKind{Group: l.group, Version: l.version, Kind: l.kind}
 }
 
 func (l catchall) GroupKind() schema.GroupKind {
@@ -51,63 +72,178 @@ func (l catchall) Path() string {
 	return l.path
 }
 
-func (l catchall) Methods() []string {
-	return []string{"get"}
+func (l catchall) NamespacedPath(namespace string) string {
+	return path.Join(path.Dir(l.path), "namespaces", namespace, l.resource)
 }
 
-func (l catchall) Handle(proxyTenants []*tenant.ProxyTenant, proxyRequest request.Request) (selector labels.Selector, err error) {
+func (l catchall) ListStrategy() modules.ListStrategy {
+	return l.listStrategy
+}
+
+// AllowedNamespaces authorizes each namespace of the Tenants returned by
+// tenantNamespaces with a SubjectAccessReview, so it selects the same objects
+// as the label selector returned by Handle.
+func (l catchall) AllowedNamespaces(proxyTenants []*tenant.ProxyTenant, proxyRequest request.Request) ([]string, error) {
+	ctx := proxyRequest.GetHTTPRequest().Context()
 	user, groups, _ := proxyRequest.GetUserAndGroups()
 
-	var sourceTenants []string
+	tenantNamespaces, err := l.tenantNamespaces(ctx, user, groups, proxyTenants)
+	if err != nil {
+		return nil, err
+	}
 
-	for _, tnt := range proxyTenants {
-		var allowed bool
-
-		for _, ns := range tnt.Tenant.Status.Namespaces {
-			sar := v1.SubjectAccessReview{}
-			sar.Spec.User = user
-			sar.Spec.Groups = groups
-			sar.Spec.ResourceAttributes = &v1.ResourceAttributes{
-				Namespace: ns,
-				Verb:      "list",
-				Group:     l.group,
-				Version:   l.version,
-				Resource:  l.resource,
-			}
+	allowed, reviewed := sets.New[string](), sets.New[string]()
 
-			if err = l.writer.Create(proxyRequest.GetHTTPRequest().Context(), &sar); err != nil {
-				return nil, fmt.Errorf("unable to check if user can list %s/%s: %w", l.group, l.resource, err)
+	for _, namespaces := range tenantNamespaces {
+		for _, ns := range namespaces {
+			if reviewed.Has(ns) {
+				continue
 			}
 
-			allowed = sar.Status.Allowed
+			reviewed.Insert(ns)
 
-			break
-		}
+			ok, err := l.canList(ctx, user, groups, ns)
+			if err != nil {
+				return nil, err
+			}
 
-		if allowed {
-			sourceTenants = append(sourceTenants, tnt.Tenant.Name)
+			if ok {
+				allowed.Insert(ns)
+			}
 		}
 	}
 
-	if l.roleBindingsReflector != nil {
-		tenantNames, reflectionErr := l.roleBindingsReflector.GetUserTenantNamesForResource(
-			proxyRequest.GetHTTPRequest().Context(), user, groups, "list", l.group, l.resource,
-		)
-		if reflectionErr != nil {
-			return nil, reflectionErr
+	return sets.List(allowed), nil
+}
+
+func (l catchall) Methods() []string {
+	return []string{"get"}
+}
+
+// Handle authorizes each namespace of the Tenants returned by tenantNamespaces
+// with a SubjectAccessReview. Objects are selected by their Tenant label,
+// namespaces of a selected Tenant the user cannot list are excluded with a
+// metadata.namespace field selector, so the result matches the namespaces
+// native RBAC grants.
+func (l catchall) Handle(proxyTenants []*tenant.ProxyTenant, proxyRequest request.Request) (selector labels.Selector, err error) {
+	ctx := proxyRequest.GetHTTPRequest().Context()
+	user, groups, _ := proxyRequest.GetUserAndGroups()
+
+	tenantNamespaces, err := l.tenantNamespaces(ctx, user, groups, proxyTenants)
+	if err != nil {
+		return nil, err
+	}
+
+	sourceTenants := sets.New[string]()
+	deniedNamespaces := make(map[string]sets.Set[string], len(tenantNamespaces))
+
+	for tenantName, namespaces := range tenantNamespaces {
+		denied := sets.New[string]()
+
+		for _, ns := range namespaces {
+			allowed, reviewErr := l.canList(ctx, user, groups, ns)
+			if reviewErr != nil {
+				return nil, reviewErr
+			}
+
+			if !allowed {
+				denied.Insert(ns)
+
+				continue
+			}
+
+			sourceTenants.Insert(tenantName)
 		}
 
-		sourceTenants = append(sourceTenants, tenantNames...)
+		deniedNamespaces[tenantName] = denied
 	}
 
 	var r *labels.Requirement
 
 	switch {
-	case len(sourceTenants) > 0:
-		r, err = labels.NewRequirement(capsulelabels.ManagedByCapsuleLabel, selection.In, sourceTenants)
+	case sourceTenants.Len() > 0:
+		r, err = labels.NewRequirement(capsulelabels.ManagedByCapsuleLabel, selection.In, sets.List(sourceTenants))
+
+		utils.AppendFieldSelector(proxyRequest.GetHTTPRequest(), excludedNamespacesSelector(sourceTenants, deniedNamespaces))
 	default:
 		r, err = labels.NewRequirement("dontexistsignoreme", selection.Exists, []string{})
 	}
 
 	return labels.NewSelector().Add(*r), err
 }
+
+// tenantNamespaces returns the namespaces of the Tenants the user is resolved
+// for, together with the Tenants reflected RoleBindings grant the list verb
+// in, keyed by Tenant name.
+func (l catchall) tenantNamespaces(ctx context.Context, user string, groups []string, proxyTenants []*tenant.ProxyTenant) (map[string][]string, error) {
+	tenantNamespaces := make(map[string][]string, len(proxyTenants))
+
+	for _, tnt := range proxyTenants {
+		tenantNamespaces[tnt.Tenant.Name] = tnt.Tenant.Status.Namespaces
+	}
+
+	if l.roleBindingsReflector == nil {
+		return tenantNamespaces, nil
+	}
+
+	tenantNames, err := l.roleBindingsReflector.GetUserTenantNamesForResource(ctx, user, groups, "list", l.group, l.resource)
+	if err != nil {
+		return nil, err
+	}
+
+	reflected := make([]string, 0, len(tenantNames))
+
+	for _, tenantName := range tenantNames {
+		if _, ok := tenantNamespaces[tenantName]; !ok {
+			reflected = append(reflected, tenantName)
+		}
+	}
+
+	reflectedNamespaces, err := l.roleBindingsReflector.GetTenantNamespaces(ctx, reflected...)
+	if err != nil {
+		return nil, err
+	}
+
+	for tenantName, namespaces := range reflectedNamespaces {
+		tenantNamespaces[tenantName] = namespaces
+	}
+
+	return tenantNamespaces, nil
+}
+
+func (l catchall) canList(ctx context.Context, user string, groups []string, namespace string) (bool, error) {
+	sar := v1.SubjectAccessReview{}
+	sar.Spec.User = user
+	sar.Spec.Groups = groups
+	sar.Spec.ResourceAttributes = &v1.ResourceAttributes{
+		Namespace: namespace,
+		Verb:      "list",
+		Group:     l.group,
+		Version:   l.version,
+		Resource:  l.resource,
+	}
+
+	if err := l.writer.Create(ctx, &sar); err != nil {
+		return false, fmt.Errorf("unable to check if user can list %s/%s: %w", l.group, l.resource, err)
+	}
+
+	return sar.Status.Allowed, nil
+}
+
+// excludedNamespacesSelector returns the field selector excluding the denied
+// namespaces of the selected Tenants. Field selectors only support equality,
+// so each namespace is excluded with its own term.
+func excludedNamespacesSelector(sourceTenants sets.Set[string], deniedNamespaces map[string]sets.Set[string]) fields.Selector {
+	excluded := sets.New[string]()
+
+	for tnt := range sourceTenants {
+		excluded = excluded.Union(deniedNamespaces[tnt])
+	}
+
+	selectors := make([]fields.Selector, 0, excluded.Len())
+	for _, ns := range sets.List(excluded) {
+		selectors = append(selectors, fields.OneTermNotEqualSelector("metadata.namespace", ns))
+	}
+
+	return fields.AndSelectors(selectors...)
+}
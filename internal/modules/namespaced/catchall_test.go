@@ -0,0 +1,250 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package namespaced
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	capsulemeta "github.com/projectcapsule/capsule/pkg/api/meta"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	"github.com/projectcapsule/capsule-proxy/internal/modules"
+	"github.com/projectcapsule/capsule-proxy/internal/reviewcache"
+	"github.com/projectcapsule/capsule-proxy/internal/tenant"
+)
+
+func TestCatchAllFiltersPerNamespace(t *testing.T) {
+	t.Parallel()
+
+	allowedNamespaces := sets.New("solar-dev", "solar-prod", "wind-dev")
+
+	var reviews atomic.Int32
+
+	scheme := runtime.NewScheme()
+	if err := authorizationv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	writer := reviewcache.NewWriter(fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(interceptor.Funcs{
+		Create: func(_ context.Context, _ client.WithWatch, obj client.Object, _ ...client.CreateOption) error {
+			sar, ok := obj.(*authorizationv1.SubjectAccessReview)
+			if !ok {
+				t.Fatalf("unexpected object %T", obj)
+			}
+
+			reviews.Add(1)
+
+			sar.Status.Allowed = sar.Spec.User == "alice" && allowedNamespaces.Has(sar.Spec.ResourceAttributes.Namespace)
+
+			return nil
+		},
+	}).Build(), reviewcache.Options{Size: reviewcache.DefaultSize, PositiveTTL: reviewcache.DefaultPositiveTTL, NegativeTTL: reviewcache.DefaultNegativeTTL})
+
+	proxyTenants := []*tenant.ProxyTenant{
+		proxyTenant("solar", "solar-dev", "solar-prod", "solar-staging"),
+		proxyTenant("wind", "wind-dev"),
+		proxyTenant("oil", "oil-dev"),
+		// The same Tenant can be resolved through several owner kinds.
+		proxyTenant("wind", "wind-dev"),
+	}
+
+	module := CatchAll(writer, nil, modules.ListStrategyLabel, "/api/v1/pods", "", "v1", "Pod", "pods")
+
+	for _, query := range []string{"", "?fieldSelector=status.phase%3DRunning"} {
+		httpRequest := httptest.NewRequest(http.MethodGet, "/api/v1/pods"+query, nil)
+
+		selector, err := module.Handle(proxyTenants, staticRequest{Request: httpRequest})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if got, want := selector.String(), capsulemeta.ManagedByCapsuleLabel+" in (solar,wind)"; got != want {
+			t.Fatalf("selector=%q, want %q", got, want)
+		}
+
+		wantFields := "metadata.namespace!=solar-staging"
+		if query != "" {
+			wantFields = "status.phase=Running," + wantFields
+		}
+
+		if got := httpRequest.URL.Query().Get("fieldSelector"); got != wantFields {
+			t.Fatalf("fieldSelector=%q, want %q", got, wantFields)
+		}
+	}
+
+	//nolint:forcetypeassert
+	namespaces, err := module.(modules.NamespacedModule).AllowedNamespaces(proxyTenants, staticRequest{Request: httptest.NewRequest(http.MethodGet, "/api/v1/pods", nil)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got, want := namespaces, sets.List(allowedNamespaces); !slices.Equal(got, want) {
+		t.Fatalf("AllowedNamespaces()=%v, want %v", got, want)
+	}
+
+	if got := reviews.Load(); got != 5 {
+		t.Fatalf("expected one cached review per namespace, got %d reviews", got)
+	}
+}
+
+func TestCatchAllWithoutAllowedNamespaces(t *testing.T) {
+	t.Parallel()
+
+	scheme := runtime.NewScheme()
+	if err := authorizationv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	writer := fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(interceptor.Funcs{
+		Create: func(context.Context, client.WithWatch, client.Object, ...client.CreateOption) error {
+			return nil
+		},
+	}).Build()
+
+	module := CatchAll(writer, nil, modules.ListStrategyLabel, "/api/v1/pods", "", "v1", "Pod", "pods")
+	httpRequest := httptest.NewRequest(http.MethodGet, "/api/v1/pods", nil)
+
+	selector, err := module.Handle([]*tenant.ProxyTenant{proxyTenant("solar", "solar-dev")}, staticRequest{Request: httpRequest})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := selector.String(); got != "dontexistsignoreme" {
+		t.Fatalf("expected a selector matching nothing, got %q", got)
+	}
+
+	if got := httpRequest.URL.Query().Get("fieldSelector"); got != "" {
+		t.Fatalf("expected no fieldSelector, got %q", got)
+	}
+}
+
+func TestCatchAllReviewsReflectedTenantNamespaces(t *testing.T) {
+	t.Parallel()
+
+	allowedNamespaces := sets.New("solar-dev", "moon-dev")
+
+	scheme := runtime.NewScheme()
+	if err := authorizationv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	writer := fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(interceptor.Funcs{
+		Create: func(_ context.Context, _ client.WithWatch, obj client.Object, _ ...client.CreateOption) error {
+			sar, ok := obj.(*authorizationv1.SubjectAccessReview)
+			if !ok {
+				t.Fatalf("unexpected object %T", obj)
+			}
+
+			sar.Status.Allowed = allowedNamespaces.Has(sar.Spec.ResourceAttributes.Namespace)
+
+			return nil
+		},
+	}).Build()
+
+	//nolint:forcetypeassert
+	module := CatchAll(writer, nil, modules.ListStrategyLabel, "/api/v1/pods", "", "v1", "Pod", "pods").(*catchall)
+	module.roleBindingsReflector = staticReflector{
+		"solar": {"solar-dev"},
+		// A reflected RoleBinding grants access to a single namespace of the Tenant.
+		"moon": {"moon-dev", "moon-prod"},
+	}
+
+	proxyTenants := []*tenant.ProxyTenant{proxyTenant("solar", "solar-dev")}
+	httpRequest := httptest.NewRequest(http.MethodGet, "/api/v1/pods", nil)
+
+	selector, err := module.Handle(proxyTenants, staticRequest{Request: httpRequest})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got, want := selector.String(), capsulemeta.ManagedByCapsuleLabel+" in (moon,solar)"; got != want {
+		t.Fatalf("selector=%q, want %q", got, want)
+	}
+
+	if got, want := httpRequest.URL.Query().Get("fieldSelector"), "metadata.namespace!=moon-prod"; got != want {
+		t.Fatalf("fieldSelector=%q, want %q", got, want)
+	}
+
+	namespaces, err := module.AllowedNamespaces(proxyTenants, staticRequest{Request: httptest.NewRequest(http.MethodGet, "/api/v1/pods", nil)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got, want := namespaces, sets.List(allowedNamespaces); !slices.Equal(got, want) {
+		t.Fatalf("AllowedNamespaces()=%v, want %v", got, want)
+	}
+}
+
+func TestCatchAllNamespacedPath(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		path, group, version, resource string
+		want                           string
+	}{
+		{path: "/api/v1/pods", version: "v1", resource: "pods", want: "/api/v1/namespaces/solar-dev/pods"},
+		{path: "/apis/apps/v1/deployments", group: "apps", version: "v1", resource: "deployments", want: "/apis/apps/v1/namespaces/solar-dev/deployments"},
+	}
+
+	for _, tt := range tests {
+		//nolint:forcetypeassert
+		module := CatchAll(nil, nil, modules.ListStrategyLabel, tt.path, tt.group, tt.version, "", tt.resource).(modules.NamespacedModule)
+
+		if got := module.NamespacedPath("solar-dev"); got != tt.want {
+			t.Fatalf("NamespacedPath()=%q, want %q", got, tt.want)
+		}
+	}
+}
+
+func proxyTenant(name string, namespaces ...string) *tenant.ProxyTenant {
+	return &tenant.ProxyTenant{Tenant: capsulev1beta2.Tenant{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status:     capsulev1beta2.TenantStatus{Namespaces: namespaces},
+	}}
+}
+
+// staticReflector maps the reflected Tenant names to their namespaces.
+type staticReflector map[string][]string
+
+func (s staticReflector) GetUserTenantNamesForResource(context.Context, string, []string, string, string, string) ([]string, error) {
+	names := make([]string, 0, len(s))
+	for name := range s {
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+func (s staticReflector) GetTenantNamespaces(_ context.Context, tenantNames ...string) (map[string][]string, error) {
+	result := map[string][]string{}
+	for _, name := range tenantNames {
+		result[name] = s[name]
+	}
+
+	return result, nil
+}
+
+type staticRequest struct {
+	*http.Request
+}
+
+func (r staticRequest) GetUserAndGroups() (string, []string, error) {
+	return "alice", []string{"developers"}, nil
+}
+
+func (r staticRequest) GetHTTPRequest() *http.Request {
+	return r.Request
+}
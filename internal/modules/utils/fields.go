@@ -0,0 +1,28 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package utils
+
+import (
+	"net/http"
+
+	"k8s.io/apimachinery/pkg/fields"
+)
+
+// AppendFieldSelector ANDs the given field selector with the one of the
+// request, if any, updating the request query in place.
+func AppendFieldSelector(request *http.Request, selector fields.Selector) {
+	if selector == nil || selector.Empty() {
+		return
+	}
+
+	value := selector.String()
+
+	q := request.URL.Query()
+	if current := q.Get("fieldSelector"); len(current) > 0 {
+		value = current + "," + value
+	}
+
+	q.Set("fieldSelector", value)
+	request.URL.RawQuery = q.Encode()
+}
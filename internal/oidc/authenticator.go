@@ -0,0 +1,187 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package oidc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// EmailClaim requires the email_verified claim, as the Kubernetes API server does.
+	EmailClaim = "email"
+
+	httpClientTimeout = 10 * time.Second
+)
+
+// ErrUnknownIssuer is returned for tokens not issued by a configured issuer,
+// including tokens which are not JWTs: they can be handled by the API server.
+var ErrUnknownIssuer = errors.New("token issuer is not configured")
+
+//nolint:gochecknoglobals
+var signingMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// Options configures the local validation of OIDC ID tokens, mirroring the
+// Kubernetes API server --oidc-* flags: the claim mapping must match the one
+// of the API server for RBAC bindings to refer to the same identities.
+type Options struct {
+	IssuerURLs     []string
+	Audiences      []string
+	UsernameClaim  string
+	UsernamePrefix string
+	GroupsClaim    string
+	GroupsPrefix   string
+	CAFile         string
+}
+
+// Authenticator validates JWTs locally against the JWKS of the configured
+// issuers, without sending a TokenReview to the API server.
+type Authenticator struct {
+	options Options
+	issuers map[string]*remoteKeySet
+	now     func() time.Time
+}
+
+func NewAuthenticator(options Options) (*Authenticator, error) {
+	if len(options.IssuerURLs) == 0 {
+		return nil, fmt.Errorf("at least one OIDC issuer URL is required")
+	}
+
+	if len(options.Audiences) == 0 {
+		return nil, fmt.Errorf("at least one OIDC audience is required")
+	}
+
+	if options.UsernameClaim == "" {
+		return nil, fmt.Errorf("the OIDC username claim is required")
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone() //nolint:forcetypeassert
+
+	if options.CAFile != "" {
+		ca, err := os.ReadFile(options.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read OIDC CA file: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate found in OIDC CA file %s", options.CAFile)
+		}
+
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	return newAuthenticator(options, &http.Client{Transport: transport, Timeout: httpClientTimeout}), nil
+}
+
+func newAuthenticator(options Options, client *http.Client) *Authenticator {
+	issuers := make(map[string]*remoteKeySet, len(options.IssuerURLs))
+	for _, issuer := range options.IssuerURLs {
+		issuers[issuer] = newRemoteKeySet(issuer, client)
+	}
+
+	return &Authenticator{
+		options: options,
+		issuers: issuers,
+		now:     time.Now,
+	}
+}
+
+// AuthenticateToken verifies the token signature, issuer, audience and
+// validity, returning the mapped username and groups.
+func (a *Authenticator) AuthenticateToken(ctx context.Context, token string) (string, []string, error) {
+	unverified, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: malformed token: %w", ErrUnknownIssuer, err)
+	}
+
+	issuer, err := unverified.Claims.GetIssuer()
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: malformed issuer claim: %w", ErrUnknownIssuer, err)
+	}
+
+	keySet, ok := a.issuers[issuer]
+	if !ok {
+		return "", nil, ErrUnknownIssuer
+	}
+
+	keyID, _ := unverified.Header["kid"].(string)
+
+	keys, err := keySet.keysFor(ctx, keyID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	parser := jwt.NewParser(
+		jwt.WithValidMethods(signingMethods),
+		jwt.WithIssuer(issuer),
+		jwt.WithAudience(a.options.Audiences...),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(a.now),
+	)
+
+	var verifyErr error
+
+	for _, key := range keys {
+		claims := jwt.MapClaims{}
+
+		if _, verifyErr = parser.ParseWithClaims(token, claims, func(*jwt.Token) (any, error) { return key, nil }); verifyErr == nil {
+			return a.mapClaims(claims)
+		}
+	}
+
+	return "", nil, fmt.Errorf("cannot verify token: %w", verifyErr)
+}
+
+func (a *Authenticator) mapClaims(claims jwt.MapClaims) (string, []string, error) {
+	username, ok := claims[a.options.UsernameClaim].(string)
+	if !ok || username == "" {
+		return "", nil, fmt.Errorf("claim %q is missing or not a string", a.options.UsernameClaim)
+	}
+
+	if a.options.UsernameClaim == EmailClaim {
+		if verified, present := claims["email_verified"]; present && verified != true {
+			return "", nil, fmt.Errorf("email %q is not verified", username)
+		}
+	}
+
+	username = a.options.UsernamePrefix + username
+
+	if a.options.GroupsClaim == "" {
+		return username, nil, nil
+	}
+
+	var groups []string
+
+	switch value := claims[a.options.GroupsClaim].(type) {
+	case nil:
+	case string:
+		groups = []string{value}
+	case []any:
+		for _, group := range value {
+			name, ok := group.(string)
+			if !ok {
+				return "", nil, fmt.Errorf("claim %q contains a non-string value", a.options.GroupsClaim)
+			}
+
+			groups = append(groups, name)
+		}
+	default:
+		return "", nil, fmt.Errorf("claim %q is neither a string nor an array of strings", a.options.GroupsClaim)
+	}
+
+	for i := range groups {
+		groups[i] = a.options.GroupsPrefix + groups[i]
+	}
+
+	return username, groups, nil
+}
@@ -0,0 +1,427 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type testIssuer struct {
+	*httptest.Server
+
+	rsaKey      *rsa.PrivateKey
+	ecKey       *ecdsa.PrivateKey
+	jwksFetches atomic.Int32
+	unavailable atomic.Bool
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issuer := &testIssuer{rsaKey: rsaKey, ecKey: ecKey}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(providerMetadata{Issuer: issuer.URL, JWKSURI: issuer.URL + "/keys"})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, _ *http.Request) {
+		issuer.jwksFetches.Add(1)
+
+		if issuer.unavailable.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string][]jsonWebKey{"keys": {
+			{KeyID: "rsa", Type: "RSA", Use: "sig", N: encode(rsaKey.N), E: encode(big.NewInt(int64(rsaKey.E)))},
+			{KeyID: "ec", Type: "EC", Curve: "P-256", X: encode(ecKey.X), Y: encode(ecKey.Y)},
+			{KeyID: "enc", Type: "RSA", Use: "enc", N: encode(rsaKey.N), E: encode(big.NewInt(int64(rsaKey.E)))},
+		}})
+	})
+
+	issuer.Server = httptest.NewServer(mux)
+	t.Cleanup(issuer.Close)
+
+	return issuer
+}
+
+func (i *testIssuer) sign(t *testing.T, method jwt.SigningMethod, keyID string, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = keyID
+
+	var key any = i.rsaKey
+	if method == jwt.SigningMethodES256 {
+		key = i.ecKey
+	}
+
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed
+}
+
+func encode(value *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(value.Bytes())
+}
+
+//nolint:funlen
+func TestAuthenticateToken(t *testing.T) {
+	t.Parallel()
+
+	issuer := newTestIssuer(t)
+	other := newTestIssuer(t)
+
+	validClaims := func(overrides jwt.MapClaims) jwt.MapClaims {
+		claims := jwt.MapClaims{
+			"iss":                issuer.URL,
+			"aud":                []string{"kubernetes", "other"},
+			"exp":                time.Now().Add(time.Hour).Unix(),
+			"preferred_username": "alice",
+			"email":              "alice@projectcapsule.dev",
+			"email_verified":     true,
+			"groups":             []string{"projectcapsule.dev", "developers"},
+		}
+
+		for k, v := range overrides {
+			if v == nil {
+				delete(claims, k)
+
+				continue
+			}
+
+			claims[k] = v
+		}
+
+		return claims
+	}
+
+	defaultOptions := Options{
+		IssuerURLs:     []string{issuer.URL},
+		Audiences:      []string{"kubernetes"},
+		UsernameClaim:  "preferred_username",
+		UsernamePrefix: "oidc:",
+		GroupsClaim:    "groups",
+		GroupsPrefix:   "oidc:",
+	}
+
+	tests := []struct {
+		name       string
+		options    *Options
+		token      func(t *testing.T) string
+		wantUser   string
+		wantGroups []string
+		wantErr    bool
+		unknownIss bool
+	}{
+		{
+			name:       "RSA signed token",
+			token:      func(t *testing.T) string { return issuer.sign(t, jwt.SigningMethodRS256, "rsa", validClaims(nil)) },
+			wantUser:   "oidc:alice",
+			wantGroups: []string{"oidc:projectcapsule.dev", "oidc:developers"},
+		},
+		{
+			name:       "EC signed token",
+			token:      func(t *testing.T) string { return issuer.sign(t, jwt.SigningMethodES256, "ec", validClaims(nil)) },
+			wantUser:   "oidc:alice",
+			wantGroups: []string{"oidc:projectcapsule.dev", "oidc:developers"},
+		},
+		{
+			name: "single group string",
+			token: func(t *testing.T) string {
+				return issuer.sign(t, jwt.SigningMethodRS256, "rsa", validClaims(jwt.MapClaims{"groups": "admins"}))
+			},
+			wantUser:   "oidc:alice",
+			wantGroups: []string{"oidc:admins"},
+		},
+		{
+			name:     "email claim",
+			options:  &Options{IssuerURLs: []string{issuer.URL}, Audiences: []string{"kubernetes"}, UsernameClaim: EmailClaim},
+			token:    func(t *testing.T) string { return issuer.sign(t, jwt.SigningMethodRS256, "rsa", validClaims(nil)) },
+			wantUser: "alice@projectcapsule.dev",
+		},
+		{
+			name:    "unverified email",
+			options: &Options{IssuerURLs: []string{issuer.URL}, Audiences: []string{"kubernetes"}, UsernameClaim: EmailClaim},
+			token: func(t *testing.T) string {
+				return issuer.sign(t, jwt.SigningMethodRS256, "rsa", validClaims(jwt.MapClaims{"email_verified": false}))
+			},
+			wantErr: true,
+		},
+		{
+			name: "wrong audience",
+			token: func(t *testing.T) string {
+				return issuer.sign(t, jwt.SigningMethodRS256, "rsa", validClaims(jwt.MapClaims{"aud": "dashboard"}))
+			},
+			wantErr: true,
+		},
+		{
+			name: "expired",
+			token: func(t *testing.T) string {
+				return issuer.sign(t, jwt.SigningMethodRS256, "rsa", validClaims(jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()}))
+			},
+			wantErr: true,
+		},
+		{
+			name: "missing expiration",
+			token: func(t *testing.T) string {
+				return issuer.sign(t, jwt.SigningMethodRS256, "rsa", validClaims(jwt.MapClaims{"exp": nil}))
+			},
+			wantErr: true,
+		},
+		{
+			name: "missing username claim",
+			token: func(t *testing.T) string {
+				return issuer.sign(t, jwt.SigningMethodRS256, "rsa", validClaims(jwt.MapClaims{"preferred_username": nil}))
+			},
+			wantErr: true,
+		},
+		{
+			name: "signed by another issuer key",
+			token: func(t *testing.T) string {
+				return other.sign(t, jwt.SigningMethodRS256, "rsa", validClaims(nil))
+			},
+			wantErr: true,
+		},
+		{
+			name:    "encryption key is not used for signatures",
+			token:   func(t *testing.T) string { return issuer.sign(t, jwt.SigningMethodRS256, "enc", validClaims(nil)) },
+			wantErr: true,
+		},
+		{
+			name: "unknown issuer",
+			token: func(t *testing.T) string {
+				return other.sign(t, jwt.SigningMethodRS256, "rsa", validClaims(jwt.MapClaims{"iss": other.URL}))
+			},
+			wantErr:    true,
+			unknownIss: true,
+		},
+		{
+			name:       "opaque token",
+			token:      func(*testing.T) string { return "static-token" },
+			wantErr:    true,
+			unknownIss: true,
+		},
+		{
+			name: "unsigned token",
+			token: func(*testing.T) string {
+				signed, _ := jwt.NewWithClaims(jwt.SigningMethodNone, validClaims(nil)).SignedString(jwt.UnsafeAllowNoneSignatureType)
+
+				return signed
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			options := defaultOptions
+			if tt.options != nil {
+				options = *tt.options
+			}
+
+			authenticator := newAuthenticator(options, issuer.Client())
+
+			username, groups, err := authenticator.AuthenticateToken(context.Background(), tt.token(t))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got user %q groups %v", username, groups)
+				}
+
+				if tt.unknownIss != errors.Is(err, ErrUnknownIssuer) {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if username != tt.wantUser || !reflect.DeepEqual(groups, tt.wantGroups) {
+				t.Fatalf("got user %q groups %v, want %q %v", username, groups, tt.wantUser, tt.wantGroups)
+			}
+		})
+	}
+}
+
+func TestKeySetRefresh(t *testing.T) {
+	t.Parallel()
+
+	issuer := newTestIssuer(t)
+	now := time.Now()
+
+	authenticator := newAuthenticator(Options{
+		IssuerURLs:    []string{issuer.URL},
+		Audiences:     []string{"kubernetes"},
+		UsernameClaim: "sub",
+	}, issuer.Client())
+	keySet := authenticator.issuers[issuer.URL]
+	keySet.now = func() time.Time { return now }
+
+	sign := func(keyID string) string {
+		return issuer.sign(t, jwt.SigningMethodRS256, keyID, jwt.MapClaims{
+			"iss": issuer.URL,
+			"aud": "kubernetes",
+			"sub": "alice",
+			"exp": now.Add(2 * maxKeySetAge).Unix(),
+		})
+	}
+
+	for range 3 {
+		if _, _, err := authenticator.AuthenticateToken(context.Background(), sign("rsa")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := issuer.jwksFetches.Load(); got != 1 {
+		t.Fatalf("expected the JWKS to be cached, got %d fetches", got)
+	}
+
+	// Unknown key IDs trigger a rate-limited refresh.
+	for range 2 {
+		if _, _, err := authenticator.AuthenticateToken(context.Background(), sign("rotated")); err == nil {
+			t.Fatal("expected unknown key ID to be rejected")
+		}
+	}
+
+	if got := issuer.jwksFetches.Load(); got != 1 {
+		t.Fatalf("expected refreshes to be rate-limited, got %d fetches", got)
+	}
+
+	now = now.Add(minRefreshInterval + time.Second)
+
+	if _, _, err := authenticator.AuthenticateToken(context.Background(), sign("rotated")); err == nil {
+		t.Fatal("expected unknown key ID to be rejected")
+	}
+
+	if got := issuer.jwksFetches.Load(); got != 2 {
+		t.Fatalf("expected a refresh for the unknown key ID, got %d fetches", got)
+	}
+
+	now = now.Add(maxKeySetAge + time.Second)
+	authenticator.now = func() time.Time { return now }
+
+	if _, _, err := authenticator.AuthenticateToken(context.Background(), sign("rsa")); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := issuer.jwksFetches.Load(); got != 3 {
+		t.Fatalf("expected stale keys to be refreshed, got %d fetches", got)
+	}
+}
+
+func TestKeySetServesCachedKeysWhenIssuerIsUnavailable(t *testing.T) {
+	t.Parallel()
+
+	issuer := newTestIssuer(t)
+	now := time.Now()
+
+	authenticator := newAuthenticator(Options{
+		IssuerURLs:    []string{issuer.URL},
+		Audiences:     []string{"kubernetes"},
+		UsernameClaim: "sub",
+	}, issuer.Client())
+	authenticator.now = func() time.Time { return now }
+	keySet := authenticator.issuers[issuer.URL]
+	keySet.now = func() time.Time { return now }
+
+	sign := func(keyID string) string {
+		return issuer.sign(t, jwt.SigningMethodRS256, keyID, jwt.MapClaims{
+			"iss": issuer.URL,
+			"aud": "kubernetes",
+			"sub": "alice",
+			"exp": now.Add(2 * maxKeySetAge).Unix(),
+		})
+	}
+
+	if _, _, err := authenticator.AuthenticateToken(context.Background(), sign("rsa")); err != nil {
+		t.Fatal(err)
+	}
+
+	issuer.unavailable.Store(true)
+	now = now.Add(maxKeySetAge + time.Second)
+
+	// Stale keys are still served while the refresh fails, and the failed
+	// refresh is not retried before the backoff.
+	for range 3 {
+		if _, _, err := authenticator.AuthenticateToken(context.Background(), sign("rsa")); err != nil {
+			t.Fatalf("expected the cached keys to be served, got %v", err)
+		}
+	}
+
+	if got := issuer.jwksFetches.Load(); got != 2 {
+		t.Fatalf("expected a single failed refresh, got %d fetches", got)
+	}
+
+	if _, _, err := authenticator.AuthenticateToken(context.Background(), sign("rotated")); err == nil {
+		t.Fatal("expected unknown key ID to be rejected")
+	}
+
+	now = now.Add(minRefreshInterval)
+	issuer.unavailable.Store(false)
+
+	if _, _, err := authenticator.AuthenticateToken(context.Background(), sign("rsa")); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := issuer.jwksFetches.Load(); got != 3 {
+		t.Fatalf("expected a refresh after the backoff, got %d fetches", got)
+	}
+}
+
+func TestKeySetBackoff(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{failures: 1, want: minRefreshInterval},
+		{failures: 2, want: 2 * minRefreshInterval},
+		{failures: 3, want: 4 * minRefreshInterval},
+		{failures: 100, want: maxRefreshBackoff},
+	}
+
+	for _, tt := range tests {
+		keySet := &remoteKeySet{failures: tt.failures}
+
+		if got := keySet.backoff(); got != tt.want {
+			t.Fatalf("backoff() with %d failures = %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,352 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// minRefreshInterval rate-limits JWKS refreshes triggered by unknown key IDs.
+	minRefreshInterval = 10 * time.Second
+	// maxKeySetAge forces a refresh of the JWKS to pick up rotated keys.
+	maxKeySetAge = time.Hour
+	// maxRefreshBackoff bounds the delay between refreshes after failures.
+	maxRefreshBackoff = 5 * time.Minute
+	// refreshTimeout bounds a refresh shared by concurrent requests, it is
+	// not tied to the request which triggered it.
+	refreshTimeout = 30 * time.Second
+	// maxResponseSize bounds discovery and JWKS documents.
+	maxResponseSize = 1 << 20
+)
+
+type providerMetadata struct {
+	Issuer  string `json:"issuer"`
+	JWKSURI string `json:"jwks_uri"`
+}
+
+type jsonWebKey struct {
+	KeyID string `json:"kid"`
+	Type  string `json:"kty"`
+	Use   string `json:"use"`
+	Curve string `json:"crv"`
+	N     string `json:"n"`
+	E     string `json:"e"`
+	X     string `json:"x"`
+	Y     string `json:"y"`
+}
+
+// remoteKeySet resolves the signing keys of an issuer through OIDC discovery,
+// caching them until a token references an unknown key ID or they get stale.
+// Refreshes run outside the lock and are shared by concurrent requests: the
+// cached keys keep being served while the issuer is unreachable, and failed
+// refreshes are retried with an exponential backoff.
+type remoteKeySet struct {
+	issuer    string
+	client    *http.Client
+	now       func() time.Time
+	refreshes singleflight.Group
+
+	mu          sync.Mutex
+	jwksURI     string
+	keys        map[string]crypto.PublicKey
+	unnamedKeys []crypto.PublicKey
+	fetchedAt   time.Time
+	failures    int
+	failedAt    time.Time
+	refreshErr  error
+}
+
+func newRemoteKeySet(issuer string, client *http.Client) *remoteKeySet {
+	return &remoteKeySet{
+		issuer: issuer,
+		client: client,
+		now:    time.Now,
+	}
+}
+
+// keysFor returns the candidate verification keys for the given key ID: an
+// empty key ID matches all the keys of the set.
+func (r *remoteKeySet) keysFor(ctx context.Context, keyID string) ([]crypto.PublicKey, error) {
+	r.mu.Lock()
+	keys := r.lookup(keyID)
+	refresh := r.needsRefresh(len(keys) > 0)
+	refreshErr := r.refreshErr
+	r.mu.Unlock()
+
+	if refresh {
+		refreshErr = r.sharedRefresh(ctx)
+		if refreshErr == nil {
+			r.mu.Lock()
+			keys = r.lookup(keyID)
+			r.mu.Unlock()
+		}
+	}
+
+	if len(keys) > 0 {
+		return keys, nil
+	}
+
+	if refreshErr != nil {
+		return nil, refreshErr
+	}
+
+	return nil, fmt.Errorf("no signing key found for key ID %q", keyID)
+}
+
+// needsRefresh reports whether the key set must be retrieved again, it must
+// be called with the lock held.
+func (r *remoteKeySet) needsRefresh(known bool) bool {
+	now := r.now()
+
+	if r.failures > 0 && now.Sub(r.failedAt) < r.backoff() {
+		return false
+	}
+
+	if r.fetchedAt.IsZero() || now.Sub(r.fetchedAt) > maxKeySetAge {
+		return true
+	}
+
+	// Unknown key ID, the issuer could have rotated its keys.
+	return !known && now.Sub(r.fetchedAt) > minRefreshInterval
+}
+
+// backoff returns the delay before retrying a failed refresh, doubling with
+// each consecutive failure.
+func (r *remoteKeySet) backoff() time.Duration {
+	backoff := minRefreshInterval
+
+	for range r.failures - 1 {
+		if backoff *= 2; backoff >= maxRefreshBackoff {
+			return maxRefreshBackoff
+		}
+	}
+
+	return backoff
+}
+
+// sharedRefresh runs a single refresh for all the concurrent callers, each
+// caller stops waiting when its own context is done.
+func (r *remoteKeySet) sharedRefresh(ctx context.Context) error {
+	result := r.refreshes.DoChan("", func() (any, error) {
+		refreshCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), refreshTimeout)
+		defer cancel()
+
+		err := r.refresh(refreshCtx)
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		if err != nil {
+			r.failures++
+			r.failedAt = r.now()
+			r.refreshErr = err
+
+			return nil, err
+		}
+
+		r.failures, r.refreshErr = 0, nil
+
+		return nil, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case res := <-result:
+		return res.Err
+	}
+}
+
+func (r *remoteKeySet) lookup(keyID string) []crypto.PublicKey {
+	if keyID == "" {
+		keys := make([]crypto.PublicKey, 0, len(r.keys)+len(r.unnamedKeys))
+		for _, key := range r.keys {
+			keys = append(keys, key)
+		}
+
+		return append(keys, r.unnamedKeys...)
+	}
+
+	if key, ok := r.keys[keyID]; ok {
+		return []crypto.PublicKey{key}
+	}
+
+	return nil
+}
+
+// refresh retrieves the key set of the issuer, the lock is only held to read
+// and store the cached values.
+func (r *remoteKeySet) refresh(ctx context.Context) error {
+	r.mu.Lock()
+	jwksURI := r.jwksURI
+	r.mu.Unlock()
+
+	if jwksURI == "" {
+		metadata := providerMetadata{}
+		if err := r.getJSON(ctx, strings.TrimSuffix(r.issuer, "/")+"/.well-known/openid-configuration", &metadata); err != nil {
+			return fmt.Errorf("cannot discover OIDC issuer %s: %w", r.issuer, err)
+		}
+
+		if metadata.Issuer != r.issuer {
+			return fmt.Errorf("OIDC discovery issuer %q does not match the configured issuer %q", metadata.Issuer, r.issuer)
+		}
+
+		if metadata.JWKSURI == "" {
+			return fmt.Errorf("OIDC issuer %s does not advertise a jwks_uri", r.issuer)
+		}
+
+		jwksURI = metadata.JWKSURI
+	}
+
+	keySet := struct {
+		Keys []jsonWebKey `json:"keys"`
+	}{}
+	if err := r.getJSON(ctx, jwksURI, &keySet); err != nil {
+		return fmt.Errorf("cannot retrieve JWKS of OIDC issuer %s: %w", r.issuer, err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(keySet.Keys))
+
+	var unnamedKeys []crypto.PublicKey
+
+	for _, jwk := range keySet.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := jwk.publicKey()
+		if err != nil {
+			// Unsupported key types are skipped, the issuer may publish keys
+			// which are not used to sign ID tokens.
+			continue
+		}
+
+		if jwk.KeyID == "" {
+			unnamedKeys = append(unnamedKeys, key)
+
+			continue
+		}
+
+		keys[jwk.KeyID] = key
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.jwksURI = jwksURI
+	r.keys = keys
+	r.unnamedKeys = unnamedKeys
+	r.fetchedAt = r.now()
+
+	return nil
+}
+
+func (r *remoteKeySet) getJSON(ctx context.Context, url string, into any) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	response, err := r.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d from %s", response.StatusCode, url)
+	}
+
+	return json.NewDecoder(io.LimitReader(response.Body, maxResponseSize)).Decode(into)
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Type {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+
+		if !e.IsInt64() {
+			return nil, fmt.Errorf("invalid RSA exponent")
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+
+		switch k.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		//nolint:staticcheck
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("invalid EC key")
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Curve != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key")
+		}
+
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Type)
+	}
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode key parameter: %w", err)
+	}
+
+	return new(big.Int).SetBytes(decoded), nil
+}
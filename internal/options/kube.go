@@ -16,7 +16,10 @@ import (
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/transport"
 
+	"github.com/projectcapsule/capsule-proxy/internal/audit"
+	"github.com/projectcapsule/capsule-proxy/internal/modules"
 	"github.com/projectcapsule/capsule-proxy/internal/request"
+	"github.com/projectcapsule/capsule-proxy/internal/reviewcache"
 )
 
 type kubeOpts struct {
@@ -32,6 +35,10 @@ type kubeOpts struct {
 	config                     *rest.Config
 	trustedProxyCIDRs          []*net.IPNet
 	xfcc_header                string
+	tokenAuthenticator         request.TokenAuthenticator
+	reviewCache                reviewcache.Options
+	auditSink                  audit.Sink
+	namespacedListStrategy     modules.ListStrategy
 }
 
 func NewKube(
@@ -46,6 +53,10 @@ func NewKube(
 	trustedProxyCIDRStrings []string,
 	xfcc_header string,
 	allowedPaths []string,
+	tokenAuthenticator request.TokenAuthenticator,
+	reviewCache reviewcache.Options,
+	auditSink audit.Sink,
+	namespacedListStrategy modules.ListStrategy,
 ) (ListenerOpts, error) {
 	u, err := url.Parse(config.Host)
 	if err != nil {
@@ -78,6 +89,10 @@ func NewKube(
 		trustedProxyCIDRs:          trustedProxyCIDRs,
 		xfcc_header:                xfcc_header,
 		allowedPaths:               allowedPaths,
+		tokenAuthenticator:         tokenAuthenticator,
+		reviewCache:                reviewCache,
+		auditSink:                  auditSink,
+		namespacedListStrategy:     namespacedListStrategy,
 	}, nil
 }
 
@@ -97,6 +112,22 @@ func (k kubeOpts) XFCCHeader() string {
 	return k.xfcc_header
 }
 
+func (k kubeOpts) TokenAuthenticator() request.TokenAuthenticator {
+	return k.tokenAuthenticator
+}
+
+func (k kubeOpts) ReviewCache() reviewcache.Options {
+	return k.reviewCache
+}
+
+func (k kubeOpts) AuditSink() audit.Sink {
+	return k.auditSink
+}
+
+func (k kubeOpts) NamespacedListStrategy() modules.ListStrategy {
+	return k.namespacedListStrategy
+}
+
 func (k kubeOpts) BearerToken() string {
 	return k.config.BearerToken
 }
@@ -8,6 +8,9 @@ import (
 	"testing"
 
 	"k8s.io/client-go/rest"
+
+	"github.com/projectcapsule/capsule-proxy/internal/modules"
+	"github.com/projectcapsule/capsule-proxy/internal/reviewcache"
 )
 
 func TestNewKubePreservesIgnoredIdentities(t *testing.T) {
@@ -28,6 +31,10 @@ func TestNewKubePreservesIgnoredIdentities(t *testing.T) {
 		nil,
 		"X-Forwarded-Client-Cert",
 		nil,
+		nil,
+		reviewcache.Options{},
+		nil,
+		modules.ListStrategyLabel,
 	)
 	if err != nil {
 		t.Fatal(err)
@@ -9,7 +9,10 @@ import (
 	"net/url"
 	"regexp"
 
+	"github.com/projectcapsule/capsule-proxy/internal/audit"
+	"github.com/projectcapsule/capsule-proxy/internal/modules"
 	"github.com/projectcapsule/capsule-proxy/internal/request"
+	"github.com/projectcapsule/capsule-proxy/internal/reviewcache"
 )
 
 //nolint:interfacebloat
@@ -28,4 +31,8 @@ type ListenerOpts interface {
 	TrustedProxyCIDRs() []*net.IPNet
 	XFCCHeader() string
 	AllowedPaths() []string
+	TokenAuthenticator() request.TokenAuthenticator
+	ReviewCache() reviewcache.Options
+	AuditSink() audit.Sink
+	NamespacedListStrategy() modules.ListStrategy
 }
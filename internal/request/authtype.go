@@ -12,4 +12,5 @@ const (
 	TLSCertificate
 	Anonymous
 	XForwardedClientCert
+	OIDC
 )
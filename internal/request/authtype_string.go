@@ -11,11 +11,13 @@ func _() {
 	_ = x[BearerToken-0]
 	_ = x[TLSCertificate-1]
 	_ = x[Anonymous-2]
+	_ = x[XForwardedClientCert-3]
+	_ = x[OIDC-4]
 }
 
-const _AuthType_name = "BearerTokenTLSCertificateAnonymous"
+const _AuthType_name = "BearerTokenTLSCertificateAnonymousXForwardedClientCertOIDC"
 
-var _AuthType_index = [...]uint8{0, 11, 25, 34}
+var _AuthType_index = [...]uint8{0, 11, 25, 34, 54, 58}
 
 func (i AuthType) String() string {
 	if i < 0 || i >= AuthType(len(_AuthType_index)-1) {
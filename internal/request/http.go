@@ -11,12 +11,15 @@ import (
 	"regexp"
 	"strings"
 
+	"go.opentelemetry.io/otel/attribute"
 	authenticationv1 "k8s.io/api/authentication/v1"
 	authorizationv1 "k8s.io/api/authorization/v1"
 	"k8s.io/apiserver/pkg/authentication/serviceaccount"
 	"k8s.io/apiserver/pkg/authentication/user"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
+	"github.com/projectcapsule/capsule-proxy/internal/audit"
+	"github.com/projectcapsule/capsule-proxy/internal/tracing"
 	"github.com/projectcapsule/capsule-proxy/internal/types"
 )
 
@@ -38,6 +41,7 @@ type http struct {
 	impersonationGroupsRegexp  *regexp.Regexp
 	skipImpersonationReview    bool
 	client                     client.Writer
+	tokenAuthenticator         TokenAuthenticator
 
 	xfcc_header string
 }
@@ -51,6 +55,7 @@ func NewHTTP(
 	impersonationGroupsRegexp *regexp.Regexp,
 	skipImpersonationReview bool,
 	xfcc_header string,
+	tokenAuthenticator TokenAuthenticator,
 ) Request {
 	return &http{
 		Request:                    request,
@@ -61,6 +66,7 @@ func NewHTTP(
 		impersonationGroupsRegexp:  impersonationGroupsRegexp,
 		skipImpersonationReview:    skipImpersonationReview,
 		xfcc_header:                xfcc_header,
+		tokenAuthenticator:         tokenAuthenticator,
 	}
 }
 
@@ -73,6 +79,7 @@ func ResolveUserAndGroups(
 	impersonationGroupsRegexp *regexp.Regexp,
 	skipImpersonationReview bool,
 	xfcc_header string,
+	tokenAuthenticator TokenAuthenticator,
 ) (*h.Request, string, []string, error) {
 	if cachedUsername, cachedGroups, ok := cachedUserAndGroups(request.Context()); ok {
 		return request, cachedUsername, cachedGroups, nil
@@ -87,6 +94,7 @@ func ResolveUserAndGroups(
 		impersonationGroupsRegexp,
 		skipImpersonationReview,
 		xfcc_header,
+		tokenAuthenticator,
 	)
 
 	username, groups, err := proxyRequest.GetUserAndGroups()
@@ -136,7 +144,7 @@ func (h http) GetUserAndGroups() (username string, groups []string, err error) {
 						Groups: groups,
 					},
 				}
-				if err = h.client.Create(h.Context(), ac); err != nil {
+				if err = h.createImpersonationReview(ac); err != nil {
 					return "", nil, err
 				}
 
@@ -165,7 +173,7 @@ func (h http) GetUserAndGroups() (username string, groups []string, err error) {
 					Groups: groups,
 				},
 			}
-			if err = h.client.Create(h.Context(), ac); err != nil {
+			if err = h.createImpersonationReview(ac); err != nil {
 				return "", nil, err
 			}
 
@@ -227,6 +235,21 @@ func (h http) processBearerToken() (username string, groups []string, err error)
 	return tr.Status.User.Username, tr.Status.User.Groups, nil
 }
 
+// processOIDCToken validates the bearer token locally against the configured
+// OIDC issuers, no TokenReview is sent to the API server.
+func (h http) processOIDCToken() (username string, groups []string, err error) {
+	if h.tokenAuthenticator == nil {
+		return "", nil, fmt.Errorf("OIDC authentication is not configured")
+	}
+
+	token, err := h.bearerToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	return h.tokenAuthenticator.AuthenticateToken(h.Context(), token)
+}
+
 // Get the JWT from headers
 // If there is no Authorizaion Bearer, then try finding the Bearer in Websocket Protocols header. This is for browser support.
 func (h http) bearerToken() (string, error) {
@@ -263,34 +286,57 @@ func cachedUserAndGroups(ctx context.Context) (string, []string, bool) {
 	return value.username, value.groups, true
 }
 
-func (h http) authenticate() (string, []string, error) {
+func (h http) authenticate() (username string, groups []string, err error) {
 	for _, authType := range h.authTypes {
-		switch authType {
-		case BearerToken:
-			username, groups, err := h.processBearerToken()
-			if err == nil {
-				return username, groups, nil
-			}
+		_, span := tracing.StartSpan(h.Context(), "authenticate", attribute.String("capsule.auth_type", authType.String()))
 
-		case TLSCertificate:
-			if h.TLS == nil {
-				continue
-			}
+		username, groups, err = h.authenticateWith(authType)
+		span.SetAttributes(attribute.Bool("capsule.authenticated", err == nil))
+		span.End()
+
+		if err == nil {
+			audit.RecordFrom(h.Context()).SetAuthType(authType.String())
 
+			return username, groups, nil
+		}
+	}
+
+	return "", nil, NewErrUnauthorized("no authentication provider available. unauthenticated users not supported")
+}
+
+// createImpersonationReview checks with a SubjectAccessReview whether the
+// user can impersonate the requested user or group.
+func (h http) createImpersonationReview(review *authorizationv1.SubjectAccessReview) (err error) {
+	ctx, span := tracing.StartSpan(h.Context(), "impersonation SubjectAccessReview",
+		attribute.String("capsule.impersonation.resource", review.Spec.ResourceAttributes.Resource),
+	)
+	defer func() {
+		span.SetAttributes(attribute.Bool("capsule.impersonation.allowed", review.Status.Allowed))
+		tracing.EndSpan(span, err)
+	}()
+
+	return h.client.Create(ctx, review)
+}
+
+// authenticateWith resolves the user with the authentication method, an error
+// means the method does not apply to the request.
+func (h http) authenticateWith(authType AuthType) (string, []string, error) {
+	switch authType {
+	case BearerToken:
+		return h.processBearerToken()
+	case TLSCertificate:
+		if h.TLS != nil {
 			if pc := h.TLS.PeerCertificates; len(pc) > 0 {
 				return pc[0].Subject.CommonName, pc[0].Subject.Organization, nil
 			}
-
-		case XForwardedClientCert:
-			username, groups, err := h.processXFCC()
-			if err == nil {
-				return username, groups, nil
-			}
-		case Anonymous:
-			// Explicitly ignored: capsule-proxy does not support unauthenticated users.
-			continue
 		}
+	case XForwardedClientCert:
+		return h.processXFCC()
+	case OIDC:
+		return h.processOIDCToken()
+	case Anonymous:
+		// Explicitly ignored: capsule-proxy does not support unauthenticated users.
 	}
 
-	return "", nil, NewErrUnauthorized("no authentication provider available. unauthenticated users not supported")
+	return "", nil, NewErrUnauthorized("authentication method " + authType.String() + " not applicable")
 }
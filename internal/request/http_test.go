@@ -265,7 +265,7 @@ func Test_http_GetUserAndGroups(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			t.Parallel()
 
-			req := request.NewHTTP(tc.fields.Request, tc.fields.authTypes, tc.fields.usernameClaimField, tc.fields.client, tc.fields.ignoreGroups, tc.fields.ignoreImpersonationRegexp, tc.fields.skipImpersonationReview, "X-Forwarded-Client-Cert")
+			req := request.NewHTTP(tc.fields.Request, tc.fields.authTypes, tc.fields.usernameClaimField, tc.fields.client, tc.fields.ignoreGroups, tc.fields.ignoreImpersonationRegexp, tc.fields.skipImpersonationReview, "X-Forwarded-Client-Cert", nil)
 			gotUsername, gotGroups, err := req.GetUserAndGroups()
 			if (err != nil) != tc.wantErr {
 				t.Errorf("GetUserAndGroups() error = %v, wantErr %v", err, tc.wantErr)
@@ -318,6 +318,7 @@ func Test_http_GetUserAndGroups_UsesCachedUserAndGroups(t *testing.T) {
 		nil,
 		false,
 		"X-Forwarded-Client-Cert",
+		nil,
 	)
 	if err != nil {
 		t.Fatal(err)
@@ -332,6 +333,7 @@ func Test_http_GetUserAndGroups_UsesCachedUserAndGroups(t *testing.T) {
 		nil,
 		false,
 		"X-Forwarded-Client-Cert",
+		nil,
 	)
 
 	username, groups, err := proxyRequest.GetUserAndGroups()
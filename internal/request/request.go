@@ -4,6 +4,7 @@
 package request
 
 import (
+	"context"
 	h "net/http"
 )
 
@@ -11,3 +12,9 @@ type Request interface {
 	GetUserAndGroups() (string, []string, error)
 	GetHTTPRequest() *h.Request
 }
+
+// TokenAuthenticator validates bearer tokens locally, without issuing a
+// TokenReview to the API server.
+type TokenAuthenticator interface {
+	AuthenticateToken(ctx context.Context, token string) (username string, groups []string, err error)
+}
@@ -0,0 +1,131 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package reviewcache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultSize is the default number of review results kept in memory.
+	DefaultSize = 4096
+	// DefaultPositiveTTL bounds how long an authenticated token or an allowed
+	// SubjectAccessReview is reused: revocations and RBAC changes are visible
+	// after at most this delay.
+	DefaultPositiveTTL = 10 * time.Second
+	// DefaultNegativeTTL bounds how long a rejected token or a denied
+	// SubjectAccessReview is reused.
+	DefaultNegativeTTL = 5 * time.Second
+)
+
+// Options configures the review cache. A zero TTL disables caching of the
+// matching results, a non-positive Size disables the cache entirely.
+type Options struct {
+	Size        int
+	PositiveTTL time.Duration
+	NegativeTTL time.Duration
+}
+
+func (o Options) enabled() bool {
+	return o.Size > 0 && (o.PositiveTTL > 0 || o.NegativeTTL > 0)
+}
+
+func (o Options) ttl(positive bool) time.Duration {
+	if positive {
+		return o.PositiveTTL
+	}
+
+	return o.NegativeTTL
+}
+
+// lru is a bounded least-recently-used cache whose entries also expire.
+type lru struct {
+	size int
+	now  func() time.Time
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type lruEntry struct {
+	key     string
+	value   any
+	expires time.Time
+}
+
+func newLRU(size int) *lru {
+	return &lru{
+		size:    size,
+		now:     time.Now,
+		order:   list.New(),
+		entries: map[string]*list.Element{},
+	}
+}
+
+func (c *lru) get(key string) (any, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	//nolint:forcetypeassert
+	entry := element.Value.(*lruEntry)
+
+	if !c.now().Before(entry.expires) {
+		c.remove(element)
+
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+
+	return entry.value, true
+}
+
+func (c *lru) set(key string, value any, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := c.now().Add(ttl)
+
+	if element, ok := c.entries[key]; ok {
+		//nolint:forcetypeassert
+		entry := element.Value.(*lruEntry)
+		entry.value, entry.expires = value, expires
+
+		c.order.MoveToFront(element)
+
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, value: value, expires: expires})
+
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *lru) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
+
+func (c *lru) remove(element *list.Element) {
+	c.order.Remove(element)
+
+	//nolint:forcetypeassert
+	delete(c.entries, element.Value.(*lruEntry).key)
+}
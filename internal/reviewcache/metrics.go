@@ -0,0 +1,47 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package reviewcache
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	kindTokenReview         = "TokenReview"
+	kindSubjectAccessReview = "SubjectAccessReview"
+	resultHit               = "hit"
+	resultMiss              = "miss"
+)
+
+//nolint:gochecknoinits
+func init() {
+	metrics.Registry.MustRegister(cacheRequests, cacheEntries, reviewDuration)
+}
+
+//nolint:gochecknoglobals
+var cacheRequests = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "capsule_proxy_review_cache_requests_total",
+		Help: "Number of TokenReview and SubjectAccessReview lookups in the review cache",
+	},
+	[]string{"kind", "result"},
+)
+
+//nolint:gochecknoglobals
+var cacheEntries = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "capsule_proxy_review_cache_entries",
+		Help: "Number of review results held by the review cache",
+	},
+)
+
+//nolint:gochecknoglobals
+var reviewDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name: "capsule_proxy_review_duration_seconds",
+		Help: "Duration of the TokenReview and SubjectAccessReview calls to the API server",
+	},
+	[]string{"kind"},
+)
@@ -0,0 +1,171 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package reviewcache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Writer caches the outcome of TokenReview and SubjectAccessReview creations,
+// any other object is passed through to the wrapped client.Writer. Wrapping
+// the writer shared by the authentication, impersonation and catch-all code
+// paths collapses their repeated reviews without changing their signatures.
+// The reviews failing upstream are never cached.
+type Writer struct {
+	client.Writer
+
+	options Options
+	cache   *lru
+}
+
+// NewWriter wraps writer with a review cache. The reviews reaching the API
+// server are timed, only them when the options disable caching.
+func NewWriter(writer client.Writer, options Options) client.Writer {
+	writer = &timedWriter{Writer: writer}
+
+	if !options.enabled() {
+		return writer
+	}
+
+	return &Writer{
+		Writer:  writer,
+		options: options,
+		cache:   newLRU(options.Size),
+	}
+}
+
+func (w *Writer) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	// Reviews created with options (e.g. dry-run) are not cached.
+	if len(opts) > 0 {
+		return w.Writer.Create(ctx, obj, opts...)
+	}
+
+	switch review := obj.(type) {
+	case *authenticationv1.TokenReview:
+		return w.createTokenReview(ctx, review)
+	case *authorizationv1.SubjectAccessReview:
+		return w.createSubjectAccessReview(ctx, review)
+	default:
+		return w.Writer.Create(ctx, obj)
+	}
+}
+
+func (w *Writer) createTokenReview(ctx context.Context, review *authenticationv1.TokenReview) error {
+	key := tokenReviewKey(review.Spec)
+
+	if cached, ok := w.cache.get(key); ok {
+		cacheRequests.WithLabelValues(kindTokenReview, resultHit).Inc()
+
+		//nolint:forcetypeassert
+		cached.(*authenticationv1.TokenReviewStatus).DeepCopyInto(&review.Status)
+
+		return nil
+	}
+
+	cacheRequests.WithLabelValues(kindTokenReview, resultMiss).Inc()
+
+	if err := w.Writer.Create(ctx, review); err != nil {
+		return err
+	}
+
+	// A review failing upstream (e.g. a timed out authentication webhook) is
+	// not cached, the token being valid as far as we know.
+	if len(review.Status.Error) > 0 {
+		return nil
+	}
+
+	w.set(key, review.Status.DeepCopy(), w.options.ttl(review.Status.Authenticated))
+
+	return nil
+}
+
+func (w *Writer) createSubjectAccessReview(ctx context.Context, review *authorizationv1.SubjectAccessReview) error {
+	key, err := subjectAccessReviewKey(review.Spec)
+	if err != nil {
+		return w.Writer.Create(ctx, review)
+	}
+
+	if cached, ok := w.cache.get(key); ok {
+		cacheRequests.WithLabelValues(kindSubjectAccessReview, resultHit).Inc()
+
+		//nolint:forcetypeassert
+		cached.(*authorizationv1.SubjectAccessReviewStatus).DeepCopyInto(&review.Status)
+
+		return nil
+	}
+
+	cacheRequests.WithLabelValues(kindSubjectAccessReview, resultMiss).Inc()
+
+	if err = w.Writer.Create(ctx, review); err != nil {
+		return err
+	}
+
+	// Likewise for the reviews an authorizer failed to evaluate.
+	if len(review.Status.EvaluationError) > 0 {
+		return nil
+	}
+
+	w.set(key, review.Status.DeepCopy(), w.options.ttl(review.Status.Allowed))
+
+	return nil
+}
+
+func (w *Writer) set(key string, value any, ttl time.Duration) {
+	w.cache.set(key, value, ttl)
+
+	cacheEntries.Set(float64(w.cache.len()))
+}
+
+// tokenReviewKey never keeps the raw token: entries are keyed by its hash
+// along with the requested audiences.
+func tokenReviewKey(spec authenticationv1.TokenReviewSpec) string {
+	sum := sha256.Sum256([]byte(spec.Token))
+
+	return kindTokenReview + "/" + hex.EncodeToString(sum[:]) + "/" + strings.Join(spec.Audiences, ",")
+}
+
+func subjectAccessReviewKey(spec authorizationv1.SubjectAccessReviewSpec) (string, error) {
+	encoded, err := json.Marshal(spec)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(encoded)
+
+	return kindSubjectAccessReview + "/" + hex.EncodeToString(sum[:]), nil
+}
+
+// timedWriter observes the duration of the reviews created with the wrapped
+// writer.
+type timedWriter struct {
+	client.Writer
+}
+
+func (w *timedWriter) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	var kind string
+
+	switch obj.(type) {
+	case *authenticationv1.TokenReview:
+		kind = kindTokenReview
+	case *authorizationv1.SubjectAccessReview:
+		kind = kindSubjectAccessReview
+	default:
+		return w.Writer.Create(ctx, obj, opts...)
+	}
+
+	timer := prometheus.NewTimer(reviewDuration.WithLabelValues(kind))
+	defer timer.ObserveDuration()
+
+	return w.Writer.Create(ctx, obj, opts...)
+}
@@ -0,0 +1,263 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package reviewcache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	model "github.com/prometheus/client_model/go"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func TestWriterCachesReviews(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		options Options
+		review  func(allowed bool) client.Object
+		// advance moves the clock between the two creations.
+		advance    time.Duration
+		allowed    bool
+		failed     bool
+		wantCreate int
+	}{
+		{
+			name:       "authenticated token is reused",
+			options:    Options{Size: 8, PositiveTTL: time.Minute, NegativeTTL: time.Second},
+			review:     tokenReview,
+			advance:    30 * time.Second,
+			allowed:    true,
+			wantCreate: 1,
+		},
+		{
+			name:       "rejected token uses the negative TTL",
+			options:    Options{Size: 8, PositiveTTL: time.Minute, NegativeTTL: time.Second},
+			review:     tokenReview,
+			advance:    30 * time.Second,
+			allowed:    false,
+			wantCreate: 2,
+		},
+		{
+			name:       "allowed access review is reused",
+			options:    Options{Size: 8, PositiveTTL: time.Minute, NegativeTTL: time.Second},
+			review:     subjectAccessReview,
+			advance:    30 * time.Second,
+			allowed:    true,
+			wantCreate: 1,
+		},
+		{
+			name:       "denied access review is reused within the negative TTL",
+			options:    Options{Size: 8, PositiveTTL: time.Minute, NegativeTTL: time.Minute},
+			review:     subjectAccessReview,
+			advance:    30 * time.Second,
+			allowed:    false,
+			wantCreate: 1,
+		},
+		{
+			name:       "negative results are not cached with a zero negative TTL",
+			options:    Options{Size: 8, PositiveTTL: time.Minute},
+			review:     subjectAccessReview,
+			allowed:    false,
+			wantCreate: 2,
+		},
+		{
+			name:       "failed token review is not cached",
+			options:    Options{Size: 8, PositiveTTL: time.Minute, NegativeTTL: time.Minute},
+			review:     tokenReview,
+			failed:     true,
+			wantCreate: 2,
+		},
+		{
+			name:       "access review failing evaluation is not cached",
+			options:    Options{Size: 8, PositiveTTL: time.Minute, NegativeTTL: time.Minute},
+			review:     subjectAccessReview,
+			failed:     true,
+			wantCreate: 2,
+		},
+		{
+			name:       "disabled cache",
+			options:    Options{PositiveTTL: time.Minute, NegativeTTL: time.Minute},
+			review:     tokenReview,
+			allowed:    true,
+			wantCreate: 2,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var creates int
+
+			writer := NewWriter(fake.NewClientBuilder().WithInterceptorFuncs(interceptor.Funcs{
+				Create: func(_ context.Context, _ client.WithWatch, obj client.Object, _ ...client.CreateOption) error {
+					creates++
+
+					setAllowed(obj, tc.allowed)
+
+					if tc.failed {
+						setFailed(obj)
+					}
+
+					return nil
+				},
+			}).Build(), tc.options)
+
+			now := time.Now()
+			if cached, ok := writer.(*Writer); ok {
+				cached.cache.now = func() time.Time { return now }
+			}
+
+			for range 2 {
+				obj := tc.review(!tc.allowed)
+
+				if err := writer.Create(context.Background(), obj); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				if got := allowed(obj); got != tc.allowed {
+					t.Fatalf("allowed=%t, want %t", got, tc.allowed)
+				}
+
+				now = now.Add(tc.advance)
+			}
+
+			if creates != tc.wantCreate {
+				t.Fatalf("creates=%d, want %d", creates, tc.wantCreate)
+			}
+		})
+	}
+}
+
+func TestWriterKeysReviews(t *testing.T) {
+	t.Parallel()
+
+	var creates int
+
+	writer := NewWriter(fake.NewClientBuilder().WithInterceptorFuncs(interceptor.Funcs{
+		Create: func(_ context.Context, _ client.WithWatch, obj client.Object, _ ...client.CreateOption) error {
+			creates++
+
+			if sar, ok := obj.(*authorizationv1.SubjectAccessReview); ok {
+				sar.Status.Allowed = sar.Spec.ResourceAttributes.Namespace == "solar-dev"
+			}
+
+			return nil
+		},
+	}).Build(), Options{Size: 2, PositiveTTL: time.Minute, NegativeTTL: time.Minute})
+
+	for _, namespace := range []string{"solar-dev", "solar-prod", "solar-dev", "wind-dev", "solar-prod"} {
+		sar := &authorizationv1.SubjectAccessReview{Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:               "alice",
+			ResourceAttributes: &authorizationv1.ResourceAttributes{Verb: "list", Resource: "pods", Namespace: namespace},
+		}}
+
+		if err := writer.Create(context.Background(), sar); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if got, want := sar.Status.Allowed, namespace == "solar-dev"; got != want {
+			t.Fatalf("%s: allowed=%t, want %t", namespace, got, want)
+		}
+	}
+
+	// solar-prod is evicted by wind-dev since the cache holds two entries.
+	if creates != 4 {
+		t.Fatalf("creates=%d, want 4", creates)
+	}
+}
+
+//nolint:paralleltest // The review duration histogram is shared by the tests.
+func TestWriterTimesReviews(t *testing.T) {
+	for _, options := range []Options{{}, {PositiveTTL: time.Minute, NegativeTTL: time.Minute, Size: 1}} {
+		writer := NewWriter(fake.NewClientBuilder().WithInterceptorFuncs(interceptor.Funcs{
+			Create: func(_ context.Context, _ client.WithWatch, obj client.Object, _ ...client.CreateOption) error {
+				setAllowed(obj, true)
+
+				return nil
+			},
+		}).Build(), options)
+
+		before := reviewSamples(t, kindSubjectAccessReview)
+
+		for range 2 {
+			if err := writer.Create(context.Background(), subjectAccessReview(false)); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+
+		// Cached reviews do not reach the API server.
+		want := uint64(2)
+		if options.enabled() {
+			want = 1
+		}
+
+		if got := reviewSamples(t, kindSubjectAccessReview) - before; got != want {
+			t.Fatalf("cache enabled=%t: observed %d reviews, want %d", options.enabled(), got, want)
+		}
+	}
+}
+
+func reviewSamples(t *testing.T, kind string) uint64 {
+	t.Helper()
+
+	metric := &model.Metric{}
+	if err := reviewDuration.WithLabelValues(kind).(prometheus.Histogram).Write(metric); err != nil {
+		t.Fatal(err)
+	}
+
+	return metric.GetHistogram().GetSampleCount()
+}
+
+func tokenReview(bool) client.Object {
+	return &authenticationv1.TokenReview{Spec: authenticationv1.TokenReviewSpec{Token: "token"}}
+}
+
+func subjectAccessReview(allowed bool) client.Object {
+	return &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:               "alice",
+			Groups:             []string{"developers"},
+			ResourceAttributes: &authorizationv1.ResourceAttributes{Verb: "list", Resource: "pods", Namespace: "solar-dev"},
+		},
+		Status: authorizationv1.SubjectAccessReviewStatus{Allowed: allowed},
+	}
+}
+
+func setAllowed(obj client.Object, allowed bool) {
+	switch review := obj.(type) {
+	case *authenticationv1.TokenReview:
+		review.Status.Authenticated = allowed
+	case *authorizationv1.SubjectAccessReview:
+		review.Status.Allowed = allowed
+	}
+}
+
+func setFailed(obj client.Object) {
+	switch review := obj.(type) {
+	case *authenticationv1.TokenReview:
+		review.Status.Error = "webhook timed out"
+	case *authorizationv1.SubjectAccessReview:
+		review.Status.EvaluationError = "webhook timed out"
+	}
+}
+
+func allowed(obj client.Object) bool {
+	switch review := obj.(type) {
+	case *authenticationv1.TokenReview:
+		return review.Status.Authenticated
+	case *authorizationv1.SubjectAccessReview:
+		return review.Status.Allowed
+	default:
+		return false
+	}
+}
@@ -6,7 +6,11 @@ import (
 	"slices"
 	"strings"
 
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/util/sets"
 	k8sdiscovery "k8s.io/client-go/discovery"
 
 	capsuleproxyv1beta1 "github.com/projectcapsule/capsule-proxy/api/v1beta1"
@@ -14,6 +18,14 @@ import (
 
 const wildcard = "*"
 
+var supportedClusterResourceOperations = []capsuleproxyv1beta1.ClusterResourceOperation{
+	capsuleproxyv1beta1.ClusterResourceOperationList,
+	capsuleproxyv1beta1.ClusterResourceOperationGet,
+	capsuleproxyv1beta1.ClusterResourceOperationUpdate,
+	capsuleproxyv1beta1.ClusterResourceOperationPatch,
+	capsuleproxyv1beta1.ClusterResourceOperationDelete,
+}
+
 type DiscoveredClusterResource struct {
 	APIGroup string
 	Resource string
@@ -103,6 +115,10 @@ func ValidateClusterResourceBlock(
 		errs = append(errs, err)
 	}
 
+	if err := ValidateClusterResourceSelector(fieldPath, clusterResource.Selector); err != nil {
+		errs = append(errs, err)
+	}
+
 	if hasWildcard(clusterResource.APIGroups) && len(clusterResource.APIGroups) > 1 {
 		errs = append(errs, fmt.Errorf("%s.apiGroups: wildcard %q must not be combined with explicit API groups", fieldPath, wildcard))
 	}
@@ -115,6 +131,18 @@ func ValidateClusterResourceBlock(
 		return errors.Join(errs...)
 	}
 
+	return ResolveClusterResourceBlock(fieldPath, clusterResource, index)
+}
+
+// ResolveClusterResourceBlock verifies the API groups and resources of a rule
+// resolve to discovered cluster-scoped resources supporting its operations.
+func ResolveClusterResourceBlock(
+	fieldPath string,
+	clusterResource capsuleproxyv1beta1.ClusterResource,
+	index *ClusterResourceDiscoveryIndex,
+) error {
+	var errs []error
+
 	apiGroups := clusterResource.APIGroups
 	if hasWildcard(apiGroups) {
 		apiGroups = index.groups()
@@ -203,24 +231,100 @@ func validateClusterResourceOperations(
 	var errs []error
 
 	for operationIndex, operation := range clusterResource.Operations {
-		if operation == capsuleproxyv1beta1.ClusterResourceOperationList ||
-			operation == capsuleproxyv1beta1.ClusterResourceOperationGet {
+		if slices.Contains(supportedClusterResourceOperations, operation) {
 			continue
 		}
 
 		errs = append(errs, fmt.Errorf(
-			"%s.operations[%d]: unsupported operation %q, only %q and %q are supported",
+			"%s.operations[%d]: unsupported operation %q, only %q are supported",
 			fieldPath,
 			operationIndex,
 			operation,
-			capsuleproxyv1beta1.ClusterResourceOperationList,
-			capsuleproxyv1beta1.ClusterResourceOperationGet,
+			supportedClusterResourceOperations,
 		))
 	}
 
 	return errors.Join(errs...)
 }
 
+// ValidateClusterResourceSelector rejects selectors which can never select a
+// cluster-scoped object. GetClusterScopeRequirements silently skips nil,
+// empty and non-selectable selectors, so such rules would grant nothing.
+func ValidateClusterResourceSelector(fieldPath string, labelSelector *metav1.LabelSelector) error {
+	if labelSelector == nil {
+		return fmt.Errorf("%s.selector: must be specified", fieldPath)
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(labelSelector)
+	if err != nil {
+		return fmt.Errorf("%s.selector: %w", fieldPath, err)
+	}
+
+	requirements, selectable := selector.Requirements()
+	if !selectable || len(requirements) == 0 {
+		return fmt.Errorf("%s.selector: must define at least one requirement, an empty selector never matches", fieldPath)
+	}
+
+	return validateSatisfiableRequirements(fieldPath, requirements)
+}
+
+// validateSatisfiableRequirements detects contradicting requirements on the
+// same label key, e.g. "env in (a)" combined with "env in (b)" or "!env".
+func validateSatisfiableRequirements(fieldPath string, requirements labels.Requirements) error {
+	type keyConstraints struct {
+		exists, notExists bool
+		allowed           sets.Set[string]
+		denied            sets.Set[string]
+	}
+
+	constraints := make(map[string]*keyConstraints)
+	keys := make([]string, 0, len(requirements))
+
+	for _, requirement := range requirements {
+		current, ok := constraints[requirement.Key()]
+		if !ok {
+			current = &keyConstraints{denied: sets.New[string]()}
+			constraints[requirement.Key()] = current
+
+			keys = append(keys, requirement.Key())
+		}
+
+		values := sets.New(requirement.ValuesUnsorted()...)
+
+		switch requirement.Operator() { //nolint:exhaustive
+		case selection.Exists:
+			current.exists = true
+		case selection.DoesNotExist:
+			current.notExists = true
+		case selection.Equals, selection.DoubleEquals, selection.In:
+			current.exists = true
+
+			if current.allowed == nil {
+				current.allowed = values
+			} else {
+				current.allowed = current.allowed.Intersection(values)
+			}
+		case selection.NotEquals, selection.NotIn:
+			current.denied = current.denied.Union(values)
+		}
+	}
+
+	var errs []error
+
+	for _, key := range keys {
+		current := constraints[key]
+
+		switch {
+		case current.exists && current.notExists:
+			errs = append(errs, fmt.Errorf("%s.selector: label %q is required to both exist and not exist, the selector never matches", fieldPath, key))
+		case current.allowed != nil && current.allowed.Difference(current.denied).Len() == 0:
+			errs = append(errs, fmt.Errorf("%s.selector: no value of label %q satisfies all requirements, the selector never matches", fieldPath, key))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
 func hasWildcard(values []string) bool {
 	return slices.Contains(values, wildcard)
 }
@@ -18,6 +18,7 @@ func TestValidateClusterResourceOperationsAndDiscoveryVerbs(t *testing.T) {
 	index := &ClusterResourceDiscoveryIndex{byGroup: map[string]map[string]DiscoveredClusterResource{
 		"storage.k8s.io": {
 			"both":      {Kinds: []string{"Both"}, Verbs: []string{"get", "list"}},
+			"writable":  {Kinds: []string{"Writable"}, Verbs: []string{"get", "list", "update", "patch", "delete"}},
 			"get-only":  {Kinds: []string{"GetOnly"}, Verbs: []string{"get"}},
 			"list-only": {Kinds: []string{"ListOnly"}, Verbs: []string{"list"}},
 		},
@@ -35,8 +36,10 @@ func TestValidateClusterResourceOperationsAndDiscoveryVerbs(t *testing.T) {
 		{name: "legacy list requires get", resource: "list-only", operations: []capsuleproxyv1beta1.ClusterResourceOperation{capsuleproxyv1beta1.ClusterResourceOperationList}, wantError: "does not support Get"},
 		{name: "default requires get", resource: "list-only", wantError: "does not support Get"},
 		{name: "default requires list", resource: "get-only", wantError: "does not support List"},
-		{name: "update is rejected", resource: "both", operations: []capsuleproxyv1beta1.ClusterResourceOperation{"Update"}, wantError: "unsupported operation"},
-		{name: "delete is rejected", resource: "both", operations: []capsuleproxyv1beta1.ClusterResourceOperation{"Delete"}, wantError: "unsupported operation"},
+		{name: "write operations", resource: "writable", operations: []capsuleproxyv1beta1.ClusterResourceOperation{capsuleproxyv1beta1.ClusterResourceOperationUpdate, capsuleproxyv1beta1.ClusterResourceOperationPatch, capsuleproxyv1beta1.ClusterResourceOperationDelete}},
+		{name: "update requires discovered verb", resource: "both", operations: []capsuleproxyv1beta1.ClusterResourceOperation{capsuleproxyv1beta1.ClusterResourceOperationUpdate}, wantError: "does not support Update"},
+		{name: "delete requires discovered verb", resource: "both", operations: []capsuleproxyv1beta1.ClusterResourceOperation{capsuleproxyv1beta1.ClusterResourceOperationDelete}, wantError: "does not support Delete"},
+		{name: "create is rejected", resource: "writable", operations: []capsuleproxyv1beta1.ClusterResourceOperation{"Create"}, wantError: "unsupported operation"},
 		{name: "operation wildcard is rejected", resource: "both", operations: []capsuleproxyv1beta1.ClusterResourceOperation{"*"}, wantError: "unsupported operation"},
 	}
 
@@ -60,3 +63,55 @@ func TestValidateClusterResourceOperationsAndDiscoveryVerbs(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateClusterResourceSelector(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		selector  *metav1.LabelSelector
+		wantError string
+	}{
+		{name: "match labels", selector: &metav1.LabelSelector{MatchLabels: map[string]string{"env": "prod"}}},
+		{name: "overlapping in requirements", selector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{"env": "prod"},
+			MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "env", Operator: metav1.LabelSelectorOpIn, Values: []string{"prod", "dev"}},
+			},
+		}},
+		{name: "nil selector", wantError: "must be specified"},
+		{name: "empty selector", selector: &metav1.LabelSelector{}, wantError: "empty selector never matches"},
+		{name: "invalid operator", selector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+			{Key: "env", Operator: "Matches", Values: []string{"prod"}},
+		}}, wantError: "not a valid label selector operator"},
+		{name: "exists and does not exist", selector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+			{Key: "env", Operator: metav1.LabelSelectorOpExists},
+			{Key: "env", Operator: metav1.LabelSelectorOpDoesNotExist},
+		}}, wantError: "both exist and not exist"},
+		{name: "disjoint in requirements", selector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{"env": "prod"},
+			MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "env", Operator: metav1.LabelSelectorOpIn, Values: []string{"dev"}},
+			},
+		}, wantError: `no value of label "env"`},
+		{name: "in fully excluded by not in", selector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+			{Key: "env", Operator: metav1.LabelSelectorOpIn, Values: []string{"prod"}},
+			{Key: "env", Operator: metav1.LabelSelectorOpNotIn, Values: []string{"prod"}},
+		}}, wantError: `no value of label "env"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := ValidateClusterResourceSelector("spec.rules[0].clusterResources[0]", tt.selector)
+
+			switch {
+			case tt.wantError == "" && err != nil:
+				t.Fatalf("unexpected validation error: %v", err)
+			case tt.wantError != "" && (err == nil || !strings.Contains(err.Error(), tt.wantError)):
+				t.Fatalf("expected error containing %q, got %v", tt.wantError, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package table serves the Table output requested by kubectl with
+// `as=Table;g=meta.k8s.io;v=v1`: it merges the Tables answered by several
+// upstream calls and synthesizes the Tables of the lists built by the proxy,
+// with the printer columns of the resource.
+package table
+
+import (
+	"context"
+	"encoding/json"
+	"mime"
+	"strings"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apiextensions-apiserver/pkg/registry/customresource/tableconvertor"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// Kind is the kind of a Table.
+	Kind = "Table"
+	// Group is the API group serving the Tables.
+	Group = metav1.GroupName
+)
+
+// DefaultColumns are the printer columns of the resources not declaring any,
+// the API server adds the name in front of them.
+func DefaultColumns() []apiextensionsv1.CustomResourceColumnDefinition {
+	return []apiextensionsv1.CustomResourceColumnDefinition{{
+		Name:        "Age",
+		Type:        "date",
+		JSONPath:    ".metadata.creationTimestamp",
+		Description: metav1.ObjectMeta{}.SwaggerDoc()["creationTimestamp"],
+	}}
+}
+
+// CRDColumns returns the printer columns of a version of the CRD.
+func CRDColumns(crd *apiextensionsv1.CustomResourceDefinition, version string) []apiextensionsv1.CustomResourceColumnDefinition {
+	for _, v := range crd.Spec.Versions {
+		if v.Name == version && len(v.AdditionalPrinterColumns) > 0 {
+			return v.AdditionalPrinterColumns
+		}
+	}
+
+	return DefaultColumns()
+}
+
+// Requested returns the version of the Table the Accept header asks for, an
+// empty version means a Table is not requested.
+func Requested(accept string) string {
+	for _, clause := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(clause))
+		if err != nil || mediaType != "application/json" {
+			continue
+		}
+
+		if params["as"] == Kind && params["g"] == Group && len(params["v"]) > 0 {
+			return params["v"]
+		}
+	}
+
+	return ""
+}
+
+// Merge merges the Tables of the same resource. The columns are the union of
+// the columns of the Tables, in order, and the cells of each row are aligned
+// on them.
+func Merge(tables ...*metav1.Table) *metav1.Table {
+	merged := &metav1.Table{Rows: []metav1.TableRow{}}
+
+	positions := make([][]int, len(tables))
+	columns := map[string]int{}
+
+	for i, t := range tables {
+		if len(merged.Kind) == 0 {
+			merged.TypeMeta = t.TypeMeta
+		}
+
+		positions[i] = make([]int, len(t.ColumnDefinitions))
+
+		for j, column := range t.ColumnDefinitions {
+			position, ok := columns[column.Name]
+			if !ok {
+				position = len(merged.ColumnDefinitions)
+				columns[column.Name] = position
+				merged.ColumnDefinitions = append(merged.ColumnDefinitions, column)
+			}
+
+			positions[i][j] = position
+		}
+	}
+
+	for i, t := range tables {
+		for _, row := range t.Rows {
+			// The rows of Tables without headers are kept as is.
+			if len(positions[i]) == 0 {
+				merged.Rows = append(merged.Rows, row)
+
+				continue
+			}
+
+			cells := make([]any, len(merged.ColumnDefinitions))
+			for j, cell := range row.Cells {
+				if j < len(positions[i]) {
+					cells[positions[i][j]] = cell
+				}
+			}
+
+			row.Cells = cells
+			merged.Rows = append(merged.Rows, row)
+		}
+	}
+
+	return merged
+}
+
+// Convert synthesizes the Table of the objects with the printer columns, as
+// the API server does for custom resources. The object of each row is set as
+// requested by includeObject, the metadata by default.
+func Convert(
+	ctx context.Context,
+	version string,
+	objects *unstructured.UnstructuredList,
+	columns []apiextensionsv1.CustomResourceColumnDefinition,
+	includeObject metav1.IncludeObjectPolicy,
+) (*metav1.Table, error) {
+	convertor, err := tableconvertor.New(columns)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := convertor.ConvertToTable(ctx, objects, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	t.APIVersion, t.Kind = schema.GroupVersion{Group: Group, Version: version}.String(), Kind
+
+	if t.Rows == nil {
+		t.Rows = []metav1.TableRow{}
+	}
+
+	for i := range t.Rows {
+		if t.Rows[i].Object.Raw, err = rowObject(t.Rows[i].Object.Object, includeObject); err != nil {
+			return nil, err
+		}
+
+		t.Rows[i].Object.Object = nil
+	}
+
+	return t, nil
+}
+
+func rowObject(obj any, includeObject metav1.IncludeObjectPolicy) ([]byte, error) {
+	object, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, nil
+	}
+
+	switch includeObject {
+	case metav1.IncludeNone:
+		return nil, nil
+	case metav1.IncludeObject:
+		return json.Marshal(object)
+	default:
+		partial := &metav1.PartialObjectMetadata{}
+		partial.SetGroupVersionKind(metav1.SchemeGroupVersion.WithKind("PartialObjectMetadata"))
+
+		metadata, _, err := unstructured.NestedMap(object.Object, "metadata")
+		if err != nil {
+			return nil, err
+		}
+
+		if err = runtime.DefaultUnstructuredConverter.FromUnstructured(metadata, &partial.ObjectMeta); err != nil {
+			return nil, err
+		}
+
+		return json.Marshal(partial)
+	}
+}
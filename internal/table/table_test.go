@@ -0,0 +1,249 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package table
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestRequested(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		accept string
+		want   string
+	}{
+		{
+			name:   "kubectl get",
+			accept: "application/json;as=Table;v=v1;g=meta.k8s.io,application/json;as=Table;v=v1beta1;g=meta.k8s.io,application/json",
+			want:   "v1",
+		},
+		{
+			name:   "spaces around the clauses",
+			accept: "application/json, application/json; as=Table; v=v1beta1; g=meta.k8s.io",
+			want:   "v1beta1",
+		},
+		{
+			name:   "plain JSON",
+			accept: "application/json",
+		},
+		{
+			name:   "other group",
+			accept: "application/json;as=Table;v=v1;g=example.com",
+		},
+		{
+			name:   "protobuf",
+			accept: "application/vnd.kubernetes.protobuf;as=Table;v=v1;g=meta.k8s.io",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := Requested(tt.accept); got != tt.want {
+				t.Fatalf("Requested()=%q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	t.Parallel()
+
+	name := metav1.TableColumnDefinition{Name: "Name", Type: "string"}
+	ready := metav1.TableColumnDefinition{Name: "Ready", Type: "string"}
+	age := metav1.TableColumnDefinition{Name: "Age", Type: "string"}
+
+	merged := Merge(
+		&metav1.Table{
+			TypeMeta:          metav1.TypeMeta{APIVersion: "meta.k8s.io/v1", Kind: Kind},
+			ColumnDefinitions: []metav1.TableColumnDefinition{name, age},
+			Rows:              []metav1.TableRow{{Cells: []any{"a", "1d"}}},
+		},
+		&metav1.Table{
+			TypeMeta:          metav1.TypeMeta{APIVersion: "meta.k8s.io/v1", Kind: Kind},
+			ColumnDefinitions: []metav1.TableColumnDefinition{name, ready, age},
+			Rows:              []metav1.TableRow{{Cells: []any{"b", "1/1", "2d"}}, {Cells: []any{"c", "0/1", "3d"}}},
+		},
+		&metav1.Table{
+			Rows: []metav1.TableRow{{Cells: []any{"d"}}},
+		},
+	)
+
+	if merged.Kind != Kind || merged.APIVersion != "meta.k8s.io/v1" {
+		t.Fatalf("unexpected type %s/%s", merged.APIVersion, merged.Kind)
+	}
+
+	columns := make([]string, 0, len(merged.ColumnDefinitions))
+	for _, column := range merged.ColumnDefinitions {
+		columns = append(columns, column.Name)
+	}
+
+	if got, want := fmt.Sprint(columns), "[Name Age Ready]"; got != want {
+		t.Fatalf("columns=%s, want %s", got, want)
+	}
+
+	cells := make([][]any, 0, len(merged.Rows))
+	for _, row := range merged.Rows {
+		cells = append(cells, row.Cells)
+	}
+
+	if got, want := fmt.Sprint(cells), "[[a 1d <nil>] [b 2d 1/1] [c 3d 0/1] [d]]"; got != want {
+		t.Fatalf("cells=%s, want %s", got, want)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	t.Parallel()
+
+	// The printer columns of the Tenant CRD.
+	crd := &apiextensionsv1.CustomResourceDefinition{
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+				{Name: "v1beta1"},
+				{
+					Name: "v1beta2",
+					AdditionalPrinterColumns: []apiextensionsv1.CustomResourceColumnDefinition{
+						{Name: "State", Type: "string", JSONPath: ".status.state", Description: "The actual state of the Tenant"},
+						{Name: "Namespace count", Type: "integer", JSONPath: ".status.size", Description: "The total amount of Namespaces in use"},
+						{Name: "Age", Type: "date", JSONPath: ".metadata.creationTimestamp", Description: "Age"},
+					},
+				},
+			},
+		},
+	}
+
+	tenants := &unstructured.UnstructuredList{}
+	tenants.SetAPIVersion("capsule.clastix.io/v1beta2")
+	tenants.SetKind("TenantList")
+
+	for _, tnt := range []struct {
+		name  string
+		state string
+		size  int64
+	}{{"solar", "Active", 3}, {"wind", "Cordoned", 1}} {
+		item := unstructured.Unstructured{Object: map[string]any{
+			"apiVersion": "capsule.clastix.io/v1beta2",
+			"kind":       "Tenant",
+			"metadata":   map[string]any{"name": tnt.name, "uid": "uid-" + tnt.name},
+			"spec":       map[string]any{"owners": []any{map[string]any{"kind": "User", "name": "alice"}}},
+			"status":     map[string]any{"state": tnt.state, "size": tnt.size},
+		}}
+
+		tenants.Items = append(tenants.Items, item)
+	}
+
+	tests := []struct {
+		name          string
+		columns       []apiextensionsv1.CustomResourceColumnDefinition
+		includeObject metav1.IncludeObjectPolicy
+		wantColumns   string
+		wantCells     string
+		wantObject    string
+	}{
+		{
+			name:          "printer columns with the metadata",
+			columns:       CRDColumns(crd, "v1beta2"),
+			includeObject: metav1.IncludeMetadata,
+			wantColumns:   "[Name State Namespace count Age]",
+			wantCells:     "[[solar Active 3 <nil>] [wind Cordoned 1 <nil>]]",
+			wantObject:    "PartialObjectMetadata",
+		},
+		{
+			name:          "printer columns with the object",
+			columns:       CRDColumns(crd, "v1beta2"),
+			includeObject: metav1.IncludeObject,
+			wantColumns:   "[Name State Namespace count Age]",
+			wantCells:     "[[solar Active 3 <nil>] [wind Cordoned 1 <nil>]]",
+			wantObject:    "Tenant",
+		},
+		{
+			name:          "default columns without the object",
+			columns:       CRDColumns(crd, "v1beta1"),
+			includeObject: metav1.IncludeNone,
+			wantColumns:   "[Name Age]",
+			wantCells:     "[[solar <nil>] [wind <nil>]]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			converted, err := Convert(context.Background(), "v1", tenants.DeepCopy(), tt.columns, tt.includeObject)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The Table must survive the round trip to the client.
+			raw, err := json.Marshal(converted)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got metav1.Table
+			if err = json.Unmarshal(raw, &got); err != nil {
+				t.Fatal(err)
+			}
+
+			if got.Kind != Kind || got.APIVersion != "meta.k8s.io/v1" {
+				t.Fatalf("unexpected type %s/%s", got.APIVersion, got.Kind)
+			}
+
+			columns := make([]string, 0, len(got.ColumnDefinitions))
+			for _, column := range got.ColumnDefinitions {
+				columns = append(columns, column.Name)
+			}
+
+			if fmt.Sprint(columns) != tt.wantColumns {
+				t.Fatalf("columns=%v, want %s", columns, tt.wantColumns)
+			}
+
+			cells := make([][]any, 0, len(got.Rows))
+
+			for _, row := range got.Rows {
+				cells = append(cells, row.Cells)
+
+				if len(tt.wantObject) == 0 {
+					if len(row.Object.Raw) > 0 {
+						t.Fatalf("unexpected object %s", row.Object.Raw)
+					}
+
+					continue
+				}
+
+				var object metav1.PartialObjectMetadata
+				if err = json.Unmarshal(row.Object.Raw, &object); err != nil {
+					t.Fatal(err)
+				}
+
+				if object.Kind != tt.wantObject || string(object.UID) != "uid-"+object.Name {
+					t.Fatalf("unexpected object %s", row.Object.Raw)
+				}
+			}
+
+			if fmt.Sprint(cells) != tt.wantCells {
+				t.Fatalf("cells=%v, want %s", cells, tt.wantCells)
+			}
+		})
+	}
+
+	empty, err := Convert(context.Background(), "v1", &unstructured.UnstructuredList{}, DefaultColumns(), metav1.IncludeMetadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if raw, _ := json.Marshal(empty.Rows); string(raw) != "[]" {
+		t.Fatalf("rows=%s, want []", raw)
+	}
+}
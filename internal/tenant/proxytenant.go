@@ -13,10 +13,31 @@ import (
 	"github.com/projectcapsule/capsule-proxy/api/v1beta1"
 )
 
+// Source tells how a ProxyTenant is granted to the user.
+type Source string
+
+const (
+	// SourceTenantOwner grants the Tenants the user is an owner of.
+	SourceTenantOwner Source = "TenantOwner"
+	// SourceProxySetting grants the Tenant of a ProxySetting the user is a
+	// subject of.
+	SourceProxySetting Source = "ProxySetting"
+	// SourceGlobalProxySettings grants the cluster resources of the
+	// GlobalProxySettings the user is a subject of.
+	SourceGlobalProxySettings Source = "GlobalProxySettings"
+	// SourceRoleBindingReflection grants the Tenant namespaces the user is
+	// bound to by a reflected RoleBinding.
+	SourceRoleBindingReflection Source = "RoleBindingReflection"
+)
+
 type ProxyTenant struct {
 	Tenant           capsulev1beta2.Tenant
 	ProxySetting     map[capsulerbac.ProxyServiceKind]*Operations
 	ClusterResources []v1beta1.ClusterResource
+	// Source tells how the ProxyTenant is granted, SourceName names the
+	// ProxySetting or the GlobalProxySettings granting it.
+	Source     Source
+	SourceName string
 }
 
 func defaultProxySettings() map[capsulerbac.ProxyServiceKind]*Operations {
@@ -0,0 +1,131 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package tracing traces the requests served by capsule-proxy with
+// OpenTelemetry: the spans are exported over OTLP and the W3C trace context
+// of the incoming requests is propagated to the API server.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// TracerName is the instrumentation scope of the capsule-proxy spans.
+	TracerName = "github.com/projectcapsule/capsule-proxy"
+	// DefaultSampleRatio is the ratio of the traces started by capsule-proxy
+	// which are sampled, the sampling decision of the caller is kept.
+	DefaultSampleRatio = 1.0
+
+	serviceName     = "capsule-proxy"
+	shutdownTimeout = 5 * time.Second
+)
+
+// Options configures the export of the spans.
+type Options struct {
+	// Endpoint is the OTLP gRPC collector address, spans are not exported when
+	// empty.
+	Endpoint string
+	// Insecure disables TLS towards the collector.
+	Insecure bool
+	// SampleRatio is the ratio of the root spans sampled.
+	SampleRatio float64
+}
+
+func (o Options) enabled() bool {
+	return len(o.Endpoint) > 0
+}
+
+// Provider exports the spans of capsule-proxy, it flushes the pending spans
+// once the manager stops.
+type Provider struct {
+	provider *sdktrace.TracerProvider
+}
+
+// Setup installs the W3C trace context propagator, so the trace context of the
+// incoming requests reaches the API server even when spans are not exported,
+// and the tracer provider exporting the spans when the options enable it. The
+// returned Provider is nil when tracing is disabled.
+func Setup(ctx context.Context, options Options) (*Provider, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	if !options.enabled() {
+		return nil, nil //nolint:nilnil
+	}
+
+	exporterOptions := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(options.Endpoint)}
+	if options.Insecure {
+		exporterOptions = append(exporterOptions, otlptracegrpc.WithInsecure())
+	}
+
+	exporter, err := otlptracegrpc.New(ctx, exporterOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create OTLP exporter: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName(serviceName)))
+	if err != nil {
+		return nil, fmt.Errorf("cannot create tracing resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(Sampler(options.SampleRatio)),
+	)
+	otel.SetTracerProvider(provider)
+
+	return &Provider{provider: provider}, nil
+}
+
+// Sampler samples the ratio of the root spans, and the spans whose parent
+// was sampled.
+func Sampler(ratio float64) sdktrace.Sampler {
+	return sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))
+}
+
+// Start waits for the manager to stop, then flushes the pending spans.
+func (p *Provider) Start(ctx context.Context) error {
+	<-ctx.Done()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := p.provider.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("cannot flush spans: %w", err)
+	}
+
+	return nil
+}
+
+// NeedLeaderElection exports the spans of every replica.
+func (p *Provider) NeedLeaderElection() bool {
+	return false
+}
+
+// StartSpan starts a span of capsule-proxy, child of the span of ctx.
+func StartSpan(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(TracerName).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// EndSpan ends the span, recording the error when not nil.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
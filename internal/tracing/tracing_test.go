@@ -0,0 +1,197 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	callerTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	callerSpanID  = "00f067aa0ba902b7"
+)
+
+// recordSpans installs a tracer provider recording the spans in memory. The
+// provider is global, the tests using it cannot run in parallel.
+func recordSpans(t *testing.T, ratio float64) *tracetest.InMemoryExporter {
+	t.Helper()
+
+	if _, err := Setup(context.Background(), Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter), sdktrace.WithSampler(Sampler(ratio)))
+
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+		_ = provider.Shutdown(context.Background())
+	})
+
+	return exporter
+}
+
+func spanNamed(t *testing.T, spans tracetest.SpanStubs, name string) tracetest.SpanStub {
+	t.Helper()
+
+	for _, span := range spans {
+		if span.Name == name {
+			return span
+		}
+	}
+
+	t.Fatalf("span %q not recorded, got %d spans", name, len(spans))
+
+	return tracetest.SpanStub{}
+}
+
+//nolint:paralleltest
+func TestTraceContextPropagation(t *testing.T) {
+	testCases := []struct {
+		name        string
+		traceparent string
+		ratio       float64
+		wantSpans   int
+	}{
+		{
+			name:        "sampled caller",
+			traceparent: "00-" + callerTraceID + "-" + callerSpanID + "-01",
+			wantSpans:   4,
+		},
+		{
+			name:      "root trace",
+			ratio:     1,
+			wantSpans: 4,
+		},
+		{
+			name:        "unsampled caller",
+			traceparent: "00-" + callerTraceID + "-" + callerSpanID + "-00",
+			ratio:       1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			exporter := recordSpans(t, tc.ratio)
+
+			var upstreamTraceparent string
+
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				upstreamTraceparent = r.Header.Get("traceparent")
+
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer upstream.Close()
+
+			upstreamURL, _ := url.Parse(upstream.URL)
+
+			proxy := httputil.NewSingleHostReverseProxy(upstreamURL)
+			proxy.Transport = NewTransport(http.DefaultTransport)
+			proxy.ModifyResponse = func(response *http.Response) error {
+				_, span := StartSpan(response.Request.Context(), "modify response")
+				span.End()
+
+				return nil
+			}
+
+			router := mux.NewRouter()
+			router.Use(Middleware)
+			router.PathPrefix("/api/v1/pods").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, span := StartSpan(r.Context(), "module")
+				EndSpan(span, nil)
+
+				proxy.ServeHTTP(w, r)
+			})
+
+			request := httptest.NewRequest(http.MethodGet, "/api/v1/pods", nil)
+			if len(tc.traceparent) > 0 {
+				request.Header.Set("traceparent", tc.traceparent)
+			}
+
+			router.ServeHTTP(httptest.NewRecorder(), request)
+
+			upstreamContext := otel.GetTextMapPropagator().Extract(context.Background(), propagation.MapCarrier{"traceparent": upstreamTraceparent})
+			upstreamSpan := trace.SpanContextFromContext(upstreamContext)
+
+			if !upstreamSpan.IsValid() {
+				t.Fatalf("trace context not propagated upstream, got traceparent %q", upstreamTraceparent)
+			}
+
+			if len(tc.traceparent) > 0 && upstreamSpan.TraceID().String() != callerTraceID {
+				t.Fatalf("trace ID %s propagated upstream, want %s", upstreamSpan.TraceID(), callerTraceID)
+			}
+
+			spans := exporter.GetSpans()
+			if len(spans) != tc.wantSpans {
+				t.Fatalf("recorded %d spans, want %d", len(spans), tc.wantSpans)
+			}
+
+			if tc.wantSpans == 0 {
+				return
+			}
+
+			server := spanNamed(t, spans, "GET /api/v1/pods")
+			client := spanNamed(t, spans, "HTTP GET")
+
+			if len(tc.traceparent) > 0 && server.Parent.SpanID().String() != callerSpanID {
+				t.Errorf("server span parent %s, want the caller span %s", server.Parent.SpanID(), callerSpanID)
+			}
+
+			for _, name := range []string{"module", "HTTP GET", "modify response"} {
+				if span := spanNamed(t, spans, name); span.Parent.SpanID() != server.SpanContext.SpanID() {
+					t.Errorf("span %q is not a child of the server span", name)
+				}
+			}
+
+			if upstreamSpan.SpanID() != client.SpanContext.SpanID() {
+				t.Errorf("upstream parent %s, want the round trip span %s", upstreamSpan.SpanID(), client.SpanContext.SpanID())
+			}
+
+			for _, attr := range server.Attributes {
+				if attr.Key == semconv.HTTPResponseStatusCodeKey && attr.Value.AsInt64() != http.StatusOK {
+					t.Errorf("server span status code %d, want %d", attr.Value.AsInt64(), http.StatusOK)
+				}
+			}
+		})
+	}
+}
+
+//nolint:paralleltest
+func TestEndSpan(t *testing.T) {
+	exporter := recordSpans(t, 1)
+
+	_, span := StartSpan(context.Background(), "failing")
+	EndSpan(span, errors.New("boom"))
+
+	_, span = StartSpan(context.Background(), "succeeding")
+	EndSpan(span, nil)
+
+	spans := exporter.GetSpans()
+
+	if failing := spanNamed(t, spans, "failing"); failing.Status.Code != codes.Error || failing.Status.Description != "boom" || len(failing.Events) != 1 {
+		t.Errorf("unexpected failing span status %+v and events %v", failing.Status, failing.Events)
+	}
+
+	if succeeding := spanNamed(t, spans, "succeeding"); succeeding.Status.Code != codes.Unset {
+		t.Errorf("unexpected succeeding span status %+v", succeeding.Status)
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package labeler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// backfillPageSize bounds the objects listed at once per resource.
+const backfillPageSize = 500
+
+// Backfill labels the objects existing in the Tenant namespaces before the
+// labeler webhook was enabled. It runs once, when the manager starts.
+type Backfill struct {
+	reader    client.Reader
+	writer    client.Writer
+	discovery discovery.DiscoveryInterface
+	log       logr.Logger
+}
+
+func NewBackfill(reader client.Reader, writer client.Writer, discoveryClient discovery.DiscoveryInterface, log logr.Logger) *Backfill {
+	return &Backfill{
+		reader:    reader,
+		writer:    writer,
+		discovery: discoveryClient,
+		log:       log,
+	}
+}
+
+// NeedLeaderElection labels the objects from the leader only.
+func (b *Backfill) NeedLeaderElection() bool {
+	return true
+}
+
+// Start labels the objects of every Tenant namespace. A failure on a resource
+// or a namespace is logged and skipped: the webhook labels the objects on
+// their next update anyway.
+func (b *Backfill) Start(ctx context.Context) error {
+	resources, err := b.resources()
+	if err != nil {
+		return err
+	}
+
+	tenants := &capsulev1beta2.TenantList{}
+	if err = b.reader.List(ctx, tenants); err != nil {
+		return fmt.Errorf("cannot list Tenants: %w", err)
+	}
+
+	labeled := 0
+
+	for _, tnt := range tenants.Items {
+		for _, namespace := range tnt.Status.Namespaces {
+			for _, gvk := range resources {
+				count, labelErr := b.label(ctx, gvk, namespace, TenantLabels(tnt.Name))
+				if labelErr != nil {
+					if errors.Is(labelErr, context.Canceled) {
+						return nil
+					}
+
+					b.log.Error(labelErr, "cannot label objects", "namespace", namespace, "kind", gvk.String())
+				}
+
+				labeled += count
+			}
+		}
+	}
+
+	b.log.Info("labeled the objects of the Tenant namespaces", "tenants", len(tenants.Items), "objects", labeled)
+
+	return nil
+}
+
+// resources returns the kinds of the namespaced resources that can be listed
+// and patched. The groups failing discovery are skipped.
+func (b *Backfill) resources() ([]schema.GroupVersionKind, error) {
+	lists, err := discovery.ServerPreferredNamespacedResources(b.discovery)
+	if err != nil {
+		if !discovery.IsGroupDiscoveryFailedError(err) {
+			return nil, fmt.Errorf("cannot discover namespaced resources: %w", err)
+		}
+
+		b.log.Error(err, "skipping the API groups failing discovery")
+	}
+
+	lists = discovery.FilteredBy(discovery.SupportsAllVerbs{Verbs: []string{"list", "patch"}}, lists)
+
+	var kinds []schema.GroupVersionKind
+
+	for _, list := range lists {
+		gv, parseErr := schema.ParseGroupVersion(list.GroupVersion)
+		if parseErr != nil {
+			continue
+		}
+
+		for _, resource := range list.APIResources {
+			kinds = append(kinds, gv.WithKind(resource.Kind))
+		}
+	}
+
+	return kinds, nil
+}
+
+// label patches the objects of the kind in the namespace missing the labels,
+// returning how many were patched.
+func (b *Backfill) label(ctx context.Context, gvk schema.GroupVersionKind, namespace string, labels map[string]string) (int, error) {
+	patch, err := json.Marshal(map[string]any{"metadata": map[string]any{"labels": labels}})
+	if err != nil {
+		return 0, err
+	}
+
+	labeled := 0
+	continueToken := ""
+
+	for {
+		list := &metav1.PartialObjectMetadataList{}
+		list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+
+		if err = b.reader.List(ctx, list, client.InNamespace(namespace), client.Limit(backfillPageSize), client.Continue(continueToken)); err != nil {
+			return labeled, err
+		}
+
+		for i := range list.Items {
+			object := &list.Items[i]
+			if hasLabels(object.Labels, labels) {
+				continue
+			}
+
+			object.SetGroupVersionKind(gvk)
+
+			if err = b.writer.Patch(ctx, object, client.RawPatch(types.MergePatchType, patch)); client.IgnoreNotFound(err) != nil {
+				return labeled, fmt.Errorf("cannot label %s: %w", object.Name, err)
+			}
+
+			labeled++
+		}
+
+		if continueToken = list.Continue; len(continueToken) == 0 {
+			return labeled, nil
+		}
+	}
+}
+
+func hasLabels(current, labels map[string]string) bool {
+	for key, value := range labels {
+		if current[key] != value {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,136 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package labeler stamps the Tenant labels on the namespaced objects of the
+// Tenant namespaces, the cross-namespace lists of the proxy selecting the
+// objects by them.
+package labeler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/go-logr/logr"
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	capsulemeta "github.com/projectcapsule/capsule/pkg/api/meta"
+	admissionv1 "k8s.io/api/admission/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/projectcapsule/capsule-proxy/internal/indexer"
+)
+
+// TenantLabels returns the labels binding an object to its Tenant: the
+// ManagedByCapsuleLabel is the one the namespaced catch-all module selects
+// the objects of a cross-namespace list with.
+func TenantLabels(tenant string) map[string]string {
+	return map[string]string{
+		capsulemeta.TenantLabel:           tenant,
+		capsulemeta.ManagedByCapsuleLabel: tenant,
+	}
+}
+
+// TenantOf returns the Tenant owning the namespace, nil when the namespace is
+// not part of a Tenant.
+func TenantOf(ctx context.Context, reader client.Reader, namespace string) (*capsulev1beta2.Tenant, error) {
+	tenants := &capsulev1beta2.TenantList{}
+	if err := reader.List(ctx, tenants, client.MatchingFields{indexer.TenantNamespacesField: namespace}); err != nil {
+		return nil, fmt.Errorf("cannot list the Tenants of the namespace %s: %w", namespace, err)
+	}
+
+	if len(tenants.Items) == 0 {
+		return nil, nil
+	}
+
+	return &tenants.Items[0], nil
+}
+
+// Labeler mutates the namespaced objects created or updated in a Tenant
+// namespace, adding the Tenant labels they miss or restoring the ones
+// changed.
+type Labeler struct {
+	reader client.Reader
+	log    logr.Logger
+}
+
+func NewLabeler(reader client.Reader, log logr.Logger) *Labeler {
+	return &Labeler{
+		reader: reader,
+		log:    log,
+	}
+}
+
+func (l *Labeler) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if req.Operation != admissionv1.Create && req.Operation != admissionv1.Update {
+		return admission.Allowed("")
+	}
+
+	if len(req.Namespace) == 0 || len(req.SubResource) > 0 {
+		return admission.Allowed("")
+	}
+
+	tenant, err := TenantOf(ctx, l.reader, req.Namespace)
+	if err != nil {
+		l.log.Error(err, "cannot resolve the Tenant", "namespace", req.Namespace)
+
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	if tenant == nil {
+		return admission.Allowed("")
+	}
+
+	labeled, changed, err := stampLabels(req.Object.Raw, TenantLabels(tenant.Name))
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	if !changed {
+		return admission.Allowed("")
+	}
+
+	return admission.PatchResponseFromRaw(req.Object.Raw, labeled)
+}
+
+// stampLabels sets the labels on the JSON object, returning whether any of
+// them was missing or different.
+func stampLabels(raw []byte, labels map[string]string) ([]byte, bool, error) {
+	object := map[string]any{}
+	if err := json.Unmarshal(raw, &object); err != nil {
+		return nil, false, fmt.Errorf("cannot decode the object: %w", err)
+	}
+
+	metadata, ok := object["metadata"].(map[string]any)
+	if !ok {
+		metadata = map[string]any{}
+		object["metadata"] = metadata
+	}
+
+	current, ok := metadata["labels"].(map[string]any)
+	if !ok {
+		current = map[string]any{}
+		metadata["labels"] = current
+	}
+
+	changed := false
+
+	for key, value := range labels {
+		if current[key] != value {
+			current[key] = value
+			changed = true
+		}
+	}
+
+	if !changed {
+		return raw, false, nil
+	}
+
+	labeled, err := json.Marshal(object)
+	if err != nil {
+		return nil, false, fmt.Errorf("cannot encode the object: %w", err)
+	}
+
+	return labeled, true, nil
+}
@@ -0,0 +1,177 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package labeler
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/go-logr/logr"
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	capsulemeta "github.com/projectcapsule/capsule/pkg/api/meta"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	discoveryfake "k8s.io/client-go/discovery/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/projectcapsule/capsule-proxy/internal/indexer"
+)
+
+func newTestClient(t *testing.T, objects ...client.Object) client.Client {
+	t.Helper()
+
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := capsulev1beta2.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	solar := &capsulev1beta2.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "solar"}}
+	solar.Status.Namespaces = []string{"solar-dev"}
+
+	return fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(append(objects, solar)...).
+		WithIndex(&capsulev1beta2.Tenant{}, indexer.TenantNamespacesField, func(obj client.Object) []string {
+			//nolint:forcetypeassert
+			return obj.(*capsulev1beta2.Tenant).Status.Namespaces
+		}).
+		Build()
+}
+
+//nolint:funlen
+func TestLabelerHandle(t *testing.T) {
+	t.Parallel()
+
+	labeler := NewLabeler(newTestClient(t), logr.Discard())
+
+	tests := []struct {
+		name      string
+		operation admissionv1.Operation
+		namespace string
+		labels    map[string]string
+		wantPatch bool
+	}{
+		{
+			name:      "missing labels",
+			operation: admissionv1.Create,
+			namespace: "solar-dev",
+			wantPatch: true,
+		},
+		{
+			name:      "changed tenant label",
+			operation: admissionv1.Update,
+			namespace: "solar-dev",
+			labels:    map[string]string{capsulemeta.TenantLabel: "wind", capsulemeta.ManagedByCapsuleLabel: "solar"},
+			wantPatch: true,
+		},
+		{
+			name:      "already labeled",
+			operation: admissionv1.Update,
+			namespace: "solar-dev",
+			labels:    TenantLabels("solar"),
+		},
+		{
+			name:      "namespace outside of Tenants",
+			operation: admissionv1.Create,
+			namespace: "kube-system",
+		},
+		{
+			name:      "deletion",
+			operation: admissionv1.Delete,
+			namespace: "solar-dev",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			raw, err := json.Marshal(&corev1.ConfigMap{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+				ObjectMeta: metav1.ObjectMeta{Name: "settings", Namespace: tt.namespace, Labels: tt.labels},
+				Data:       map[string]string{"key": "value"},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			response := labeler.Handle(context.Background(), admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: tt.operation,
+				Namespace: tt.namespace,
+				Object:    runtime.RawExtension{Raw: raw},
+			}})
+
+			if !response.Allowed {
+				t.Fatalf("expected request to be allowed, got %v", response.Result)
+			}
+
+			if (len(response.Patches) > 0) != tt.wantPatch {
+				t.Fatalf("got patches %v, expected patch %t", response.Patches, tt.wantPatch)
+			}
+
+			labeled, _, err := stampLabels(raw, TenantLabels("solar"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			object := &corev1.ConfigMap{}
+			if err = json.Unmarshal(labeled, object); err != nil {
+				t.Fatal(err)
+			}
+
+			if !hasLabels(object.Labels, TenantLabels("solar")) || object.Data["key"] != "value" {
+				t.Errorf("unexpected labeled object %+v", object)
+			}
+		})
+	}
+}
+
+func TestBackfillStart(t *testing.T) {
+	t.Parallel()
+
+	unlabeled := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "unlabeled", Namespace: "solar-dev", Labels: map[string]string{"app": "web"}}}
+	outside := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "outside", Namespace: "kube-system"}}
+	c := newTestClient(t, unlabeled, outside)
+
+	discoveryClient := &discoveryfake.FakeDiscovery{Fake: &clienttesting.Fake{}}
+	discoveryClient.Resources = []*metav1.APIResourceList{{
+		GroupVersion: "v1",
+		APIResources: []metav1.APIResource{
+			{Name: "configmaps", Kind: "ConfigMap", Namespaced: true, Verbs: []string{"get", "list", "patch"}},
+			{Name: "nodes", Kind: "Node", Verbs: []string{"get", "list", "patch"}},
+		},
+	}}
+
+	if err := NewBackfill(c, c, discoveryClient, logr.Discard()).Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[client.ObjectKey]bool{
+		client.ObjectKeyFromObject(unlabeled): true,
+		client.ObjectKeyFromObject(outside):   false,
+	} {
+		got := &corev1.ConfigMap{}
+		if err := c.Get(context.Background(), name, got); err != nil {
+			t.Fatal(err)
+		}
+
+		if hasLabels(got.Labels, TenantLabels("solar")) != want {
+			t.Errorf("%s: got labels %v, expected labeled %t", name, got.Labels, want)
+		}
+
+		if want && got.Labels["app"] != "web" {
+			t.Errorf("%s: existing labels dropped, got %v", name, got.Labels)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package proxysettings validates ProxySetting and GlobalProxySettings rules
+// against the API resources discovered in the cluster.
+package proxysettings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-logr/logr"
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/client-go/discovery"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	capsuleproxyv1beta1 "github.com/projectcapsule/capsule-proxy/api/v1beta1"
+	"github.com/projectcapsule/capsule-proxy/internal/runtime/validation"
+)
+
+const (
+	proxySettingKind        = "ProxySetting"
+	globalProxySettingsKind = "GlobalProxySettings"
+)
+
+// Validator rejects ProxySetting and GlobalProxySettings objects whose
+// clusterResources rules would silently match nothing.
+type Validator struct {
+	decoder   admission.Decoder
+	discovery discovery.DiscoveryInterface
+	log       logr.Logger
+}
+
+func NewValidator(decoder admission.Decoder, discoveryClient discovery.DiscoveryInterface, log logr.Logger) *Validator {
+	return &Validator{
+		decoder:   decoder,
+		discovery: discoveryClient,
+		log:       log,
+	}
+}
+
+func (v *Validator) Handle(_ context.Context, req admission.Request) admission.Response {
+	if req.Operation != admissionv1.Create && req.Operation != admissionv1.Update {
+		return admission.Allowed("")
+	}
+
+	var (
+		rules []fieldRule
+		err   error
+	)
+
+	switch req.Kind.Kind {
+	case proxySettingKind:
+		rules, err = v.proxySettingRules(req)
+	case globalProxySettingsKind:
+		rules, err = v.globalProxySettingsRules(req)
+	default:
+		return admission.Allowed("")
+	}
+
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	if len(rules) == 0 {
+		return admission.Allowed("")
+	}
+
+	// Discovery is resolved on each admission request: ProxySettings change
+	// rarely, while CRDs referenced by the rules may be installed at any time.
+	index, err := validation.DiscoverClusterResources(v.discovery)
+	if err != nil {
+		v.log.Error(err, "cannot discover cluster-scoped resources")
+
+		return admission.Errored(http.StatusInternalServerError, fmt.Errorf("cannot discover cluster-scoped resources: %w", err))
+	}
+
+	var errs []error
+
+	for _, rule := range rules {
+		if validationErr := validation.ValidateClusterResourceBlock(rule.path, rule.resource, index); validationErr != nil {
+			errs = append(errs, validationErr)
+		}
+	}
+
+	if len(errs) > 0 {
+		return admission.Denied(errors.Join(errs...).Error())
+	}
+
+	return admission.Allowed("")
+}
+
+// fieldRule is a ClusterResource together with its field path in the object.
+type fieldRule struct {
+	path     string
+	resource capsuleproxyv1beta1.ClusterResource
+}
+
+func (v *Validator) proxySettingRules(req admission.Request) ([]fieldRule, error) {
+	setting := &capsuleproxyv1beta1.ProxySetting{}
+	if err := v.decoder.Decode(req, setting); err != nil {
+		return nil, fmt.Errorf("cannot decode ProxySetting: %w", err)
+	}
+
+	var rules []fieldRule
+
+	for subjectIndex, subject := range setting.Spec.Subjects {
+		for resourceIndex, resource := range subject.ClusterResources {
+			rules = append(rules, fieldRule{
+				path:     fmt.Sprintf("spec.subjects[%d].clusterResources[%d]", subjectIndex, resourceIndex),
+				resource: resource,
+			})
+		}
+	}
+
+	return rules, nil
+}
+
+func (v *Validator) globalProxySettingsRules(req admission.Request) ([]fieldRule, error) {
+	setting := &capsuleproxyv1beta1.GlobalProxySettings{}
+	if err := v.decoder.Decode(req, setting); err != nil {
+		return nil, fmt.Errorf("cannot decode GlobalProxySettings: %w", err)
+	}
+
+	var rules []fieldRule
+
+	for ruleIndex, rule := range setting.Spec.Rules {
+		for resourceIndex, resource := range rule.ClusterResources {
+			rules = append(rules, fieldRule{
+				path:     fmt.Sprintf("spec.rules[%d].clusterResources[%d]", ruleIndex, resourceIndex),
+				resource: resource,
+			})
+		}
+	}
+
+	return rules, nil
+}
@@ -0,0 +1,142 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package proxysettings
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	discoveryfake "k8s.io/client-go/discovery/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	capsuleproxyv1beta1 "github.com/projectcapsule/capsule-proxy/api/v1beta1"
+)
+
+// preferredDiscovery serves the configured resources as preferred resources,
+// which the client-go fake does not implement.
+type preferredDiscovery struct {
+	*discoveryfake.FakeDiscovery
+}
+
+func (d preferredDiscovery) ServerPreferredResources() ([]*metav1.APIResourceList, error) {
+	return d.Resources, nil
+}
+
+func newTestValidator(t *testing.T) *Validator {
+	t.Helper()
+
+	scheme := runtime.NewScheme()
+	if err := capsuleproxyv1beta1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	discoveryClient := &discoveryfake.FakeDiscovery{Fake: &clienttesting.Fake{}}
+	discoveryClient.Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{{Name: "nodes", Kind: "Node", Verbs: []string{"get", "list"}}},
+		},
+		{
+			GroupVersion: "storage.k8s.io/v1",
+			APIResources: []metav1.APIResource{{Name: "storageclasses", Kind: "StorageClass", Verbs: []string{"get", "list"}}},
+		},
+	}
+
+	return NewValidator(admission.NewDecoder(scheme), preferredDiscovery{discoveryClient}, logr.Discard())
+}
+
+func admissionRequest(t *testing.T, kind string, obj runtime.Object) admission.Request {
+	t.Helper()
+
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+		Operation: admissionv1.Create,
+		Kind:      metav1.GroupVersionKind{Group: capsuleproxyv1beta1.GroupVersion.Group, Version: capsuleproxyv1beta1.GroupVersion.Version, Kind: kind},
+		Object:    runtime.RawExtension{Raw: raw},
+	}}
+}
+
+func TestValidatorHandle(t *testing.T) {
+	t.Parallel()
+
+	selector := &metav1.LabelSelector{MatchLabels: map[string]string{"tenant": "solar"}}
+
+	tests := []struct {
+		name      string
+		kind      string
+		obj       runtime.Object
+		wantError string
+	}{
+		{
+			name: "valid proxy setting",
+			kind: proxySettingKind,
+			obj: &capsuleproxyv1beta1.ProxySetting{Spec: capsuleproxyv1beta1.ProxySettingSpec{Subjects: []capsuleproxyv1beta1.OwnerSpec{{
+				Kind: "User", Name: "alice",
+				ClusterResources: []capsuleproxyv1beta1.ClusterResource{{APIGroups: []string{""}, Resources: []string{"nodes"}, Selector: selector}},
+			}}}},
+		},
+		{
+			name: "typo in resource name",
+			kind: proxySettingKind,
+			obj: &capsuleproxyv1beta1.ProxySetting{Spec: capsuleproxyv1beta1.ProxySettingSpec{Subjects: []capsuleproxyv1beta1.OwnerSpec{{
+				Kind: "User", Name: "alice",
+				ClusterResources: []capsuleproxyv1beta1.ClusterResource{{APIGroups: []string{""}, Resources: []string{"node"}, Selector: selector}},
+			}}}},
+			wantError: `spec.subjects[0].clusterResources[0].resources: resource "node" was not discovered`,
+		},
+		{
+			name: "unknown API group",
+			kind: globalProxySettingsKind,
+			obj: &capsuleproxyv1beta1.GlobalProxySettings{Spec: capsuleproxyv1beta1.GlobalProxySettingsSpec{Rules: []capsuleproxyv1beta1.GlobalSubjectSpec{{
+				Subjects:         []capsuleproxyv1beta1.GlobalSubject{{Kind: "User", Name: "alice"}},
+				ClusterResources: []capsuleproxyv1beta1.ClusterResource{{APIGroups: []string{"storage.k8s.oi"}, Resources: []string{"storageclasses"}, Selector: selector}},
+			}}}},
+			wantError: `spec.rules[0].clusterResources[0].apiGroups: API group "storage.k8s.oi" was not discovered`,
+		},
+		{
+			name: "selector never matching",
+			kind: globalProxySettingsKind,
+			obj: &capsuleproxyv1beta1.GlobalProxySettings{Spec: capsuleproxyv1beta1.GlobalProxySettingsSpec{Rules: []capsuleproxyv1beta1.GlobalSubjectSpec{{
+				Subjects: []capsuleproxyv1beta1.GlobalSubject{{Kind: "User", Name: "alice"}},
+				ClusterResources: []capsuleproxyv1beta1.ClusterResource{{
+					APIGroups: []string{"storage.k8s.io"},
+					Resources: []string{"storageclasses"},
+					Selector: &metav1.LabelSelector{
+						MatchLabels:      map[string]string{"tenant": "solar"},
+						MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "tenant", Operator: metav1.LabelSelectorOpDoesNotExist}},
+					},
+				}},
+			}}}},
+			wantError: `spec.rules[0].clusterResources[0].selector: label "tenant" is required to both exist and not exist`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			response := newTestValidator(t).Handle(context.Background(), admissionRequest(t, tt.kind, tt.obj))
+
+			switch {
+			case tt.wantError == "" && !response.Allowed:
+				t.Fatalf("expected request to be allowed, got %v", response.Result)
+			case tt.wantError != "" && response.Allowed:
+				t.Fatalf("expected request to be denied with %q", tt.wantError)
+			case tt.wantError != "" && !strings.Contains(response.Result.Message, tt.wantError):
+				t.Fatalf("expected denial containing %q, got %q", tt.wantError, response.Result.Message)
+			}
+		})
+	}
+}
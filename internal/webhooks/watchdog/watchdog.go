@@ -0,0 +1,162 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package watchdog stops Tenant users from tampering with the labels and the
+// objects capsule-proxy relies on to filter their requests.
+package watchdog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/go-logr/logr"
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	capsulerbac "github.com/projectcapsule/capsule/pkg/api/rbac"
+	admissionv1 "k8s.io/api/admission/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apiserver/pkg/authentication/serviceaccount"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	capsuleproxyv1beta1 "github.com/projectcapsule/capsule-proxy/api/v1beta1"
+	"github.com/projectcapsule/capsule-proxy/internal/controllers"
+	"github.com/projectcapsule/capsule-proxy/internal/webhooks/labeler"
+	"github.com/projectcapsule/capsule-proxy/internal/webserver/middleware"
+	"github.com/projectcapsule/capsule-proxy/internal/webserver/writeguard"
+)
+
+const (
+	roleBindingKind  = "RoleBinding"
+	proxySettingKind = "ProxySetting"
+)
+
+// Watchdog rejects the creations and updates of Capsule users in a Tenant
+// namespace that:
+//   - change the Tenant labels of an object to anything but its Tenant;
+//   - change the reflection label of a RoleBinding;
+//   - create or update a ProxySetting while not owning the Tenant.
+//
+// The trusted usernames and the admin groups are never rejected.
+type Watchdog struct {
+	reader           client.Reader
+	trustedUsernames sets.Set[string]
+	adminGroups      sets.Set[string]
+	log              logr.Logger
+}
+
+func NewWatchdog(reader client.Reader, trustedUsernames, adminGroups []string, log logr.Logger) *Watchdog {
+	return &Watchdog{
+		reader:           reader,
+		trustedUsernames: sets.New(trustedUsernames...),
+		adminGroups:      sets.New(adminGroups...),
+		log:              log,
+	}
+}
+
+func (w *Watchdog) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if req.Operation != admissionv1.Create && req.Operation != admissionv1.Update {
+		return admission.Allowed("")
+	}
+
+	if len(req.Namespace) == 0 || len(req.SubResource) > 0 {
+		return admission.Allowed("")
+	}
+
+	username, groups := req.UserInfo.Username, req.UserInfo.Groups
+	if w.trustedUsernames.Has(username) || slices.ContainsFunc(groups, w.adminGroups.Has) || !middleware.IsCapsuleUser(username, groups) {
+		return admission.Allowed("")
+	}
+
+	tnt, err := labeler.TenantOf(ctx, w.reader, req.Namespace)
+	if err != nil {
+		w.log.Error(err, "cannot resolve the Tenant", "namespace", req.Namespace)
+
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	if tnt == nil {
+		return admission.Allowed("")
+	}
+
+	object, old := &metav1.PartialObjectMetadata{}, &metav1.PartialObjectMetadata{}
+	if err = decodeMetadata(req.Object.Raw, object); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	if req.Operation == admissionv1.Update {
+		if err = decodeMetadata(req.OldObject.Raw, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+	}
+
+	for _, label := range writeguard.ProtectedLabels {
+		if tamperedLabel(old.Labels, object.Labels, label, tnt.Name) {
+			return admission.Denied(fmt.Sprintf("the label %s is managed by Capsule and cannot be changed", label))
+		}
+	}
+
+	switch req.Kind.Kind {
+	case roleBindingKind:
+		if req.Kind.Group == rbacv1.GroupName && tamperedLabel(old.Labels, object.Labels, controllers.RoleBindingReflectionLabel, "") {
+			return admission.Denied(fmt.Sprintf("the label %s can be changed only by the cluster administrators", controllers.RoleBindingReflectionLabel))
+		}
+	case proxySettingKind:
+		if req.Kind.Group == capsuleproxyv1beta1.GroupVersion.Group && !isOwner(tnt, username, groups) {
+			return admission.Denied(fmt.Sprintf("ProxySettings can be managed only by the owners of the Tenant %s", tnt.Name))
+		}
+	}
+
+	return admission.Allowed("")
+}
+
+// tamperedLabel reports whether the label was added, changed or removed,
+// unless set to the allowed value.
+func tamperedLabel(before, after map[string]string, label, allowed string) bool {
+	previous, wasSet := before[label]
+	next, isSet := after[label]
+
+	if wasSet == isSet && previous == next {
+		return false
+	}
+
+	return !isSet || len(allowed) == 0 || next != allowed
+}
+
+// isOwner reports whether the user is an owner of the Tenant, by name or by
+// one of the groups.
+func isOwner(tnt *capsulev1beta2.Tenant, username string, groups []string) bool {
+	kind := capsulerbac.UserOwner
+	if strings.HasPrefix(username, serviceaccount.ServiceAccountUsernamePrefix) {
+		kind = capsulerbac.ServiceAccountOwner
+	}
+
+	for _, owner := range tnt.Status.Owners {
+		switch owner.Kind {
+		case kind:
+			if owner.Name == username {
+				return true
+			}
+		case capsulerbac.GroupOwner:
+			if slices.Contains(groups, owner.Name) {
+				return true
+			}
+		default:
+		}
+	}
+
+	return false
+}
+
+func decodeMetadata(raw []byte, object *metav1.PartialObjectMetadata) error {
+	if err := json.Unmarshal(raw, object); err != nil {
+		return fmt.Errorf("cannot decode the object metadata: %w", err)
+	}
+
+	return nil
+}
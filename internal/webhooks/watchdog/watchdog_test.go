@@ -0,0 +1,215 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package watchdog
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/go-logr/logr"
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	capsulemeta "github.com/projectcapsule/capsule/pkg/api/meta"
+	capsulerbac "github.com/projectcapsule/capsule/pkg/api/rbac"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/projectcapsule/capsule-proxy/internal/controllers"
+	"github.com/projectcapsule/capsule-proxy/internal/indexer"
+)
+
+func newTestWatchdog(t *testing.T) *Watchdog {
+	t.Helper()
+
+	scheme := runtime.NewScheme()
+	if err := capsulev1beta2.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	solar := &capsulev1beta2.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "solar"}}
+	solar.Status.Namespaces = []string{"solar-dev"}
+	solar.Status.Owners = []capsulerbac.CoreOwnerSpec{
+		{UserSpec: capsulerbac.UserSpec{Kind: capsulerbac.UserOwner, Name: "alice"}},
+		{UserSpec: capsulerbac.UserSpec{Kind: capsulerbac.GroupOwner, Name: "solar-admins"}},
+	}
+
+	c := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(solar).
+		WithIndex(&capsulev1beta2.Tenant{}, indexer.TenantNamespacesField, func(obj client.Object) []string {
+			//nolint:forcetypeassert
+			return obj.(*capsulev1beta2.Tenant).Status.Namespaces
+		}).
+		Build()
+
+	return NewWatchdog(c, []string{"system:serviceaccount:capsule-system:capsule"}, []string{"cluster-admins"}, logr.Discard())
+}
+
+func rawMetadata(t *testing.T, labels map[string]string) runtime.RawExtension {
+	t.Helper()
+
+	raw, err := json.Marshal(&metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: "object", Namespace: "solar-dev", Labels: labels}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return runtime.RawExtension{Raw: raw}
+}
+
+//nolint:funlen,paralleltest
+func TestWatchdogHandle(t *testing.T) {
+	controllers.CapsuleUsers = sets.New[string]()
+	controllers.CapsuleUserGroups = sets.New("projectcapsule.dev")
+
+	t.Cleanup(func() {
+		controllers.CapsuleUsers = nil
+		controllers.CapsuleUserGroups = nil
+	})
+
+	watchdog := newTestWatchdog(t)
+
+	configMap := metav1.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}
+	roleBinding := metav1.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: roleBindingKind}
+	proxySetting := metav1.GroupVersionKind{Group: "capsule.clastix.io", Version: "v1beta1", Kind: proxySettingKind}
+
+	tenantLabeled := map[string]string{capsulemeta.TenantLabel: "solar"}
+	reflected := map[string]string{controllers.RoleBindingReflectionLabel: "true"}
+
+	tests := []struct {
+		name      string
+		kind      metav1.GroupVersionKind
+		username  string
+		groups    []string
+		old, new  map[string]string
+		operation admissionv1.Operation
+		allowed   bool
+	}{
+		{
+			name:      "tenant label removed",
+			kind:      configMap,
+			username:  "bob",
+			old:       tenantLabeled,
+			operation: admissionv1.Update,
+		},
+		{
+			name:      "tenant label moved to another Tenant",
+			kind:      configMap,
+			username:  "bob",
+			old:       tenantLabeled,
+			new:       map[string]string{capsulemeta.TenantLabel: "wind"},
+			operation: admissionv1.Update,
+		},
+		{
+			name:      "tenant label set to the Tenant",
+			kind:      configMap,
+			username:  "bob",
+			new:       tenantLabeled,
+			operation: admissionv1.Create,
+			allowed:   true,
+		},
+		{
+			name:      "unrelated label changed",
+			kind:      configMap,
+			username:  "bob",
+			old:       tenantLabeled,
+			new:       map[string]string{capsulemeta.TenantLabel: "solar", "app": "web"},
+			operation: admissionv1.Update,
+			allowed:   true,
+		},
+		{
+			name:      "tenant label removed by an admin group",
+			kind:      configMap,
+			username:  "carol",
+			groups:    []string{"cluster-admins"},
+			old:       tenantLabeled,
+			operation: admissionv1.Update,
+			allowed:   true,
+		},
+		{
+			name:      "tenant label removed by a trusted service account",
+			kind:      configMap,
+			username:  "system:serviceaccount:capsule-system:capsule",
+			old:       tenantLabeled,
+			operation: admissionv1.Update,
+			allowed:   true,
+		},
+		{
+			name:      "reflection label added",
+			kind:      roleBinding,
+			username:  "alice",
+			new:       reflected,
+			operation: admissionv1.Create,
+		},
+		{
+			name:      "reflection label kept",
+			kind:      roleBinding,
+			username:  "alice",
+			old:       reflected,
+			new:       map[string]string{controllers.RoleBindingReflectionLabel: "true", "app": "web"},
+			operation: admissionv1.Update,
+			allowed:   true,
+		},
+		{
+			name:      "proxy setting by an owner",
+			kind:      proxySetting,
+			username:  "alice",
+			operation: admissionv1.Create,
+			allowed:   true,
+		},
+		{
+			name:      "proxy setting by an owner group",
+			kind:      proxySetting,
+			username:  "dave",
+			groups:    []string{"solar-admins"},
+			operation: admissionv1.Create,
+			allowed:   true,
+		},
+		{
+			name:      "proxy setting by a non owner",
+			kind:      proxySetting,
+			username:  "bob",
+			operation: admissionv1.Update,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			groups := append([]string{"projectcapsule.dev"}, tt.groups...)
+
+			req := admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: tt.operation,
+				Kind:      tt.kind,
+				Namespace: "solar-dev",
+				UserInfo:  authenticationv1.UserInfo{Username: tt.username, Groups: groups},
+				Object:    rawMetadata(t, tt.new),
+			}}
+			if tt.operation == admissionv1.Update {
+				req.OldObject = rawMetadata(t, tt.old)
+			}
+
+			if response := watchdog.Handle(context.Background(), req); response.Allowed != tt.allowed {
+				t.Fatalf("expected allowed %t, got %v", tt.allowed, response.Result)
+			}
+		})
+	}
+
+	// Users outside of the Capsule groups are left alone.
+	response := watchdog.Handle(context.Background(), admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+		Operation: admissionv1.Update,
+		Kind:      configMap,
+		Namespace: "solar-dev",
+		UserInfo:  authenticationv1.UserInfo{Username: "bob"},
+		Object:    rawMetadata(t, nil),
+		OldObject: rawMetadata(t, tenantLabeled),
+	}})
+	if !response.Allowed {
+		t.Fatalf("expected request of a non Capsule user to be allowed, got %v", response.Result)
+	}
+}
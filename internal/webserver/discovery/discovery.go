@@ -0,0 +1,197 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package discovery advertises the API group served by capsule-proxy itself,
+// so kubectl discovers its resources along with the ones of the API server.
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+
+	apidiscoveryv2 "k8s.io/api/apidiscovery/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	proxyv1beta1 "github.com/projectcapsule/capsule-proxy/api/proxy/v1beta1"
+	"github.com/projectcapsule/capsule-proxy/internal/webserver/rewrite"
+)
+
+const (
+	// GroupPath is the discovery endpoint of the API group.
+	GroupPath = "/apis/proxy.projectcapsule.dev"
+	// VersionPath is the discovery endpoint of the API group version.
+	VersionPath = GroupPath + "/v1beta1"
+	// SelfProxyReviewPath is the endpoint the SelfProxyReview is created with.
+	SelfProxyReviewPath = VersionPath + "/" + proxyv1beta1.SelfProxyReviewResource
+
+	apisPath = "/apis"
+
+	kindAPIGroupList          = "APIGroupList"
+	kindAPIGroupDiscoveryList = "APIGroupDiscoveryList"
+)
+
+func groupVersion() metav1.GroupVersionForDiscovery {
+	return metav1.GroupVersionForDiscovery{
+		GroupVersion: proxyv1beta1.GroupVersion.String(),
+		Version:      proxyv1beta1.GroupVersion.Version,
+	}
+}
+
+// APIGroup is the discovery document of the API group.
+func APIGroup() *metav1.APIGroup {
+	return &metav1.APIGroup{
+		TypeMeta:         metav1.TypeMeta{Kind: "APIGroup", APIVersion: "v1"},
+		Name:             proxyv1beta1.GroupVersion.Group,
+		Versions:         []metav1.GroupVersionForDiscovery{groupVersion()},
+		PreferredVersion: groupVersion(),
+	}
+}
+
+// APIResourceList is the discovery document of the API group version.
+func APIResourceList() *metav1.APIResourceList {
+	return &metav1.APIResourceList{
+		TypeMeta:     metav1.TypeMeta{Kind: "APIResourceList", APIVersion: "v1"},
+		GroupVersion: proxyv1beta1.GroupVersion.String(),
+		APIResources: []metav1.APIResource{
+			{
+				Name:         proxyv1beta1.SelfProxyReviewResource,
+				SingularName: "selfproxyreview",
+				Namespaced:   false,
+				Kind:         proxyv1beta1.SelfProxyReviewKind,
+				Verbs:        metav1.Verbs{"create"},
+			},
+		},
+	}
+}
+
+// APIGroupDiscovery is the aggregated discovery document of the API group.
+func APIGroupDiscovery() apidiscoveryv2.APIGroupDiscovery {
+	return apidiscoveryv2.APIGroupDiscovery{
+		ObjectMeta: metav1.ObjectMeta{Name: proxyv1beta1.GroupVersion.Group},
+		Versions: []apidiscoveryv2.APIVersionDiscovery{
+			{
+				Version: proxyv1beta1.GroupVersion.Version,
+				Resources: []apidiscoveryv2.APIResourceDiscovery{
+					{
+						Resource: proxyv1beta1.SelfProxyReviewResource,
+						ResponseKind: &metav1.GroupVersionKind{
+							Group:   proxyv1beta1.GroupVersion.Group,
+							Version: proxyv1beta1.GroupVersion.Version,
+							Kind:    proxyv1beta1.SelfProxyReviewKind,
+						},
+						Scope:            apidiscoveryv2.ScopeCluster,
+						SingularResource: "selfproxyreview",
+						Verbs:            []string{"create"},
+					},
+				},
+				Freshness: apidiscoveryv2.DiscoveryFreshnessCurrent,
+			},
+		},
+	}
+}
+
+// ServeGroup answers the discovery request of the API group.
+func ServeGroup(writer http.ResponseWriter, _ *http.Request) {
+	serve(writer, APIGroup())
+}
+
+// ServeVersion answers the discovery request of the API group version.
+func ServeVersion(writer http.ResponseWriter, _ *http.Request) {
+	serve(writer, APIResourceList())
+}
+
+func serve(writer http.ResponseWriter, document any) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusOK)
+
+	_ = json.NewEncoder(writer).Encode(document)
+}
+
+type contextKey struct{}
+
+// Middleware holds back the If-None-Match header of the discovery requests of
+// the API groups: the API server does not know the ETag of the document with
+// the API group added, ModifyResponse matches the response against it instead.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method != http.MethodGet || request.URL.Path != apisPath {
+			next.ServeHTTP(writer, request)
+
+			return
+		}
+
+		ifNoneMatch := rewrite.HoldBackIfNoneMatch(request)
+
+		request = request.WithContext(context.WithValue(request.Context(), contextKey{}, ifNoneMatch))
+
+		next.ServeHTTP(writer, request)
+	})
+}
+
+// ModifyResponse is intended for httputil.ReverseProxy.ModifyResponse: it
+// adds the API group to the JSON discovery of the API groups, either legacy or
+// aggregated. Any other response, or one that cannot be decoded, is preserved
+// unchanged.
+//
+// The ETag is computed from the document with the API group added, and the
+// If-None-Match header held back by Middleware is matched against it.
+func ModifyResponse(response *http.Response) error {
+	if response == nil || response.Request == nil || response.Body == nil {
+		return nil
+	}
+
+	if response.Request.Method != http.MethodGet || response.Request.URL.Path != apisPath {
+		return nil
+	}
+
+	ifNoneMatch, _ := response.Request.Context().Value(contextKey{}).(string)
+
+	return rewrite.Response(response, ifNoneMatch, addGroup)
+}
+
+// addGroup returns the discovery document with the API group added, and
+// whether it has been modified.
+func addGroup(document []byte) ([]byte, bool) {
+	var typeMeta metav1.TypeMeta
+	if err := json.Unmarshal(document, &typeMeta); err != nil {
+		return nil, false
+	}
+
+	var modified any
+
+	switch typeMeta.Kind {
+	case kindAPIGroupList:
+		list := &metav1.APIGroupList{}
+		if err := json.Unmarshal(document, list); err != nil || slices.ContainsFunc(list.Groups, func(group metav1.APIGroup) bool {
+			return group.Name == proxyv1beta1.GroupVersion.Group
+		}) {
+			return nil, false
+		}
+
+		list.Groups = append(list.Groups, *APIGroup())
+		modified = list
+	case kindAPIGroupDiscoveryList:
+		// The v2beta1 and v2 versions of the aggregated discovery share the
+		// same schema.
+		list := &apidiscoveryv2.APIGroupDiscoveryList{}
+		if err := json.Unmarshal(document, list); err != nil || slices.ContainsFunc(list.Items, func(group apidiscoveryv2.APIGroupDiscovery) bool {
+			return group.Name == proxyv1beta1.GroupVersion.Group
+		}) {
+			return nil, false
+		}
+
+		list.Items = append(list.Items, APIGroupDiscovery())
+		modified = list
+	default:
+		return nil, false
+	}
+
+	body, err := json.Marshal(modified)
+	if err != nil {
+		return nil, false
+	}
+
+	return body, true
+}
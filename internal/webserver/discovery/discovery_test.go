@@ -0,0 +1,302 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package discovery
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	apidiscoveryv2 "k8s.io/api/apidiscovery/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	proxyv1beta1 "github.com/projectcapsule/capsule-proxy/api/proxy/v1beta1"
+	"github.com/projectcapsule/capsule-proxy/internal/webserver/rewrite"
+)
+
+const aggregatedContentType = "application/json;g=apidiscovery.k8s.io;v=v2;as=APIGroupDiscoveryList"
+
+func mustMarshal(t *testing.T, v any) []byte {
+	t.Helper()
+
+	body, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return body
+}
+
+func gzipped(t *testing.T, body []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(body); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func groupNames(t *testing.T, body []byte) []string {
+	t.Helper()
+
+	var typeMeta metav1.TypeMeta
+	if err := json.Unmarshal(body, &typeMeta); err != nil {
+		t.Fatalf("cannot decode %q: %v", body, err)
+	}
+
+	var names []string
+
+	switch typeMeta.Kind {
+	case kindAPIGroupList:
+		list := &metav1.APIGroupList{}
+		if err := json.Unmarshal(body, list); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, group := range list.Groups {
+			names = append(names, group.Name)
+		}
+	case kindAPIGroupDiscoveryList:
+		list := &apidiscoveryv2.APIGroupDiscoveryList{}
+		if err := json.Unmarshal(body, list); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, group := range list.Items {
+			names = append(names, group.Name)
+		}
+	}
+
+	return names
+}
+
+//nolint:funlen
+func TestModifyResponse(t *testing.T) {
+	t.Parallel()
+
+	legacy := &metav1.APIGroupList{
+		TypeMeta: metav1.TypeMeta{Kind: kindAPIGroupList, APIVersion: "v1"},
+		Groups:   []metav1.APIGroup{{Name: "apps"}},
+	}
+	aggregated := &apidiscoveryv2.APIGroupDiscoveryList{
+		TypeMeta: metav1.TypeMeta{Kind: kindAPIGroupDiscoveryList, APIVersion: "apidiscovery.k8s.io/v2"},
+		Items:    []apidiscoveryv2.APIGroupDiscovery{{ObjectMeta: metav1.ObjectMeta{Name: "apps"}}},
+	}
+	advertised := &metav1.APIGroupList{
+		TypeMeta: metav1.TypeMeta{Kind: kindAPIGroupList, APIVersion: "v1"},
+		Groups:   []metav1.APIGroup{{Name: "apps"}, *APIGroup()},
+	}
+
+	testCases := []struct {
+		name        string
+		method      string
+		path        string
+		statusCode  int
+		contentType string
+		encoding    string
+		body        []byte
+		want        []string
+	}{
+		{
+			name:        "legacy discovery",
+			body:        mustMarshal(t, legacy),
+			contentType: "application/json",
+			want:        []string{"apps", proxyv1beta1.GroupVersion.Group},
+		},
+		{
+			name:        "aggregated discovery",
+			body:        mustMarshal(t, aggregated),
+			contentType: aggregatedContentType,
+			want:        []string{"apps", proxyv1beta1.GroupVersion.Group},
+		},
+		{
+			name:        "compressed discovery",
+			body:        gzipped(t, mustMarshal(t, aggregated)),
+			contentType: aggregatedContentType,
+			encoding:    "gzip",
+			want:        []string{"apps", proxyv1beta1.GroupVersion.Group},
+		},
+		{
+			name:        "already advertised",
+			body:        mustMarshal(t, advertised),
+			contentType: "application/json",
+			want:        []string{"apps", proxyv1beta1.GroupVersion.Group},
+		},
+		{
+			name:        "protobuf discovery",
+			body:        []byte("k8s\x00"),
+			contentType: "application/vnd.kubernetes.protobuf",
+		},
+		{
+			name:        "other path",
+			path:        "/apis/apps",
+			body:        mustMarshal(t, legacy),
+			contentType: "application/json",
+			want:        []string{"apps"},
+		},
+		{
+			name:        "not modified",
+			statusCode:  http.StatusNotModified,
+			contentType: "application/json",
+		},
+		{
+			name:        "undecodable discovery",
+			body:        []byte("{"),
+			contentType: "application/json",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			method, path, statusCode := tc.method, tc.path, tc.statusCode
+			if len(method) == 0 {
+				method = http.MethodGet
+			}
+
+			if len(path) == 0 {
+				path = apisPath
+			}
+
+			if statusCode == 0 {
+				statusCode = http.StatusOK
+			}
+
+			response := &http.Response{
+				StatusCode: statusCode,
+				Header:     http.Header{"Content-Type": []string{tc.contentType}, "Etag": []string{`"upstream"`}},
+				Body:       io.NopCloser(bytes.NewReader(tc.body)),
+				Request:    httptest.NewRequest(method, path, nil),
+			}
+			if len(tc.encoding) > 0 {
+				response.Header.Set("Content-Encoding", tc.encoding)
+			}
+
+			if err := ModifyResponse(response); err != nil {
+				t.Fatal(err)
+			}
+
+			body, err := io.ReadAll(response.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tc.want == nil {
+				if !bytes.Equal(body, tc.body) {
+					t.Fatalf("response modified to %q", body)
+				}
+
+				return
+			}
+
+			if encoding := response.Header.Get("Content-Encoding"); len(encoding) > 0 {
+				t.Fatalf("modified response still encoded as %q", encoding)
+			}
+
+			wantTag := `"upstream"`
+			if !bytes.Equal(body, tc.body) {
+				wantTag = rewrite.ETag(body)
+			}
+
+			if response.Header.Get("Content-Type") != tc.contentType || response.Header.Get("Etag") != wantTag {
+				t.Errorf("unexpected headers %v", response.Header)
+			}
+
+			got := groupNames(t, body)
+			if len(got) != len(tc.want) {
+				t.Fatalf("got groups %v, want %v", got, tc.want)
+			}
+
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Fatalf("got groups %v, want %v", got, tc.want)
+				}
+			}
+		})
+	}
+}
+
+func TestModifyResponseIfNoneMatch(t *testing.T) {
+	t.Parallel()
+
+	upstream := mustMarshal(t, &metav1.APIGroupList{
+		TypeMeta: metav1.TypeMeta{Kind: kindAPIGroupList, APIVersion: "v1"},
+		Groups:   []metav1.APIGroup{{Name: "apps"}},
+	})
+
+	respond := func(ifNoneMatch string) *http.Response {
+		var response *http.Response
+
+		handler := Middleware(http.HandlerFunc(func(_ http.ResponseWriter, request *http.Request) {
+			if len(request.Header.Get("If-None-Match")) > 0 {
+				t.Fatal("expected If-None-Match not to be forwarded")
+			}
+
+			response = &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": []string{"application/json"}, "Etag": []string{rewrite.ETag(upstream)}},
+				Body:       io.NopCloser(bytes.NewReader(upstream)),
+				Request:    request,
+			}
+		}))
+
+		request := httptest.NewRequest(http.MethodGet, apisPath, nil)
+		request.Header.Set("If-None-Match", ifNoneMatch)
+		handler.ServeHTTP(httptest.NewRecorder(), request)
+
+		if err := ModifyResponse(response); err != nil {
+			t.Fatal(err)
+		}
+
+		return response
+	}
+
+	response := respond(rewrite.ETag(upstream))
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("expected the ETag of the API server not to match, got %d", response.StatusCode)
+	}
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tag := response.Header.Get("ETag")
+	if tag != rewrite.ETag(body) {
+		t.Fatalf("expected the ETag of the modified document, got %s", tag)
+	}
+
+	if response = respond(tag); response.StatusCode != http.StatusNotModified {
+		t.Fatalf("expected %d, got %d", http.StatusNotModified, response.StatusCode)
+	}
+}
+
+func TestServeVersion(t *testing.T) {
+	t.Parallel()
+
+	recorder := httptest.NewRecorder()
+	ServeVersion(recorder, httptest.NewRequest(http.MethodGet, VersionPath, nil))
+
+	list := &metav1.APIResourceList{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), list); err != nil {
+		t.Fatal(err)
+	}
+
+	if list.GroupVersion != proxyv1beta1.GroupVersion.String() || len(list.APIResources) != 1 || list.APIResources[0].Name != proxyv1beta1.SelfProxyReviewResource {
+		t.Fatalf("unexpected resource list %+v", list)
+	}
+}
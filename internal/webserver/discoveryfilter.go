@@ -0,0 +1,424 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package webserver
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	authorizationv1client "k8s.io/client-go/kubernetes/typed/authorization/v1"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/projectcapsule/capsule-proxy/internal/authorization"
+	"github.com/projectcapsule/capsule-proxy/internal/controllers"
+	"github.com/projectcapsule/capsule-proxy/internal/features"
+	req "github.com/projectcapsule/capsule-proxy/internal/request"
+	"github.com/projectcapsule/capsule-proxy/internal/tenant"
+	"github.com/projectcapsule/capsule-proxy/internal/types"
+	"github.com/projectcapsule/capsule-proxy/internal/webserver/discoveryfilter"
+	server "github.com/projectcapsule/capsule-proxy/internal/webserver/errors"
+	"github.com/projectcapsule/capsule-proxy/internal/webserver/middleware"
+)
+
+// discoveryFilterMiddleware has the discovery documents answered to the
+// Capsule users filtered with the resources they can reach.
+func (n *kubeFilter) discoveryFilterMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if !n.gates.Enabled(features.DiscoveryFilter) || request.Method != http.MethodGet || !discoveryfilter.IsDiscoveryPath(request.URL.Path) {
+			next.ServeHTTP(writer, request)
+
+			return
+		}
+
+		resolved, username, groups, err := req.ResolveUserAndGroups(request, n.authTypes, n.usernameClaimField, n.writer, n.ignoredImpersonationGroups, n.impersonationGroupsRegexp, n.skipImpersonationReview, n.xfcc_header, n.tokenAuthenticator)
+		if err != nil {
+			n.handleResolveUserAndGroupsError(writer, err)
+
+			return
+		}
+
+		if !middleware.IsCapsuleUser(username, groups) || middleware.IdentityIsIgnored(username, groups, n.ignoredUsernames, n.ignoredUserGroups) {
+			next.ServeHTTP(writer, request)
+
+			return
+		}
+
+		proxyTenants, err := n.getTenantsForOwner(resolved.Context(), username, groups)
+		if err != nil {
+			server.HandleError(writer, err, "cannot list Tenant resources")
+
+			return
+		}
+
+		table := n.routes.Load()
+
+		next.ServeHTTP(writer, discoveryfilter.WithAccess(request, &discoveryAccess{
+			username:              username,
+			groups:                groups,
+			proxyTenants:          proxyTenants,
+			proxyClusterScoped:    n.gates.Enabled(features.ProxyClusterScoped),
+			discoveredResources:   table.discoveredResources,
+			judged:                n.discoveryJudgements.forUser(table, username, groups),
+			roleBindingsReflector: n.roleBindingsReflector,
+			writer:                n.writer,
+			reviewRules:           n.rulesReviewer(username, groups),
+			log:                   n.log.WithName("discovery_filter"),
+		}))
+	})
+}
+
+const (
+	// discoveryJudgementsTTL bounds how long the resources judged reachable
+	// by a user are reused: Tenant and RBAC changes are reflected in the
+	// discovery documents after at most this delay.
+	discoveryJudgementsTTL = time.Minute
+	// discoveryJudgementsSize is the maximum number of users whose judged
+	// resources are kept.
+	discoveryJudgementsSize = 1024
+)
+
+// discoveryJudgements keeps the resources judged reachable per user for the
+// current route table: clients request the discovery documents repeatedly,
+// and judging the resources takes a SelfSubjectRulesReview per Tenant
+// namespace.
+type discoveryJudgements struct {
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*userJudgements
+}
+
+// userJudgements is the reachability of the resources judged for a user, by
+// API group and resource, valid for the route table it was judged with.
+type userJudgements struct {
+	table   *routeTable
+	expires time.Time
+
+	mu        sync.Mutex
+	reachable map[string]bool
+	rules     map[string]*authorizationv1.SubjectRulesReviewStatus
+}
+
+func newDiscoveryJudgements() *discoveryJudgements {
+	return &discoveryJudgements{now: time.Now, entries: map[string]*userJudgements{}}
+}
+
+// forUser returns the judgements of the user, starting over once they expire
+// or the API resources are discovered again.
+func (d *discoveryJudgements) forUser(table *routeTable, username string, groups []string) *userJudgements {
+	sortedGroups := slices.Sorted(slices.Values(groups))
+	key := username + "\x01" + strings.Join(sortedGroups, "\x00")
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+
+	if judged, ok := d.entries[key]; ok && judged.table == table && now.Before(judged.expires) {
+		return judged
+	}
+
+	if len(d.entries) >= discoveryJudgementsSize {
+		d.evict(now)
+	}
+
+	judged := &userJudgements{table: table, expires: now.Add(discoveryJudgementsTTL), reachable: map[string]bool{}, rules: map[string]*authorizationv1.SubjectRulesReviewStatus{}}
+	d.entries[key] = judged
+
+	return judged
+}
+
+// evict drops the expired judgements, or the ones expiring first when none
+// did: it must be called with the lock held.
+func (d *discoveryJudgements) evict(now time.Time) {
+	var (
+		oldestKey     string
+		oldestExpires time.Time
+	)
+
+	for key, judged := range d.entries {
+		if !now.Before(judged.expires) {
+			delete(d.entries, key)
+
+			continue
+		}
+
+		if oldestKey == "" || judged.expires.Before(oldestExpires) {
+			oldestKey, oldestExpires = key, judged.expires
+		}
+	}
+
+	if len(d.entries) >= discoveryJudgementsSize {
+		delete(d.entries, oldestKey)
+	}
+}
+
+func (u *userJudgements) get(key string) (reachable, ok bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	reachable, ok = u.reachable[key]
+
+	return reachable, ok
+}
+
+func (u *userJudgements) set(key string, reachable bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.reachable[key] = reachable
+}
+
+func (u *userJudgements) getRules(namespace string) (*authorizationv1.SubjectRulesReviewStatus, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	rules, ok := u.rules[namespace]
+
+	return rules, ok
+}
+
+func (u *userJudgements) setRules(namespace string, rules *authorizationv1.SubjectRulesReviewStatus) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.rules[namespace] = rules
+}
+
+// rulesReviewer returns the function reviewing the rules of the user in a
+// namespace: the SelfSubjectRulesReview is created impersonating them.
+func (n *kubeFilter) rulesReviewer(username string, groups []string) func(ctx context.Context, namespace string) (*authorizationv1.SubjectRulesReviewStatus, error) {
+	reviews := sync.OnceValues(func() (authorizationv1client.SelfSubjectRulesReviewInterface, error) {
+		config := rest.CopyConfig(n.mgr.GetConfig())
+		config.Impersonate = rest.ImpersonationConfig{UserName: username, Groups: groups}
+
+		clientset, err := authorizationv1client.NewForConfig(config)
+		if err != nil {
+			return nil, err
+		}
+
+		return clientset.SelfSubjectRulesReviews(), nil
+	})
+
+	return func(ctx context.Context, namespace string) (*authorizationv1.SubjectRulesReviewStatus, error) {
+		reviewer, err := reviews()
+		if err != nil {
+			return nil, err
+		}
+
+		review := &authorizationv1.SelfSubjectRulesReview{}
+		review.Spec.Namespace = namespace
+
+		if review, err = reviewer.Create(ctx, review, metav1.CreateOptions{}); err != nil {
+			return nil, err
+		}
+
+		return &review.Status, nil
+	}
+}
+
+// discoveryAccess judges the resources a Capsule user can reach: the ones
+// capsule-proxy grants through their Tenants, the ClusterResource rules and
+// the reflected RoleBindings, and the ones native RBAC allows. A resource that
+// cannot be judged is kept, and not remembered.
+type discoveryAccess struct {
+	username              string
+	groups                []string
+	proxyTenants          []*tenant.ProxyTenant
+	proxyClusterScoped    bool
+	discoveredResources   map[string][]discoveryfilter.Resource
+	judged                *userJudgements
+	roleBindingsReflector *controllers.RoleBindingReflector
+	writer                client.Writer
+	reviewRules           func(ctx context.Context, namespace string) (*authorizationv1.SubjectRulesReviewStatus, error)
+	log                   logr.Logger
+}
+
+func (a *discoveryAccess) Resources(group string) ([]discoveryfilter.Resource, bool) {
+	resources, ok := a.discoveredResources[group]
+
+	return resources, ok
+}
+
+func (a *discoveryAccess) Reachable(ctx context.Context, resource discoveryfilter.Resource) bool {
+	key := resource.Group + "/" + resource.Name
+
+	if reachable, ok := a.judged.get(key); ok {
+		return reachable
+	}
+
+	reachable, judged := a.judge(ctx, resource)
+	if judged {
+		a.judged.set(key, reachable)
+	}
+
+	return reachable
+}
+
+// judge reports whether the resource is reachable, judged being false when
+// the access could not be reviewed and the resource is kept.
+func (a *discoveryAccess) judge(ctx context.Context, resource discoveryfilter.Resource) (reachable, judged bool) {
+	verb := reviewVerb(resource.Verbs)
+	if len(verb) == 0 {
+		return true, true
+	}
+
+	attributes := &authorizationv1.ResourceAttributes{
+		Verb:     verb,
+		Group:    resource.Group,
+		Version:  resource.Version,
+		Resource: resource.Name,
+	}
+
+	if !resource.Namespaced &&
+		authorization.GrantsAccess(a.proxyClusterScoped, a.proxyTenants, nil, attributes) {
+		return true, true
+	}
+
+	// The Tenants are served to their owners.
+	if resource.Group == types.CapsuleGroup && resource.Name == types.Tenants && len(a.proxyTenants) > 0 {
+		return true, true
+	}
+
+	if resource.Namespaced && a.roleBindingsReflector != nil {
+		tenantNames, err := a.roleBindingsReflector.GetUserTenantNamesForResource(ctx, a.username, a.groups, verb, resource.Group, resource.Name)
+		if err != nil {
+			a.log.Error(err, "cannot resolve the reflected RoleBindings", "group", resource.Group, "resource", resource.Name)
+
+			return true, false
+		}
+
+		if len(tenantNames) > 0 {
+			return true, true
+		}
+	}
+
+	// Native RBAC is reviewed cluster-wide and, for the namespaced resources,
+	// in every namespace of the Tenants until one allows it: RoleBindings can
+	// be created in a single namespace of a Tenant. The rules of a namespace
+	// are reviewed once for all the resources, an incomplete review falling
+	// back to an access review of the resource.
+	if allowed, err := a.reviewAccess(ctx, attributes, ""); err != nil {
+		return true, false
+	} else if allowed {
+		return true, true
+	}
+
+	if !resource.Namespaced {
+		return false, true
+	}
+
+	namespaces := sets.New[string]()
+
+	for _, pt := range a.proxyTenants {
+		namespaces.Insert(pt.Tenant.Status.Namespaces...)
+	}
+
+	for _, namespace := range sets.List(namespaces) {
+		rules, err := a.namespaceRules(ctx, namespace)
+		if err != nil {
+			a.log.Error(err, "cannot review the rules", "namespace", namespace)
+
+			return true, false
+		}
+
+		if rulesAllow(rules.ResourceRules, verb, resource.Group, resource.Name) {
+			return true, true
+		}
+
+		if !rules.Incomplete {
+			continue
+		}
+
+		if allowed, err := a.reviewAccess(ctx, attributes, namespace); err != nil {
+			return true, false
+		} else if allowed {
+			return true, true
+		}
+	}
+
+	return false, true
+}
+
+// reviewAccess reviews the access of the user to the resource in the
+// namespace, cluster-wide when empty.
+func (a *discoveryAccess) reviewAccess(ctx context.Context, attributes *authorizationv1.ResourceAttributes, namespace string) (bool, error) {
+	reviewed := *attributes
+	reviewed.Namespace = namespace
+
+	sar := &authorizationv1.SubjectAccessReview{}
+	sar.Spec.User = a.username
+	sar.Spec.Groups = a.groups
+	sar.Spec.ResourceAttributes = &reviewed
+
+	if err := a.writer.Create(ctx, sar); err != nil {
+		a.log.Error(err, "cannot review the access", "group", attributes.Group, "resource", attributes.Resource, "namespace", namespace)
+
+		return false, err
+	}
+
+	return sar.Status.Allowed, nil
+}
+
+// namespaceRules returns the rules of the user in the namespace, reviewed
+// once per judgements.
+func (a *discoveryAccess) namespaceRules(ctx context.Context, namespace string) (*authorizationv1.SubjectRulesReviewStatus, error) {
+	if rules, ok := a.judged.getRules(namespace); ok {
+		return rules, nil
+	}
+
+	rules, err := a.reviewRules(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	a.judged.setRules(namespace, rules)
+
+	return rules, nil
+}
+
+// rulesAllow reports whether the reviewed rules grant the verb on every object
+// of the resource.
+func rulesAllow(rules []authorizationv1.ResourceRule, verb, apiGroup, resource string) bool {
+	for _, rule := range rules {
+		policyRule := rbacv1.PolicyRule{
+			Verbs:         rule.Verbs,
+			APIGroups:     rule.APIGroups,
+			Resources:     rule.Resources,
+			ResourceNames: rule.ResourceNames,
+		}
+
+		if controllers.PolicyRuleAllows(policyRule, verb, apiGroup, resource) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// reviewVerb returns the verb the access to a resource is reviewed with: the
+// resources that cannot be listed nor read, as the reviews, are created.
+func reviewVerb(verbs []string) string {
+	for _, verb := range []string{"list", "get", "create"} {
+		if slices.Contains(verbs, verb) {
+			return verb
+		}
+	}
+
+	if len(verbs) > 0 {
+		return verbs[0]
+	}
+
+	return ""
+}
@@ -0,0 +1,238 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package discoveryfilter
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	apidiscoveryv2 "k8s.io/api/apidiscovery/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	proxyv1beta1 "github.com/projectcapsule/capsule-proxy/api/proxy/v1beta1"
+)
+
+const (
+	kindAPIGroupList          = "APIGroupList"
+	kindAPIResourceList       = "APIResourceList"
+	kindAPIGroupDiscoveryList = "APIGroupDiscoveryList"
+)
+
+// judge memoizes the reachability of the resources along a document, by API
+// group and resource: RBAC does not tell the versions apart.
+type judge struct {
+	access Access
+	judged map[string]bool
+}
+
+func newJudge(access Access) *judge {
+	return &judge{access: access, judged: map[string]bool{}}
+}
+
+func (j *judge) reachable(ctx context.Context, resource Resource) bool {
+	key := resource.Group + "/" + resource.Name
+
+	reachable, ok := j.judged[key]
+	if !ok {
+		reachable = j.access.Reachable(ctx, resource)
+		j.judged[key] = reachable
+	}
+
+	return reachable
+}
+
+// groupReachable reports whether any resource of the API group is reachable,
+// an unknown group being kept.
+func (j *judge) groupReachable(ctx context.Context, group string) bool {
+	resources, known := j.access.Resources(group)
+	if !known {
+		return true
+	}
+
+	for _, resource := range resources {
+		if j.reachable(ctx, resource) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// filterDocument returns the discovery document without the resources the
+// caller cannot reach, and whether it has been modified. The API group of
+// capsule-proxy is always kept.
+func filterDocument(ctx context.Context, access Access, document []byte) ([]byte, bool) {
+	var typeMeta metav1.TypeMeta
+
+	err := json.Unmarshal(document, &typeMeta)
+	if err != nil {
+		return nil, false
+	}
+
+	j := newJudge(access)
+
+	var (
+		filtered any
+		modified bool
+	)
+
+	switch typeMeta.Kind {
+	case kindAPIGroupList:
+		list := &metav1.APIGroupList{}
+		if err = json.Unmarshal(document, list); err != nil {
+			return nil, false
+		}
+
+		modified = filterGroups(ctx, j, list)
+		filtered = list
+	case kindAPIResourceList:
+		list := &metav1.APIResourceList{}
+		if err = json.Unmarshal(document, list); err != nil {
+			return nil, false
+		}
+
+		modified = filterResources(ctx, j, list)
+		filtered = list
+	case kindAPIGroupDiscoveryList:
+		// The v2beta1 and v2 versions of the aggregated discovery share the
+		// same schema.
+		list := &apidiscoveryv2.APIGroupDiscoveryList{}
+		if err = json.Unmarshal(document, list); err != nil {
+			return nil, false
+		}
+
+		modified = filterAggregated(ctx, j, list)
+		filtered = list
+	default:
+		return nil, false
+	}
+
+	if !modified {
+		return nil, false
+	}
+
+	body, err := json.Marshal(filtered)
+	if err != nil {
+		return nil, false
+	}
+
+	return body, true
+}
+
+func filterGroups(ctx context.Context, j *judge, list *metav1.APIGroupList) bool {
+	groups := make([]metav1.APIGroup, 0, len(list.Groups))
+
+	for _, group := range list.Groups {
+		if group.Name == proxyv1beta1.GroupVersion.Group || j.groupReachable(ctx, group.Name) {
+			groups = append(groups, group)
+		}
+	}
+
+	if len(groups) == len(list.Groups) {
+		return false
+	}
+
+	list.Groups = groups
+
+	return true
+}
+
+func filterResources(ctx context.Context, j *judge, list *metav1.APIResourceList) bool {
+	gv, err := schema.ParseGroupVersion(list.GroupVersion)
+	if err != nil || gv.Group == proxyv1beta1.GroupVersion.Group {
+		return false
+	}
+
+	// The subresources follow the resource they belong to.
+	removed := map[string]bool{}
+
+	for _, resource := range list.APIResources {
+		if strings.Contains(resource.Name, "/") {
+			continue
+		}
+
+		removed[resource.Name] = !j.reachable(ctx, Resource{
+			Group:      gv.Group,
+			Version:    gv.Version,
+			Name:       resource.Name,
+			Namespaced: resource.Namespaced,
+			Verbs:      resource.Verbs,
+		})
+	}
+
+	resources := make([]metav1.APIResource, 0, len(list.APIResources))
+
+	for _, resource := range list.APIResources {
+		name, _, _ := strings.Cut(resource.Name, "/")
+		if !removed[name] {
+			resources = append(resources, resource)
+		}
+	}
+
+	if len(resources) == len(list.APIResources) {
+		return false
+	}
+
+	list.APIResources = resources
+
+	return true
+}
+
+// filterAggregated filters the resources of each group version, removing the
+// versions and the groups left empty: the ones empty upstream, as the stale
+// ones, are kept.
+func filterAggregated(ctx context.Context, j *judge, list *apidiscoveryv2.APIGroupDiscoveryList) bool {
+	modified := false
+	items := make([]apidiscoveryv2.APIGroupDiscovery, 0, len(list.Items))
+
+	for _, group := range list.Items {
+		if group.Name == proxyv1beta1.GroupVersion.Group {
+			items = append(items, group)
+
+			continue
+		}
+
+		versions := make([]apidiscoveryv2.APIVersionDiscovery, 0, len(group.Versions))
+
+		for _, version := range group.Versions {
+			resources := make([]apidiscoveryv2.APIResourceDiscovery, 0, len(version.Resources))
+
+			for _, resource := range version.Resources {
+				if j.reachable(ctx, Resource{
+					Group:      group.Name,
+					Version:    version.Version,
+					Name:       resource.Resource,
+					Namespaced: resource.Scope == apidiscoveryv2.ScopeNamespace,
+					Verbs:      resource.Verbs,
+				}) {
+					resources = append(resources, resource)
+				}
+			}
+
+			if len(resources) == len(version.Resources) {
+				versions = append(versions, version)
+
+				continue
+			}
+
+			modified = true
+
+			if len(resources) > 0 {
+				version.Resources = resources
+				versions = append(versions, version)
+			}
+		}
+
+		if len(versions) > 0 || len(group.Versions) == 0 {
+			group.Versions = versions
+			items = append(items, group)
+		}
+	}
+
+	list.Items = items
+
+	return modified
+}
@@ -0,0 +1,93 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package discoveryfilter removes from the discovery documents the resources
+// the caller cannot reach, so Tenant users discover only the API groups they
+// can use.
+package discoveryfilter
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/projectcapsule/capsule-proxy/internal/webserver/rewrite"
+)
+
+// Resource is a resource advertised by the discovery.
+type Resource struct {
+	Group, Version, Name string
+	Namespaced           bool
+	Verbs                []string
+}
+
+// Access judges the resources the caller can reach.
+type Access interface {
+	// Reachable reports whether the caller can reach the resource.
+	Reachable(ctx context.Context, resource Resource) bool
+	// Resources returns the discovered resources of the API group, false when
+	// the group is unknown.
+	Resources(group string) ([]Resource, bool)
+}
+
+type contextKey struct{}
+
+// filtering is the state of a request whose discovery response is filtered.
+type filtering struct {
+	access      Access
+	ifNoneMatch string
+}
+
+// IsDiscoveryPath reports whether the path serves a discovery document the
+// filter rewrites: the API versions and groups, legacy or aggregated, and the
+// resources of a group version.
+func IsDiscoveryPath(path string) bool {
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if slices.Contains(parts, "") {
+		return false
+	}
+
+	switch parts[0] {
+	case "api":
+		return len(parts) <= 2
+	case "apis":
+		return len(parts) == 1 || len(parts) == 3
+	default:
+		return false
+	}
+}
+
+// WithAccess returns the request whose discovery response is filtered with
+// the access of the caller. The If-None-Match header is held back, the API
+// server not knowing the ETag of the filtered document: the response is
+// matched against it instead.
+func WithAccess(request *http.Request, access Access) *http.Request {
+	state := &filtering{access: access, ifNoneMatch: rewrite.HoldBackIfNoneMatch(request)}
+
+	return request.WithContext(context.WithValue(request.Context(), contextKey{}, state))
+}
+
+// ModifyResponse is intended for httputil.ReverseProxy.ModifyResponse: it
+// filters the JSON discovery documents of the requests prepared with
+// WithAccess. Any other response, or one that cannot be decoded, is preserved
+// unchanged.
+//
+// The document depending on the caller, the ETag is computed from the
+// filtered one, and the response is not cacheable by shared caches.
+func ModifyResponse(response *http.Response) error {
+	if response == nil || response.Request == nil || response.Body == nil {
+		return nil
+	}
+
+	state, ok := response.Request.Context().Value(contextKey{}).(*filtering)
+	if !ok || response.StatusCode != http.StatusOK {
+		return nil
+	}
+
+	response.Header.Set("Cache-Control", "private")
+
+	return rewrite.Response(response, state.ifNoneMatch, func(document []byte) ([]byte, bool) {
+		return filterDocument(response.Request.Context(), state.access, document)
+	})
+}
@@ -0,0 +1,295 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package discoveryfilter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	apidiscoveryv2 "k8s.io/api/apidiscovery/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	proxyv1beta1 "github.com/projectcapsule/capsule-proxy/api/proxy/v1beta1"
+	"github.com/projectcapsule/capsule-proxy/internal/webserver/rewrite"
+)
+
+const aggregatedContentType = "application/json;g=apidiscovery.k8s.io;v=v2;as=APIGroupDiscoveryList"
+
+// testAccess reaches the resources of the apps group, and the pods.
+type testAccess struct{}
+
+func (testAccess) Reachable(_ context.Context, resource Resource) bool {
+	return resource.Group == "apps" || resource.Name == "pods"
+}
+
+func (testAccess) Resources(group string) ([]Resource, bool) {
+	switch group {
+	case "apps":
+		return []Resource{{Group: "apps", Version: "v1", Name: "deployments", Namespaced: true}}, true
+	case "internal.example.com":
+		return []Resource{{Group: "internal.example.com", Version: "v1", Name: "widgets", Namespaced: true}}, true
+	default:
+		return nil, false
+	}
+}
+
+func mustMarshal(t *testing.T, v any) []byte {
+	t.Helper()
+
+	body, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return body
+}
+
+func TestIsDiscoveryPath(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		path string
+		want bool
+	}{
+		{path: "/api", want: true},
+		{path: "/api/v1", want: true},
+		{path: "/apis", want: true},
+		{path: "/apis/apps/v1", want: true},
+		{path: "/apis/apps"},
+		{path: "/api/v1/pods"},
+		{path: "/apis/apps/v1/deployments"},
+		{path: "/apis/"},
+		{path: "/version"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			t.Parallel()
+
+			if got := IsDiscoveryPath(tc.path); got != tc.want {
+				t.Fatalf("expected %t, got %t", tc.want, got)
+			}
+		})
+	}
+}
+
+//nolint:funlen
+func TestFilterDocument(t *testing.T) {
+	t.Parallel()
+
+	groups := &metav1.APIGroupList{
+		TypeMeta: metav1.TypeMeta{Kind: kindAPIGroupList, APIVersion: "v1"},
+		Groups: []metav1.APIGroup{
+			{Name: "apps"},
+			{Name: "internal.example.com"},
+			{Name: "unknown.example.com"},
+			{Name: proxyv1beta1.GroupVersion.Group},
+		},
+	}
+	resources := &metav1.APIResourceList{
+		TypeMeta:     metav1.TypeMeta{Kind: kindAPIResourceList, APIVersion: "v1"},
+		GroupVersion: "v1",
+		APIResources: []metav1.APIResource{
+			{Name: "pods", Namespaced: true},
+			{Name: "pods/log", Namespaced: true},
+			{Name: "secrets", Namespaced: true},
+			{Name: "secrets/status", Namespaced: true},
+		},
+	}
+	aggregated := &apidiscoveryv2.APIGroupDiscoveryList{
+		TypeMeta: metav1.TypeMeta{Kind: kindAPIGroupDiscoveryList, APIVersion: "apidiscovery.k8s.io/v2"},
+		Items: []apidiscoveryv2.APIGroupDiscovery{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "apps"},
+				Versions:   []apidiscoveryv2.APIVersionDiscovery{{Version: "v1", Resources: []apidiscoveryv2.APIResourceDiscovery{{Resource: "deployments"}}}},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "internal.example.com"},
+				Versions:   []apidiscoveryv2.APIVersionDiscovery{{Version: "v1", Resources: []apidiscoveryv2.APIResourceDiscovery{{Resource: "widgets"}}}},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "stale.example.com"},
+				Versions:   []apidiscoveryv2.APIVersionDiscovery{{Version: "v1", Freshness: apidiscoveryv2.DiscoveryFreshnessStale}},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: proxyv1beta1.GroupVersion.Group},
+				Versions:   []apidiscoveryv2.APIVersionDiscovery{{Version: "v1beta1", Resources: []apidiscoveryv2.APIResourceDiscovery{{Resource: "selfproxyreviews"}}}},
+			},
+		},
+	}
+
+	testCases := []struct {
+		name     string
+		body     []byte
+		modified bool
+		want     []string
+	}{
+		{
+			name:     "groups",
+			body:     mustMarshal(t, groups),
+			modified: true,
+			want:     []string{"apps", "unknown.example.com", proxyv1beta1.GroupVersion.Group},
+		},
+		{
+			name:     "resources",
+			body:     mustMarshal(t, resources),
+			modified: true,
+			want:     []string{"pods", "pods/log"},
+		},
+		{
+			name:     "aggregated discovery",
+			body:     mustMarshal(t, aggregated),
+			modified: true,
+			want:     []string{"apps", "stale.example.com", proxyv1beta1.GroupVersion.Group},
+		},
+		{
+			name: "nothing removed",
+			body: mustMarshal(t, &metav1.APIGroupList{
+				TypeMeta: metav1.TypeMeta{Kind: kindAPIGroupList, APIVersion: "v1"},
+				Groups:   []metav1.APIGroup{{Name: "apps"}},
+			}),
+		},
+		{
+			name: "other document",
+			body: mustMarshal(t, &metav1.APIVersions{TypeMeta: metav1.TypeMeta{Kind: "APIVersions"}, Versions: []string{"v1"}}),
+		},
+		{
+			name: "not JSON",
+			body: []byte("not json"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			body, modified := filterDocument(context.Background(), testAccess{}, tc.body)
+			if modified != tc.modified {
+				t.Fatalf("expected modified %t, got %t", tc.modified, modified)
+			}
+
+			if !modified {
+				return
+			}
+
+			if got := names(t, body); !slices.Equal(got, tc.want) {
+				t.Fatalf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestModifyResponse(t *testing.T) {
+	t.Parallel()
+
+	upstream := mustMarshal(t, &apidiscoveryv2.APIGroupDiscoveryList{
+		TypeMeta: metav1.TypeMeta{Kind: kindAPIGroupDiscoveryList, APIVersion: "apidiscovery.k8s.io/v2"},
+		Items: []apidiscoveryv2.APIGroupDiscovery{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "internal.example.com"},
+				Versions:   []apidiscoveryv2.APIVersionDiscovery{{Version: "v1", Resources: []apidiscoveryv2.APIResourceDiscovery{{Resource: "widgets"}}}},
+			},
+		},
+	})
+
+	respond := func(ifNoneMatch string) *http.Response {
+		request := httptest.NewRequest(http.MethodGet, "/apis", nil)
+		request.Header.Set("If-None-Match", ifNoneMatch)
+
+		request = WithAccess(request, testAccess{})
+		if len(request.Header.Get("If-None-Match")) > 0 {
+			t.Fatal("expected If-None-Match not to be forwarded")
+		}
+
+		response := &http.Response{
+			StatusCode: http.StatusOK,
+			Header: http.Header{
+				"Content-Type":  []string{aggregatedContentType},
+				"Cache-Control": []string{"public"},
+				"Etag":          []string{`"UPSTREAM"`},
+			},
+			Body:    io.NopCloser(bytes.NewReader(upstream)),
+			Request: request,
+		}
+
+		if err := ModifyResponse(response); err != nil {
+			t.Fatal(err)
+		}
+
+		return response
+	}
+
+	response := respond(`"UPSTREAM"`)
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("expected the ETag of the API server not to match, got %d", response.StatusCode)
+	}
+
+	if cacheControl := response.Header.Get("Cache-Control"); cacheControl != "private" {
+		t.Fatalf("expected a private response, got %q", cacheControl)
+	}
+
+	body, _ := io.ReadAll(response.Body)
+
+	tag := response.Header.Get("ETag")
+	if tag != rewrite.ETag(body) {
+		t.Fatalf("expected the ETag of the filtered document, got %s", tag)
+	}
+
+	if response = respond(tag); response.StatusCode != http.StatusNotModified {
+		t.Fatalf("expected %d, got %d", http.StatusNotModified, response.StatusCode)
+	}
+
+	if body, _ = io.ReadAll(response.Body); len(body) > 0 {
+		t.Fatalf("expected no body, got %q", body)
+	}
+}
+
+func names(t *testing.T, body []byte) []string {
+	t.Helper()
+
+	var typeMeta metav1.TypeMeta
+	if err := json.Unmarshal(body, &typeMeta); err != nil {
+		t.Fatalf("cannot decode %q: %v", body, err)
+	}
+
+	var out []string
+
+	switch typeMeta.Kind {
+	case kindAPIGroupList:
+		list := &metav1.APIGroupList{}
+		if err := json.Unmarshal(body, list); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, group := range list.Groups {
+			out = append(out, group.Name)
+		}
+	case kindAPIResourceList:
+		list := &metav1.APIResourceList{}
+		if err := json.Unmarshal(body, list); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, resource := range list.APIResources {
+			out = append(out, resource.Name)
+		}
+	case kindAPIGroupDiscoveryList:
+		list := &apidiscoveryv2.APIGroupDiscoveryList{}
+		if err := json.Unmarshal(body, list); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, group := range list.Items {
+			out = append(out, group.Name)
+		}
+	}
+
+	return out
+}
@@ -6,7 +6,10 @@ package errors
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
@@ -54,3 +57,51 @@ func HandleError(w http.ResponseWriter, err error, message string) {
 	b, _ := json.Marshal(status)
 	_, _ = w.Write(b)
 }
+
+// HandleTooManyRequests rejects a request exceeding a rate limit, the client
+// is told to retry after the given delay.
+func HandleTooManyRequests(w http.ResponseWriter, message string, retryAfter time.Duration) {
+	seconds := int32(max(math.Ceil(retryAfter.Seconds()), 1))
+
+	status := &metav1.Status{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       types.StatusKind,
+			APIVersion: types.V1,
+		},
+		Status:  metav1.StatusFailure,
+		Message: message,
+		Reason:  metav1.StatusReasonTooManyRequests,
+		Details: &metav1.StatusDetails{RetryAfterSeconds: seconds},
+		Code:    http.StatusTooManyRequests,
+	}
+
+	w.Header().Set("content-type", "application/json")
+	w.Header().Set("Retry-After", strconv.Itoa(int(seconds)))
+	w.WriteHeader(http.StatusTooManyRequests)
+
+	//nolint:errchkjson
+	b, _ := json.Marshal(status)
+	_, _ = w.Write(b)
+}
+
+// HandleBadRequest rejects a malformed request.
+func HandleBadRequest(w http.ResponseWriter, err error, message string) {
+	message = fmt.Sprintf("%s: %s", message, err.Error())
+	status := &metav1.Status{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       types.StatusKind,
+			APIVersion: types.V1,
+		},
+		Status:  metav1.StatusFailure,
+		Message: message,
+		Reason:  metav1.StatusReasonBadRequest,
+		Code:    http.StatusBadRequest,
+	}
+
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+
+	//nolint:errchkjson
+	b, _ := json.Marshal(status)
+	_, _ = w.Write(b)
+}
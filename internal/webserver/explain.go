@@ -0,0 +1,379 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package webserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/gorilla/mux"
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	capsulerbac "github.com/projectcapsule/capsule/pkg/api/rbac"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/projectcapsule/capsule-proxy/api/v1beta1"
+	"github.com/projectcapsule/capsule-proxy/internal/audit"
+	"github.com/projectcapsule/capsule-proxy/internal/authorization"
+	"github.com/projectcapsule/capsule-proxy/internal/features"
+	"github.com/projectcapsule/capsule-proxy/internal/indexer"
+	"github.com/projectcapsule/capsule-proxy/internal/modules"
+	moderrors "github.com/projectcapsule/capsule-proxy/internal/modules/errors"
+	req "github.com/projectcapsule/capsule-proxy/internal/request"
+	"github.com/projectcapsule/capsule-proxy/internal/tenant"
+	server "github.com/projectcapsule/capsule-proxy/internal/webserver/errors"
+	"github.com/projectcapsule/capsule-proxy/internal/webserver/middleware"
+)
+
+// ExplainPath is the endpoint explaining how a request of the caller would be
+// handled, e.g. /_capsule/explain?path=/api/v1/nodes&method=GET.
+const ExplainPath = "/_capsule/explain"
+
+// Reasons a request is forwarded impersonating the user rather than filtered.
+const (
+	explainReasonAllowedPath     = "AllowedPath"
+	explainReasonSelfReview      = "SelfReview"
+	explainReasonSubjectReview   = "SubjectReview"
+	explainReasonNoModule        = "NoModule"
+	explainReasonIgnoredIdentity = "IgnoredIdentity"
+	explainReasonNotCapsuleUser  = "NotCapsuleUser"
+	explainReasonNoSelector      = "NoSelector"
+)
+
+// explanation is the answer of the explain endpoint.
+type explanation struct {
+	Path   string `json:"path"`
+	Method string `json:"method"`
+
+	User explainedUser `json:"user"`
+
+	ProxyTenants []explainedProxyTenant `json:"proxyTenants"`
+
+	// Module is the path template of the module handling the request.
+	Module string `json:"module,omitempty"`
+	// Forwarding tells how the request is forwarded to the API server, Reason
+	// why it is forwarded impersonating the user when it is.
+	Forwarding audit.Forwarding `json:"forwarding,omitempty"`
+	Reason     string           `json:"reason,omitempty"`
+	// Selector is the label selector injected in the request, FieldSelector
+	// the field selector excluding the namespaces the user cannot list.
+	Selector      string `json:"selector,omitempty"`
+	FieldSelector string `json:"fieldSelector,omitempty"`
+	// Namespaces are listed one by one when the module fans out the request.
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Status is the error the module answers with.
+	Status *metav1.Status `json:"status,omitempty"`
+}
+
+type explainedUser struct {
+	Username    string   `json:"username"`
+	Groups      []string `json:"groups,omitempty"`
+	CapsuleUser bool     `json:"capsuleUser"`
+	Ignored     bool     `json:"ignored"`
+}
+
+type explainedProxyTenant struct {
+	Name             string                    `json:"name"`
+	Source           tenant.Source             `json:"source"`
+	SourceName       string                    `json:"sourceName,omitempty"`
+	Namespaces       []string                  `json:"namespaces,omitempty"`
+	ClusterResources []v1beta1.ClusterResource `json:"clusterResources,omitempty"`
+	// Operations are the legacy proxy operations of the Tenant owner, by kind.
+	Operations map[string][]string `json:"operations,omitempty"`
+}
+
+// routedModule is a module along with the route serving it.
+type routedModule struct {
+	route  *mux.Route
+	module modules.Module
+}
+
+// explainHandler runs the module pipeline for the path of the query, as the
+// caller, without forwarding anything to the API server.
+//
+//nolint:funlen,cyclop
+func (n *kubeFilter) explainHandler(writer http.ResponseWriter, request *http.Request) {
+	target, method, err := explainTarget(request)
+	if err != nil {
+		server.HandleBadRequest(writer, err, "invalid explain request")
+
+		return
+	}
+
+	request, username, groups, err := req.ResolveUserAndGroups(request, n.authTypes, n.usernameClaimField, n.writer, n.ignoredImpersonationGroups, n.impersonationGroupsRegexp, n.skipImpersonationReview, n.xfcc_header, n.tokenAuthenticator)
+	if err != nil {
+		n.handleResolveUserAndGroupsError(writer, err)
+
+		return
+	}
+
+	// The explained request carries the identity of the caller, already
+	// resolved in its context, and is only evaluated by the modules.
+	explained := request.Clone(modules.WithEvaluation(request.Context()))
+	explained.Method = method
+	explained.URL = request.URL.ResolveReference(target)
+	explained.RequestURI = target.RequestURI()
+	explained.Body = http.NoBody
+	explained.ContentLength = 0
+
+	result := &explanation{
+		Path:   explained.URL.Path,
+		Method: method,
+		User: explainedUser{
+			Username:    username,
+			Groups:      groups,
+			CapsuleUser: middleware.IsCapsuleUser(username, groups),
+			Ignored:     middleware.IdentityIsIgnored(username, groups, n.ignoredUsernames, n.ignoredUserGroups),
+		},
+		ProxyTenants: []explainedProxyTenant{},
+	}
+
+	mod, vars := n.matchModule(explained)
+	if mod != nil {
+		result.Module = mod.Path()
+		explained = mux.SetURLVars(explained, vars)
+	}
+
+	proxyTenants, err := n.getTenantsForOwner(explained.Context(), username, groups)
+	if err != nil {
+		server.HandleError(writer, err, "cannot list Tenant resources")
+
+		return
+	}
+
+	for _, pt := range proxyTenants {
+		result.ProxyTenants = append(result.ProxyTenants, explainProxyTenant(pt))
+	}
+
+	proxyRequest := req.NewHTTP(
+		explained,
+		n.authTypes,
+		n.usernameClaimField,
+		n.writer,
+		n.ignoredImpersonationGroups,
+		n.impersonationGroupsRegexp,
+		n.skipImpersonationReview,
+		n.xfcc_header,
+		n.tokenAuthenticator,
+	)
+
+	if n.roleBindingsReflector != nil {
+		reflected, reflectionErr := n.explainReflectedTenants(proxyRequest)
+		if reflectionErr != nil {
+			server.HandleError(writer, reflectionErr, "cannot resolve the reflected RoleBindings")
+
+			return
+		}
+
+		result.ProxyTenants = append(result.ProxyTenants, reflected...)
+	}
+
+	switch {
+	case n.allowedPaths.Has(explained.URL.Path):
+		result.Forwarding, result.Reason = audit.ForwardingImpersonation, explainReasonAllowedPath
+	case slices.Contains(authorization.Paths, explained.URL.Path):
+		result.Forwarding, result.Reason = audit.ForwardingImpersonation, explainReasonSelfReview
+	case authorization.IsSubjectReviewPath(explained.URL.Path):
+		result.Forwarding, result.Reason = audit.ForwardingImpersonation, explainReasonSubjectReview
+	case mod == nil:
+		result.Forwarding, result.Reason = audit.ForwardingImpersonation, explainReasonNoModule
+	case result.User.Ignored:
+		result.Forwarding, result.Reason = audit.ForwardingImpersonation, explainReasonIgnoredIdentity
+	case !result.User.CapsuleUser:
+		result.Forwarding, result.Reason = audit.ForwardingImpersonation, explainReasonNotCapsuleUser
+	default:
+		if err = n.explainModule(result, mod, proxyTenants, proxyRequest); err != nil {
+			server.HandleError(writer, err, err.Error())
+
+			return
+		}
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusOK)
+
+	_ = json.NewEncoder(writer).Encode(result)
+}
+
+// explainModule records the outcome of the module handling the request.
+func (n *kubeFilter) explainModule(result *explanation, mod modules.Module, proxyTenants []*tenant.ProxyTenant, proxyRequest req.Request) error {
+	if namespacedModule, ok := n.fanOutModule(mod); ok {
+		namespaces, err := namespacedModule.AllowedNamespaces(proxyTenants, proxyRequest)
+		if err != nil {
+			return err
+		}
+
+		result.Namespaces = namespaces
+		result.Forwarding = audit.ForwardingServiceAccount
+
+		if n.gates.Enabled(features.ImpersonateFilteredRequests) {
+			result.Forwarding = audit.ForwardingImpersonation
+		}
+
+		return nil
+	}
+
+	selector, err := mod.Handle(proxyTenants, proxyRequest)
+	if err != nil {
+		var t moderrors.Error
+		if errors.As(err, &t) {
+			result.Status = t.Status()
+
+			return nil
+		}
+
+		return err
+	}
+
+	if selector == nil {
+		result.Forwarding, result.Reason = audit.ForwardingImpersonation, explainReasonNoSelector
+
+		return nil
+	}
+
+	result.Forwarding, result.Selector = audit.ForwardingServiceAccount, selector.String()
+	result.FieldSelector = proxyRequest.GetHTTPRequest().URL.Query().Get("fieldSelector")
+
+	return nil
+}
+
+// matchModule returns the module the request is routed to, along with the
+// route variables.
+func (n *kubeFilter) matchModule(request *http.Request) (modules.Module, map[string]string) {
+	for _, routed := range n.routes.Load().routedModules {
+		var match mux.RouteMatch
+		if routed.route.Match(request, &match) {
+			return routed.module, match.Vars
+		}
+	}
+
+	return nil, nil
+}
+
+// explainReflectedTenants returns the Tenant namespaces the user is bound to by
+// reflected RoleBindings, grouped by Tenant.
+func (n *kubeFilter) explainReflectedTenants(proxyRequest req.Request) ([]explainedProxyTenant, error) {
+	byTenant, err := n.reflectedTenantNamespaces(proxyRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	reflected := make([]explainedProxyTenant, 0, len(byTenant))
+
+	for _, name := range sets.List(sets.KeySet(byTenant)) {
+		reflected = append(reflected, explainedProxyTenant{
+			Name:       name,
+			Source:     tenant.SourceRoleBindingReflection,
+			Namespaces: byTenant[name],
+		})
+	}
+
+	return reflected, nil
+}
+
+// reflectedTenantNamespaces returns the namespaces the user is bound to by
+// reflected RoleBindings, by Tenant name.
+func (n *kubeFilter) reflectedTenantNamespaces(proxyRequest req.Request) (map[string][]string, error) {
+	namespaces, err := n.roleBindingsReflector.GetUserNamespacesFromRequest(proxyRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	byTenant := map[string][]string{}
+
+	for _, ns := range namespaces {
+		tntList := &capsulev1beta2.TenantList{}
+		if err = n.managerReader.List(proxyRequest.GetHTTPRequest().Context(), tntList, client.MatchingFields{indexer.TenantNamespacesField: ns}); err != nil {
+			return nil, fmt.Errorf("cannot retrieve the Tenant of the namespace %s: %w", ns, err)
+		}
+
+		if len(tntList.Items) == 0 {
+			continue
+		}
+
+		byTenant[tntList.Items[0].Name] = append(byTenant[tntList.Items[0].Name], ns)
+	}
+
+	return byTenant, nil
+}
+
+func explainProxyTenant(pt *tenant.ProxyTenant) explainedProxyTenant {
+	return explainedProxyTenant{
+		Name:             pt.Tenant.Name,
+		Source:           pt.Source,
+		SourceName:       pt.SourceName,
+		Namespaces:       pt.Tenant.Status.Namespaces,
+		ClusterResources: pt.ClusterResources,
+		Operations:       allowedOperations(pt),
+	}
+}
+
+// allowedOperations returns the legacy proxy operations of the Tenant owner,
+// by kind, nil when none is allowed.
+func allowedOperations(pt *tenant.ProxyTenant) map[string][]string {
+	var allowedByKind map[string][]string
+
+	for kind, operations := range pt.ProxySetting {
+		if operations == nil {
+			continue
+		}
+
+		var allowed []string
+
+		for operation, ok := range map[capsulerbac.ProxyOperation]bool{
+			capsulerbac.ListOperation:   operations.List,
+			capsulerbac.UpdateOperation: operations.Update,
+			capsulerbac.DeleteOperation: operations.Delete,
+		} {
+			if ok {
+				allowed = append(allowed, string(operation))
+			}
+		}
+
+		if len(allowed) == 0 {
+			continue
+		}
+
+		if allowedByKind == nil {
+			allowedByKind = map[string][]string{}
+		}
+
+		slices.Sort(allowed)
+		allowedByKind[string(kind)] = allowed
+	}
+
+	return allowedByKind
+}
+
+// explainTarget returns the path and the method of the explained request.
+func explainTarget(request *http.Request) (*url.URL, string, error) {
+	query := request.URL.Query()
+
+	path := query.Get("path")
+	if !strings.HasPrefix(path, "/") {
+		return nil, "", fmt.Errorf("the path query parameter must be an absolute path, got %q", path)
+	}
+
+	target, err := url.Parse(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot parse the path %q: %w", path, err)
+	}
+
+	method := strings.ToUpper(query.Get("method"))
+	if len(method) == 0 {
+		method = http.MethodGet
+	}
+
+	if !slices.Contains([]string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}, method) {
+		return nil, "", fmt.Errorf("unsupported method %q", method)
+	}
+
+	return target, method, nil
+}
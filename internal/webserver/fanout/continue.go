@@ -0,0 +1,44 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package fanout
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+// continueToken resumes a paged cross-namespace list: the namespaces are
+// listed in order at the resourceVersion of the first page, Namespace is the
+// namespace to resume from along with its own upstream continue token.
+type continueToken struct {
+	ResourceVersion string `json:"rv"`
+	Namespace       string `json:"ns"`
+	Continue        string `json:"continue,omitempty"`
+}
+
+var errInvalidContinue = errors.New("invalid continue token")
+
+func (c continueToken) encode() (string, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeContinueToken(value string) (*continueToken, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errInvalidContinue
+	}
+
+	var token continueToken
+	if err = json.Unmarshal(data, &token); err != nil || len(token.ResourceVersion) == 0 || len(token.Namespace) == 0 {
+		return nil, errInvalidContinue
+	}
+
+	return &token, nil
+}
@@ -0,0 +1,214 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package fanout
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/projectcapsule/capsule-proxy/internal/table"
+)
+
+const (
+	contentTypeJSON     = "application/json"
+	contentTypeProtobuf = "application/vnd.kubernetes.protobuf"
+
+	// Every generated List message carries its ListMeta and items with the
+	// same field numbers, e.g. PodList or DeploymentList.
+	listMetaField  protowire.Number = 1
+	listItemsField protowire.Number = 2
+)
+
+// protobufPrefix is the magic number of the Kubernetes protobuf envelope.
+//
+//nolint:gochecknoglobals
+var protobufPrefix = []byte{0x6b, 0x38, 0x73, 0x00}
+
+// page is a List answered by the API server for one namespace, the items are
+// kept encoded since the proxy does not need to know their type.
+type page struct {
+	typeMeta        metav1.TypeMeta
+	resourceVersion string
+	continueToken   string
+	items           [][]byte
+	// protobuf is set when the API server answered with protobuf.
+	protobuf bool
+	// table is set when the API server answered with a Table.
+	table *metav1.Table
+}
+
+// len returns the number of objects of the page.
+func (p *page) len() int {
+	if p.table != nil {
+		return len(p.table.Rows)
+	}
+
+	return len(p.items)
+}
+
+type jsonList struct {
+	metav1.TypeMeta `json:",inline"`
+	Metadata        metav1.ListMeta   `json:"metadata"`
+	Items           []json.RawMessage `json:"items"`
+}
+
+// negotiate returns the encoding used with the API server and the client:
+// protobuf when the client prefers it, JSON otherwise.
+func negotiate(accept string) string {
+	for _, clause := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(clause))
+		if err != nil {
+			continue
+		}
+
+		switch {
+		case len(params["as"]) > 0:
+			continue
+		case mediaType == contentTypeProtobuf:
+			return contentTypeProtobuf
+		case mediaType == contentTypeJSON, mediaType == "*/*", mediaType == "application/*":
+			return contentTypeJSON
+		}
+	}
+
+	return contentTypeJSON
+}
+
+func decodePage(contentType string, body []byte) (*page, error) {
+	if contentType == contentTypeProtobuf {
+		return decodeProtobufPage(body)
+	}
+
+	var list jsonList
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, err
+	}
+
+	if list.Kind == table.Kind {
+		t := &metav1.Table{}
+		if err := json.Unmarshal(body, t); err != nil {
+			return nil, err
+		}
+
+		return &page{typeMeta: t.TypeMeta, resourceVersion: t.ResourceVersion, continueToken: t.Continue, table: t}, nil
+	}
+
+	p := &page{
+		typeMeta:        list.TypeMeta,
+		resourceVersion: list.Metadata.ResourceVersion,
+		continueToken:   list.Metadata.Continue,
+		items:           make([][]byte, 0, len(list.Items)),
+	}
+
+	for _, item := range list.Items {
+		p.items = append(p.items, item)
+	}
+
+	return p, nil
+}
+
+func decodeProtobufPage(body []byte) (*page, error) {
+	if !bytes.HasPrefix(body, protobufPrefix) {
+		return nil, errors.New("missing protobuf envelope")
+	}
+
+	var unknown runtime.Unknown
+	if err := unknown.Unmarshal(body[len(protobufPrefix):]); err != nil {
+		return nil, err
+	}
+
+	p := &page{typeMeta: metav1.TypeMeta{APIVersion: unknown.APIVersion, Kind: unknown.Kind}, protobuf: true}
+
+	for raw := unknown.Raw; len(raw) > 0; {
+		number, wireType, n := protowire.ConsumeTag(raw)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+
+		raw = raw[n:]
+
+		if wireType != protowire.BytesType {
+			if n = protowire.ConsumeFieldValue(number, wireType, raw); n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+
+			raw = raw[n:]
+
+			continue
+		}
+
+		value, n := protowire.ConsumeBytes(raw)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+
+		raw = raw[n:]
+
+		switch number {
+		case listMetaField:
+			var listMeta metav1.ListMeta
+			if err := listMeta.Unmarshal(value); err != nil {
+				return nil, fmt.Errorf("cannot decode list metadata: %w", err)
+			}
+
+			p.resourceVersion, p.continueToken = listMeta.ResourceVersion, listMeta.Continue
+		case listItemsField:
+			p.items = append(p.items, value)
+		}
+	}
+
+	return p, nil
+}
+
+// encodeList encodes the merged items as a List of the given type.
+func encodeList(contentType string, typeMeta metav1.TypeMeta, listMeta metav1.ListMeta, items [][]byte) ([]byte, error) {
+	if contentType == contentTypeProtobuf {
+		return encodeProtobufList(typeMeta, listMeta, items)
+	}
+
+	list := jsonList{
+		TypeMeta: typeMeta,
+		Metadata: listMeta,
+		Items:    make([]json.RawMessage, 0, len(items)),
+	}
+
+	for _, item := range items {
+		list.Items = append(list.Items, item)
+	}
+
+	return json.Marshal(list)
+}
+
+func encodeProtobufList(typeMeta metav1.TypeMeta, listMeta metav1.ListMeta, items [][]byte) ([]byte, error) {
+	meta, err := listMeta.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	raw := protowire.AppendTag(nil, listMetaField, protowire.BytesType)
+	raw = protowire.AppendBytes(raw, meta)
+
+	for _, item := range items {
+		raw = protowire.AppendTag(raw, listItemsField, protowire.BytesType)
+		raw = protowire.AppendBytes(raw, item)
+	}
+
+	envelope, err := (&runtime.Unknown{
+		TypeMeta: runtime.TypeMeta{APIVersion: typeMeta.APIVersion, Kind: typeMeta.Kind},
+		Raw:      raw,
+	}).Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	return append(append([]byte{}, protobufPrefix...), envelope...), nil
+}
@@ -0,0 +1,571 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package fanout gathers a cross-namespace list or watch by listing or
+// watching each Tenant namespace on its own and merging the results, so the
+// objects are returned whether or not they carry the Tenant label, and the
+// request can be sent with the identity of the user instead of the proxy
+// ServiceAccount.
+package fanout
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"golang.org/x/sync/errgroup"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/projectcapsule/capsule-proxy/internal/table"
+	"github.com/projectcapsule/capsule-proxy/internal/types"
+	server "github.com/projectcapsule/capsule-proxy/internal/webserver/errors"
+)
+
+const (
+	// DefaultConcurrency bounds the namespaces listed in parallel for a request.
+	DefaultConcurrency = 8
+	// DefaultResyncInterval is how often the namespaces of a watch are
+	// evaluated again.
+	DefaultResyncInterval = 10 * time.Second
+)
+
+// Lister sends the per-namespace lists and watches to the API server.
+type Lister struct {
+	transport   http.RoundTripper
+	upstream    url.URL
+	log         logr.Logger
+	concurrency int
+	resync      time.Duration
+}
+
+func New(transport http.RoundTripper, upstream url.URL, log logr.Logger) *Lister {
+	return &Lister{
+		transport:   transport,
+		upstream:    upstream,
+		log:         log,
+		concurrency: DefaultConcurrency,
+		resync:      DefaultResyncInterval,
+	}
+}
+
+// Target is the namespaced resource listed across namespaces.
+type Target struct {
+	// ListKind is the kind of the merged List, used when no namespace answered.
+	ListKind schema.GroupVersionKind
+	// Namespaces are the namespaces to list.
+	Namespaces []string
+	// Path returns the path listing the resource in a namespace.
+	Path func(namespace string) string
+	// Columns are the printer columns of the Tables synthesized for the
+	// resource, the default columns when nil.
+	Columns []apiextensionsv1.CustomResourceColumnDefinition
+}
+
+// IsWatch reports whether the request asks for a watch instead of a list.
+func IsWatch(request *http.Request) bool {
+	watch, _ := strconv.ParseBool(request.URL.Query().Get("watch"))
+
+	return watch
+}
+
+// upstreamError is a failure answered by the API server, relayed as is.
+type upstreamError struct {
+	statusCode  int
+	contentType string
+	body        []byte
+}
+
+func (u *upstreamError) Error() string {
+	return fmt.Sprintf("the API server answered with status %d", u.statusCode)
+}
+
+// fetchOptions select the page of a namespace list.
+type fetchOptions struct {
+	// resourceVersion is the snapshot read, once known.
+	resourceVersion string
+	limit           int64
+	continueToken   string
+}
+
+// listing is a cross-namespace list in progress.
+type listing struct {
+	*Lister
+
+	request     *http.Request
+	query       url.Values
+	contentType string
+	// tableVersion is the version of the Table requested by the client, if
+	// any.
+	tableVersion string
+	target       Target
+}
+
+// ServeList lists the Target namespaces with the headers of request, which
+// must already carry the identity the API server authorizes, and writes the
+// merged List.
+//
+// The first namespace is read as the client asked and the others at its exact
+// resourceVersion, so the merged List is a consistent snapshot a watch can be
+// started from: its resourceVersion is a resume token starting every
+// namespace from the snapshot. A resume token is read back as the snapshot it
+// carries, or as the most recent one when the namespaces reached different
+// resourceVersions, which cannot be read exactly. A limit pages through the
+// namespaces in order: the continue token carries the snapshot, the namespace
+// to resume and its own upstream continue token.
+//
+// A Table requested by the client is asked to the API server, the Tables of
+// the namespaces are merged.
+//
+// Namespaces the user cannot list are skipped, as the label filtering of the
+// cross-namespace list does; any other failure is returned to the client as
+// answered by the API server.
+func (l *Lister) ServeList(writer http.ResponseWriter, request *http.Request, target Target) {
+	query := request.URL.Query()
+
+	var (
+		limit int64
+		token *continueToken
+		err   error
+	)
+
+	if value := query.Get("limit"); len(value) > 0 {
+		if limit, err = strconv.ParseInt(value, 10, 64); err != nil {
+			writeStatus(writer, http.StatusBadRequest, metav1.StatusReasonBadRequest, "invalid limit: "+value)
+
+			return
+		}
+	}
+
+	if value := query.Get("continue"); len(value) > 0 {
+		if token, err = decodeContinueToken(value); err != nil {
+			writeStatus(writer, http.StatusBadRequest, metav1.StatusReasonBadRequest, err.Error())
+
+			return
+		}
+	}
+
+	query.Del("limit")
+	query.Del("continue")
+
+	if resume := decodeWatchToken(query.Get("resourceVersion")); resume != nil {
+		resourceVersion, ok := resume.snapshot()
+
+		switch {
+		case ok:
+			query.Set("resourceVersion", resourceVersion)
+		case query.Get("resourceVersionMatch") == string(metav1.ResourceVersionMatchExact):
+			writeStatus(writer, http.StatusGone, metav1.StatusReasonExpired, "the namespaces of the resourceVersion cannot be read at once")
+
+			return
+		default:
+			// The most recent snapshot is not older than any of the namespaces.
+			query.Del("resourceVersion")
+			query.Del("resourceVersionMatch")
+		}
+	}
+
+	target.Namespaces = slices.Clone(target.Namespaces)
+	slices.Sort(target.Namespaces)
+
+	ls := &listing{
+		Lister:       l,
+		request:      request,
+		query:        query,
+		contentType:  negotiate(request.Header.Get("Accept")),
+		tableVersion: table.Requested(request.Header.Get("Accept")),
+		target:       target,
+	}
+
+	var (
+		pages    []*page
+		listMeta metav1.ListMeta
+	)
+
+	if limit > 0 || token != nil {
+		pages, listMeta, err = ls.paged(limit, token)
+	} else {
+		pages, listMeta, err = ls.all()
+	}
+
+	if err != nil {
+		l.writeError(writer, err)
+
+		return
+	}
+
+	if len(listMeta.ResourceVersion) > 0 {
+		listMeta.ResourceVersion = watchToken{snapshotKey: listMeta.ResourceVersion}.encode()
+	}
+
+	ls.write(writer, pages, listMeta)
+}
+
+// all lists every namespace, in parallel once the snapshot is known.
+func (l *listing) all() ([]*page, metav1.ListMeta, error) {
+	namespaces := l.target.Namespaces
+	pages := make([]*page, len(namespaces))
+
+	var (
+		resourceVersion string
+		i               int
+	)
+
+	// The first listable namespace sets the snapshot read by the others.
+	for ; i < len(namespaces) && len(resourceVersion) == 0; i++ {
+		p, err := l.fetch(l.request.Context(), namespaces[i], fetchOptions{})
+		if err != nil {
+			return nil, metav1.ListMeta{}, err
+		}
+
+		if pages[i] = p; p != nil {
+			resourceVersion = p.resourceVersion
+		}
+	}
+
+	group, ctx := errgroup.WithContext(l.request.Context())
+	group.SetLimit(l.concurrency)
+
+	for j := i; j < len(namespaces); j++ {
+		group.Go(func() (err error) {
+			pages[j], err = l.fetch(ctx, namespaces[j], fetchOptions{resourceVersion: resourceVersion})
+
+			return err
+		})
+	}
+
+	if err := group.Wait(); err != nil {
+		return nil, metav1.ListMeta{}, err
+	}
+
+	return pages, metav1.ListMeta{ResourceVersion: resourceVersion}, nil
+}
+
+// paged lists the namespaces in order until limit items are gathered, a
+// zero limit lists the remaining namespaces of a continued list.
+func (l *listing) paged(limit int64, token *continueToken) ([]*page, metav1.ListMeta, error) {
+	namespaces := l.target.Namespaces
+
+	var resourceVersion, upstreamContinue string
+
+	if token != nil {
+		resourceVersion = token.ResourceVersion
+		// A namespace which left the Tenants since the previous page is
+		// skipped, one which joined is listed when ahead of the token.
+		start, found := slices.BinarySearch(namespaces, token.Namespace)
+		if found {
+			upstreamContinue = token.Continue
+		}
+
+		namespaces = namespaces[start:]
+	}
+
+	var (
+		pages     []*page
+		next      *continueToken
+		remaining = limit
+	)
+
+	for i := 0; i < len(namespaces); {
+		p, err := l.fetch(l.request.Context(), namespaces[i], fetchOptions{
+			resourceVersion: resourceVersion,
+			limit:           max(remaining, 0),
+			continueToken:   upstreamContinue,
+		})
+		if err != nil {
+			return nil, metav1.ListMeta{}, err
+		}
+
+		upstreamContinue = ""
+
+		if p == nil {
+			i++
+
+			continue
+		}
+
+		if len(resourceVersion) == 0 {
+			resourceVersion = p.resourceVersion
+		}
+
+		pages = append(pages, p)
+		remaining -= int64(p.len())
+
+		exhausted := limit > 0 && remaining <= 0
+
+		if len(p.continueToken) > 0 {
+			if exhausted {
+				next = &continueToken{ResourceVersion: resourceVersion, Namespace: namespaces[i], Continue: p.continueToken}
+
+				break
+			}
+
+			upstreamContinue = p.continueToken
+
+			continue
+		}
+
+		if i++; exhausted && i < len(namespaces) {
+			next = &continueToken{ResourceVersion: resourceVersion, Namespace: namespaces[i]}
+
+			break
+		}
+	}
+
+	listMeta := metav1.ListMeta{ResourceVersion: resourceVersion}
+
+	if next != nil {
+		var err error
+		if listMeta.Continue, err = next.encode(); err != nil {
+			return nil, metav1.ListMeta{}, err
+		}
+	}
+
+	return pages, listMeta, nil
+}
+
+// fetch lists a namespace, a nil page means the namespace is skipped.
+func (l *listing) fetch(ctx context.Context, namespace string, options fetchOptions) (*page, error) {
+	query := cloneQuery(l.query)
+
+	switch {
+	case len(options.continueToken) > 0:
+		// The upstream continue token carries its own resourceVersion.
+		query.Del("resourceVersion")
+		query.Del("resourceVersionMatch")
+		query.Set("continue", options.continueToken)
+	case len(options.resourceVersion) > 0:
+		query.Set("resourceVersion", options.resourceVersion)
+		query.Set("resourceVersionMatch", string(metav1.ResourceVersionMatchExact))
+	}
+
+	if options.limit > 0 {
+		query.Set("limit", strconv.FormatInt(options.limit, 10))
+	}
+
+	path := l.target.Path(namespace)
+
+	upstream := l.upstreamRequest(ctx, l.request, path, query)
+
+	if l.contentType == contentTypeProtobuf {
+		upstream.Header.Set("Accept", contentTypeProtobuf+", "+contentTypeJSON)
+	}
+
+	response, err := l.transport.RoundTrip(upstream)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	switch response.StatusCode {
+	case http.StatusOK:
+		contentType, _, _ := mime.ParseMediaType(response.Header.Get("Content-Type"))
+
+		p, decodeErr := decodePage(contentType, body)
+		if decodeErr != nil {
+			return nil, fmt.Errorf("cannot decode the list of %s: %w", path, decodeErr)
+		}
+
+		return p, nil
+	case http.StatusForbidden, http.StatusNotFound:
+		l.log.V(5).Info("skipping namespace not listable by the user", "path", path, "status", response.StatusCode)
+
+		return nil, nil
+	default:
+		return nil, &upstreamError{
+			statusCode:  response.StatusCode,
+			contentType: response.Header.Get("Content-Type"),
+			body:        body,
+		}
+	}
+}
+
+// upstreamRequest returns the request sent to the API server for path, with
+// the headers of request.
+func (l *Lister) upstreamRequest(ctx context.Context, request *http.Request, path string, query url.Values) *http.Request {
+	target := l.upstream
+	target.Path = strings.TrimSuffix(target.Path, "/") + path
+	target.RawQuery = query.Encode()
+
+	upstream := request.Clone(ctx)
+	upstream.URL = &target
+	upstream.Host = target.Host
+	upstream.RequestURI = ""
+	upstream.Header.Del("Accept-Encoding")
+	// Custom resources are only served as JSON, whatever the client prefers,
+	// the Tables are converted by the API server.
+	if len(table.Requested(request.Header.Get("Accept"))) == 0 {
+		upstream.Header.Set("Accept", contentTypeJSON)
+	}
+
+	return upstream
+}
+
+func (l *listing) write(writer http.ResponseWriter, pages []*page, listMeta metav1.ListMeta) {
+	if len(l.tableVersion) > 0 {
+		l.writeTable(writer, pages, listMeta)
+
+		return
+	}
+
+	typeMeta := metav1.TypeMeta{
+		APIVersion: l.target.ListKind.GroupVersion().String(),
+		Kind:       l.target.ListKind.Kind,
+	}
+
+	contentType := l.contentType
+
+	var items [][]byte
+
+	for _, p := range pages {
+		if p == nil {
+			continue
+		}
+
+		typeMeta = p.typeMeta
+		items = append(items, p.items...)
+		// The API server answers with JSON the resources it cannot encode
+		// with protobuf, as custom resources.
+		if !p.protobuf {
+			contentType = contentTypeJSON
+		}
+	}
+
+	body, err := encodeList(contentType, typeMeta, listMeta, items)
+	if err != nil {
+		l.writeError(writer, err)
+
+		return
+	}
+
+	writer.Header().Set("Content-Type", contentType)
+	writer.WriteHeader(http.StatusOK)
+
+	_, _ = writer.Write(body)
+}
+
+// writeTable merges the Tables of the namespaces. The Lists answered instead,
+// by API servers not serving Tables, are converted with the printer columns
+// of the Target, as is the empty List when no namespace answered.
+func (l *listing) writeTable(writer http.ResponseWriter, pages []*page, listMeta metav1.ListMeta) {
+	var tables []*metav1.Table
+
+	objects := &unstructured.UnstructuredList{}
+
+	for _, p := range pages {
+		switch {
+		case p == nil:
+		case p.table != nil:
+			tables = append(tables, p.table)
+		default:
+			for _, item := range p.items {
+				object := map[string]any{}
+				if err := json.Unmarshal(item, &object); err != nil {
+					l.writeError(writer, err)
+
+					return
+				}
+
+				objects.Items = append(objects.Items, unstructured.Unstructured{Object: object})
+			}
+		}
+	}
+
+	if len(objects.Items) > 0 || len(tables) == 0 {
+		columns := l.target.Columns
+		if columns == nil {
+			columns = table.DefaultColumns()
+		}
+
+		converted, err := table.Convert(l.request.Context(), l.tableVersion, objects, columns, metav1.IncludeObjectPolicy(l.query.Get("includeObject")))
+		if err != nil {
+			l.writeError(writer, err)
+
+			return
+		}
+
+		tables = append(tables, converted)
+	}
+
+	merged := table.Merge(tables...)
+	merged.ListMeta = listMeta
+
+	body, err := json.Marshal(merged)
+	if err != nil {
+		l.writeError(writer, err)
+
+		return
+	}
+
+	writer.Header().Set("Content-Type", contentTypeJSON)
+	writer.WriteHeader(http.StatusOK)
+
+	_, _ = writer.Write(body)
+}
+
+func (l *Lister) writeError(writer http.ResponseWriter, err error) {
+	var upstream *upstreamError
+	if errors.As(err, &upstream) {
+		if len(upstream.contentType) > 0 {
+			writer.Header().Set("Content-Type", upstream.contentType)
+		}
+
+		writer.WriteHeader(upstream.statusCode)
+
+		_, _ = writer.Write(upstream.body)
+
+		return
+	}
+
+	l.log.Error(err, "cannot list across namespaces")
+
+	server.HandleError(writer, err, "cannot list across namespaces")
+}
+
+func writeStatus(writer http.ResponseWriter, code int, reason metav1.StatusReason, message string) {
+	//nolint:errchkjson
+	body, _ := json.Marshal(&metav1.Status{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       types.StatusKind,
+			APIVersion: types.V1,
+		},
+		Status:  metav1.StatusFailure,
+		Message: message,
+		Reason:  reason,
+		Code:    int32(code), //nolint:gosec
+	})
+
+	writer.Header().Set("Content-Type", contentTypeJSON)
+	writer.WriteHeader(code)
+
+	_, _ = writer.Write(body)
+}
+
+func cloneQuery(query url.Values) url.Values {
+	clone := make(url.Values, len(query))
+	for k, v := range query {
+		clone[k] = slices.Clone(v)
+	}
+
+	return clone
+}
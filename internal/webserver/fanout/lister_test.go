@@ -0,0 +1,529 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package fanout
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer/protobuf"
+
+	"github.com/projectcapsule/capsule-proxy/internal/table"
+)
+
+const snapshot = "42"
+
+// snapshotToken is the resourceVersion of the merged Lists of the snapshot.
+//
+//nolint:gochecknoglobals
+var snapshotToken = watchToken{snapshotKey: snapshot}.encode()
+
+//nolint:gochecknoglobals
+var pods = map[string][]string{
+	"solar-dev":  {"a", "b", "c"},
+	"solar-prod": {"d"},
+	"wind-dev":   {"e", "f"},
+}
+
+func newUpstream(t *testing.T) (*Lister, *protobuf.Serializer) {
+	t.Helper()
+
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	serializer := protobuf.NewSerializer(scheme, scheme)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		query := request.URL.Query()
+
+		switch {
+		case request.Header.Get("Impersonate-User") != "alice":
+			writer.WriteHeader(http.StatusUnauthorized)
+
+			return
+		case query.Has("continue") && query.Has("resourceVersion"),
+			query.Get("resourceVersionMatch") == string(metav1.ResourceVersionMatchExact) && query.Get("resourceVersion") != snapshot:
+			// The snapshot must be read consistently across namespaces.
+			writer.WriteHeader(http.StatusBadRequest)
+
+			return
+		case query.Has("resourceVersion"):
+			// The resume tokens are not resourceVersions of the API server.
+			if _, err := strconv.ParseUint(query.Get("resourceVersion"), 10, 64); err != nil {
+				writer.WriteHeader(http.StatusBadRequest)
+
+				return
+			}
+		}
+
+		namespace := strings.Split(request.URL.Path, "/")[4]
+
+		names, ok := pods[namespace]
+
+		switch {
+		case namespace == "solar-staging":
+			writer.WriteHeader(http.StatusForbidden)
+
+			return
+		case !ok:
+			writer.Header().Set("Content-Type", "application/json")
+			writer.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = writer.Write([]byte(`{"kind":"Status","code":503}`))
+
+			return
+		}
+
+		start, _ := strconv.Atoi(query.Get("continue"))
+		limit, _ := strconv.Atoi(query.Get("limit"))
+
+		list := &corev1.PodList{ListMeta: metav1.ListMeta{ResourceVersion: snapshot}}
+		list.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("PodList"))
+
+		end := len(names)
+		if limit > 0 && start+limit < end {
+			end = start + limit
+			list.Continue = strconv.Itoa(end)
+		}
+
+		for _, name := range names[start:end] {
+			list.Items = append(list.Items, corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}})
+		}
+
+		if version := table.Requested(request.Header.Get("Accept")); len(version) > 0 {
+			writer.Header().Set("Content-Type", contentTypeJSON)
+			_ = json.NewEncoder(writer).Encode(podTable(version, list))
+
+			return
+		}
+
+		if strings.Contains(request.Header.Get("Accept"), contentTypeProtobuf) {
+			writer.Header().Set("Content-Type", contentTypeProtobuf)
+			_ = serializer.Encode(list, writer)
+
+			return
+		}
+
+		writer.Header().Set("Content-Type", contentTypeJSON)
+		_ = json.NewEncoder(writer).Encode(list)
+	}))
+	t.Cleanup(upstream.Close)
+
+	upstreamURL, err := url.Parse(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return New(http.DefaultTransport, *upstreamURL, logr.Discard()), serializer
+}
+
+// podTable converts the pods as the API server does, the production
+// namespaces have an additional column.
+func podTable(version string, list *corev1.PodList) *metav1.Table {
+	t := &metav1.Table{
+		TypeMeta: metav1.TypeMeta{APIVersion: table.Group + "/" + version, Kind: table.Kind},
+		ListMeta: list.ListMeta,
+		ColumnDefinitions: []metav1.TableColumnDefinition{
+			{Name: "Name", Type: "string"},
+			{Name: "Status", Type: "string"},
+		},
+		Rows: []metav1.TableRow{},
+	}
+
+	for _, pod := range list.Items {
+		cells := []any{pod.Name, "Running"}
+
+		if strings.HasSuffix(pod.Namespace, "-prod") {
+			t.ColumnDefinitions = append(t.ColumnDefinitions[:2], metav1.TableColumnDefinition{Name: "Node", Type: "string"})
+			cells = append(cells, "worker")
+		}
+
+		//nolint:errchkjson
+		raw, _ := json.Marshal(&metav1.PartialObjectMetadata{ObjectMeta: pod.ObjectMeta})
+		t.Rows = append(t.Rows, metav1.TableRow{Cells: cells, Object: runtime.RawExtension{Raw: raw}})
+	}
+
+	return t
+}
+
+func target(namespaces ...string) Target {
+	return Target{
+		ListKind:   schema.GroupVersionKind{Version: "v1", Kind: "PodList"},
+		Namespaces: namespaces,
+		Path: func(namespace string) string {
+			return "/api/v1/namespaces/" + namespace + "/pods"
+		},
+	}
+}
+
+func list(t *testing.T, lister *Lister, rawQuery, accept string, namespaces ...string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	return listTarget(t, lister, rawQuery, accept, target(namespaces...))
+}
+
+func listTarget(t *testing.T, lister *Lister, rawQuery, accept string, target Target) *httptest.ResponseRecorder {
+	t.Helper()
+
+	request := httptest.NewRequest(http.MethodGet, "/api/v1/pods?"+rawQuery, nil)
+	request.Header.Set("Impersonate-User", "alice")
+	request.Header.Set("Accept", accept)
+
+	recorder := httptest.NewRecorder()
+	lister.ServeList(recorder, request, target)
+
+	return recorder
+}
+
+func podNames(list *corev1.PodList) []string {
+	names := make([]string, 0, len(list.Items))
+	for _, item := range list.Items {
+		names = append(names, item.Name)
+	}
+
+	return names
+}
+
+func TestServeList(t *testing.T) {
+	t.Parallel()
+
+	lister, _ := newUpstream(t)
+
+	tests := []struct {
+		name       string
+		namespaces []string
+		wantStatus int
+		wantItems  []string
+		wantRV     string
+	}{
+		{
+			name:       "items are merged in namespace order",
+			namespaces: []string{"wind-dev", "solar-prod", "solar-dev"},
+			wantStatus: http.StatusOK,
+			wantItems:  []string{"a", "b", "c", "d", "e", "f"},
+			wantRV:     snapshotToken,
+		},
+		{
+			name:       "forbidden namespaces are skipped",
+			namespaces: []string{"solar-staging", "wind-dev"},
+			wantStatus: http.StatusOK,
+			wantItems:  []string{"e", "f"},
+			wantRV:     snapshotToken,
+		},
+		{
+			name:       "no listable namespace",
+			namespaces: []string{"solar-staging"},
+			wantStatus: http.StatusOK,
+			wantItems:  []string{},
+		},
+		{
+			name:       "upstream failures are returned",
+			namespaces: []string{"solar-dev", "oil-dev", "wind-dev"},
+			wantStatus: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			recorder := list(t, lister, "", contentTypeJSON, tt.namespaces...)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status=%d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body.String())
+			}
+
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var merged corev1.PodList
+			if err := json.Unmarshal(recorder.Body.Bytes(), &merged); err != nil {
+				t.Fatal(err)
+			}
+
+			if merged.Kind != "PodList" || merged.APIVersion != "v1" {
+				t.Fatalf("unexpected type %s/%s", merged.APIVersion, merged.Kind)
+			}
+
+			if got := podNames(&merged); !slices.Equal(got, tt.wantItems) {
+				t.Fatalf("items=%v, want %v", got, tt.wantItems)
+			}
+
+			if merged.ResourceVersion != tt.wantRV || merged.Continue != "" {
+				t.Fatalf("resourceVersion=%q continue=%q, want %q and no continue", merged.ResourceVersion, merged.Continue, tt.wantRV)
+			}
+		})
+	}
+}
+
+func TestServeListProtobuf(t *testing.T) {
+	t.Parallel()
+
+	lister, serializer := newUpstream(t)
+
+	recorder := list(t, lister, "", contentTypeProtobuf+", "+contentTypeJSON, "solar-dev", "wind-dev")
+
+	if recorder.Code != http.StatusOK || recorder.Header().Get("Content-Type") != contentTypeProtobuf {
+		t.Fatalf("status=%d content type=%q: %s", recorder.Code, recorder.Header().Get("Content-Type"), recorder.Body.String())
+	}
+
+	obj, err := runtime.Decode(serializer, recorder.Body.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	merged, ok := obj.(*corev1.PodList)
+	if !ok {
+		t.Fatalf("unexpected object %T", obj)
+	}
+
+	if got, want := podNames(merged), []string{"a", "b", "c", "e", "f"}; !slices.Equal(got, want) {
+		t.Fatalf("items=%v, want %v", got, want)
+	}
+
+	if merged.Items[3].Namespace != "wind-dev" || merged.ResourceVersion != snapshotToken {
+		t.Fatalf("unexpected list %+v", merged)
+	}
+}
+
+func TestServeListPaging(t *testing.T) {
+	t.Parallel()
+
+	lister, _ := newUpstream(t)
+
+	var (
+		pages         [][]string
+		continueToken string
+	)
+
+	for {
+		query := url.Values{"limit": {"2"}}
+		if len(continueToken) > 0 {
+			query.Set("continue", continueToken)
+		}
+
+		recorder := list(t, lister, query.Encode(), contentTypeJSON, "wind-dev", "solar-staging", "solar-prod", "solar-dev")
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("status=%d: %s", recorder.Code, recorder.Body.String())
+		}
+
+		var page corev1.PodList
+		if err := json.Unmarshal(recorder.Body.Bytes(), &page); err != nil {
+			t.Fatal(err)
+		}
+
+		if page.ResourceVersion != snapshotToken {
+			t.Fatalf("resourceVersion=%q, want %q", page.ResourceVersion, snapshotToken)
+		}
+
+		pages = append(pages, podNames(&page))
+
+		if continueToken = page.Continue; len(continueToken) == 0 {
+			break
+		}
+
+		if len(pages) > 5 {
+			t.Fatalf("paging does not end: %v", pages)
+		}
+	}
+
+	if got, want := fmt.Sprint(pages), "[[a b] [c d] [e f]]"; got != want {
+		t.Fatalf("pages=%s, want %s", got, want)
+	}
+}
+
+func TestServeListResumeToken(t *testing.T) {
+	t.Parallel()
+
+	lister, _ := newUpstream(t)
+
+	bookmark := watchToken{"solar-dev": "40", "wind-dev": snapshot}.encode()
+
+	tests := []struct {
+		name       string
+		query      url.Values
+		wantStatus int
+	}{
+		{
+			name:       "snapshot of a merged List",
+			query:      url.Values{"resourceVersion": {snapshotToken}, "resourceVersionMatch": {string(metav1.ResourceVersionMatchExact)}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "resourceVersions of a BOOKMARK",
+			query:      url.Values{"resourceVersion": {bookmark}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "resourceVersions of a BOOKMARK not older than",
+			query:      url.Values{"resourceVersion": {bookmark}, "resourceVersionMatch": {string(metav1.ResourceVersionMatchNotOlderThan)}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "resourceVersions of a BOOKMARK read exactly",
+			query:      url.Values{"resourceVersion": {bookmark}, "resourceVersionMatch": {string(metav1.ResourceVersionMatchExact)}},
+			wantStatus: http.StatusGone,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			recorder := list(t, lister, tt.query.Encode(), contentTypeJSON, "solar-dev", "wind-dev")
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status=%d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body.String())
+			}
+
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var merged corev1.PodList
+			if err := json.Unmarshal(recorder.Body.Bytes(), &merged); err != nil {
+				t.Fatal(err)
+			}
+
+			if got, want := podNames(&merged), []string{"a", "b", "c", "e", "f"}; !slices.Equal(got, want) {
+				t.Fatalf("items=%v, want %v", got, want)
+			}
+
+			if merged.ResourceVersion != snapshotToken {
+				t.Fatalf("resourceVersion=%q, want %q", merged.ResourceVersion, snapshotToken)
+			}
+		})
+	}
+}
+
+func TestServeListInvalidContinue(t *testing.T) {
+	t.Parallel()
+
+	lister, _ := newUpstream(t)
+
+	for _, query := range []string{"continue=not-a-token", "limit=many"} {
+		recorder := list(t, lister, query, contentTypeJSON, "solar-dev")
+
+		if recorder.Code != http.StatusBadRequest {
+			t.Fatalf("%s: status=%d, want %d", query, recorder.Code, http.StatusBadRequest)
+		}
+
+		var status metav1.Status
+		if err := json.Unmarshal(recorder.Body.Bytes(), &status); err != nil {
+			t.Fatal(err)
+		}
+
+		if status.Reason != metav1.StatusReasonBadRequest {
+			t.Fatalf("%s: reason=%q, want %q", query, status.Reason, metav1.StatusReasonBadRequest)
+		}
+	}
+}
+
+func TestServeListTable(t *testing.T) {
+	t.Parallel()
+
+	lister, _ := newUpstream(t)
+
+	const accept = "application/json;as=Table;v=v1;g=meta.k8s.io,application/json"
+
+	columns := []apiextensionsv1.CustomResourceColumnDefinition{
+		{Name: "Phase", Type: "string", JSONPath: ".status.phase"},
+	}
+
+	tests := []struct {
+		name        string
+		rawQuery    string
+		namespaces  []string
+		columns     []apiextensionsv1.CustomResourceColumnDefinition
+		wantColumns string
+		wantCells   string
+		wantRV      string
+		wantMore    bool
+	}{
+		{
+			name:        "rows and columns are merged",
+			namespaces:  []string{"wind-dev", "solar-prod", "solar-staging"},
+			wantColumns: "[Name Status Node]",
+			wantCells:   "[[d Running worker] [e Running <nil>] [f Running <nil>]]",
+			wantRV:      snapshotToken,
+		},
+		{
+			name:        "rows are paged",
+			rawQuery:    "limit=2",
+			namespaces:  []string{"solar-dev", "wind-dev"},
+			wantColumns: "[Name Status]",
+			wantCells:   "[[a Running] [b Running]]",
+			wantRV:      snapshotToken,
+			wantMore:    true,
+		},
+		{
+			name:        "empty Table with the default columns",
+			namespaces:  []string{"solar-staging"},
+			wantColumns: "[Name Age]",
+			wantCells:   "[]",
+		},
+		{
+			name:        "empty Table with the printer columns",
+			namespaces:  []string{"solar-staging"},
+			columns:     columns,
+			wantColumns: "[Name Phase]",
+			wantCells:   "[]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tgt := target(tt.namespaces...)
+			tgt.Columns = tt.columns
+
+			recorder := listTarget(t, lister, tt.rawQuery, accept, tgt)
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status=%d: %s", recorder.Code, recorder.Body.String())
+			}
+
+			var got metav1.Table
+			if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+
+			if got.Kind != table.Kind || got.APIVersion != "meta.k8s.io/v1" {
+				t.Fatalf("unexpected type %s/%s", got.APIVersion, got.Kind)
+			}
+
+			columns := make([]string, 0, len(got.ColumnDefinitions))
+			for _, column := range got.ColumnDefinitions {
+				columns = append(columns, column.Name)
+			}
+
+			cells := make([][]any, 0, len(got.Rows))
+			for _, row := range got.Rows {
+				cells = append(cells, row.Cells)
+			}
+
+			if fmt.Sprint(columns) != tt.wantColumns || fmt.Sprint(cells) != tt.wantCells {
+				t.Fatalf("columns=%v cells=%v, want %s and %s", columns, cells, tt.wantColumns, tt.wantCells)
+			}
+
+			if got.ResourceVersion != tt.wantRV || (len(got.Continue) > 0) != tt.wantMore {
+				t.Fatalf("resourceVersion=%q continue=%q", got.ResourceVersion, got.Continue)
+			}
+		})
+	}
+}
@@ -0,0 +1,548 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package fanout
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+
+	"github.com/projectcapsule/capsule-proxy/internal/table"
+	"github.com/projectcapsule/capsule-proxy/internal/types"
+)
+
+// reconnectDelay is the pause before a namespace watch closed by the API
+// server is opened again.
+const reconnectDelay = time.Second
+
+// NamespacesFunc returns the namespaces a watch spans, it is called again
+// every resync interval to follow the namespaces joining or leaving the
+// Tenants.
+type NamespacesFunc func(ctx context.Context) ([]string, error)
+
+// watchToken resumes a multiplexed watch, with the resourceVersion reached
+// in each namespace. It is sent to the client as the resourceVersion of the
+// BOOKMARK events and of the merged Lists, whose snapshot is the
+// resourceVersion of every namespace.
+type watchToken map[string]string
+
+// snapshotKey holds the resourceVersion of the namespaces missing from a
+// token, no namespace being named after it.
+const snapshotKey = ""
+
+// resourceVersion returns the resourceVersion the namespace resumes from.
+func (w watchToken) resourceVersion(namespace string) string {
+	if resourceVersion, ok := w[namespace]; ok {
+		return resourceVersion
+	}
+
+	return w[snapshotKey]
+}
+
+// snapshot returns the resourceVersion every namespace of the token reached,
+// false when they differ.
+func (w watchToken) snapshot() (string, bool) {
+	var snapshot string
+
+	for _, resourceVersion := range w {
+		if len(snapshot) > 0 && resourceVersion != snapshot {
+			return "", false
+		}
+
+		snapshot = resourceVersion
+	}
+
+	return snapshot, len(snapshot) > 0
+}
+
+func (w watchToken) encode() string {
+	//nolint:errchkjson
+	data, _ := json.Marshal(w)
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeWatchToken returns the resourceVersion of each namespace, a nil
+// token means value is a plain resourceVersion.
+func decodeWatchToken(value string) watchToken {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil
+	}
+
+	var token watchToken
+	if err = json.Unmarshal(data, &token); err != nil || token == nil {
+		return nil
+	}
+
+	return token
+}
+
+type watchEvent struct {
+	Type   watch.EventType `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+type eventObject struct {
+	Kind     string            `json:"kind"`
+	Metadata metav1.ObjectMeta `json:"metadata"`
+	// Rows hold the object of the event when the client watches a Table.
+	Rows []struct {
+		Object struct {
+			Metadata metav1.ObjectMeta `json:"metadata"`
+		} `json:"object"`
+	} `json:"rows"`
+}
+
+// metadata returns the metadata of the object of the event, the one of its
+// row for a Table.
+func (e eventObject) metadata() metav1.ObjectMeta {
+	if e.Kind == table.Kind && len(e.Rows) > 0 {
+		metadata := e.Rows[0].Object.Metadata
+		if len(metadata.ResourceVersion) == 0 {
+			metadata.ResourceVersion = e.Metadata.ResourceVersion
+		}
+
+		return metadata
+	}
+
+	return e.Metadata
+}
+
+// namespacedEvent is sent by a namespace watch to the multiplexer.
+type namespacedEvent struct {
+	id        int
+	namespace string
+	event     watchEvent
+	metadata  metav1.ObjectMeta
+	// gone reports the namespace cannot be watched by the user anymore.
+	gone bool
+	err  error
+}
+
+type namespaceWatch struct {
+	id     int
+	cancel context.CancelFunc
+	// initialEventsEnd is set once the initial events were received.
+	initialEventsEnd bool
+	// objects are the objects received from the namespace, by name.
+	objects map[string]json.RawMessage
+}
+
+// multiplexer merges the namespace watches into a single stream.
+type multiplexer struct {
+	*Lister
+
+	request *http.Request
+	target  Target
+	encoder *json.Encoder
+	flusher http.Flusher
+
+	bookmarks     bool
+	initialEvents bool
+
+	wg               sync.WaitGroup
+	events           chan namespacedEvent
+	nextID           int
+	watches          map[string]*namespaceWatch
+	resourceVersions watchToken
+}
+
+// ServeWatch opens a watch on each of the Target namespaces with the headers
+// of request and merges their events in a single stream.
+//
+// Objects are not rewritten, BOOKMARK events carry a resume token with the
+// resourceVersion reached in each namespace instead, since the events of the
+// namespaces are not ordered with one another. For the same reason a watch of
+// several namespaces cannot be resumed from a plain resourceVersion, as the
+// one of an object, and is answered as expired so the client lists again:
+// the merged Lists carry a resume token.
+//
+// The namespaces are evaluated again every resync interval: a namespace
+// joining is watched from its current state, so its objects are sent as
+// ADDED, a namespace leaving is no longer watched and the objects received
+// from it are sent as DELETED. A namespace watch closed by the API server is
+// opened again from the last resourceVersion received.
+func (l *Lister) ServeWatch(writer http.ResponseWriter, request *http.Request, target Target, namespaces NamespacesFunc) {
+	query := request.URL.Query()
+
+	m := &multiplexer{
+		Lister:           l,
+		request:          request,
+		target:           target,
+		encoder:          json.NewEncoder(writer),
+		events:           make(chan namespacedEvent),
+		watches:          map[string]*namespaceWatch{},
+		resourceVersions: watchToken{},
+	}
+
+	m.flusher, _ = writer.(http.Flusher)
+	m.bookmarks, _ = strconv.ParseBool(query.Get("allowWatchBookmarks"))
+	m.initialEvents, _ = strconv.ParseBool(query.Get("sendInitialEvents"))
+
+	ctx := request.Context()
+
+	if timeout, err := strconv.ParseInt(query.Get("timeoutSeconds"), 10, 64); err == nil && timeout > 0 {
+		var cancelTimeout context.CancelFunc
+
+		ctx, cancelTimeout = context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+		defer cancelTimeout()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	defer m.wg.Wait()
+	defer cancel()
+
+	resourceVersion := query.Get("resourceVersion")
+
+	token := decodeWatchToken(resourceVersion)
+	if token == nil && len(resourceVersion) > 0 && resourceVersion != "0" && len(target.Namespaces) > 1 {
+		writeStatus(writer, http.StatusGone, metav1.StatusReasonExpired, "a watch across namespaces is resumed from the resourceVersion of a List or a BOOKMARK")
+
+		return
+	}
+
+	for _, namespace := range target.Namespaces {
+		switch {
+		case token == nil:
+			m.resourceVersions[namespace] = resourceVersion
+		case len(token.resourceVersion(namespace)) > 0:
+			m.resourceVersions[namespace] = token.resourceVersion(namespace)
+		}
+	}
+
+	writer.Header().Set("Content-Type", contentTypeJSON)
+	writer.WriteHeader(http.StatusOK)
+	m.flush()
+
+	m.sync(ctx, target.Namespaces)
+
+	ticker := time.NewTicker(l.resync)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			current, err := namespaces(ctx)
+			if err != nil {
+				l.log.Error(err, "cannot evaluate the namespaces of the watch")
+
+				continue
+			}
+
+			if m.sync(ctx, current) && m.initialEventsSent() {
+				m.writeBookmark(false)
+			}
+		case e := <-m.events:
+			if !m.handle(e) {
+				return
+			}
+		}
+	}
+}
+
+// sync starts watching the namespaces joining and stops watching the ones
+// leaving, it reports whether the namespaces changed.
+func (m *multiplexer) sync(ctx context.Context, namespaces []string) (changed bool) {
+	current := make(map[string]bool, len(namespaces))
+
+	for _, namespace := range namespaces {
+		current[namespace] = true
+
+		if _, ok := m.watches[namespace]; ok {
+			continue
+		}
+
+		m.start(ctx, namespace, m.resourceVersions[namespace])
+
+		changed = true
+	}
+
+	for namespace := range m.watches {
+		if current[namespace] {
+			continue
+		}
+
+		m.leave(namespace)
+
+		changed = true
+	}
+
+	return changed
+}
+
+func (m *multiplexer) start(ctx context.Context, namespace, resourceVersion string) {
+	watchCtx, cancel := context.WithCancel(ctx)
+
+	m.nextID++
+	m.watches[namespace] = &namespaceWatch{id: m.nextID, cancel: cancel, objects: map[string]json.RawMessage{}}
+
+	m.wg.Add(1)
+
+	go m.watch(watchCtx, m.nextID, namespace, resourceVersion)
+}
+
+// leave stops watching the namespace and deletes the objects received from it.
+func (m *multiplexer) leave(namespace string) {
+	w := m.watches[namespace]
+	w.cancel()
+
+	delete(m.watches, namespace)
+	delete(m.resourceVersions, namespace)
+
+	for _, object := range w.objects {
+		m.write(watchEvent{Type: watch.Deleted, Object: object})
+	}
+}
+
+// handle processes an event of a namespace, it returns false when the
+// stream is over.
+func (m *multiplexer) handle(e namespacedEvent) bool {
+	w, ok := m.watches[e.namespace]
+	if !ok || w.id != e.id {
+		// The namespace left while the event was sent.
+		return true
+	}
+
+	switch {
+	case e.err != nil:
+		m.writeError(e.err)
+
+		return false
+	case e.gone:
+		m.log.V(5).Info("namespace not watchable by the user anymore", "namespace", e.namespace)
+		m.leave(e.namespace)
+
+		return true
+	}
+
+	if len(e.metadata.ResourceVersion) > 0 {
+		m.resourceVersions[e.namespace] = e.metadata.ResourceVersion
+	}
+
+	switch e.event.Type {
+	case watch.Bookmark:
+		if e.metadata.Annotations[metav1.InitialEventsAnnotationKey] == "true" && !w.initialEventsEnd {
+			w.initialEventsEnd = true
+
+			if m.initialEventsSent() {
+				m.writeBookmark(m.initialEvents)
+			}
+
+			return true
+		}
+
+		if m.initialEventsSent() {
+			m.writeBookmark(false)
+		}
+	case watch.Error:
+		m.write(e.event)
+
+		return false
+	case watch.Deleted:
+		delete(w.objects, e.metadata.Name)
+		m.write(e.event)
+	default:
+		w.objects[e.metadata.Name] = e.event.Object
+		m.write(e.event)
+	}
+
+	return true
+}
+
+// initialEventsSent reports whether every namespace sent its initial events,
+// which is always the case when they were not requested.
+func (m *multiplexer) initialEventsSent() bool {
+	if !m.initialEvents {
+		return true
+	}
+
+	for _, w := range m.watches {
+		if !w.initialEventsEnd {
+			return false
+		}
+	}
+
+	return true
+}
+
+// watch streams the events of a namespace to the multiplexer.
+func (m *multiplexer) watch(ctx context.Context, id int, namespace, resourceVersion string) {
+	defer m.wg.Done()
+
+	send := func(e namespacedEvent) bool {
+		e.id, e.namespace = id, namespace
+
+		select {
+		case m.events <- e:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	for {
+		response, err := m.open(ctx, namespace, resourceVersion)
+
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err != nil:
+			send(namespacedEvent{err: err})
+
+			return
+		}
+
+		switch response.StatusCode {
+		case http.StatusOK:
+		case http.StatusForbidden, http.StatusNotFound:
+			_ = response.Body.Close()
+
+			send(namespacedEvent{gone: true})
+
+			return
+		default:
+			body, _ := io.ReadAll(response.Body)
+			_ = response.Body.Close()
+
+			send(namespacedEvent{err: &upstreamError{statusCode: response.StatusCode, contentType: response.Header.Get("Content-Type"), body: body}})
+
+			return
+		}
+
+		decoder := json.NewDecoder(response.Body)
+
+		for {
+			var e namespacedEvent
+			if err = decoder.Decode(&e.event); err != nil {
+				break
+			}
+
+			var object eventObject
+			if e.event.Type != watch.Error {
+				_ = json.Unmarshal(e.event.Object, &object)
+			}
+
+			e.metadata = object.metadata()
+			if len(e.metadata.ResourceVersion) > 0 {
+				resourceVersion = e.metadata.ResourceVersion
+			}
+
+			if !send(e) {
+				break
+			}
+		}
+
+		_ = response.Body.Close()
+
+		// The API server closes the watches after a while, the namespace is
+		// watched again from the last resourceVersion received.
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+func (m *multiplexer) open(ctx context.Context, namespace, resourceVersion string) (*http.Response, error) {
+	query := m.request.URL.Query()
+	query.Del("resourceVersion")
+	query.Del("timeoutSeconds")
+	// The bookmarks keep the resourceVersion of quiet namespaces up to date.
+	query.Set("allowWatchBookmarks", "true")
+
+	if len(resourceVersion) > 0 {
+		query.Set("resourceVersion", resourceVersion)
+	}
+
+	return m.transport.RoundTrip(m.upstreamRequest(ctx, m.request, m.target.Path(namespace), query))
+}
+
+func (m *multiplexer) write(e watchEvent) {
+	if err := m.encoder.Encode(e); err != nil {
+		m.log.V(5).Info("cannot write watch event", "error", err.Error())
+	}
+
+	m.flush()
+}
+
+// writeBookmark sends the resume token to the client, when it asked for
+// bookmarks.
+func (m *multiplexer) writeBookmark(initialEventsEnd bool) {
+	if !m.bookmarks {
+		return
+	}
+
+	metadata := map[string]any{"resourceVersion": m.resourceVersions.encode()}
+	if initialEventsEnd {
+		metadata["annotations"] = map[string]string{metav1.InitialEventsAnnotationKey: "true"}
+	}
+
+	object := map[string]any{
+		"apiVersion": m.target.ListKind.GroupVersion().String(),
+		"kind":       strings.TrimSuffix(m.target.ListKind.Kind, "List"),
+		"metadata":   metadata,
+	}
+
+	// The bookmarks of a Table watch are Tables carrying the resourceVersion.
+	if version := table.Requested(m.request.Header.Get("Accept")); len(version) > 0 {
+		delete(metadata, "annotations")
+
+		object["apiVersion"], object["kind"] = schema.GroupVersion{Group: table.Group, Version: version}.String(), table.Kind
+	}
+
+	//nolint:errchkjson
+	raw, _ := json.Marshal(object)
+
+	m.write(watchEvent{Type: watch.Bookmark, Object: raw})
+}
+
+// writeError ends the stream with an ERROR event.
+func (m *multiplexer) writeError(err error) {
+	status := &metav1.Status{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       types.StatusKind,
+			APIVersion: types.V1,
+		},
+		Status:  metav1.StatusFailure,
+		Message: err.Error(),
+		Reason:  metav1.StatusReasonInternalError,
+		Code:    http.StatusInternalServerError,
+	}
+
+	var upstream *upstreamError
+	if errors.As(err, &upstream) {
+		if json.Unmarshal(upstream.body, status) != nil || status.Code == 0 {
+			status.Code = int32(upstream.statusCode) //nolint:gosec
+		}
+	}
+
+	m.log.Error(err, "cannot watch across namespaces")
+
+	//nolint:errchkjson
+	raw, _ := json.Marshal(status)
+
+	m.write(watchEvent{Type: watch.Error, Object: raw})
+}
+
+func (m *multiplexer) flush() {
+	if m.flusher != nil {
+		m.flusher.Flush()
+	}
+}
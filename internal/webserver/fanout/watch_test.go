@@ -0,0 +1,315 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package fanout
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// watchUpstream serves one pod per namespace followed by a bookmark, and
+// records the resourceVersion each namespace is watched from.
+type watchUpstream struct {
+	mu       sync.Mutex
+	requests map[string][]string
+}
+
+func (w *watchUpstream) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	query := request.URL.Query()
+	namespace := strings.Split(request.URL.Path, "/")[4]
+
+	w.mu.Lock()
+	w.requests[namespace] = append(w.requests[namespace], query.Get("resourceVersion"))
+	w.mu.Unlock()
+
+	switch {
+	case query.Get("watch") != "true" || query.Get("allowWatchBookmarks") != "true":
+		writer.WriteHeader(http.StatusBadRequest)
+
+		return
+	case namespace == "solar-staging":
+		writer.WriteHeader(http.StatusForbidden)
+
+		return
+	}
+
+	writer.Header().Set("Content-Type", contentTypeJSON)
+	writer.WriteHeader(http.StatusOK)
+
+	encoder := json.NewEncoder(writer)
+	_ = encoder.Encode(map[string]any{
+		"type":   watch.Added,
+		"object": map[string]any{"kind": "Pod", "metadata": map[string]any{"name": "nginx", "namespace": namespace, "resourceVersion": "10"}},
+	})
+	_ = encoder.Encode(map[string]any{
+		"type":   watch.Bookmark,
+		"object": map[string]any{"kind": "Pod", "metadata": map[string]any{"resourceVersion": "11"}},
+	})
+
+	writer.(http.Flusher).Flush()
+
+	<-request.Context().Done()
+}
+
+func (w *watchUpstream) watchedFrom(namespace string) []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.requests[namespace]
+}
+
+type receivedEvent struct {
+	Type   watch.EventType `json:"type"`
+	Object struct {
+		Kind     string            `json:"kind"`
+		Metadata metav1.ObjectMeta `json:"metadata"`
+	} `json:"object"`
+}
+
+// startWatch serves the multiplexed watch and returns its events.
+func startWatch(t *testing.T, rawQuery string, initial []string, namespaces NamespacesFunc) (*watchUpstream, <-chan receivedEvent) {
+	t.Helper()
+
+	upstream := &watchUpstream{requests: map[string][]string{}}
+
+	upstreamServer := httptest.NewServer(upstream)
+	t.Cleanup(upstreamServer.Close)
+
+	upstreamURL, err := url.Parse(upstreamServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lister := New(http.DefaultTransport, *upstreamURL, logr.Discard())
+	lister.resync = 10 * time.Millisecond
+
+	proxy := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		lister.ServeWatch(writer, request, target(initial...), namespaces)
+	}))
+	t.Cleanup(proxy.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, proxy.URL+"/api/v1/pods?"+rawQuery, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := make(chan receivedEvent)
+
+	go func() {
+		defer close(events)
+		defer response.Body.Close()
+
+		decoder := json.NewDecoder(response.Body)
+
+		for {
+			var event receivedEvent
+			if decoder.Decode(&event) != nil {
+				return
+			}
+
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return upstream, events
+}
+
+// next returns the next event matching the filter.
+func next(t *testing.T, events <-chan receivedEvent, filter func(receivedEvent) bool) receivedEvent {
+	t.Helper()
+
+	timeout := time.After(10 * time.Second)
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				t.Fatal("the watch ended")
+			}
+
+			if filter(event) {
+				return event
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for the event")
+		}
+	}
+}
+
+func TestServeWatch(t *testing.T) {
+	t.Parallel()
+
+	var changed atomic.Bool
+
+	// The namespaces are evaluated again while the watch is running: once the
+	// first events are received, solar-dev leaves and wind-dev joins.
+	namespaces := func(context.Context) ([]string, error) {
+		if changed.Load() {
+			return []string{"solar-prod", "wind-dev"}, nil
+		}
+
+		return []string{"solar-dev", "solar-prod"}, nil
+	}
+
+	upstream, events := startWatch(t, "watch=true&allowWatchBookmarks=true&resourceVersion="+snapshotToken, []string{"solar-dev", "solar-prod", "solar-staging"}, namespaces)
+
+	added := map[string]bool{}
+	for len(added) < 2 {
+		event := next(t, events, func(e receivedEvent) bool { return e.Type == watch.Added })
+		added[event.Object.Metadata.Namespace] = true
+	}
+
+	if !added["solar-dev"] || !added["solar-prod"] {
+		t.Fatalf("expected the pods of solar-dev and solar-prod, got %v", added)
+	}
+
+	changed.Store(true)
+
+	deleted := next(t, events, func(e receivedEvent) bool { return e.Type == watch.Deleted })
+	if deleted.Object.Metadata.Namespace != "solar-dev" {
+		t.Fatalf("expected the pod of solar-dev deleted, got %+v", deleted.Object.Metadata)
+	}
+
+	joined := next(t, events, func(e receivedEvent) bool { return e.Type == watch.Added })
+	if joined.Object.Metadata.Namespace != "wind-dev" {
+		t.Fatalf("expected the pod of wind-dev added, got %+v", joined.Object.Metadata)
+	}
+
+	// The namespaces of the initial watch start from the snapshot, the one
+	// joining from its current state.
+	if got := fmt.Sprint(upstream.watchedFrom("solar-prod")); got != "["+snapshot+"]" {
+		t.Fatalf("solar-prod watched from %s", got)
+	}
+
+	if got := fmt.Sprint(upstream.watchedFrom("wind-dev")); got != "[]" {
+		t.Fatalf("wind-dev watched from %s", got)
+	}
+
+	bookmark := next(t, events, func(e receivedEvent) bool {
+		token := decodeWatchToken(e.Object.Metadata.ResourceVersion)
+
+		return e.Type == watch.Bookmark && token["wind-dev"] == "11" && token["solar-prod"] == "11"
+	})
+
+	if bookmark.Object.Kind != "Pod" {
+		t.Fatalf("bookmark kind=%q, want Pod", bookmark.Object.Kind)
+	}
+
+	if token := decodeWatchToken(bookmark.Object.Metadata.ResourceVersion); len(token) != 2 {
+		t.Fatalf("expected the resume token of the current namespaces, got %v", token)
+	}
+}
+
+func TestServeWatchResume(t *testing.T) {
+	t.Parallel()
+
+	token := watchToken{"solar-dev": "7", "solar-prod": "9"}.encode()
+
+	namespaces := func(context.Context) ([]string, error) {
+		return []string{"solar-dev", "solar-prod"}, nil
+	}
+
+	upstream, events := startWatch(t, "watch=true&resourceVersion="+token, []string{"solar-dev", "solar-prod"}, namespaces)
+
+	for range 2 {
+		next(t, events, func(e receivedEvent) bool {
+			// Without allowWatchBookmarks the bookmarks are not sent.
+			if e.Type == watch.Bookmark {
+				t.Fatal("unexpected bookmark")
+			}
+
+			return e.Type == watch.Added
+		})
+	}
+
+	if got := fmt.Sprint(upstream.watchedFrom("solar-dev"), upstream.watchedFrom("solar-prod")); got != "[7] [9]" {
+		t.Fatalf("namespaces watched from %s, want [7] [9]", got)
+	}
+}
+
+func TestServeWatchPlainResourceVersion(t *testing.T) {
+	t.Parallel()
+
+	lister := New(http.DefaultTransport, url.URL{}, logr.Discard())
+
+	request := httptest.NewRequest(http.MethodGet, "/api/v1/pods?watch=true&resourceVersion=10", nil)
+	recorder := httptest.NewRecorder()
+
+	lister.ServeWatch(recorder, request, target("solar-dev", "solar-prod"), func(context.Context) ([]string, error) {
+		return []string{"solar-dev", "solar-prod"}, nil
+	})
+
+	// The resourceVersion of an object does not tell where the other
+	// namespaces are.
+	if recorder.Code != http.StatusGone {
+		t.Fatalf("status=%d, want %d: %s", recorder.Code, http.StatusGone, recorder.Body.String())
+	}
+}
+
+func TestEventObjectMetadata(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		object string
+		want   string
+	}{
+		{
+			name:   "object",
+			object: `{"kind":"Pod","metadata":{"name":"nginx","namespace":"solar-dev","resourceVersion":"10"}}`,
+			want:   "solar-dev/nginx@10",
+		},
+		{
+			name:   "Table row",
+			object: `{"kind":"Table","metadata":{},"rows":[{"cells":["nginx"],"object":{"kind":"PartialObjectMetadata","metadata":{"name":"nginx","namespace":"solar-dev","resourceVersion":"10"}}}]}`,
+			want:   "solar-dev/nginx@10",
+		},
+		{
+			name:   "Table bookmark",
+			object: `{"kind":"Table","metadata":{"resourceVersion":"11"}}`,
+			want:   "/@11",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var object eventObject
+			if err := json.Unmarshal([]byte(tt.object), &object); err != nil {
+				t.Fatal(err)
+			}
+
+			metadata := object.metadata()
+			if got := metadata.Namespace + "/" + metadata.Name + "@" + metadata.ResourceVersion; got != tt.want {
+				t.Fatalf("metadata=%s, want %s", got, tt.want)
+			}
+		})
+	}
+}
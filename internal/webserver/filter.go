@@ -4,6 +4,7 @@
 package webserver
 
 import (
+	"context"
 	"net/http"
 
 	"sigs.k8s.io/controller-runtime/pkg/manager"
@@ -13,4 +14,10 @@ type Filter interface {
 	manager.Runnable
 	ReadinessProbe(req *http.Request) error
 	LivenessProbe(req *http.Request) error
+	// DiscoveryProbe reports the API group versions whose resources are not
+	// routed since their discovery failed.
+	DiscoveryProbe(req *http.Request) error
+	// RefreshRoutes rebuilds the module routes from the discovered API
+	// resources.
+	RefreshRoutes(ctx context.Context) error
 }
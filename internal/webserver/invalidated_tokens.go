@@ -0,0 +1,52 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package webserver
+
+import (
+	"fmt"
+	"net/http"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+
+	req "github.com/projectcapsule/capsule-proxy/internal/request"
+	server "github.com/projectcapsule/capsule-proxy/internal/webserver/errors"
+)
+
+// InvalidatedTokensPath is the endpoint the operators forget the tokens
+// rejected by a TokenReview with, e.g. when a token was rejected by mistake:
+// a DELETE purges the invalidated tokens of the replica answering it. The
+// caller must be allowed to delete the non-resource URL.
+const InvalidatedTokensPath = "/_capsule/invalidated-tokens"
+
+func (n *kubeFilter) purgeInvalidatedTokensHandler(writer http.ResponseWriter, request *http.Request) {
+	request, username, groups, err := req.ResolveUserAndGroups(request, n.authTypes, n.usernameClaimField, n.writer, n.ignoredImpersonationGroups, n.impersonationGroupsRegexp, n.skipImpersonationReview, n.xfcc_header, n.tokenAuthenticator)
+	if err != nil {
+		n.handleResolveUserAndGroupsError(writer, err)
+
+		return
+	}
+
+	sar := &authorizationv1.SubjectAccessReview{}
+	sar.Spec.User = username
+	sar.Spec.Groups = groups
+	sar.Spec.NonResourceAttributes = &authorizationv1.NonResourceAttributes{Path: InvalidatedTokensPath, Verb: "delete"}
+
+	if err = n.writer.Create(request.Context(), sar); err != nil {
+		server.HandleError(writer, err, "cannot review the access")
+
+		return
+	}
+
+	if !sar.Status.Allowed {
+		server.HandleUnauthorized(writer, fmt.Errorf("user %s cannot delete %s", username, InvalidatedTokensPath), "cannot purge the invalidated tokens")
+
+		return
+	}
+
+	n.invalidatedTokens.PurgeAll()
+
+	n.log.Info("invalidated tokens purged", "username", username)
+
+	writer.WriteHeader(http.StatusNoContent)
+}
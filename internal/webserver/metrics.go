@@ -0,0 +1,23 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package webserver
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+//nolint:gochecknoinits
+func init() {
+	metrics.Registry.MustRegister(unavailableGroups)
+}
+
+//nolint:gochecknoglobals
+var unavailableGroups = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "capsule_proxy_discovery_unavailable_groups",
+		Help: "Group versions the discovery failed for, whose resources are not routed by the proxy",
+	},
+	[]string{"group_version"},
+)
@@ -0,0 +1,199 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package middleware
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// DefaultInvalidatedTokenTTL is how long a rejected token without an exp
+	// claim, such as an opaque token, is remembered.
+	DefaultInvalidatedTokenTTL = 5 * time.Minute
+	// DefaultInvalidatedTokenMaxTTL bounds how long any rejected token is
+	// remembered: the exp claim is not verified and cannot be trusted to
+	// bound the entry on its own.
+	DefaultInvalidatedTokenMaxTTL = time.Hour
+	// DefaultInvalidatedTokensSize is the maximum number of rejected tokens
+	// remembered, the least recently used ones are forgotten first.
+	DefaultInvalidatedTokensSize = 4096
+)
+
+type tokenHash [sha256.Size]byte
+
+type invalidatedToken struct {
+	hash    tokenHash
+	expires time.Time
+}
+
+// InvalidatedTokens remembers the tokens rejected by a TokenReview, so they
+// are refused without asking the API server again. Tokens are stored by their
+// SHA-256 hash and forgotten once they expire: a JWT is remembered until its
+// exp claim, any other token for the fallback TTL, and no token longer than
+// the maximum TTL. At most size tokens are remembered.
+type InvalidatedTokens struct {
+	fallbackTTL time.Duration
+	maxTTL      time.Duration
+	size        int
+	now         func() time.Time
+
+	mu        sync.Mutex
+	order     *list.List
+	entries   map[tokenHash]*list.Element
+	lastSweep time.Time
+}
+
+func NewInvalidatedTokens(fallbackTTL, maxTTL time.Duration, size int) *InvalidatedTokens {
+	return &InvalidatedTokens{
+		fallbackTTL: min(fallbackTTL, maxTTL),
+		maxTTL:      maxTTL,
+		size:        size,
+		now:         time.Now,
+		order:       list.New(),
+		entries:     map[tokenHash]*list.Element{},
+	}
+}
+
+// Invalidate records the token as rejected. Tokens which already expired are
+// not recorded, the API server rejects them anyway.
+func (i *InvalidatedTokens) Invalidate(token string) {
+	if i == nil || i.size <= 0 {
+		return
+	}
+
+	now := i.now()
+
+	expires, ok := tokenExpiration(token)
+	if !ok {
+		expires = now.Add(i.fallbackTTL)
+	}
+
+	if limit := now.Add(i.maxTTL); expires.After(limit) {
+		expires = limit
+	}
+
+	if !now.Before(expires) {
+		return
+	}
+
+	hash := sha256.Sum256([]byte(token))
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	// Expired entries are swept at most once per fallback TTL.
+	if now.Sub(i.lastSweep) >= i.fallbackTTL {
+		i.purgeExpired(now)
+	}
+
+	if element, found := i.entries[hash]; found {
+		//nolint:forcetypeassert
+		element.Value.(*invalidatedToken).expires = expires
+
+		i.order.MoveToFront(element)
+
+		return
+	}
+
+	i.entries[hash] = i.order.PushFront(&invalidatedToken{hash: hash, expires: expires})
+
+	for i.order.Len() > i.size {
+		i.remove(i.order.Back())
+	}
+}
+
+// IsInvalidated reports whether the token was rejected and did not expire yet.
+func (i *InvalidatedTokens) IsInvalidated(token string) bool {
+	if i == nil {
+		return false
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	element, ok := i.entries[sha256.Sum256([]byte(token))]
+	if !ok {
+		return false
+	}
+
+	//nolint:forcetypeassert
+	if !i.now().Before(element.Value.(*invalidatedToken).expires) {
+		i.remove(element)
+
+		return false
+	}
+
+	i.order.MoveToFront(element)
+
+	return true
+}
+
+// PurgeAll forgets every invalidated token, they are reviewed again on their
+// next use.
+func (i *InvalidatedTokens) PurgeAll() {
+	if i == nil {
+		return
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	clear(i.entries)
+	i.order.Init()
+}
+
+// Len returns the number of tracked tokens, including expired ones not swept yet.
+func (i *InvalidatedTokens) Len() int {
+	if i == nil {
+		return 0
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return i.order.Len()
+}
+
+func (i *InvalidatedTokens) purgeExpired(now time.Time) {
+	for element := i.order.Front(); element != nil; {
+		next := element.Next()
+
+		//nolint:forcetypeassert
+		if !now.Before(element.Value.(*invalidatedToken).expires) {
+			i.remove(element)
+		}
+
+		element = next
+	}
+
+	i.lastSweep = now
+}
+
+func (i *InvalidatedTokens) remove(element *list.Element) {
+	i.order.Remove(element)
+
+	//nolint:forcetypeassert
+	delete(i.entries, element.Value.(*invalidatedToken).hash)
+}
+
+// tokenExpiration returns the exp claim of a JWT, the signature is not
+// verified since the value only bounds how long the rejection is kept.
+func tokenExpiration(token string) (time.Time, bool) {
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	exp, err := parsed.Claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return time.Time{}, false
+	}
+
+	return exp.Time, true
+}
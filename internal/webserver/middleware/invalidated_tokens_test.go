@@ -0,0 +1,152 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+//nolint:testpackage
+package middleware
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestInvalidatedTokensExpiration(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		token   string
+		advance time.Duration
+		want    bool
+	}{
+		{name: "opaque token within the fallback TTL", token: "opaque", advance: time.Minute, want: true},
+		{name: "opaque token after the fallback TTL", token: "opaque", advance: DefaultInvalidatedTokenTTL, want: false},
+		{name: "JWT before its exp claim", token: signedToken(t, now.Add(time.Hour)), advance: 30 * time.Minute, want: true},
+		{name: "JWT after its exp claim", token: signedToken(t, now.Add(time.Minute)), advance: 2 * time.Minute, want: false},
+		{name: "expired JWT is not recorded", token: signedToken(t, now.Add(-time.Minute)), want: false},
+		{name: "JWT within the maximum TTL", token: signedToken(t, now.Add(365*24*time.Hour)), advance: 30 * time.Minute, want: true},
+		{name: "JWT after the maximum TTL", token: signedToken(t, now.Add(365*24*time.Hour)), advance: DefaultInvalidatedTokenMaxTTL, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			clock := now
+
+			tokens := NewInvalidatedTokens(DefaultInvalidatedTokenTTL, DefaultInvalidatedTokenMaxTTL, DefaultInvalidatedTokensSize)
+			tokens.now = func() time.Time { return clock }
+
+			tokens.Invalidate(tt.token)
+
+			clock = clock.Add(tt.advance)
+
+			if got := tokens.IsInvalidated(tt.token); got != tt.want {
+				t.Fatalf("IsInvalidated()=%t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInvalidatedTokensPurge(t *testing.T) {
+	t.Parallel()
+
+	clock := time.Now()
+
+	tokens := NewInvalidatedTokens(time.Minute, DefaultInvalidatedTokenMaxTTL, DefaultInvalidatedTokensSize)
+	tokens.now = func() time.Time { return clock }
+
+	tokens.Invalidate("first")
+	tokens.Invalidate("second")
+
+	// Expired entries are swept by the next invalidation.
+	clock = clock.Add(time.Minute)
+	tokens.Invalidate("third")
+
+	if got := tokens.Len(); got != 1 {
+		t.Fatalf("Len()=%d, want 1", got)
+	}
+
+	tokens.PurgeAll()
+
+	if got := tokens.Len(); got != 0 || tokens.IsInvalidated("third") {
+		t.Fatalf("Len()=%d after PurgeAll(), want 0", got)
+	}
+
+	var nilTokens *InvalidatedTokens
+
+	nilTokens.Invalidate("token")
+
+	if nilTokens.IsInvalidated("token") {
+		t.Fatal("a nil set must not invalidate tokens")
+	}
+}
+
+func TestInvalidatedTokensSize(t *testing.T) {
+	t.Parallel()
+
+	tokens := NewInvalidatedTokens(time.Minute, DefaultInvalidatedTokenMaxTTL, 2)
+
+	tokens.Invalidate("first")
+	tokens.Invalidate("second")
+
+	// Looking up the first token makes the second the least recently used.
+	if !tokens.IsInvalidated("first") {
+		t.Fatal("the first token must be invalidated")
+	}
+
+	tokens.Invalidate("third")
+
+	if got := tokens.Len(); got != 2 {
+		t.Fatalf("Len()=%d, want 2", got)
+	}
+
+	if !tokens.IsInvalidated("first") || tokens.IsInvalidated("second") || !tokens.IsInvalidated("third") {
+		t.Fatal("the least recently used token must be forgotten first")
+	}
+}
+
+func TestInvalidatedTokensConcurrentUse(t *testing.T) {
+	t.Parallel()
+
+	tokens := NewInvalidatedTokens(time.Minute, DefaultInvalidatedTokenMaxTTL, DefaultInvalidatedTokensSize)
+
+	var wg sync.WaitGroup
+
+	for _, token := range []string{"first", "second", "third", "fourth"} {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for range 100 {
+				tokens.Invalidate(token)
+				_ = tokens.IsInvalidated(token)
+				tokens.PurgeAll()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if got := tokens.Len(); got != 0 {
+		t.Fatalf("Len()=%d, want 0", got)
+	}
+}
+
+func signedToken(t *testing.T, expires time.Time) string {
+	t.Helper()
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(expires),
+	}).SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token
+}
@@ -4,6 +4,7 @@
 package middleware
 
 import (
+	stderrors "errors"
 	"net/http"
 	"strings"
 
@@ -11,15 +12,18 @@ import (
 	goerrors "github.com/pkg/errors"
 	authenticationv1 "k8s.io/api/authentication/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/util/sets"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
+	"github.com/projectcapsule/capsule-proxy/internal/oidc"
+	req "github.com/projectcapsule/capsule-proxy/internal/request"
 	"github.com/projectcapsule/capsule-proxy/internal/webserver/errors"
 )
 
-func CheckJWTMiddleware(client client.Writer) mux.MiddlewareFunc {
-	invalidatedToken := sets.New[string]()
-
+// CheckJWTMiddleware rejects requests with an invalid bearer token. Tokens of
+// the configured OIDC issuers are validated locally, others with a TokenReview.
+// Tokens rejected by a TokenReview without error are recorded in
+// invalidatedTokens and refused without a further review until they expire.
+func CheckJWTMiddleware(client client.Writer, tokenAuthenticator req.TokenAuthenticator, invalidatedTokens *InvalidatedTokens) mux.MiddlewareFunc {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
 			var err error
@@ -27,7 +31,25 @@ func CheckJWTMiddleware(client client.Writer) mux.MiddlewareFunc {
 			token := strings.ReplaceAll(request.Header.Get("Authorization"), "Bearer ", "")
 
 			switch {
-			case len(token) > 0 && !invalidatedToken.Has(token):
+			case len(token) == 0:
+				break
+			case invalidatedTokens.IsInvalidated(token):
+				errors.HandleUnauthorized(writer, goerrors.New("token is invalid"), "cannot authenticate the token due to error")
+
+				return
+			case tokenAuthenticator != nil:
+				if _, _, err = tokenAuthenticator.AuthenticateToken(request.Context(), token); err == nil {
+					break
+				}
+
+				if !stderrors.Is(err, oidc.ErrUnknownIssuer) {
+					errors.HandleUnauthorized(writer, err, "cannot authenticate the token due to error")
+
+					return
+				}
+
+				fallthrough
+			default:
 				tr := authenticationv1.TokenReview{
 					TypeMeta: metav1.TypeMeta{
 						Kind:       "TokenReview",
@@ -43,15 +65,22 @@ func CheckJWTMiddleware(client client.Writer) mux.MiddlewareFunc {
 					return
 				}
 
+				// An error reported by the review may be transient, such as an
+				// unreachable authenticator webhook: only definitive rejections
+				// are recorded, the token is reviewed again on its next use.
 				if statusErr := tr.Status.Error; len(statusErr) > 0 {
 					errors.HandleUnauthorized(writer, goerrors.New(statusErr), "cannot authenticate the token due to error")
 
 					return
 				}
-			case invalidatedToken.Has(token):
-				errors.HandleUnauthorized(writer, goerrors.New("token is invalid"), "cannot authenticate the token due to error")
 
-				return
+				if !tr.Status.Authenticated {
+					invalidatedTokens.Invalidate(token)
+
+					errors.HandleUnauthorized(writer, goerrors.New("token is not authenticated"), "cannot authenticate the token due to error")
+
+					return
+				}
 			}
 
 			next.ServeHTTP(writer, request)
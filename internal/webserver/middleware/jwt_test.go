@@ -0,0 +1,164 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+//nolint:testpackage
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	"github.com/projectcapsule/capsule-proxy/internal/oidc"
+)
+
+type staticTokenAuthenticator map[string]error
+
+func (s staticTokenAuthenticator) AuthenticateToken(_ context.Context, token string) (string, []string, error) {
+	err, ok := s[token]
+	if !ok {
+		return "", nil, oidc.ErrUnknownIssuer
+	}
+
+	return "alice", nil, err
+}
+
+func TestCheckJWTMiddlewareWithTokenAuthenticator(t *testing.T) {
+	t.Parallel()
+
+	authenticator := staticTokenAuthenticator{
+		"valid":   nil,
+		"expired": errors.New("token is expired"),
+	}
+
+	tests := []struct {
+		name             string
+		token            string
+		wantStatus       int
+		wantTokenReviews int
+	}{
+		{name: "locally validated", token: "valid", wantStatus: http.StatusOK},
+		{name: "locally rejected", token: "expired", wantStatus: http.StatusForbidden},
+		{name: "unknown issuer falls back to TokenReview", token: "kubernetes", wantStatus: http.StatusOK, wantTokenReviews: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			scheme := runtime.NewScheme()
+			if err := authenticationv1.AddToScheme(scheme); err != nil {
+				t.Fatal(err)
+			}
+
+			tokenReviews := 0
+			writer := fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(interceptor.Funcs{
+				Create: func(_ context.Context, _ client.WithWatch, obj client.Object, _ ...client.CreateOption) error {
+					tr, ok := obj.(*authenticationv1.TokenReview)
+					if !ok {
+						return fmt.Errorf("unexpected object %T", obj)
+					}
+
+					tokenReviews++
+
+					tr.Status.Authenticated = true
+
+					return nil
+				},
+			}).Build()
+
+			request := httptest.NewRequest(http.MethodGet, "/api/v1/namespaces", nil)
+			request.Header.Set("Authorization", "Bearer "+tt.token)
+
+			recorder := httptest.NewRecorder()
+			CheckJWTMiddleware(writer, authenticator, nil)(http.HandlerFunc(dummyHandler)).ServeHTTP(recorder, request)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status=%d, want %d", recorder.Code, tt.wantStatus)
+			}
+
+			if tokenReviews != tt.wantTokenReviews {
+				t.Fatalf("tokenReviews=%d, want %d", tokenReviews, tt.wantTokenReviews)
+			}
+		})
+	}
+}
+
+func TestCheckJWTMiddlewareInvalidatesRejectedTokens(t *testing.T) {
+	t.Parallel()
+
+	scheme := runtime.NewScheme()
+	if err := authenticationv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	tokenReviews := 0
+	writer := fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(interceptor.Funcs{
+		Create: func(_ context.Context, _ client.WithWatch, obj client.Object, _ ...client.CreateOption) error {
+			tr, ok := obj.(*authenticationv1.TokenReview)
+			if !ok {
+				return fmt.Errorf("unexpected object %T", obj)
+			}
+
+			tokenReviews++
+
+			tr.Status.Authenticated = tr.Spec.Token == "valid"
+			if tr.Spec.Token == "unreachable" {
+				tr.Status.Error = "authenticator webhook is unreachable"
+			}
+
+			return nil
+		},
+	}).Build()
+
+	invalidatedTokens := NewInvalidatedTokens(DefaultInvalidatedTokenTTL, DefaultInvalidatedTokenMaxTTL, DefaultInvalidatedTokensSize)
+	handler := CheckJWTMiddleware(writer, nil, invalidatedTokens)(http.HandlerFunc(dummyHandler))
+
+	serve := func(token string) int {
+		request := httptest.NewRequest(http.MethodGet, "/api/v1/namespaces", nil)
+		request.Header.Set("Authorization", "Bearer "+token)
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+
+		return recorder.Code
+	}
+
+	for _, step := range []struct {
+		token            string
+		wantStatus       int
+		wantTokenReviews int
+	}{
+		{token: "valid", wantStatus: http.StatusOK, wantTokenReviews: 1},
+		{token: "revoked", wantStatus: http.StatusForbidden, wantTokenReviews: 2},
+		// The rejected token is refused without a further TokenReview.
+		{token: "revoked", wantStatus: http.StatusForbidden, wantTokenReviews: 2},
+		{token: "valid", wantStatus: http.StatusOK, wantTokenReviews: 3},
+		// Review errors may be transient and are not recorded.
+		{token: "unreachable", wantStatus: http.StatusForbidden, wantTokenReviews: 4},
+		{token: "unreachable", wantStatus: http.StatusForbidden, wantTokenReviews: 5},
+	} {
+		if got := serve(step.token); got != step.wantStatus {
+			t.Fatalf("%s: status=%d, want %d", step.token, got, step.wantStatus)
+		}
+
+		if tokenReviews != step.wantTokenReviews {
+			t.Fatalf("%s: tokenReviews=%d, want %d", step.token, tokenReviews, step.wantTokenReviews)
+		}
+	}
+
+	invalidatedTokens.PurgeAll()
+
+	if got := serve("revoked"); got != http.StatusForbidden || tokenReviews != 6 {
+		t.Fatalf("purged token: status=%d, tokenReviews=%d, want %d and 6", got, tokenReviews, http.StatusForbidden)
+	}
+}
@@ -14,17 +14,34 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/projectcapsule/capsule-proxy/internal/audit"
 )
 
 //nolint:gochecknoinits
 func init() {
-	metrics.Registry.MustRegister(totalRequests, httpDuration)
+	metrics.Registry.MustRegister(
+		totalRequests,
+		httpDuration,
+		rateLimitedRequests,
+		tenantRequests,
+		tenantDuration,
+		authTypeRequests,
+		moduleRequests,
+		inflightWatches,
+	)
 }
 
 type httpResponseWriter struct {
 	http.ResponseWriter
 
 	statusCode int
+
+	// record and watch are used to account a watch to the Tenants of the
+	// user once the response starts: the Tenants are resolved by then.
+	record   *audit.Record
+	watch    bool
+	watching []string
 }
 
 func (h *httpResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
@@ -36,18 +53,60 @@ func (h *httpResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	return hijacker.Hijack()
 }
 
+func (h *httpResponseWriter) Flush() {
+	h.startWatch()
+
+	if flusher, ok := h.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (h *httpResponseWriter) Unwrap() http.ResponseWriter {
+	return h.ResponseWriter
+}
+
 func newHTTPResponseWriter(w http.ResponseWriter) *httpResponseWriter {
 	return &httpResponseWriter{
-		w,
-		http.StatusOK,
+		ResponseWriter: w,
+		statusCode:     http.StatusOK,
 	}
 }
 
 func (h *httpResponseWriter) WriteHeader(statusCode int) {
 	h.statusCode = statusCode
+	h.startWatch()
 	h.ResponseWriter.WriteHeader(statusCode)
 }
 
+func (h *httpResponseWriter) Write(b []byte) (int, error) {
+	h.startWatch()
+
+	return h.ResponseWriter.Write(b)
+}
+
+// startWatch accounts a successful watch to the Tenants of the user.
+func (h *httpResponseWriter) startWatch() {
+	if !h.watch || h.watching != nil || h.statusCode >= http.StatusBadRequest {
+		return
+	}
+
+	h.watching = h.record.Tenants()
+	if h.watching == nil {
+		h.watching = []string{}
+	}
+
+	for _, tenant := range h.watching {
+		inflightWatches.WithLabelValues(tenant).Inc()
+	}
+}
+
+// stopWatch releases the watch from the Tenants it was accounted to.
+func (h *httpResponseWriter) stopWatch() {
+	for _, tenant := range h.watching {
+		inflightWatches.WithLabelValues(tenant).Dec()
+	}
+}
+
 //nolint:gochecknoglobals
 var totalRequests = prometheus.NewCounterVec(
 	prometheus.CounterOpts{
@@ -63,6 +122,56 @@ var httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
 	Help: "Duration of capsule proxy requests.",
 }, []string{"path"})
 
+// The following metrics are labelled by Tenant, authentication method,
+// module path and forwarding: all of them are bounded by the cluster
+// configuration rather than by the requests. Status codes are reported by
+// class for the same reason.
+
+//nolint:gochecknoglobals
+var tenantRequests = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "capsule_proxy_tenant_requests_total",
+		Help: "Number of requests by Tenant of the user and status code class",
+	},
+	[]string{"tenant", "code"},
+)
+
+//nolint:gochecknoglobals
+var tenantDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name: "capsule_proxy_tenant_response_time_seconds",
+		Help: "Duration of capsule proxy requests by Tenant of the user",
+	},
+	[]string{"tenant"},
+)
+
+//nolint:gochecknoglobals
+var authTypeRequests = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "capsule_proxy_auth_requests_total",
+		Help: "Number of requests by authentication method",
+	},
+	[]string{"auth_type"},
+)
+
+//nolint:gochecknoglobals
+var moduleRequests = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "capsule_proxy_module_requests_total",
+		Help: "Number of requests by module and forwarding, filtered with the proxy ServiceAccount or impersonating the user",
+	},
+	[]string{"module", "forwarding"},
+)
+
+//nolint:gochecknoglobals
+var inflightWatches = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "capsule_proxy_inflight_watches",
+		Help: "Number of watches open by the users of a Tenant",
+	},
+	[]string{"tenant"},
+)
+
 func MetricsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		route := mux.CurrentRoute(r)
@@ -70,13 +179,49 @@ func MetricsMiddleware(next http.Handler) http.Handler {
 
 		timer := prometheus.NewTimer(httpDuration.WithLabelValues(path))
 
+		ctx, record := r.Context(), audit.RecordFrom(r.Context())
+		if record == nil {
+			ctx, record = audit.WithRecord(ctx)
+		}
+
 		rw := newHTTPResponseWriter(w)
-		next.ServeHTTP(rw, r)
+		rw.record = record
+		rw.watch, _ = strconv.ParseBool(r.URL.Query().Get("watch"))
+
+		defer rw.stopWatch()
+
+		next.ServeHTTP(rw, r.WithContext(ctx))
 
 		statusCode := rw.statusCode
 
 		totalRequests.WithLabelValues(path, strconv.Itoa(statusCode)).Inc()
 
-		timer.ObserveDuration()
+		elapsed := timer.ObserveDuration()
+
+		observeRecord(record, statusCode, elapsed.Seconds())
 	})
 }
+
+// observeRecord reports the request by the Tenants, authentication method and
+// module recorded while handling it.
+func observeRecord(record *audit.Record, statusCode int, seconds float64) {
+	code := strconv.Itoa(statusCode/100) + "xx"
+
+	for _, tenant := range record.Tenants() {
+		tenantRequests.WithLabelValues(tenant, code).Inc()
+		tenantDuration.WithLabelValues(tenant).Observe(seconds)
+	}
+
+	if authType := record.AuthType(); len(authType) > 0 {
+		authTypeRequests.WithLabelValues(authType).Inc()
+	}
+
+	if module := record.Module(); len(module) > 0 {
+		forwarding := string(record.Forwarding())
+		if len(forwarding) == 0 {
+			forwarding = "none"
+		}
+
+		moduleRequests.WithLabelValues(module, forwarding).Inc()
+	}
+}
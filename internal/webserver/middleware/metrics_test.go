@@ -12,6 +12,8 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus"
 	model "github.com/prometheus/client_model/go"
+
+	"github.com/projectcapsule/capsule-proxy/internal/audit"
 )
 
 func dummyHandler(w http.ResponseWriter, _ *http.Request) {
@@ -71,6 +73,56 @@ func Test_MetricsMiddleware_RequestCount(t *testing.T) {
 	}
 }
 
+func Test_MetricsMiddleware_Record(t *testing.T) {
+	t.Parallel()
+
+	var watching float64
+
+	router := mux.NewRouter()
+	router.Use(MetricsMiddleware)
+	router.PathPrefix("/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		record := audit.RecordFrom(r.Context())
+		record.SetAuthType("BearerToken")
+		record.SetTenants([]string{"metrics-oil", "metrics-gas"})
+		record.SetModule("/api/v1/metrics-pods")
+		record.SetForwarding(audit.ForwardingServiceAccount, "capsule.clastix.io/tenant in (metrics-gas,metrics-oil)")
+
+		_, _ = w.Write([]byte("{}"))
+
+		watching = gaugeValue(inflightWatches.WithLabelValues("metrics-oil"))
+	})
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/metrics-pods?watch=true", nil))
+
+	if watching != 1 {
+		t.Errorf("expected the watch accounted to the Tenant while open, got %f", watching)
+	}
+
+	if value := gaugeValue(inflightWatches.WithLabelValues("metrics-oil")); value != 0 {
+		t.Errorf("expected the watch released once closed, got %f", value)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		metric prometheus.Metric
+	}{
+		{name: "tenant oil", metric: tenantRequests.WithLabelValues("metrics-oil", "2xx")},
+		{name: "tenant gas", metric: tenantRequests.WithLabelValues("metrics-gas", "2xx")},
+		{name: "module", metric: moduleRequests.WithLabelValues("/api/v1/metrics-pods", string(audit.ForwardingServiceAccount))},
+	} {
+		if result := readVector(tc.metric); result.value != 1 {
+			t.Errorf("%s: expected a single request, got %f", tc.name, result.value)
+		}
+	}
+}
+
+func gaugeValue(g prometheus.Metric) float64 {
+	m := &model.Metric{}
+	_ = g.Write(m)
+
+	return m.GetGauge().GetValue()
+}
+
 type metricResult struct {
 	value  float64
 	labels map[string]string
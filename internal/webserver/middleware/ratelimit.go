@@ -0,0 +1,257 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package middleware
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
+
+	weberrors "github.com/projectcapsule/capsule-proxy/internal/webserver/errors"
+)
+
+const (
+	// DefaultRateLimitIdleTTL is how long the budget of a key without requests
+	// is kept.
+	DefaultRateLimitIdleTTL = 10 * time.Minute
+	// watchRetryAfter is the delay suggested to a watch refused because too
+	// many watches are open.
+	watchRetryAfter = time.Second
+)
+
+//nolint:gochecknoglobals
+var rateLimitedRequests = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "capsule_proxy_rate_limited_requests_total",
+		Help: "Number of requests refused by a rate limit",
+	},
+	[]string{"reason"},
+)
+
+// RateLimit is a budget shared by the requests with the same key, such as the
+// requests of a user or of the users of a Tenant.
+type RateLimit struct {
+	// Key identifies the requests sharing the budget.
+	Key string
+	// QPS is the sustained rate of the token bucket, zero means unlimited.
+	QPS float64
+	// Burst is the size of the token bucket, QPS when not set.
+	Burst int
+	// MaxInflightWatches bounds the watches open at once, zero means unlimited.
+	MaxInflightWatches int
+}
+
+// RateLimitResolver returns the budgets a request is accounted to.
+type RateLimitResolver func(request *http.Request) ([]RateLimit, error)
+
+// RateLimitedError reports a request exceeding the budget of a key.
+type RateLimitedError struct {
+	Key string
+	// Watches is set when too many watches are open, instead of too many
+	// requests sent.
+	Watches bool
+	// RetryAfter is the delay to wait before retrying.
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitedError) Error() string {
+	if e.Watches {
+		return "too many watches open for " + e.Key
+	}
+
+	return "too many requests for " + e.Key
+}
+
+func (e *RateLimitedError) reason() string {
+	if e.Watches {
+		return "watches"
+	}
+
+	return "qps"
+}
+
+type rateLimitBucket struct {
+	limiter         *rate.Limiter
+	inflightWatches int
+	lastUsed        time.Time
+}
+
+// RateLimiter keeps the token bucket and the open watches of each key. The
+// budget of a key is updated as its limits change, and forgotten once it was
+// not used for the idle TTL.
+type RateLimiter struct {
+	idleTTL time.Duration
+	now     func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*rateLimitBucket
+	lastSweep time.Time
+}
+
+func NewRateLimiter(idleTTL time.Duration) *RateLimiter {
+	return &RateLimiter{
+		idleTTL: idleTTL,
+		now:     time.Now,
+		buckets: map[string]*rateLimitBucket{},
+	}
+}
+
+// Admit accounts a request to the budgets. An admitted request gets the
+// function to call once it is served, a refused one a *RateLimitedError.
+func (r *RateLimiter) Admit(limits []RateLimit, watch bool) (release func(), err error) {
+	now := r.now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if now.Sub(r.lastSweep) >= r.idleTTL {
+		r.purgeIdle(now)
+	}
+
+	buckets := make([]*rateLimitBucket, len(limits))
+
+	for i, limit := range limits {
+		buckets[i] = r.bucket(limit, now)
+
+		if watch && limit.MaxInflightWatches > 0 && buckets[i].inflightWatches >= limit.MaxInflightWatches {
+			return nil, &RateLimitedError{Key: limit.Key, Watches: true, RetryAfter: watchRetryAfter}
+		}
+	}
+
+	reservations := make([]*rate.Reservation, 0, len(limits))
+
+	cancel := func() {
+		for _, reservation := range reservations {
+			reservation.CancelAt(now)
+		}
+	}
+
+	for i, limit := range limits {
+		if limit.QPS <= 0 {
+			continue
+		}
+
+		reservation := buckets[i].limiter.ReserveN(now, 1)
+		reservations = append(reservations, reservation)
+
+		if delay := reservation.DelayFrom(now); !reservation.OK() || delay > 0 {
+			cancel()
+
+			return nil, &RateLimitedError{Key: limit.Key, RetryAfter: delay}
+		}
+	}
+
+	if !watch {
+		return func() {}, nil
+	}
+
+	for i, limit := range limits {
+		if limit.MaxInflightWatches > 0 {
+			buckets[i].inflightWatches++
+		}
+	}
+
+	var once sync.Once
+
+	return func() {
+		once.Do(func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+
+			for i, limit := range limits {
+				if limit.MaxInflightWatches > 0 {
+					buckets[i].inflightWatches--
+					buckets[i].lastUsed = r.now()
+				}
+			}
+		})
+	}, nil
+}
+
+// bucket returns the budget of the key, updated to the limit.
+func (r *RateLimiter) bucket(limit RateLimit, now time.Time) *rateLimitBucket {
+	qps, burst := rate.Limit(limit.QPS), limit.Burst
+	if burst <= 0 {
+		burst = max(int(math.Ceil(limit.QPS)), 1)
+	}
+
+	b, ok := r.buckets[limit.Key]
+	if !ok {
+		b = &rateLimitBucket{limiter: rate.NewLimiter(qps, burst)}
+		r.buckets[limit.Key] = b
+	}
+
+	if b.limiter.Limit() != qps {
+		b.limiter.SetLimitAt(now, qps)
+	}
+
+	if b.limiter.Burst() != burst {
+		b.limiter.SetBurstAt(now, burst)
+	}
+
+	b.lastUsed = now
+
+	return b
+}
+
+func (r *RateLimiter) purgeIdle(now time.Time) {
+	for key, b := range r.buckets {
+		if b.inflightWatches == 0 && now.Sub(b.lastUsed) >= r.idleTTL {
+			delete(r.buckets, key)
+		}
+	}
+
+	r.lastSweep = now
+}
+
+// RateLimitMiddleware refuses the requests exceeding one of their budgets
+// with a 429 Status and a Retry-After header. Requests whose budgets cannot
+// be resolved are let through, the next middlewares refuse the ones which
+// cannot be authenticated.
+func RateLimitMiddleware(log logr.Logger, limiter *RateLimiter, resolve RateLimitResolver) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			limits, err := resolve(request)
+			if err != nil {
+				log.V(5).Info("cannot resolve the rate limits of the request", "error", err.Error())
+			}
+
+			if len(limits) == 0 {
+				next.ServeHTTP(writer, request)
+
+				return
+			}
+
+			watch, _ := strconv.ParseBool(request.URL.Query().Get("watch"))
+
+			release, err := limiter.Admit(limits, watch)
+			if err != nil {
+				var limited *RateLimitedError
+				if !errors.As(err, &limited) {
+					weberrors.HandleError(writer, err, "cannot rate limit the request")
+
+					return
+				}
+
+				log.V(4).Info("request rate limited", "reason", limited.Error(), "uri", request.URL.Path)
+				rateLimitedRequests.WithLabelValues(limited.reason()).Inc()
+				weberrors.HandleTooManyRequests(writer, limited.Error(), limited.RetryAfter)
+
+				return
+			}
+
+			defer release()
+
+			next.ServeHTTP(writer, request)
+		})
+	}
+}
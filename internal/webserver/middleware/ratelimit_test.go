@@ -0,0 +1,200 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRateLimiterQPS(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+
+	limiter := NewRateLimiter(DefaultRateLimitIdleTTL)
+	limiter.now = func() time.Time { return now }
+
+	user := RateLimit{Key: "User/alice", QPS: 1, Burst: 2}
+	tenant := RateLimit{Key: "Tenant/solar", QPS: 10, Burst: 3}
+
+	admit := func(limits ...RateLimit) error {
+		release, err := limiter.Admit(limits, false)
+		if err == nil {
+			release()
+		}
+
+		return err
+	}
+
+	for i := range 2 {
+		if err := admit(user, tenant); err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+	}
+
+	var limited *RateLimitedError
+	if err := admit(user, tenant); !errors.As(err, &limited) || limited.Key != user.Key || limited.Watches {
+		t.Fatalf("expected the user budget exhausted, got %v", err)
+	}
+
+	if limited.RetryAfter != time.Second {
+		t.Fatalf("retry after %s, want 1s", limited.RetryAfter)
+	}
+
+	// The refused request did not consume the tenant budget.
+	if err := admit(tenant); err != nil {
+		t.Fatalf("expected the tenant budget left, got %v", err)
+	}
+
+	if err := admit(RateLimit{Key: "User/bob", QPS: 1}, tenant); !errors.As(err, &limited) || limited.Key != tenant.Key {
+		t.Fatalf("expected the tenant budget exhausted, got %v", err)
+	}
+
+	now = now.Add(time.Second)
+
+	if err := admit(user, tenant); err != nil {
+		t.Fatalf("expected the budgets refilled, got %v", err)
+	}
+
+	// A raised limit applies to the existing budget: at 1 QPS the next token
+	// would be available in a second.
+	user.QPS, user.Burst = 100, 100
+
+	if err := admit(user); !errors.As(err, &limited) || limited.RetryAfter > 10*time.Millisecond {
+		t.Fatalf("expected a retry at the raised limit, got %v", err)
+	}
+
+	now = now.Add(10 * time.Millisecond)
+
+	if err := admit(user); err != nil {
+		t.Fatalf("expected the raised limit applied, got %v", err)
+	}
+}
+
+func TestRateLimiterWatches(t *testing.T) {
+	t.Parallel()
+
+	limiter := NewRateLimiter(DefaultRateLimitIdleTTL)
+
+	tenant := RateLimit{Key: "Tenant/solar", MaxInflightWatches: 2}
+
+	first, err := limiter.Admit([]RateLimit{tenant}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := limiter.Admit([]RateLimit{tenant}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var limited *RateLimitedError
+	if _, err = limiter.Admit([]RateLimit{tenant}, true); !errors.As(err, &limited) || !limited.Watches {
+		t.Fatalf("expected too many watches, got %v", err)
+	}
+
+	// Lists are not bound by the open watches.
+	if _, err = limiter.Admit([]RateLimit{tenant}, false); err != nil {
+		t.Fatalf("expected the list admitted, got %v", err)
+	}
+
+	first()
+	first()
+
+	if _, err = limiter.Admit([]RateLimit{tenant}, true); err != nil {
+		t.Fatalf("expected the watch admitted once one closed, got %v", err)
+	}
+
+	second()
+}
+
+func TestRateLimiterPurgeIdle(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+
+	limiter := NewRateLimiter(time.Minute)
+	limiter.now = func() time.Time { return now }
+
+	release, err := limiter.Admit([]RateLimit{{Key: "User/alice", QPS: 1}, {Key: "Tenant/solar", MaxInflightWatches: 1}}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(time.Hour)
+
+	if _, err = limiter.Admit(nil, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// The budget with an open watch is kept.
+	if _, ok := limiter.buckets["Tenant/solar"]; !ok || len(limiter.buckets) != 1 {
+		t.Fatalf("unexpected budgets %v", limiter.buckets)
+	}
+
+	release()
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	t.Parallel()
+
+	limiter := NewRateLimiter(DefaultRateLimitIdleTTL)
+
+	resolve := func(request *http.Request) ([]RateLimit, error) {
+		if request.Header.Get("X-User") == "" {
+			return nil, errors.New("unauthenticated")
+		}
+
+		return []RateLimit{{Key: "User/" + request.Header.Get("X-User"), QPS: 1}}, nil
+	}
+
+	handler := RateLimitMiddleware(logr.Discard(), limiter, resolve)(http.HandlerFunc(func(writer http.ResponseWriter, _ *http.Request) {
+		writer.WriteHeader(http.StatusOK)
+	}))
+
+	serve := func(user string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, "/api/v1/pods", nil)
+		if len(user) > 0 {
+			request.Header.Set("X-User", user)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+
+		return recorder
+	}
+
+	if code := serve("alice").Code; code != http.StatusOK {
+		t.Fatalf("status=%d, want %d", code, http.StatusOK)
+	}
+
+	recorder := serve("alice")
+	if recorder.Code != http.StatusTooManyRequests || recorder.Header().Get("Retry-After") != "1" {
+		t.Fatalf("status=%d Retry-After=%q, want %d and 1", recorder.Code, recorder.Header().Get("Retry-After"), http.StatusTooManyRequests)
+	}
+
+	var status metav1.Status
+	if err := json.Unmarshal(recorder.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+
+	if status.Reason != metav1.StatusReasonTooManyRequests || status.Details == nil || status.Details.RetryAfterSeconds != 1 {
+		t.Fatalf("unexpected status %+v", status)
+	}
+
+	// Budgets are not shared between users, and unresolved requests pass.
+	for _, user := range []string{"bob", "", ""} {
+		if code := serve(user).Code; code != http.StatusOK {
+			t.Fatalf("user %q: status=%d, want %d", user, code, http.StatusOK)
+		}
+	}
+}
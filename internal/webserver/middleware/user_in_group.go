@@ -19,7 +19,7 @@ import (
 	weberrors "github.com/projectcapsule/capsule-proxy/internal/webserver/errors"
 )
 
-func CheckUserInIgnoredIdentityMiddleware(client client.Writer, log logr.Logger, claim string, authTypes []req.AuthType, ignoredUsernames, ignoredUserGroups sets.Set[string], ignoredImpersonationGroups []string, impersonationGroupsRegexp *regexp.Regexp, skipImpersonationReview bool, xfcc_header string, fn func(writer http.ResponseWriter, request *http.Request)) mux.MiddlewareFunc {
+func CheckUserInIgnoredIdentityMiddleware(client client.Writer, log logr.Logger, claim string, authTypes []req.AuthType, ignoredUsernames, ignoredUserGroups sets.Set[string], ignoredImpersonationGroups []string, impersonationGroupsRegexp *regexp.Regexp, skipImpersonationReview bool, xfcc_header string, tokenAuthenticator req.TokenAuthenticator, fn func(writer http.ResponseWriter, request *http.Request)) mux.MiddlewareFunc {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
 			if ignoredUsernames.Len() == 0 && ignoredUserGroups.Len() == 0 {
@@ -28,7 +28,7 @@ func CheckUserInIgnoredIdentityMiddleware(client client.Writer, log logr.Logger,
 				return
 			}
 
-			request, user, groups, err := req.ResolveUserAndGroups(request, authTypes, claim, client, ignoredImpersonationGroups, impersonationGroupsRegexp, skipImpersonationReview, xfcc_header)
+			request, user, groups, err := req.ResolveUserAndGroups(request, authTypes, claim, client, ignoredImpersonationGroups, impersonationGroupsRegexp, skipImpersonationReview, xfcc_header, tokenAuthenticator)
 			if err != nil {
 				log.Error(err, "Cannot retrieve username and group from request")
 				handleResolveUserAndGroupsError(writer, err)
@@ -36,7 +36,7 @@ func CheckUserInIgnoredIdentityMiddleware(client client.Writer, log logr.Logger,
 				return
 			}
 
-			if identityIsIgnored(user, groups, ignoredUsernames, ignoredUserGroups) {
+			if IdentityIsIgnored(user, groups, ignoredUsernames, ignoredUserGroups) {
 				log.V(5).Info("current user is ignored by proxy filtering", "user", user)
 				fn(writer, request)
 
@@ -48,14 +48,16 @@ func CheckUserInIgnoredIdentityMiddleware(client client.Writer, log logr.Logger,
 	}
 }
 
-func identityIsIgnored(username string, groups []string, ignoredUsernames, ignoredUserGroups sets.Set[string]) bool {
+// IdentityIsIgnored reports whether the requests of the user are forwarded
+// without filtering.
+func IdentityIsIgnored(username string, groups []string, ignoredUsernames, ignoredUserGroups sets.Set[string]) bool {
 	return ignoredUsernames.Has(username) || slices.ContainsFunc(groups, ignoredUserGroups.Has)
 }
 
-func CheckUserInCapsuleGroupMiddleware(client client.Writer, log logr.Logger, claim string, authTypes []req.AuthType, ignoredImpersonationGroups []string, impersonationGroupsRegexp *regexp.Regexp, skipImpersonationReview bool, xfcc_header string, impersonate func(http.ResponseWriter, *http.Request)) mux.MiddlewareFunc {
+func CheckUserInCapsuleGroupMiddleware(client client.Writer, log logr.Logger, claim string, authTypes []req.AuthType, ignoredImpersonationGroups []string, impersonationGroupsRegexp *regexp.Regexp, skipImpersonationReview bool, xfcc_header string, tokenAuthenticator req.TokenAuthenticator, impersonate func(http.ResponseWriter, *http.Request)) mux.MiddlewareFunc {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
-			request, user, groups, err := req.ResolveUserAndGroups(request, authTypes, claim, client, ignoredImpersonationGroups, impersonationGroupsRegexp, skipImpersonationReview, xfcc_header)
+			request, user, groups, err := req.ResolveUserAndGroups(request, authTypes, claim, client, ignoredImpersonationGroups, impersonationGroupsRegexp, skipImpersonationReview, xfcc_header, tokenAuthenticator)
 			if err != nil {
 				log.Error(err, "Cannot retrieve username and group from request")
 				handleResolveUserAndGroupsError(writer, err)
@@ -65,15 +67,7 @@ func CheckUserInCapsuleGroupMiddleware(client client.Writer, log logr.Logger, cl
 
 			log.V(10).Info("request groups", "groups", groups)
 
-			if slices.ContainsFunc(groups, func(group string) bool {
-				return controllers.CapsuleUserGroups.Has(group)
-			}) {
-				next.ServeHTTP(writer, request)
-
-				return
-			}
-
-			if controllers.CapsuleUsers.Has(user) {
+			if IsCapsuleUser(user, groups) {
 				next.ServeHTTP(writer, request)
 
 				return
@@ -85,6 +79,13 @@ func CheckUserInCapsuleGroupMiddleware(client client.Writer, log logr.Logger, cl
 	}
 }
 
+// IsCapsuleUser reports whether the user is a Capsule user, by name or by one
+// of the groups: the requests of the other users are forwarded without
+// filtering.
+func IsCapsuleUser(username string, groups []string) bool {
+	return controllers.CapsuleUsers.Has(username) || slices.ContainsFunc(groups, controllers.CapsuleUserGroups.Has)
+}
+
 func handleResolveUserAndGroupsError(writer http.ResponseWriter, err error) {
 	var unauthorizedErr *req.ErrUnauthorized
 	if errors.As(err, &unauthorizedErr) {
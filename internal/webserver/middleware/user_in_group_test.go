@@ -62,8 +62,8 @@ func TestIdentityIsIgnored(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
 
-			if got := identityIsIgnored(tt.username, tt.groups, tt.ignoredUsernames, tt.ignoredGroups); got != tt.want {
-				t.Fatalf("identityIsIgnored() = %v, want %v", got, tt.want)
+			if got := IdentityIsIgnored(tt.username, tt.groups, tt.ignoredUsernames, tt.ignoredGroups); got != tt.want {
+				t.Fatalf("IdentityIsIgnored() = %v, want %v", got, tt.want)
 			}
 		})
 	}
@@ -127,6 +127,7 @@ func TestCheckUserInIgnoredIdentityMiddleware(t *testing.T) {
 				nil,
 				false,
 				"X-Forwarded-Client-Cert",
+				nil,
 				func(http.ResponseWriter, *http.Request) { bypassed = true },
 			)
 			handler := middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { continued = true }))
@@ -9,7 +9,10 @@ import (
 	"net/http"
 
 	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/attribute"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/projectcapsule/capsule-proxy/internal/tracing"
 )
 
 // Gate mutates only forbidden responses for named resources in namespaces that
@@ -34,6 +37,11 @@ func (g *Gate) ModifyResponse(response *http.Response) error {
 		return nil
 	}
 
+	_, span := tracing.StartSpan(response.Request.Context(), "namespacegate.ModifyResponse",
+		attribute.Int("http.response.status_code", response.StatusCode),
+	)
+	defer span.End()
+
 	if response.StatusCode == http.StatusForbidden {
 		g.maskForbiddenForMissingNamespace(response)
 	}
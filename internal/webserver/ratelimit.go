@@ -0,0 +1,173 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package webserver
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+
+	capsulerbac "github.com/projectcapsule/capsule/pkg/api/rbac"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/projectcapsule/capsule-proxy/api/v1beta1"
+	"github.com/projectcapsule/capsule-proxy/internal/indexer"
+	req "github.com/projectcapsule/capsule-proxy/internal/request"
+	"github.com/projectcapsule/capsule-proxy/internal/webserver/middleware"
+)
+
+// rateLimits returns the budgets of the request: the rate limit of each
+// GlobalProxySettings the user is a subject of, by user, group or Tenant as
+// configured, and the rate limit of each ProxySetting of the Tenants of the
+// user, shared by all the users of the Tenant. The Tenants are resolved once
+// per request, the module handling it reuses them.
+func (n *kubeFilter) rateLimits(request *http.Request) ([]middleware.RateLimit, error) {
+	request, username, groups, err := req.ResolveUserAndGroups(request, n.authTypes, n.usernameClaimField, n.writer, n.ignoredImpersonationGroups, n.impersonationGroupsRegexp, n.skipImpersonationReview, n.xfcc_header, n.tokenAuthenticator)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := request.Context()
+
+	proxyTenants, err := n.getTenantsForOwner(ctx, username, groups)
+	if err != nil {
+		return nil, err
+	}
+
+	tenants := proxyTenantNames(proxyTenants)
+	namespaces := map[string]string{}
+
+	for _, pt := range proxyTenants {
+		for _, ns := range pt.Tenant.Status.Namespaces {
+			namespaces[ns] = pt.Tenant.Name
+		}
+	}
+
+	var limits []middleware.RateLimit
+
+	globalProxySettings, err := n.subjectGlobalProxySettings(ctx, username, groups)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, settings := range globalProxySettings {
+		if settings.Spec.RateLimit == nil {
+			continue
+		}
+
+		userMatched, matchedGroups := globalSubjectsMatch(settings.Spec.Rules, username, groups)
+		if !userMatched && matchedGroups.Len() == 0 {
+			continue
+		}
+
+		var keys []string
+
+		switch settings.Spec.RateLimit.Key {
+		case v1beta1.RateLimitKeyGroup:
+			for _, group := range sets.List(matchedGroups) {
+				keys = append(keys, "Group/"+group)
+			}
+		case v1beta1.RateLimitKeyTenant:
+			for _, tnt := range tenants {
+				keys = append(keys, "Tenant/"+tnt)
+			}
+		default:
+			keys = append(keys, "User/"+username)
+		}
+
+		for _, key := range keys {
+			limits = append(limits, rateLimit("GlobalProxySettings/"+settings.Name+"/"+key, settings.Spec.RateLimit.RateLimit))
+		}
+	}
+
+	if len(namespaces) == 0 {
+		return limits, nil
+	}
+
+	for _, ns := range slices.Sorted(maps.Keys(namespaces)) {
+		proxySettings := &v1beta1.ProxySettingList{}
+		if err = n.managerReader.List(ctx, proxySettings, client.InNamespace(ns)); err != nil {
+			return nil, fmt.Errorf("cannot list the ProxySettings of the namespace %s: %w", ns, err)
+		}
+
+		for _, settings := range proxySettings.Items {
+			if settings.Spec.RateLimit == nil {
+				continue
+			}
+
+			limits = append(limits, rateLimit("Tenant/"+namespaces[ns]+"/ProxySetting/"+settings.Namespace+"/"+settings.Name, *settings.Spec.RateLimit))
+		}
+	}
+
+	return limits, nil
+}
+
+// subjectGlobalProxySettings returns the GlobalProxySettings the user, or any
+// of its groups, is a subject of, retrieved by the subject index.
+func (n *kubeFilter) subjectGlobalProxySettings(ctx context.Context, username string, groups []string) ([]v1beta1.GlobalProxySettings, error) {
+	subjects := []string{
+		fmt.Sprintf("%s:%s", capsulerbac.UserOwner.String(), username),
+		fmt.Sprintf("%s:%s", capsulerbac.ServiceAccountOwner.String(), username),
+	}
+
+	for _, group := range groups {
+		subjects = append(subjects, fmt.Sprintf("%s:%s", capsulerbac.GroupOwner.String(), group))
+	}
+
+	seen := sets.New[string]()
+
+	var settings []v1beta1.GlobalProxySettings
+
+	for _, subject := range subjects {
+		list := &v1beta1.GlobalProxySettingsList{}
+		if err := n.managerReader.List(ctx, list, client.MatchingFields{indexer.GlobalKindField: subject}); err != nil {
+			return nil, fmt.Errorf("cannot list GlobalProxySettings: %w", err)
+		}
+
+		for _, item := range list.Items {
+			if seen.Has(item.Name) {
+				continue
+			}
+
+			seen.Insert(item.Name)
+
+			settings = append(settings, item)
+		}
+	}
+
+	return settings, nil
+}
+
+// globalSubjectsMatch reports whether the user is a subject of the rules, and
+// the groups of the user among the subjects.
+func globalSubjectsMatch(rules []v1beta1.GlobalSubjectSpec, username string, groups []string) (userMatched bool, matchedGroups sets.Set[string]) {
+	matchedGroups = sets.New[string]()
+
+	for _, rule := range rules {
+		for _, subject := range rule.Subjects {
+			switch subject.Kind {
+			case capsulerbac.GroupOwner:
+				if slices.Contains(groups, subject.Name) {
+					matchedGroups.Insert(subject.Name)
+				}
+			case capsulerbac.UserOwner, capsulerbac.ServiceAccountOwner:
+				userMatched = userMatched || subject.Name == username
+			}
+		}
+	}
+
+	return userMatched, matchedGroups
+}
+
+func rateLimit(key string, limit v1beta1.RateLimit) middleware.RateLimit {
+	return middleware.RateLimit{
+		Key:                key,
+		QPS:                float64(limit.QPS),
+		Burst:              int(limit.Burst),
+		MaxInflightWatches: int(limit.MaxInflightWatches),
+	}
+}
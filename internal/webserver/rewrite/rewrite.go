@@ -0,0 +1,100 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package rewrite rewrites the JSON documents answered by the API server,
+// keeping their ETag and the conditional requests consistent.
+package rewrite
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha512"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+)
+
+// HoldBackIfNoneMatch removes the If-None-Match header from the request and
+// returns it: the API server does not know the ETag of the rewritten
+// document, Response matches the response against it instead.
+func HoldBackIfNoneMatch(request *http.Request) string {
+	ifNoneMatch := request.Header.Get("If-None-Match")
+	request.Header.Del("If-None-Match")
+
+	return ifNoneMatch
+}
+
+// Response rewrites the uncompressed body of a successful JSON response with
+// the document function, which reports whether it modified it. The ETag is
+// computed from the rewritten document, and the response is answered as not
+// modified when it matches the If-None-Match header held back. Any other
+// response, or one that cannot be decompressed, is preserved unchanged.
+func Response(response *http.Response, ifNoneMatch string, document func(raw []byte) ([]byte, bool)) error {
+	if response.StatusCode != http.StatusOK {
+		return nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		return nil
+	}
+
+	raw, err := io.ReadAll(response.Body)
+	_ = response.Body.Close()
+
+	if err != nil {
+		return err
+	}
+
+	response.Body = io.NopCloser(bytes.NewReader(raw))
+
+	if decompressed, err := decompress(raw, response.Header.Get("Content-Encoding") == "gzip"); err == nil {
+		if body, modified := document(decompressed); modified {
+			setBody(response, body)
+
+			if len(response.Header.Get("ETag")) > 0 {
+				response.Header.Set("ETag", ETag(body))
+			}
+		}
+	}
+
+	if tag := response.Header.Get("ETag"); len(tag) > 0 && tag == ifNoneMatch {
+		response.StatusCode = http.StatusNotModified
+		response.Status = fmt.Sprintf("%d %s", http.StatusNotModified, http.StatusText(http.StatusNotModified))
+
+		setBody(response, nil)
+	}
+
+	return nil
+}
+
+// ETag returns the quoted ETag of the document, computed as the API server
+// does.
+func ETag(body []byte) string {
+	return strconv.Quote(fmt.Sprintf("%X", sha512.Sum512(body)))
+}
+
+func setBody(response *http.Response, body []byte) {
+	response.Body = io.NopCloser(bytes.NewReader(body))
+	response.ContentLength = int64(len(body))
+	response.TransferEncoding = nil
+	response.Uncompressed = false
+	response.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	response.Header.Del("Content-Encoding")
+	response.Header.Del("Transfer-Encoding")
+}
+
+func decompress(raw []byte, compressed bool) ([]byte, error) {
+	if !compressed {
+		return raw, nil
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	return io.ReadAll(reader)
+}
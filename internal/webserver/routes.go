@@ -0,0 +1,116 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package webserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gorilla/mux"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/projectcapsule/capsule-proxy/internal/webserver/discoveryfilter"
+)
+
+// routeTable is the routing of the discovered API resources to the modules,
+// along with the state derived from the same discovery: it is never mutated,
+// a new table is swapped in instead.
+type routeTable struct {
+	// router serves the fixed endpoints and the module routes, forwarding any
+	// other request as the user.
+	router *mux.Router
+	// namespacedResources holds the set of proxied namespaced resources (keyed
+	// via authorization.NamespacedResourceKey) for which capsule-proxy serves
+	// cross-namespace (`-A`) list/watch queries. It is used to advertise that
+	// capability through the self review (auth review) APIs.
+	namespacedResources sets.Set[string]
+	// printerColumns holds the printer columns of the custom resources, by
+	// GroupVersionKind, used to synthesize their Tables.
+	printerColumns map[schema.GroupVersionKind][]apiextensionsv1.CustomResourceColumnDefinition
+	// routedModules are the registered modules in the order they are matched,
+	// for the explain endpoint.
+	routedModules []routedModule
+	// discoveredResources are the preferred resources of each API group,
+	// judged by the discovery filter when enabled.
+	discoveredResources map[string][]discoveryfilter.Resource
+	// unavailableGroups are the group versions the discovery failed for,
+	// whose resources are not routed.
+	unavailableGroups map[schema.GroupVersion]error
+}
+
+// serveHTTP routes the request with the current routes, answering with 503
+// until the API resources are discovered.
+func (n *kubeFilter) serveHTTP(writer http.ResponseWriter, request *http.Request) {
+	table := n.routes.Load()
+	if table == nil {
+		writeStatus(writer, &apierrors.NewServiceUnavailable("the API resources have not been discovered yet").ErrStatus)
+
+		return
+	}
+
+	table.router.ServeHTTP(writer, request)
+}
+
+// RefreshRoutes discovers the API resources again and swaps the module routes
+// along with the namespaced resources advertised by the self reviews: the
+// requests in flight complete with the previous routes.
+func (n *kubeFilter) RefreshRoutes(ctx context.Context) error {
+	n.routesMu.Lock()
+	defer n.routesMu.Unlock()
+
+	table, err := n.buildRoutes(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot build the module routes: %w", err)
+	}
+
+	n.routes.Store(table)
+	n.log.V(4).Info("module routes refreshed", "modules", len(table.routedModules), "namespacedResources", table.namespacedResources.Len())
+
+	unavailableGroups.Reset()
+
+	if len(table.unavailableGroups) == 0 {
+		return nil
+	}
+
+	for gv, gvErr := range table.unavailableGroups {
+		unavailableGroups.WithLabelValues(gv.String()).Set(1)
+
+		n.log.Error(gvErr, "API resources unavailable, not routed", "groupVersion", gv.String())
+	}
+
+	return fmt.Errorf("cannot discover the API resources of %s", strings.Join(table.unavailableGroupVersions(), ", "))
+}
+
+// DiscoveryProbe fails listing the group versions the last discovery failed
+// for, whose resources are not routed.
+func (n *kubeFilter) DiscoveryProbe(*http.Request) error {
+	table := n.routes.Load()
+	if table == nil {
+		return fmt.Errorf("the API resources have not been discovered yet")
+	}
+
+	if len(table.unavailableGroups) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("API resources unavailable, not routed: %s", strings.Join(table.unavailableGroupVersions(), ", "))
+}
+
+// unavailableGroupVersions returns the sorted unavailable group versions.
+func (t *routeTable) unavailableGroupVersions() []string {
+	groupVersions := make([]string, 0, len(t.unavailableGroups))
+	for gv := range t.unavailableGroups {
+		groupVersions = append(groupVersions, gv.String())
+	}
+
+	slices.Sort(groupVersions)
+
+	return groupVersions
+}
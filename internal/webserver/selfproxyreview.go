@@ -0,0 +1,129 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package webserver
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	capsulerbac "github.com/projectcapsule/capsule/pkg/api/rbac"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	proxyv1beta1 "github.com/projectcapsule/capsule-proxy/api/proxy/v1beta1"
+	req "github.com/projectcapsule/capsule-proxy/internal/request"
+	"github.com/projectcapsule/capsule-proxy/internal/tenant"
+	server "github.com/projectcapsule/capsule-proxy/internal/webserver/errors"
+	"github.com/projectcapsule/capsule-proxy/internal/webserver/middleware"
+)
+
+// maxSelfProxyReviewBytes bounds the body of a SelfProxyReview, whose spec is
+// empty.
+const maxSelfProxyReviewBytes = 1 << 20
+
+// selfProxyReviewHandler answers the SelfProxyReview created by the caller
+// with the Tenants, namespaces and cluster resources capsule-proxy grants to
+// them. Nothing is forwarded to, nor persisted by, the API server.
+func (n *kubeFilter) selfProxyReviewHandler(writer http.ResponseWriter, request *http.Request) {
+	review := &proxyv1beta1.SelfProxyReview{}
+	if err := json.NewDecoder(http.MaxBytesReader(writer, request.Body, maxSelfProxyReviewBytes)).Decode(review); err != nil && !errors.Is(err, io.EOF) {
+		server.HandleBadRequest(writer, err, "cannot decode the SelfProxyReview")
+
+		return
+	}
+
+	request, username, groups, err := req.ResolveUserAndGroups(request, n.authTypes, n.usernameClaimField, n.writer, n.ignoredImpersonationGroups, n.impersonationGroupsRegexp, n.skipImpersonationReview, n.xfcc_header, n.tokenAuthenticator)
+	if err != nil {
+		n.handleResolveUserAndGroupsError(writer, err)
+
+		return
+	}
+
+	proxyTenants, err := n.getTenantsForOwner(request.Context(), username, groups)
+	if err != nil {
+		server.HandleError(writer, err, "cannot list Tenant resources")
+
+		return
+	}
+
+	review.SetGroupVersionKind(proxyv1beta1.GroupVersion.WithKind(proxyv1beta1.SelfProxyReviewKind))
+	review.Status = proxyv1beta1.SelfProxyReviewStatus{
+		UserInfo: authenticationv1.UserInfo{
+			Username: username,
+			Groups:   groups,
+		},
+		CapsuleUser: middleware.IsCapsuleUser(username, groups),
+		Ignored:     middleware.IdentityIsIgnored(username, groups, n.ignoredUsernames, n.ignoredUserGroups),
+	}
+
+	for _, pt := range proxyTenants {
+		review.Status.Tenants = append(review.Status.Tenants, reviewProxyTenant(pt))
+	}
+
+	if n.roleBindingsReflector != nil {
+		proxyRequest := req.NewHTTP(
+			request,
+			n.authTypes,
+			n.usernameClaimField,
+			n.writer,
+			n.ignoredImpersonationGroups,
+			n.impersonationGroupsRegexp,
+			n.skipImpersonationReview,
+			n.xfcc_header,
+			n.tokenAuthenticator,
+		)
+
+		byTenant, reflectionErr := n.reflectedTenantNamespaces(proxyRequest)
+		if reflectionErr != nil {
+			server.HandleError(writer, reflectionErr, "cannot resolve the reflected RoleBindings")
+
+			return
+		}
+
+		for _, name := range sets.List(sets.KeySet(byTenant)) {
+			review.Status.Tenants = append(review.Status.Tenants, proxyv1beta1.SelfProxyReviewTenant{
+				Name:       name,
+				Source:     proxyv1beta1.SourceRoleBindingReflection,
+				Namespaces: byTenant[name],
+			})
+		}
+	}
+
+	namespaces := sets.New[string]()
+	for _, reviewed := range review.Status.Tenants {
+		namespaces.Insert(reviewed.Namespaces...)
+	}
+
+	review.Status.Namespaces = sets.List(namespaces)
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusCreated)
+
+	_ = json.NewEncoder(writer).Encode(review)
+}
+
+func reviewProxyTenant(pt *tenant.ProxyTenant) proxyv1beta1.SelfProxyReviewTenant {
+	reviewed := proxyv1beta1.SelfProxyReviewTenant{
+		Name:             pt.Tenant.Name,
+		Source:           proxyv1beta1.SelfProxyReviewSource(pt.Source),
+		SourceName:       pt.SourceName,
+		Namespaces:       pt.Tenant.Status.Namespaces,
+		ClusterResources: pt.ClusterResources,
+	}
+
+	allowed := allowedOperations(pt)
+
+	for _, kind := range sets.List(sets.KeySet(allowed)) {
+		setting := capsulerbac.ProxySettings{Kind: capsulerbac.ProxyServiceKind(kind)}
+		for _, operation := range allowed[kind] {
+			setting.Operations = append(setting.Operations, capsulerbac.ProxyOperation(operation))
+		}
+
+		reviewed.ProxyOperations = append(reviewed.ProxyOperations, setting)
+	}
+
+	return reviewed
+}
@@ -4,24 +4,40 @@
 package webserver
 
 import (
+	"context"
 	"strings"
 
 	"github.com/pkg/errors"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/discovery"
-	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/projectcapsule/capsule-proxy/internal/modules"
+	"github.com/projectcapsule/capsule-proxy/internal/table"
 	"github.com/projectcapsule/capsule-proxy/internal/utils"
+	"github.com/projectcapsule/capsule-proxy/internal/webserver/discoveryfilter"
 )
 
-func discoverAPI(config *rest.Config) ([]utils.ProxyGroupVersionKind, error) {
-	discoveryClient := discovery.NewDiscoveryClientForConfigOrDie(config)
+// partialDiscovery returns the group versions the discovery failed for, the
+// resources of the other ones being returned nonetheless, or the error when
+// the discovery failed as a whole.
+func partialDiscovery(err error) (map[schema.GroupVersion]error, error) {
+	var groupErr *discovery.ErrGroupDiscoveryFailed
+	if errors.As(err, &groupErr) {
+		return groupErr.Groups, nil
+	}
+
+	return nil, err
+}
 
+func discoverAPI(discoveryClient discovery.DiscoveryInterface) ([]utils.ProxyGroupVersionKind, map[schema.GroupVersion]error, error) {
 	apiResourceLists, err := discoveryClient.ServerPreferredNamespacedResources()
+
+	failed, err := partialDiscovery(err)
 	if err != nil {
-		return nil, errors.Wrap(err, "cannot retrieve server's preferred namespaced resources")
+		return nil, nil, errors.Wrap(err, "cannot retrieve server's preferred namespaced resources")
 	}
 
 	var out []utils.ProxyGroupVersionKind
@@ -55,7 +71,7 @@ func discoverAPI(config *rest.Config) ([]utils.ProxyGroupVersionKind, error) {
 		}
 	}
 
-	return out, nil
+	return out, failed, nil
 }
 
 func moduleGroupKindPresent(modules []modules.Module, clusterModule utils.ProxyGroupVersionKind) (present bool) {
@@ -72,10 +88,11 @@ func moduleGroupKindPresent(modules []modules.Module, clusterModule utils.ProxyG
 	return
 }
 
-func serverPreferredResources(discoveryClient *discovery.DiscoveryClient) (out []utils.ProxyGroupVersionKind, err error) {
+func serverPreferredResources(discoveryClient discovery.DiscoveryInterface) (out []utils.ProxyGroupVersionKind, failed map[schema.GroupVersion]error, err error) {
 	apiResourceLists, err := discoveryClient.ServerPreferredResources()
-	if err != nil {
-		return nil, errors.Wrap(err, "cannot retrieve server's preferred resources")
+
+	if failed, err = partialDiscovery(err); err != nil {
+		return nil, nil, errors.Wrap(err, "cannot retrieve server's preferred resources")
 	}
 
 	for _, ar := range apiResourceLists {
@@ -112,5 +129,59 @@ func serverPreferredResources(discoveryClient *discovery.DiscoveryClient) (out [
 		}
 	}
 
+	return out, failed, nil
+}
+
+// discoverResources returns the preferred resources of the API groups, by
+// group, judged by the discovery filter.
+func discoverResources(discoveryClient discovery.DiscoveryInterface) (map[string][]discoveryfilter.Resource, map[schema.GroupVersion]error, error) {
+	apiResourceLists, err := discoveryClient.ServerPreferredResources()
+
+	failed, err := partialDiscovery(err)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "cannot retrieve server's preferred resources")
+	}
+
+	out := map[string][]discoveryfilter.Resource{}
+
+	for _, ar := range apiResourceLists {
+		gv, err := schema.ParseGroupVersion(ar.GroupVersion)
+		if err != nil {
+			continue
+		}
+
+		for _, i := range ar.APIResources {
+			out[gv.Group] = append(out[gv.Group], discoveryfilter.Resource{
+				Group:      gv.Group,
+				Version:    gv.Version,
+				Name:       i.Name,
+				Namespaced: i.Namespaced,
+				Verbs:      i.Verbs,
+			})
+		}
+	}
+
+	return out, failed, nil
+}
+
+// printerColumns returns the printer columns of each version of the custom
+// resources, used to synthesize their Tables.
+func printerColumns(ctx context.Context, reader client.Reader) (map[schema.GroupVersionKind][]apiextensionsv1.CustomResourceColumnDefinition, error) {
+	crds := &apiextensionsv1.CustomResourceDefinitionList{}
+	if err := reader.List(ctx, crds); err != nil {
+		return nil, errors.Wrap(err, "cannot list CustomResourceDefinitions")
+	}
+
+	out := map[schema.GroupVersionKind][]apiextensionsv1.CustomResourceColumnDefinition{}
+
+	for i := range crds.Items {
+		crd := &crds.Items[i]
+
+		for _, version := range crd.Spec.Versions {
+			gvk := schema.GroupVersionKind{Group: crd.Spec.Group, Version: version.Name, Kind: crd.Spec.Names.Kind}
+			out[gvk] = table.CRDColumns(crd, version.Name)
+		}
+	}
+
 	return out, nil
 }
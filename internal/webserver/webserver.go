@@ -10,6 +10,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"mime"
 	"net"
 	"net/http"
@@ -20,6 +21,8 @@ import (
 	"regexp"
 	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-logr/logr"
@@ -28,12 +31,15 @@ import (
 	pkgerrors "github.com/pkg/errors"
 	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
 	capsulerbac "github.com/projectcapsule/capsule/pkg/api/rbac"
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/net/http/httpguts"
 	authenticationv1 "k8s.io/api/authentication/v1"
 	authorizationv1 "k8s.io/api/authorization/v1"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
 	"k8s.io/apimachinery/pkg/runtime/serializer/protobuf"
 	"k8s.io/apimachinery/pkg/util/sets"
@@ -45,6 +51,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/projectcapsule/capsule-proxy/api/v1beta1"
+	"github.com/projectcapsule/capsule-proxy/internal/audit"
 	"github.com/projectcapsule/capsule-proxy/internal/authorization"
 	"github.com/projectcapsule/capsule-proxy/internal/controllers"
 	"github.com/projectcapsule/capsule-proxy/internal/features"
@@ -62,13 +69,20 @@ import (
 	"github.com/projectcapsule/capsule-proxy/internal/modules/runtimeclass"
 	"github.com/projectcapsule/capsule-proxy/internal/modules/storageclass"
 	"github.com/projectcapsule/capsule-proxy/internal/modules/tenants"
+	"github.com/projectcapsule/capsule-proxy/internal/oidc"
 	"github.com/projectcapsule/capsule-proxy/internal/options"
 	req "github.com/projectcapsule/capsule-proxy/internal/request"
+	"github.com/projectcapsule/capsule-proxy/internal/reviewcache"
 	"github.com/projectcapsule/capsule-proxy/internal/tenant"
+	"github.com/projectcapsule/capsule-proxy/internal/tracing"
 	"github.com/projectcapsule/capsule-proxy/internal/utils"
+	proxydiscovery "github.com/projectcapsule/capsule-proxy/internal/webserver/discovery"
+	"github.com/projectcapsule/capsule-proxy/internal/webserver/discoveryfilter"
 	server "github.com/projectcapsule/capsule-proxy/internal/webserver/errors"
+	"github.com/projectcapsule/capsule-proxy/internal/webserver/fanout"
 	"github.com/projectcapsule/capsule-proxy/internal/webserver/middleware"
 	"github.com/projectcapsule/capsule-proxy/internal/webserver/namespacegate"
+	"github.com/projectcapsule/capsule-proxy/internal/webserver/writeguard"
 )
 
 func NewKubeFilter(
@@ -77,6 +91,7 @@ func NewKubeFilter(
 	gates featuregate.FeatureGate,
 	rbReflector *controllers.RoleBindingReflector,
 	clientOverride client.Reader,
+	discoveryClient discovery.CachedDiscoveryInterface,
 	mgr ctrl.Manager,
 ) (Filter, error) {
 	reverseProxy := httputil.NewSingleHostReverseProxy(opts.KubernetesControlPlaneURL())
@@ -87,7 +102,8 @@ func NewKubeFilter(
 		return nil, pkgerrors.Wrap(err, "cannot create transport for reverse proxy")
 	}
 
-	reverseProxy.Transport = reverseProxyTransport
+	tracingTransport := tracing.NewTransport(reverseProxyTransport)
+	reverseProxy.Transport = tracingTransport
 
 	scheme := runtime.NewScheme()
 	protoEncoder := protobuf.NewSerializer(scheme, scheme)
@@ -109,13 +125,23 @@ func NewKubeFilter(
 		mgr.GetAPIReader(),
 		ctrl.Log.WithName("proxy").WithName("namespace_gate"),
 	)
-	reverseProxy.ModifyResponse = namespaceResponseGate.ModifyResponse
+	reverseProxy.ModifyResponse = func(response *http.Response) error {
+		if err := proxydiscovery.ModifyResponse(response); err != nil {
+			return err
+		}
+
+		if err := discoveryfilter.ModifyResponse(response); err != nil {
+			return err
+		}
+
+		return namespaceResponseGate.ModifyResponse(response)
+	}
 
 	return &kubeFilter{
 		mgr:                        mgr,
 		gates:                      gates,
 		reader:                     clientOverride,
-		writer:                     mgr.GetClient(),
+		writer:                     reviewcache.NewWriter(mgr.GetClient(), opts.ReviewCache()),
 		managerReader:              mgr.GetClient(),
 		allowedPaths:               sets.New(opts.AllowedPaths()...),
 		authTypes:                  opts.AuthTypes(),
@@ -132,11 +158,20 @@ func NewKubeFilter(
 		serverOptions:              srv,
 		log:                        ctrl.Log.WithName("proxy"),
 		roleBindingsReflector:      rbReflector,
+		discovery:                  discoveryClient,
+		discoveryJudgements:        newDiscoveryJudgements(),
+		invalidatedTokens:          middleware.NewInvalidatedTokens(middleware.DefaultInvalidatedTokenTTL, middleware.DefaultInvalidatedTokenMaxTTL, middleware.DefaultInvalidatedTokensSize),
+		rateLimiter:                middleware.NewRateLimiter(middleware.DefaultRateLimitIdleTTL),
+		auditor:                    audit.NewAuditor(opts.AuditSink(), ctrl.Log.WithName("audit")),
+		namespacedListStrategy:     opts.NamespacedListStrategy(),
+		fanOutLister:               fanout.New(tracingTransport, *opts.KubernetesControlPlaneURL(), ctrl.Log.WithName("proxy").WithName("fanout")),
 		protoEncoder:               protoEncoder,
 		universalDecoder:           universalDecoder,
 		scheme:                     scheme,
 		trustedProxyCIDRs:          opts.TrustedProxyCIDRs(),
 		xfcc_header:                opts.XFCCHeader(),
+		tokenAuthenticator:         opts.TokenAuthenticator(),
+		writeGuard:                 writeguard.New(mgr.GetAPIReader(), mgr.GetRESTMapper()),
 	}, nil
 }
 
@@ -157,9 +192,18 @@ type kubeFilter struct {
 	serverOptions              options.ServerOptions
 	log                        logr.Logger
 	roleBindingsReflector      *controllers.RoleBindingReflector
+	discovery                  discovery.CachedDiscoveryInterface
+	discoveryJudgements        *discoveryJudgements
+	invalidatedTokens          *middleware.InvalidatedTokens
+	rateLimiter                *middleware.RateLimiter
+	auditor                    *audit.Auditor
+	namespacedListStrategy     modules.ListStrategy
+	fanOutLister               *fanout.Lister
 	gates                      featuregate.FeatureGate
 	xfcc_header                string
+	tokenAuthenticator         req.TokenAuthenticator
 	trustedProxyCIDRs          []*net.IPNet
+	writeGuard                 *writeguard.Guard
 
 	managerReader, reader client.Reader
 	writer                client.Writer
@@ -167,11 +211,11 @@ type kubeFilter struct {
 	universalDecoder      runtime.Decoder
 	scheme                *runtime.Scheme
 
-	// namespacedResources holds the set of proxied namespaced resources (keyed
-	// via authorization.NamespacedResourceKey) for which capsule-proxy serves
-	// cross-namespace (`-A`) list/watch queries. It is used to advertise that
-	// capability through the self review (auth review) APIs.
-	namespacedResources sets.Set[string]
+	// routes holds the module routes built from the discovered API resources,
+	// swapped at once when CustomResourceDefinitions or APIServices change.
+	routes atomic.Pointer[routeTable]
+	// routesMu serializes the route builds, the last one being swapped in.
+	routesMu sync.Mutex
 }
 
 // NeedLeaderElection starts the proxy (webserver) independently of controller manager
@@ -182,27 +226,13 @@ func (n *kubeFilter) NeedLeaderElection() bool {
 
 //nolint:funlen
 func (n *kubeFilter) Start(ctx context.Context) error {
-	r := mux.NewRouter()
-	r.Use(n.recoveryMiddleware)
-
-	r.Path("/_healthz").Subrouter().HandleFunc("", func(writer http.ResponseWriter, _ *http.Request) {
-		writer.WriteHeader(http.StatusOK)
-		_, _ = writer.Write([]byte("ok"))
-	})
+	if err := n.RefreshRoutes(ctx); err != nil {
+		// The API resources controller retries with backoff: meanwhile the
+		// group versions failing discovery are not routed, and until any route
+		// is built the proxy answers with 503 and is not ready.
+		n.log.Error(err, "cannot discover the API resources")
+	}
 
-	root := r.PathPrefix("").Subrouter()
-	n.registerModules(ctx, root)
-	root.Use(
-		middleware.RequireTrustedSourceMiddleware(n.log, n.trustedProxyCIDRs),
-		n.authorizationMiddleware,
-		n.reverseProxyMiddleware,
-		middleware.LoggerMiddleware(n.log),
-		middleware.CheckPaths(n.log, n.allowedPaths, n.impersonateHandler),
-		middleware.CheckJWTMiddleware(n.writer),
-	)
-	root.PathPrefix("/").HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
-		n.impersonateHandler(writer, request)
-	})
 	// cert-watcher integration:
 	// extracting the GetCertificate function for hot reload upon certificate update.
 	// This will be used only if the proxy is set to bare TLS mode.
@@ -242,7 +272,7 @@ func (n *kubeFilter) Start(ctx context.Context) error {
 			}
 
 			srv = &http.Server{
-				Handler:           r,
+				Handler:           http.HandlerFunc(n.serveHTTP),
 				Addr:              addr,
 				TLSConfig:         tlsConfig,
 				ReadHeaderTimeout: 5 * time.Second,
@@ -256,7 +286,7 @@ func (n *kubeFilter) Start(ctx context.Context) error {
 			err = srv.Serve(ln)
 		} else {
 			srv = &http.Server{
-				Handler:           r,
+				Handler:           http.HandlerFunc(n.serveHTTP),
 				Addr:              addr,
 				ReadHeaderTimeout: 5 * time.Second,
 			}
@@ -274,11 +304,79 @@ func (n *kubeFilter) Start(ctx context.Context) error {
 	return srv.Shutdown(ctx)
 }
 
+// newRouter returns the router of the fixed endpoints, along with the
+// subrouter the modules are routed by.
+func (n *kubeFilter) newRouter() (*mux.Router, *mux.Router) {
+	r := mux.NewRouter()
+	r.Use(tracing.Middleware, middleware.MetricsMiddleware, n.recoveryMiddleware)
+
+	r.Path("/_healthz").Subrouter().HandleFunc("", func(writer http.ResponseWriter, _ *http.Request) {
+		writer.WriteHeader(http.StatusOK)
+		_, _ = writer.Write([]byte("ok"))
+	})
+
+	// The explain endpoint answers on its own: nothing is forwarded to the
+	// API server.
+	explain := r.Path(ExplainPath).Subrouter()
+	explain.Use(
+		middleware.RequireTrustedSourceMiddleware(n.log, n.trustedProxyCIDRs),
+		middleware.LoggerMiddleware(n.log),
+		middleware.CheckJWTMiddleware(n.writer, n.tokenAuthenticator, n.invalidatedTokens),
+		middleware.RateLimitMiddleware(n.log, n.rateLimiter, n.rateLimits),
+	)
+	explain.HandleFunc("", n.explainHandler).Methods(http.MethodGet)
+
+	// The invalidated tokens are purged on their own as well.
+	invalidatedTokens := r.Path(InvalidatedTokensPath).Subrouter()
+	invalidatedTokens.Use(
+		middleware.RequireTrustedSourceMiddleware(n.log, n.trustedProxyCIDRs),
+		middleware.LoggerMiddleware(n.log),
+		middleware.CheckJWTMiddleware(n.writer, n.tokenAuthenticator, n.invalidatedTokens),
+		middleware.RateLimitMiddleware(n.log, n.rateLimiter, n.rateLimits),
+	)
+	invalidatedTokens.HandleFunc("", n.purgeInvalidatedTokensHandler).Methods(http.MethodDelete)
+
+	// The API group of capsule-proxy is served on its own as well, the
+	// discovery of the API server advertising it.
+	proxyAPI := r.PathPrefix(proxydiscovery.GroupPath).Subrouter()
+	proxyAPI.Use(
+		middleware.RequireTrustedSourceMiddleware(n.log, n.trustedProxyCIDRs),
+		middleware.LoggerMiddleware(n.log),
+		middleware.CheckJWTMiddleware(n.writer, n.tokenAuthenticator, n.invalidatedTokens),
+		middleware.RateLimitMiddleware(n.log, n.rateLimiter, n.rateLimits),
+	)
+	proxyAPI.HandleFunc("", proxydiscovery.ServeGroup).Methods(http.MethodGet)
+	proxyAPI.HandleFunc(strings.TrimPrefix(proxydiscovery.VersionPath, proxydiscovery.GroupPath), proxydiscovery.ServeVersion).Methods(http.MethodGet)
+	proxyAPI.HandleFunc(strings.TrimPrefix(proxydiscovery.SelfProxyReviewPath, proxydiscovery.GroupPath), n.selfProxyReviewHandler).Methods(http.MethodPost)
+
+	root := r.PathPrefix("").Subrouter()
+	root.Use(
+		ownerTenantsMiddleware,
+		n.auditor.Middleware,
+		middleware.RequireTrustedSourceMiddleware(n.log, n.trustedProxyCIDRs),
+		n.authorizationMiddleware,
+		n.discoveryFilterMiddleware,
+		proxydiscovery.Middleware,
+		n.reverseProxyMiddleware,
+		middleware.LoggerMiddleware(n.log),
+		middleware.CheckPaths(n.log, n.allowedPaths, n.impersonateHandler),
+		middleware.CheckJWTMiddleware(n.writer, n.tokenAuthenticator, n.invalidatedTokens),
+		middleware.RateLimitMiddleware(n.log, n.rateLimiter, n.rateLimits),
+		n.writeGuardMiddleware,
+	)
+
+	return r, root
+}
+
 func (n *kubeFilter) LivenessProbe(*http.Request) error {
 	return nil
 }
 
 func (n *kubeFilter) ReadinessProbe(req *http.Request) (err error) {
+	if n.routes.Load() == nil {
+		return fmt.Errorf("the API resources have not been discovered yet")
+	}
+
 	scheme := "http"
 	clt := &http.Client{}
 
@@ -332,28 +430,143 @@ func (n *kubeFilter) BearerToken() string {
 
 func (n *kubeFilter) reverseProxyMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
-		next.ServeHTTP(writer, request)
+		rw := &answeredResponseWriter{ResponseWriter: writer}
+		next.ServeHTTP(rw, request)
+
+		// The handlers answering on their own (errors, fan-out lists) must not
+		// have the request proxied on top of their response.
+		if rw.answered {
+			return
+		}
 
 		n.log.V(5).Info("debugging request", "uri", request.RequestURI, "method", request.Method)
 		n.reverseProxy.ServeHTTP(writer, request)
 	})
 }
 
+// writeGuardMiddleware rejects the updates and patches of Tenant users
+// changing the labels Capsule binds their namespaced objects with.
+func (n *kubeFilter) writeGuardMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		target, ok := writeguard.TargetOf(request)
+		if !ok {
+			next.ServeHTTP(writer, request)
+
+			return
+		}
+
+		_, username, groups, err := req.ResolveUserAndGroups(request, n.authTypes, n.usernameClaimField, n.writer, n.ignoredImpersonationGroups, n.impersonationGroupsRegexp, n.skipImpersonationReview, n.xfcc_header, n.tokenAuthenticator)
+		if err != nil {
+			n.handleResolveUserAndGroupsError(writer, err)
+
+			return
+		}
+
+		if !middleware.IsCapsuleUser(username, groups) || middleware.IdentityIsIgnored(username, groups, n.ignoredUsernames, n.ignoredUserGroups) {
+			next.ServeHTTP(writer, request)
+
+			return
+		}
+
+		// The body is restored on the request the reverse proxy forwards,
+		// rather than on its copy carrying the resolved user.
+		if err = n.writeGuard.Check(request, target); err != nil {
+			var t moderrors.Error
+			if errors.As(err, &t) {
+				writeStatus(writer, t.Status())
+
+				return
+			}
+
+			server.HandleError(writer, err, "cannot check the labels written to the object")
+
+			return
+		}
+
+		next.ServeHTTP(writer, request)
+	})
+}
+
+// writeStatus answers with the Status, using its code when set.
+func writeStatus(writer http.ResponseWriter, status *metav1.Status) {
+	writer.Header().Set("Content-Type", "application/json")
+
+	if status.Code > 0 {
+		writer.WriteHeader(int(status.Code))
+	} else {
+		writer.WriteHeader(http.StatusInternalServerError)
+	}
+
+	b, _ := json.Marshal(status)
+	_, _ = writer.Write(b)
+}
+
+// answeredResponseWriter tracks whether a handler wrote a response.
+type answeredResponseWriter struct {
+	http.ResponseWriter
+
+	answered bool
+}
+
+func (a *answeredResponseWriter) WriteHeader(statusCode int) {
+	a.answered = true
+	a.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (a *answeredResponseWriter) Write(b []byte) (int, error) {
+	a.answered = true
+
+	return a.ResponseWriter.Write(b)
+}
+
+// Flush sends the buffered data of the streamed responses, as watches.
+func (a *answeredResponseWriter) Flush() {
+	if flusher, ok := a.ResponseWriter.(http.Flusher); ok {
+		a.answered = true
+
+		flusher.Flush()
+	}
+}
+
+func (a *answeredResponseWriter) Unwrap() http.ResponseWriter {
+	return a.ResponseWriter
+}
+
 func hasBearerToken(request *http.Request) bool {
 	parts := strings.Fields(request.Header.Get("Authorization"))
 
 	return len(parts) >= 2 && strings.EqualFold(parts[0], "Bearer")
 }
 
+// forwardsBearerToken reports whether the review request can be forwarded
+// with the caller's own bearer token. Tokens of the configured OIDC issuers
+// are only validated by capsule-proxy, the API server rejects them: these
+// requests are forwarded impersonating the user.
+func (n *kubeFilter) forwardsBearerToken(request *http.Request) bool {
+	if !hasBearerToken(request) {
+		return false
+	}
+
+	if n.tokenAuthenticator == nil || !slices.Contains(n.authTypes, req.OIDC) {
+		return true
+	}
+
+	token := strings.Fields(request.Header.Get("Authorization"))[1]
+
+	_, _, err := n.tokenAuthenticator.AuthenticateToken(request.Context(), token)
+
+	return errors.Is(err, oidc.ErrUnknownIssuer)
+}
+
 func (n *kubeFilter) authorizationMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
-		if !slices.Contains(authorization.Paths, request.URL.Path) {
+		if !slices.Contains(authorization.Paths, request.URL.Path) && !authorization.IsSubjectReviewPath(request.URL.Path) {
 			next.ServeHTTP(writer, request)
 
 			return
 		}
 
-		// Self-review requests are forwarded to the API server using the
+		// Review requests are forwarded to the API server using the
 		// caller's own bearer token whenever one is available,
 		// instead of having the proxy impersonate the user together with every
 		// one of their groups.
@@ -363,10 +576,12 @@ func (n *kubeFilter) authorizationMiddleware(next http.Handler) http.Handler {
 		// extremely slow.
 		// A self-review answered with the caller's own
 		// credentials returns the exact same result at a fraction of the cost.
+		// OIDC tokens are not accepted by the API server and are forwarded
+		// impersonating the user.
 
 		w := httptest.NewRecorder()
 
-		if hasBearerToken(request) {
+		if n.forwardsBearerToken(request) {
 			n.reverseProxy.ServeHTTP(w, request)
 		} else {
 			next.ServeHTTP(w, request)
@@ -385,27 +600,60 @@ func (n *kubeFilter) authorizationMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		request, username, groups, err := req.ResolveUserAndGroups(request, n.authTypes, n.usernameClaimField, n.writer, n.ignoredImpersonationGroups, n.impersonationGroupsRegexp, n.skipImpersonationReview, n.xfcc_header)
-		if err != nil {
-			n.handleResolveUserAndGroupsError(writer, err)
+		var (
+			proxyTenants []*tenant.ProxyTenant
+			obj          runtime.Object
+			gvk          *schema.GroupVersionKind
+		)
 
-			return
-		}
+		if authorization.IsSubjectReviewPath(request.URL.Path) {
+			// The API server answers the access reviews on behalf of a user
+			// only to the callers allowed to create them: a failed review, or
+			// one about a user capsule-proxy does not filter, is returned as is.
+			var decodeErr error
 
-		//nolint:contextcheck
-		proxyTenants, err := n.getTenantsForOwner(request.Context(), username, groups)
-		if err != nil {
-			server.HandleError(writer, err, "cannot list Tenant resources")
+			obj, gvk, decodeErr = n.universalDecoder.Decode(body, nil, nil)
 
-			return
-		}
+			username, groups, ok := authorization.ReviewedSubject(obj)
+			if decodeErr != nil || (result.StatusCode != http.StatusCreated && result.StatusCode != http.StatusOK) || !ok ||
+				!middleware.IsCapsuleUser(username, groups) || middleware.IdentityIsIgnored(username, groups, n.ignoredUsernames, n.ignoredUserGroups) {
+				n.writeAuthorizationResponse(writer, result, body)
 
-		obj, gvk, err := n.universalDecoder.Decode(body, nil, nil)
-		if err != nil {
-			n.log.Error(err, "cannot decode authorization object")
+				return
+			}
+
+			//nolint:contextcheck
+			if proxyTenants, err = n.getTenantsForOwner(request.Context(), username, groups); err != nil {
+				server.HandleError(writer, err, "cannot list Tenant resources")
+
+				return
+			}
+		} else {
+			var (
+				username string
+				groups   []string
+			)
+
+			request, username, groups, err = req.ResolveUserAndGroups(request, n.authTypes, n.usernameClaimField, n.writer, n.ignoredImpersonationGroups, n.impersonationGroupsRegexp, n.skipImpersonationReview, n.xfcc_header, n.tokenAuthenticator)
+			if err != nil {
+				n.handleResolveUserAndGroupsError(writer, err)
+
+				return
+			}
+
+			//nolint:contextcheck
+			if proxyTenants, err = n.getTenantsForOwner(request.Context(), username, groups); err != nil {
+				server.HandleError(writer, err, "cannot list Tenant resources")
+
+				return
+			}
+
+			if obj, gvk, err = n.universalDecoder.Decode(body, nil, nil); err != nil {
+				n.log.Error(err, "cannot decode authorization object")
+			}
 		}
 
-		if err = authorization.MutateAuthorization(n.gates.Enabled(features.ProxyClusterScoped), proxyTenants, n.namespacedResources, &obj, *gvk); err != nil {
+		if err = authorization.MutateAuthorization(n.gates.Enabled(features.ProxyClusterScoped), proxyTenants, n.routes.Load().namespacedResources, &obj, *gvk); err != nil {
 			n.log.Error(err, "cannot mutate authorization object")
 		}
 
@@ -429,35 +677,45 @@ func (n *kubeFilter) authorizationMiddleware(next http.Handler) http.Handler {
 			}
 		}
 
-		for k, v := range result.Header {
-			if k == "Content-Length" {
-				continue
-			}
+		n.writeAuthorizationResponse(writer, result, body)
+	})
+}
 
-			for _, sv := range v {
-				writer.Header().Add(k, sv)
-			}
+// writeAuthorizationResponse answers with the API server response to the
+// review, along with the possibly mutated body.
+func (n *kubeFilter) writeAuthorizationResponse(writer http.ResponseWriter, result *http.Response, body []byte) {
+	for k, v := range result.Header {
+		if k == "Content-Length" {
+			continue
 		}
 
-		writer.WriteHeader(result.StatusCode)
-
-		write, err := writer.Write(body)
-		if err != nil {
-			n.log.Error(err, "cannot write mutated authorization object to response", "bytesWritten", write)
+		for _, sv := range v {
+			writer.Header().Add(k, sv)
 		}
-	})
+	}
+
+	writer.WriteHeader(result.StatusCode)
+
+	write, err := writer.Write(body)
+	if err != nil {
+		n.log.Error(err, "cannot write mutated authorization object to response", "bytesWritten", write)
+	}
 }
 
 func (n *kubeFilter) handleRequest(request *http.Request, selector labels.Selector, username string) {
 	// Requests handled with a selector are forwarded using the proxy ServiceAccount,
 	// so the Kubernetes audit event cannot retain the original user through
 	// impersonation. Record that identity before replacing the bearer token.
+	// The label selector does not apply to the writes of a named object: the
+	// module pins them to the object it checked instead.
 	n.log.V(5).Info("proxying filtered request", "username", username, "method", request.Method, "uri", request.URL.Path)
 
 	req.SanitizeImpersonationHeaders(request)
 
 	selectorValue := selector.String()
 
+	audit.RecordFrom(request.Context()).SetForwarding(audit.ForwardingServiceAccount, selectorValue)
+
 	q := request.URL.Query()
 	if e := q.Get("labelSelector"); len(e) > 0 {
 		n.log.V(4).Info("handling current labelSelector", "selector", e)
@@ -479,8 +737,86 @@ func (n *kubeFilter) handleRequest(request *http.Request, selector labels.Select
 	}
 }
 
+// fanOutModule returns the module of a cross-namespace list or watch served
+// by listing or watching each Tenant namespace, either as its list strategy or
+// to keep the identity of the user. The other filtered requests read
+// cluster-scoped objects the user cannot read on their own, they are always
+// forwarded with the proxy ServiceAccount.
+func (n *kubeFilter) fanOutModule(mod modules.Module) (modules.NamespacedModule, bool) {
+	namespacedModule, ok := mod.(modules.NamespacedModule)
+	if !ok {
+		return nil, false
+	}
+
+	return namespacedModule, namespacedModule.ListStrategy() == modules.ListStrategyFanOut || n.gates.Enabled(features.ImpersonateFilteredRequests)
+}
+
+// fanOut lists or watches the resource in each Tenant namespace the user can
+// list it in, and merges the results.
+func (n *kubeFilter) fanOut(
+	writer http.ResponseWriter,
+	request *http.Request,
+	mod modules.NamespacedModule,
+	proxyTenants []*tenant.ProxyTenant,
+	proxyRequest req.Request,
+	username string,
+	groups []string,
+) {
+	namespaces, err := mod.AllowedNamespaces(proxyTenants, proxyRequest)
+	if err != nil {
+		server.HandleError(writer, err, err.Error())
+
+		return
+	}
+
+	req.SanitizeImpersonationHeaders(request)
+
+	record := audit.RecordFrom(request.Context())
+
+	if n.gates.Enabled(features.ImpersonateFilteredRequests) {
+		record.SetForwarding(audit.ForwardingImpersonation, "")
+		n.impersonate(request, username, groups)
+	} else {
+		// The namespaces are authorized for the user already, they are listed
+		// with the proxy ServiceAccount as a label filtered request would be.
+		record.SetForwarding(audit.ForwardingServiceAccount, "")
+		n.removingHopByHopHeaders(request)
+
+		if token := n.BearerToken(); len(token) > 0 {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+
+	gvk := mod.GroupVersionKind()
+
+	target := fanout.Target{
+		ListKind:   gvk.GroupVersion().WithKind(gvk.Kind + "List"),
+		Namespaces: namespaces,
+		Path:       mod.NamespacedPath,
+		Columns:    n.routes.Load().printerColumns[gvk],
+	}
+
+	if !fanout.IsWatch(request) {
+		n.log.V(5).Info("fanning out cross-namespace list", "username", username, "uri", request.URL.Path, "namespaces", len(namespaces))
+		n.fanOutLister.ServeList(writer, request, target)
+
+		return
+	}
+
+	n.log.V(5).Info("multiplexing cross-namespace watch", "username", username, "uri", request.URL.Path, "namespaces", len(namespaces))
+
+	n.fanOutLister.ServeWatch(writer, request, target, func(ctx context.Context) ([]string, error) {
+		current, tenantsErr := n.getTenantsForOwner(ctx, username, groups)
+		if tenantsErr != nil {
+			return nil, tenantsErr
+		}
+
+		return mod.AllowedNamespaces(current, proxyRequest)
+	})
+}
+
 func (n *kubeFilter) impersonateHandler(writer http.ResponseWriter, request *http.Request) {
-	request, username, groups, err := req.ResolveUserAndGroups(request, n.authTypes, n.usernameClaimField, n.writer, n.ignoredImpersonationGroups, n.impersonationGroupsRegexp, n.skipImpersonationReview, n.xfcc_header)
+	request, username, groups, err := req.ResolveUserAndGroups(request, n.authTypes, n.usernameClaimField, n.writer, n.ignoredImpersonationGroups, n.impersonationGroupsRegexp, n.skipImpersonationReview, n.xfcc_header, n.tokenAuthenticator)
 	if err != nil {
 		msg := "cannot retrieve user and group"
 
@@ -496,6 +832,16 @@ func (n *kubeFilter) impersonateHandler(writer http.ResponseWriter, request *htt
 
 	n.log.V(4).Info("impersonating for the current request", "username", username, "groups", groups, "uri", request.URL.Path)
 
+	record := audit.RecordFrom(request.Context())
+	record.SetUser(username, groups)
+	record.SetForwarding(audit.ForwardingImpersonation, "")
+
+	n.impersonate(request, username, groups)
+}
+
+// impersonate sets the proxy credentials on the request, along with the
+// impersonation headers of the user.
+func (n *kubeFilter) impersonate(request *http.Request, username string, groups []string) {
 	if token := n.BearerToken(); len(token) > 0 {
 		request.Header.Set("Authorization", "Bearer "+token)
 	}
@@ -524,8 +870,10 @@ func (n *kubeFilter) ownerFromCapsuleToProxySetting(owners capsulerbac.OwnerList
 	return out
 }
 
-//nolint:funlen
-func (n *kubeFilter) registerModules(ctx context.Context, root *mux.Router) {
+// buildRoutes discovers the API resources and routes them to the modules.
+//
+//nolint:funlen,cyclop
+func (n *kubeFilter) buildRoutes(ctx context.Context) (*routeTable, error) {
 	// We are using namespaces and tenants as default routes from the legacy
 	// system, as their outcome heavily relies on the tenants config/status
 	modList := []modules.Module{
@@ -535,15 +883,24 @@ func (n *kubeFilter) registerModules(ctx context.Context, root *mux.Router) {
 		tenants.Get(n.reader),
 	}
 
-	// Discovery client
-	discoveryClient := discovery.NewDiscoveryClientForConfigOrDie(ctrl.GetConfigOrDie())
+	// The discovery is shared with the ProxySettings controllers: a refresh
+	// invalidates it, the API resources having changed.
+	n.discovery.Invalidate()
+
+	discoveryClient := n.discovery
+
+	// The group versions failing discovery, as an aggregated API whose
+	// backend is down, are left out: the others are routed nonetheless.
+	unavailable := map[schema.GroupVersion]error{}
 
 	if n.gates.Enabled(features.ProxyClusterScoped) {
-		apis, err := serverPreferredResources(discoveryClient)
+		apis, failed, err := serverPreferredResources(discoveryClient)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
 
+		maps.Copy(unavailable, failed)
+
 		for _, api := range apis {
 			if !moduleGroupKindPresent(modList, api) {
 				n.log.V(6).Info("adding generic cluster scoped resource", "url", api.Path())
@@ -573,24 +930,48 @@ func (n *kubeFilter) registerModules(ctx context.Context, root *mux.Router) {
 	}
 
 	// Get all API group resources
-	apis, err := discoverAPI(ctrl.GetConfigOrDie())
+	apis, failed, err := discoverAPI(discoveryClient)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	n.namespacedResources = sets.New[string]()
+	maps.Copy(unavailable, failed)
+
+	router, root := n.newRouter()
+
+	table := &routeTable{
+		router:              router,
+		namespacedResources: sets.New[string](),
+		unavailableGroups:   unavailable,
+	}
+
+	if n.gates.Enabled(features.DiscoveryFilter) {
+		if table.discoveredResources, failed, err = discoverResources(discoveryClient); err != nil {
+			return nil, err
+		}
+
+		maps.Copy(unavailable, failed)
+	}
+
+	if table.printerColumns, err = printerColumns(ctx, n.mgr.GetAPIReader()); err != nil {
+		// The Tables synthesized for the custom resources fall back to the
+		// default columns.
+		n.log.Error(err, "cannot retrieve the printer columns of the custom resources")
+	}
 
 	for _, api := range apis {
 		n.log.V(6).Info("adding generic namespaced resource", "url", api.Path())
 		modList = append(modList, namespaced.CatchAll(
 			n.writer,
 			n.roleBindingsReflector,
+			n.namespacedListStrategy,
 			api.Path(),
 			api.Group,
 			api.Version,
+			api.Kind,
 			api.URLName,
 		))
-		n.namespacedResources.Insert(authorization.NamespacedResourceKey(api.Group, api.URLName))
+		table.namespacedResources.Insert(authorization.NamespacedResourceKey(api.Group, api.URLName))
 	}
 
 	for _, i := range modList {
@@ -602,56 +983,62 @@ func (n *kubeFilter) registerModules(ctx context.Context, root *mux.Router) {
 		}
 
 		sr := rp.Subrouter()
+		table.routedModules = append(table.routedModules, routedModule{route: rp, module: mod})
 		sr.Use(
 			middleware.CheckPaths(n.log, n.allowedPaths, n.impersonateHandler),
-			middleware.CheckJWTMiddleware(n.writer),
-			middleware.CheckUserInIgnoredIdentityMiddleware(n.writer, n.log, n.usernameClaimField, n.authTypes, n.ignoredUsernames, n.ignoredUserGroups, n.ignoredImpersonationGroups, n.impersonationGroupsRegexp, n.skipImpersonationReview, n.xfcc_header, n.impersonateHandler),
-			middleware.CheckUserInCapsuleGroupMiddleware(n.writer, n.log, n.usernameClaimField, n.authTypes, n.ignoredImpersonationGroups, n.impersonationGroupsRegexp, n.skipImpersonationReview, n.xfcc_header, n.impersonateHandler),
+			middleware.CheckJWTMiddleware(n.writer, n.tokenAuthenticator, n.invalidatedTokens),
+			middleware.CheckUserInIgnoredIdentityMiddleware(n.writer, n.log, n.usernameClaimField, n.authTypes, n.ignoredUsernames, n.ignoredUserGroups, n.ignoredImpersonationGroups, n.impersonationGroupsRegexp, n.skipImpersonationReview, n.xfcc_header, n.tokenAuthenticator, n.impersonateHandler),
+			middleware.CheckUserInCapsuleGroupMiddleware(n.writer, n.log, n.usernameClaimField, n.authTypes, n.ignoredImpersonationGroups, n.impersonationGroupsRegexp, n.skipImpersonationReview, n.xfcc_header, n.tokenAuthenticator, n.impersonateHandler),
 		)
 		sr.HandleFunc("", func(writer http.ResponseWriter, request *http.Request) {
-			request, username, groups, err := req.ResolveUserAndGroups(request, n.authTypes, n.usernameClaimField, n.writer, n.ignoredImpersonationGroups, n.impersonationGroupsRegexp, n.skipImpersonationReview, n.xfcc_header)
+			request, username, groups, err := req.ResolveUserAndGroups(request, n.authTypes, n.usernameClaimField, n.writer, n.ignoredImpersonationGroups, n.impersonationGroupsRegexp, n.skipImpersonationReview, n.xfcc_header, n.tokenAuthenticator)
 			if err != nil {
 				n.handleResolveUserAndGroupsError(writer, err)
 
 				return
 			}
 
-			proxyTenants, err := n.getTenantsForOwner(ctx, username, groups)
+			proxyTenants, err := n.getTenantsForOwner(request.Context(), username, groups)
 			if err != nil {
 				server.HandleError(writer, err, "cannot list Tenant resources")
 
 				return
 			}
 
+			record := audit.RecordFrom(request.Context())
+			record.SetUser(username, groups)
+			record.SetTenants(proxyTenantNames(proxyTenants))
+			record.SetModule(mod.Path())
+
+			proxyRequest := req.NewHTTP(
+				request,
+				n.authTypes,
+				n.usernameClaimField,
+				n.writer,
+				n.ignoredImpersonationGroups,
+				n.impersonationGroupsRegexp,
+				n.skipImpersonationReview,
+				n.xfcc_header,
+				n.tokenAuthenticator,
+			)
+
+			if namespacedModule, ok := n.fanOutModule(mod); ok {
+				n.fanOut(writer, request, namespacedModule, proxyTenants, proxyRequest, username, groups)
+
+				return
+			}
+
 			var selector labels.Selector
 
-			selector, err = mod.Handle(
-				proxyTenants,
-				req.NewHTTP(
-					request,
-					n.authTypes,
-					n.usernameClaimField,
-					n.writer,
-					n.ignoredImpersonationGroups,
-					n.impersonationGroupsRegexp,
-					n.skipImpersonationReview,
-					n.xfcc_header,
-				))
+			_, span := tracing.StartSpan(request.Context(), "module "+mod.Path())
+			selector, err = mod.Handle(proxyTenants, proxyRequest)
+			tracing.EndSpan(span, err)
 
 			switch {
 			case err != nil:
 				var t moderrors.Error
 				if errors.As(err, &t) {
-					writer.Header().Set("Content-Type", "application/json")
-
-					if t.Status().Code > 0 {
-						writer.WriteHeader(int(t.Status().Code))
-					} else {
-						writer.WriteHeader(http.StatusInternalServerError)
-					}
-
-					b, _ := json.Marshal(t.Status())
-					_, _ = writer.Write(b)
+					writeStatus(writer, t.Status())
 
 					return
 				}
@@ -667,6 +1054,11 @@ func (n *kubeFilter) registerModules(ctx context.Context, root *mux.Router) {
 			}
 		})
 	}
+
+	// The requests no module serves are forwarded as the user.
+	root.PathPrefix("/").HandlerFunc(n.impersonateHandler)
+
+	return table, nil
 }
 
 func (n *kubeFilter) recoveryMiddleware(next http.Handler) http.Handler {
@@ -700,7 +1092,53 @@ func (n *kubeFilter) handleResolveUserAndGroupsError(writer http.ResponseWriter,
 	server.HandleError(writer, err, "cannot retrieve user and group from the request")
 }
 
-func (n *kubeFilter) getTenantsForOwner(ctx context.Context, username string, groups []string) (proxyTenants []*tenant.ProxyTenant, err error) {
+type ownerTenantsContextKey struct{}
+
+// ownerTenants memoizes the Tenants of the caller for the lifetime of a
+// request: the rate limits and the module handling the request resolve them
+// both.
+type ownerTenants struct {
+	mu           sync.Mutex
+	resolved     bool
+	username     string
+	groups       []string
+	proxyTenants []*tenant.ProxyTenant
+}
+
+// ownerTenantsMiddleware has the Tenants of the caller resolved at most once
+// per request.
+func ownerTenantsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		next.ServeHTTP(writer, request.WithContext(context.WithValue(request.Context(), ownerTenantsContextKey{}, &ownerTenants{})))
+	})
+}
+
+// getTenantsForOwner returns the Tenants of the user, reusing the ones already
+// resolved for the same identity while handling the request.
+func (n *kubeFilter) getTenantsForOwner(ctx context.Context, username string, groups []string) ([]*tenant.ProxyTenant, error) {
+	memo, ok := ctx.Value(ownerTenantsContextKey{}).(*ownerTenants)
+	if !ok {
+		return n.resolveTenantsForOwner(ctx, username, groups)
+	}
+
+	memo.mu.Lock()
+	defer memo.mu.Unlock()
+
+	if memo.resolved && memo.username == username && slices.Equal(memo.groups, groups) {
+		return slices.Clone(memo.proxyTenants), nil
+	}
+
+	proxyTenants, err := n.resolveTenantsForOwner(ctx, username, groups)
+	if err != nil {
+		return nil, err
+	}
+
+	memo.resolved, memo.username, memo.groups, memo.proxyTenants = true, username, slices.Clone(groups), proxyTenants
+
+	return slices.Clone(proxyTenants), nil
+}
+
+func (n *kubeFilter) resolveTenantsForOwner(ctx context.Context, username string, groups []string) (proxyTenants []*tenant.ProxyTenant, err error) {
 	if strings.HasPrefix(username, serviceaccount.ServiceAccountUsernamePrefix) {
 		proxyTenants, err = n.getProxyTenantsForOwnerKind(ctx, capsulerbac.ServiceAccountOwner, username)
 		if err != nil {
@@ -726,8 +1164,26 @@ func (n *kubeFilter) getTenantsForOwner(ctx context.Context, username string, gr
 	return
 }
 
+// proxyTenantNames returns the sorted names of the Tenants, a Tenant resolved
+// through several owner kinds is listed once.
+func proxyTenantNames(proxyTenants []*tenant.ProxyTenant) []string {
+	names := sets.New[string]()
+
+	for _, pt := range proxyTenants {
+		names.Insert(pt.Tenant.Name)
+	}
+
+	return sets.List(names)
+}
+
 //nolint:funlen
 func (n *kubeFilter) getProxyTenantsForOwnerKind(ctx context.Context, ownerKind capsulerbac.OwnerKind, ownerName string) (proxyTenants []*tenant.ProxyTenant, err error) {
+	ctx, span := tracing.StartSpan(ctx, "getProxyTenantsForOwnerKind", attribute.String("capsule.owner.kind", ownerKind.String()))
+	defer func() {
+		span.SetAttributes(attribute.Int("capsule.tenants", len(proxyTenants)))
+		tracing.EndSpan(span, err)
+	}()
+
 	ownerIndexValue := fmt.Sprintf("%s:%s", ownerKind.String(), ownerName)
 
 	tl := &capsulev1beta2.TenantList{}
@@ -750,17 +1206,22 @@ func (n *kubeFilter) getProxyTenantsForOwnerKind(ctx context.Context, ownerKind
 
 	for _, proxySetting := range proxySettings.Items {
 		tntList := &capsulev1beta2.TenantList{}
-		if err = n.managerReader.List(ctx, tntList, client.MatchingFields{".status.namespaces": proxySetting.GetNamespace()}); err != nil {
+		if err = n.managerReader.List(ctx, tntList, client.MatchingFields{indexer.TenantNamespacesField: proxySetting.GetNamespace()}); err != nil {
 			n.log.Error(err, "cannot retrieve Tenant list for ProxySetting", "owner", ownerKind, "name", ownerName)
 
 			continue
 		}
 
 		if len(tntList.Items) == 0 {
+			n.log.V(4).Info("ignoring ProxySetting outside of a Tenant namespace", "namespace", proxySetting.GetNamespace(), "name", proxySetting.GetName())
+
 			continue
 		}
 
-		proxyTenants = append(proxyTenants, tenant.NewProxyTenant(tntList.Items[0], ownerName, ownerKind, proxySetting.Spec.Subjects, n.gates.Enabled(features.ProxyClusterScoped)))
+		pt := tenant.NewProxyTenant(tntList.Items[0], ownerName, ownerKind, proxySetting.Spec.Subjects, n.gates.Enabled(features.ProxyClusterScoped))
+		pt.Source, pt.SourceName = tenant.SourceProxySetting, proxySetting.GetNamespace()+"/"+proxySetting.GetName()
+
+		proxyTenants = append(proxyTenants, pt)
 	}
 
 	// Consider Global ProxySettings
@@ -774,6 +1235,7 @@ func (n *kubeFilter) getProxyTenantsForOwnerKind(ctx context.Context, ownerKind
 			n.log.V(10).Info("Converting GlobalProxySettings", "Setting", globalProxySetting.Name)
 
 			tProxy := tenant.NewClusterProxy(ownerName, ownerKind, globalProxySetting.Spec.Rules)
+			tProxy.Source, tProxy.SourceName = tenant.SourceGlobalProxySettings, globalProxySetting.Name
 			proxyTenants = append(proxyTenants, tProxy)
 		}
 
@@ -783,7 +1245,10 @@ func (n *kubeFilter) getProxyTenantsForOwnerKind(ctx context.Context, ownerKind
 	tenants := make([]string, 0, len(tl.Items))
 
 	for _, t := range tl.Items {
-		proxyTenants = append(proxyTenants, tenant.NewProxyTenant(t, ownerName, ownerKind, n.ownerFromCapsuleToProxySetting(t.Spec.Owners), n.gates.Enabled(features.ProxyClusterScoped)))
+		pt := tenant.NewProxyTenant(t, ownerName, ownerKind, n.ownerFromCapsuleToProxySetting(t.Spec.Owners), n.gates.Enabled(features.ProxyClusterScoped))
+		pt.Source = tenant.SourceTenantOwner
+
+		proxyTenants = append(proxyTenants, pt)
 		tenants = append(tenants, t.GetName())
 	}
 
@@ -0,0 +1,161 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package writeguard rejects the writes of Tenant users changing the labels
+// capsule-proxy relies on to filter the namespaced objects of the Tenants.
+package writeguard
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+
+	capsulemeta "github.com/projectcapsule/capsule/pkg/api/meta"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	moderrors "github.com/projectcapsule/capsule-proxy/internal/modules/errors"
+)
+
+// ProtectedLabels are the labels binding a namespaced object to its Tenant:
+// adding, changing or removing them would hide the object from the Tenant
+// users, or leak it into the view of another Tenant.
+//
+//nolint:gochecknoglobals
+var ProtectedLabels = []string{
+	capsulemeta.TenantLabel,
+	capsulemeta.NewTenantLabel,
+	capsulemeta.ManagedByCapsuleLabel,
+}
+
+// Target is the namespaced object written by a request.
+type Target struct {
+	Resource  schema.GroupVersionResource
+	Namespace string
+	Name      string
+}
+
+// TargetOf returns the namespaced object updated or patched by the request,
+// the writes of subresources aside.
+func TargetOf(request *http.Request) (Target, bool) {
+	if request.Method != http.MethodPut && request.Method != http.MethodPatch {
+		return Target{}, false
+	}
+
+	parts := strings.Split(strings.TrimPrefix(request.URL.Path, "/"), "/")
+	if slices.Contains(parts, "") {
+		return Target{}, false
+	}
+
+	switch {
+	case len(parts) == 6 && parts[0] == "api" && parts[2] == "namespaces":
+		return Target{
+			Resource:  schema.GroupVersionResource{Version: parts[1], Resource: parts[4]},
+			Namespace: parts[3],
+			Name:      parts[5],
+		}, true
+	case len(parts) == 7 && parts[0] == "apis" && parts[3] == "namespaces":
+		return Target{
+			Resource:  schema.GroupVersionResource{Group: parts[1], Version: parts[2], Resource: parts[5]},
+			Namespace: parts[4],
+			Name:      parts[6],
+		}, true
+	default:
+		return Target{}, false
+	}
+}
+
+// Guard compares the protected labels of the written object before and
+// after the write.
+type Guard struct {
+	reader client.Reader
+	mapper apimeta.RESTMapper
+}
+
+func New(reader client.Reader, mapper apimeta.RESTMapper) *Guard {
+	return &Guard{
+		reader: reader,
+		mapper: mapper,
+	}
+}
+
+// Check returns a moderrors.Error when the body of the request adds, changes
+// or removes a protected label of the target. The body is restored, so the
+// request can be forwarded.
+func (g *Guard) Check(request *http.Request, target Target) error {
+	body, err := io.ReadAll(request.Body)
+	_ = request.Body.Close()
+
+	request.Body = io.NopCloser(bytes.NewReader(body))
+
+	if err != nil {
+		return fmt.Errorf("cannot read the request body: %w", err)
+	}
+
+	current, found, err := g.current(request.Context(), target)
+	if err != nil || !found {
+		return err
+	}
+
+	gk := schema.GroupKind{Group: target.Resource.Group, Kind: target.Resource.Resource}
+
+	written, err := resultingLabels(request.Method, request.Header.Get("Content-Type"), request.URL.Query().Get("fieldManager"), current, body)
+	if err != nil {
+		return moderrors.NewBadRequest(fmt.Errorf("cannot evaluate the labels written to %s/%s: %w", target.Namespace, target.Name, err), gk)
+	}
+
+	if label, changed := changedLabel(current.Labels, written); changed {
+		return moderrors.NewForbiddenError(target.Name, gk, fmt.Sprintf("the label %s is managed by Capsule and cannot be changed", label))
+	}
+
+	return nil
+}
+
+// current returns the metadata of the target, not found when the resource
+// or the object does not exist: the API server answers the request then.
+func (g *Guard) current(ctx context.Context, target Target) (*metav1.PartialObjectMetadata, bool, error) {
+	gvk, err := g.mapper.KindFor(target.Resource)
+	if err != nil {
+		if apimeta.IsNoMatchError(err) {
+			return nil, false, nil
+		}
+
+		return nil, false, fmt.Errorf("cannot resolve the kind of %s: %w", target.Resource, err)
+	}
+
+	current := &metav1.PartialObjectMetadata{}
+	current.SetGroupVersionKind(gvk)
+
+	if err = g.reader.Get(ctx, types.NamespacedName{Namespace: target.Namespace, Name: target.Name}, current); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, false, nil
+		}
+
+		return nil, false, fmt.Errorf("cannot retrieve %s %s/%s: %w", gvk.Kind, target.Namespace, target.Name, err)
+	}
+
+	return current, true, nil
+}
+
+// changedLabel returns the first protected label whose presence or value
+// differs.
+func changedLabel(before, after map[string]string) (string, bool) {
+	for _, label := range ProtectedLabels {
+		previous, wasSet := before[label]
+		next, isSet := after[label]
+
+		if wasSet != isSet || previous != next {
+			return label, true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,283 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package writeguard
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	moderrors "github.com/projectcapsule/capsule-proxy/internal/modules/errors"
+)
+
+const tenantLabel = "capsule.clastix.io/tenant"
+
+func TestTargetOf(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		method string
+		path   string
+		want   Target
+		ok     bool
+	}{
+		{
+			method: http.MethodPatch,
+			path:   "/api/v1/namespaces/solar-dev/configmaps/settings",
+			want:   Target{Resource: schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}, Namespace: "solar-dev", Name: "settings"},
+			ok:     true,
+		},
+		{
+			method: http.MethodPut,
+			path:   "/apis/apps/v1/namespaces/solar-dev/deployments/web",
+			want:   Target{Resource: schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}, Namespace: "solar-dev", Name: "web"},
+			ok:     true,
+		},
+		{method: http.MethodPost, path: "/api/v1/namespaces/solar-dev/configmaps"},
+		{method: http.MethodDelete, path: "/api/v1/namespaces/solar-dev/configmaps/settings"},
+		{method: http.MethodPatch, path: "/api/v1/namespaces/solar-dev"},
+		{method: http.MethodPatch, path: "/apis/apps/v1/namespaces/solar-dev/deployments/web/scale"},
+		{method: http.MethodPut, path: "/api/v1/nodes/worker"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.method+" "+tc.path, func(t *testing.T) {
+			t.Parallel()
+
+			got, ok := TargetOf(httptest.NewRequest(tc.method, tc.path, nil))
+			if ok != tc.ok || got != tc.want {
+				t.Errorf("got %+v, %t; want %+v, %t", got, ok, tc.want, tc.ok)
+			}
+		})
+	}
+}
+
+//nolint:funlen
+func TestResultingLabels(t *testing.T) {
+	t.Parallel()
+
+	current := &metav1.PartialObjectMetadata{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "settings",
+			Namespace: "solar-dev",
+			Labels:    map[string]string{tenantLabel: "solar", "app": "web"},
+			ManagedFields: []metav1.ManagedFieldsEntry{{
+				Manager:    "kubectl",
+				Operation:  metav1.ManagedFieldsOperationApply,
+				APIVersion: "v1",
+				FieldsType: "FieldsV1",
+				FieldsV1:   &metav1.FieldsV1{Raw: []byte(`{"f:metadata":{"f:labels":{"f:app":{},"f:capsule.clastix.io/tenant":{}}}}`)},
+			}},
+		},
+	}
+
+	testCases := []struct {
+		name         string
+		method       string
+		contentType  string
+		fieldManager string
+		body         string
+		want         map[string]string
+		wantErr      bool
+	}{
+		{
+			name:        "update keeping the labels",
+			method:      http.MethodPut,
+			contentType: "application/json",
+			body:        `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"settings","labels":{"capsule.clastix.io/tenant":"solar"}}}`,
+			want:        map[string]string{tenantLabel: "solar"},
+		},
+		{
+			name:        "yaml update dropping the labels",
+			method:      http.MethodPut,
+			contentType: "application/yaml",
+			body:        "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: settings\n",
+			want:        nil,
+		},
+		{
+			name:        "json patch removing the label",
+			method:      http.MethodPatch,
+			contentType: "application/json-patch+json",
+			body:        `[{"op":"remove","path":"/metadata/labels/capsule.clastix.io~1tenant"},{"op":"replace","path":"/data/key","value":"v"}]`,
+			want:        map[string]string{"app": "web"},
+		},
+		{
+			name:        "json patch replacing the labels",
+			method:      http.MethodPatch,
+			contentType: "application/json-patch+json",
+			body:        `[{"op":"replace","path":"/metadata/labels","value":{"capsule.clastix.io/tenant":"wind"}}]`,
+			want:        map[string]string{tenantLabel: "wind"},
+		},
+		{
+			name:        "json patch outside of the metadata",
+			method:      http.MethodPatch,
+			contentType: "application/json-patch+json",
+			body:        `[{"op":"add","path":"/data/key","value":"v"}]`,
+			want:        current.Labels,
+		},
+		{
+			name:        "merge patch nulling the label",
+			method:      http.MethodPatch,
+			contentType: "application/merge-patch+json",
+			body:        `{"metadata":{"labels":{"capsule.clastix.io/tenant":null}},"data":{"key":"v"}}`,
+			want:        map[string]string{"app": "web"},
+		},
+		{
+			name:        "strategic merge patch adding a label",
+			method:      http.MethodPatch,
+			contentType: "application/strategic-merge-patch+json; charset=utf-8",
+			body:        `{"metadata":{"labels":{"team":"green"}}}`,
+			want:        map[string]string{tenantLabel: "solar", "app": "web", "team": "green"},
+		},
+		{
+			name:        "strategic merge patch replacing the labels",
+			method:      http.MethodPatch,
+			contentType: "application/strategic-merge-patch+json",
+			body:        `{"metadata":{"labels":{"$patch":"replace","app":"api"}}}`,
+			want:        map[string]string{"app": "api"},
+		},
+		{
+			name:        "apply patch omitting the label",
+			method:      http.MethodPatch,
+			contentType: "application/apply-patch+yaml",
+			body:        "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: settings\n  labels:\n    app: api\n",
+			want:        map[string]string{tenantLabel: "solar", "app": "api"},
+		},
+		{
+			name:         "apply patch omitting the label applied by the field manager",
+			method:       http.MethodPatch,
+			contentType:  "application/apply-patch+yaml",
+			fieldManager: "kubectl",
+			body:         "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: settings\n  labels:\n    app: api\n",
+			want:         map[string]string{"app": "api"},
+		},
+		{
+			name:         "apply patch keeping the label applied by the field manager",
+			method:       http.MethodPatch,
+			contentType:  "application/apply-patch+yaml",
+			fieldManager: "kubectl",
+			body:         "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: settings\n  labels:\n    app: web\n    capsule.clastix.io/tenant: solar\n",
+			want:         map[string]string{tenantLabel: "solar", "app": "web"},
+		},
+		{
+			name:        "unsupported patch type",
+			method:      http.MethodPatch,
+			contentType: "text/plain",
+			body:        "{}",
+			wantErr:     true,
+		},
+		{
+			name:        "invalid json patch",
+			method:      http.MethodPatch,
+			contentType: "application/json-patch+json",
+			body:        `{"op":"remove"}`,
+			wantErr:     true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := resultingLabels(tc.method, tc.contentType, tc.fieldManager, current, []byte(tc.body))
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+
+			if !tc.wantErr && !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got labels %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+		Name:      "settings",
+		Namespace: "solar-dev",
+		Labels:    map[string]string{tenantLabel: "solar"},
+	}}
+
+	mapper := apimeta.NewDefaultRESTMapper(nil)
+	mapper.Add(corev1.SchemeGroupVersion.WithKind("ConfigMap"), apimeta.RESTScopeNamespace)
+
+	guard := New(fake.NewClientBuilder().WithScheme(scheme).WithObjects(configMap).Build(), mapper)
+
+	testCases := []struct {
+		name      string
+		path      string
+		body      string
+		forbidden bool
+	}{
+		{
+			name: "unrelated label",
+			path: "/api/v1/namespaces/solar-dev/configmaps/settings",
+			body: `{"metadata":{"labels":{"app":"web"}}}`,
+		},
+		{
+			name:      "tenant label",
+			path:      "/api/v1/namespaces/solar-dev/configmaps/settings",
+			body:      `{"metadata":{"labels":{"capsule.clastix.io/tenant":"wind"}}}`,
+			forbidden: true,
+		},
+		{
+			name: "missing object",
+			path: "/api/v1/namespaces/solar-dev/configmaps/missing",
+			body: `{"metadata":{"labels":{"capsule.clastix.io/tenant":"wind"}}}`,
+		},
+		{
+			name: "unknown resource",
+			path: "/apis/example.com/v1/namespaces/solar-dev/widgets/settings",
+			body: `{"metadata":{"labels":{"capsule.clastix.io/tenant":"wind"}}}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			request := httptest.NewRequest(http.MethodPatch, tc.path, strings.NewReader(tc.body))
+			request.Header.Set("Content-Type", "application/merge-patch+json")
+
+			target, ok := TargetOf(request)
+			if !ok {
+				t.Fatal("expected a target")
+			}
+
+			err := guard.Check(request, target)
+
+			var status moderrors.Error
+			if forbidden := errors.As(err, &status) && status.Status().Code == http.StatusForbidden; forbidden != tc.forbidden {
+				t.Errorf("got error %v, forbidden expected %t", err, tc.forbidden)
+			}
+
+			if !tc.forbidden && err != nil {
+				t.Errorf("unexpected error %v", err)
+			}
+
+			if body, _ := io.ReadAll(request.Body); string(body) != tc.body {
+				t.Errorf("body not restored, got %q", body)
+			}
+		})
+	}
+}
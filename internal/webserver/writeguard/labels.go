@@ -0,0 +1,264 @@
+// Copyright 2020-2026 Project Capsule Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package writeguard
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"mime"
+	"net/http"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// resultingLabels returns the labels of the object once the body of the
+// request is applied to its current metadata. The field manager only matters
+// to server-side apply requests.
+func resultingLabels(method, contentType, fieldManager string, current *metav1.PartialObjectMetadata, body []byte) (map[string]string, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Content-Type %q: %w", contentType, err)
+	}
+
+	if method == http.MethodPut {
+		return updatedLabels(mediaType, body)
+	}
+
+	switch types.PatchType(mediaType) {
+	case types.JSONPatchType:
+		return jsonPatchedLabels(current, body)
+	case types.MergePatchType:
+		return mergePatchedLabels(current, body)
+	case types.StrategicMergePatchType:
+		return strategicMergePatchedLabels(current, body)
+	case types.ApplyYAMLPatchType:
+		return appliedLabels(current, fieldManager, body)
+	default:
+		return nil, fmt.Errorf("unsupported patch type %q", mediaType)
+	}
+}
+
+// updatedLabels returns the labels of the object replacing the current one.
+func updatedLabels(mediaType string, body []byte) (map[string]string, error) {
+	switch mediaType {
+	case runtime.ContentTypeJSON, runtime.ContentTypeYAML:
+		object, err := decodeMetadata(body)
+		if err != nil {
+			return nil, err
+		}
+
+		return object.Labels, nil
+	case runtime.ContentTypeProtobuf:
+		obj, _, err := scheme.Codecs.UniversalDeserializer().Decode(body, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode the object: %w", err)
+		}
+
+		accessor, err := apimeta.Accessor(obj)
+		if err != nil {
+			return nil, fmt.Errorf("cannot access the object metadata: %w", err)
+		}
+
+		return accessor.GetLabels(), nil
+	default:
+		return nil, fmt.Errorf("unsupported media type %q", mediaType)
+	}
+}
+
+// jsonPatchedLabels applies the operations touching the metadata to the
+// current one: the others cannot change labels, and would fail on a document
+// missing the rest of the object.
+func jsonPatchedLabels(current *metav1.PartialObjectMetadata, body []byte) (map[string]string, error) {
+	var operations []map[string]*json.RawMessage
+	if err := json.Unmarshal(body, &operations); err != nil {
+		return nil, fmt.Errorf("cannot decode the JSON patch: %w", err)
+	}
+
+	filtered := make(jsonpatch.Patch, 0, len(operations))
+
+	for _, operation := range operations {
+		path, err := jsonpatch.Operation(operation).Path()
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON patch operation: %w", err)
+		}
+
+		from, _ := jsonpatch.Operation(operation).From()
+
+		if touchesMetadata(path) || (len(from) > 0 && touchesMetadata(from)) {
+			filtered = append(filtered, operation)
+		}
+	}
+
+	if len(filtered) == 0 {
+		return current.Labels, nil
+	}
+
+	document, err := json.Marshal(current)
+	if err != nil {
+		return nil, err
+	}
+
+	patched, err := filtered.Apply(document)
+	if err != nil {
+		return nil, fmt.Errorf("cannot apply the JSON patch: %w", err)
+	}
+
+	object, err := decodeMetadata(patched)
+	if err != nil {
+		return nil, err
+	}
+
+	return object.Labels, nil
+}
+
+func touchesMetadata(path string) bool {
+	return path == "" || path == "/metadata" || strings.HasPrefix(path, "/metadata/")
+}
+
+// mergePatchedLabels applies the metadata of a JSON merge patch.
+func mergePatchedLabels(current *metav1.PartialObjectMetadata, body []byte) (map[string]string, error) {
+	patch, err := metadataPatch(body)
+	if err != nil {
+		return nil, err
+	}
+
+	document, err := json.Marshal(current)
+	if err != nil {
+		return nil, err
+	}
+
+	patched, err := jsonpatch.MergePatch(document, patch)
+	if err != nil {
+		return nil, fmt.Errorf("cannot apply the merge patch: %w", err)
+	}
+
+	object, err := decodeMetadata(patched)
+	if err != nil {
+		return nil, err
+	}
+
+	return object.Labels, nil
+}
+
+// strategicMergePatchedLabels applies the metadata of a strategic merge
+// patch, along with its directives replacing or deleting the whole object.
+func strategicMergePatchedLabels(current *metav1.PartialObjectMetadata, body []byte) (map[string]string, error) {
+	patch, err := metadataPatch(body, "$patch")
+	if err != nil {
+		return nil, err
+	}
+
+	document, err := json.Marshal(current)
+	if err != nil {
+		return nil, err
+	}
+
+	patched, err := strategicpatch.StrategicMergePatch(document, patch, &metav1.PartialObjectMetadata{})
+	if err != nil {
+		return nil, fmt.Errorf("cannot apply the strategic merge patch: %w", err)
+	}
+
+	object, err := decodeMetadata(patched)
+	if err != nil {
+		return nil, err
+	}
+
+	return object.Labels, nil
+}
+
+// appliedLabels returns the current labels overridden by the ones of a
+// server-side apply: omitting a label does not remove the ones owned by
+// other field managers, such as Capsule, but removes the protected labels
+// the applying field manager owns.
+func appliedLabels(current *metav1.PartialObjectMetadata, fieldManager string, body []byte) (map[string]string, error) {
+	object, err := decodeMetadata(body)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := maps.Clone(current.Labels)
+	if labels == nil {
+		labels = map[string]string{}
+	}
+
+	maps.Copy(labels, object.Labels)
+
+	for _, label := range ProtectedLabels {
+		if _, applied := object.Labels[label]; !applied && appliesLabel(current.ManagedFields, fieldManager, label) {
+			delete(labels, label)
+		}
+	}
+
+	return labels, nil
+}
+
+// appliesLabel reports whether the field manager owns the label through a
+// previous server-side apply of the object.
+func appliesLabel(managedFields []metav1.ManagedFieldsEntry, fieldManager, label string) bool {
+	for _, entry := range managedFields {
+		if entry.Manager != fieldManager || entry.Operation != metav1.ManagedFieldsOperationApply ||
+			entry.Subresource != "" || entry.FieldsV1 == nil {
+			continue
+		}
+
+		var fields struct {
+			Metadata struct {
+				Labels map[string]json.RawMessage `json:"f:labels"`
+			} `json:"f:metadata"`
+		}
+
+		if err := json.Unmarshal(entry.FieldsV1.Raw, &fields); err != nil {
+			continue
+		}
+
+		if _, ok := fields.Metadata.Labels["f:"+label]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// metadataPatch strips the patch from everything but the metadata and the
+// given top level keys.
+func metadataPatch(body []byte, keys ...string) ([]byte, error) {
+	var patch map[string]json.RawMessage
+	if err := json.Unmarshal(body, &patch); err != nil {
+		return nil, fmt.Errorf("cannot decode the patch: %w", err)
+	}
+
+	stripped := map[string]json.RawMessage{}
+
+	for _, key := range append(keys, "metadata") {
+		if value, ok := patch[key]; ok {
+			stripped[key] = value
+		}
+	}
+
+	return json.Marshal(stripped)
+}
+
+// decodeMetadata decodes the metadata of a JSON or YAML object.
+func decodeMetadata(body []byte) (*metav1.PartialObjectMetadata, error) {
+	document, err := yaml.ToJSON(body)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode the object: %w", err)
+	}
+
+	object := &metav1.PartialObjectMetadata{}
+	if err = json.Unmarshal(document, object); err != nil {
+		return nil, fmt.Errorf("cannot decode the object metadata: %w", err)
+	}
+
+	return object, nil
+}
@@ -8,6 +8,7 @@ import (
 	goflag "flag"
 	"fmt"
 	"os"
+	"slices"
 	"time"
 
 	capsulev1beta1 "github.com/projectcapsule/capsule/api/v1beta1"
@@ -20,6 +21,8 @@ import (
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/component-base/featuregate"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -27,13 +30,22 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	ctrlwebhook "sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 
 	capsuleproxyv1beta1 "github.com/projectcapsule/capsule-proxy/api/v1beta1"
+	"github.com/projectcapsule/capsule-proxy/internal/audit"
 	"github.com/projectcapsule/capsule-proxy/internal/controllers"
 	"github.com/projectcapsule/capsule-proxy/internal/features"
 	"github.com/projectcapsule/capsule-proxy/internal/indexer"
+	"github.com/projectcapsule/capsule-proxy/internal/modules"
+	"github.com/projectcapsule/capsule-proxy/internal/oidc"
 	"github.com/projectcapsule/capsule-proxy/internal/options"
 	"github.com/projectcapsule/capsule-proxy/internal/request"
+	"github.com/projectcapsule/capsule-proxy/internal/reviewcache"
+	"github.com/projectcapsule/capsule-proxy/internal/tracing"
+	"github.com/projectcapsule/capsule-proxy/internal/webhooks/labeler"
+	"github.com/projectcapsule/capsule-proxy/internal/webhooks/proxysettings"
+	"github.com/projectcapsule/capsule-proxy/internal/webhooks/watchdog"
 	"github.com/projectcapsule/capsule-proxy/internal/webserver"
 )
 
@@ -50,20 +62,30 @@ func setupHealthProbes(mgr ctrl.Manager, filter webserver.Filter) error {
 		return fmt.Errorf("cannot create readiness probe: %w", err)
 	}
 
+	// The unavailable API group versions are listed at /readyz/discovery: the
+	// Pod readiness probe excludes this check, a single broken APIService must
+	// not take every replica out of service.
+	if err := mgr.AddReadyzCheck("discovery", filter.DiscoveryProbe); err != nil {
+		return fmt.Errorf("cannot create discovery probe: %w", err)
+	}
+
 	return nil
 }
 
-// setupObservedGenerationControllers registers the status controllers that maintain
-// observedGeneration on GlobalProxySettings and ProxySetting resources.
-func setupObservedGenerationControllers(mgr ctrl.Manager) error {
+// setupProxySettingsControllers registers the status controllers that maintain
+// observedGeneration and rule resolution conditions on GlobalProxySettings
+// and ProxySetting resources.
+func setupProxySettingsControllers(mgr ctrl.Manager, discoveryClient discovery.DiscoveryInterface) error {
 	if err := (&controllers.GlobalProxySettingsReconciler{
-		Client: mgr.GetClient(),
+		Client:    mgr.GetClient(),
+		Discovery: discoveryClient,
 	}).SetupWithManager(mgr); err != nil {
 		return fmt.Errorf("cannot start GlobalProxySettings controller: %w", err)
 	}
 
 	if err := (&controllers.ProxySettingReconciler{
-		Client: mgr.GetClient(),
+		Client:    mgr.GetClient(),
+		Discovery: discoveryClient,
 	}).SetupWithManager(mgr); err != nil {
 		return fmt.Errorf("cannot start ProxySetting controller: %w", err)
 	}
@@ -71,9 +93,64 @@ func setupObservedGenerationControllers(mgr ctrl.Manager) error {
 	return nil
 }
 
+// setupWebhooks registers the admission handlers of the enabled webhooks
+// on the manager webhook server.
+func setupWebhooks(mgr ctrl.Manager, hooks []WebhookType, watchdogTrustedUsernames, watchdogAdminGroups []string) error {
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(mgr.GetConfig())
+	if err != nil {
+		return fmt.Errorf("cannot create discovery client: %w", err)
+	}
+
+	if slices.Contains(hooks, WebhookLabler) {
+		mgr.GetWebhookServer().Register("/mutate/labeler", &ctrlwebhook.Admission{
+			Handler: labeler.NewLabeler(
+				mgr.GetClient(),
+				ctrl.Log.WithName("webhooks").WithName("labeler"),
+			),
+		})
+
+		if err = mgr.Add(labeler.NewBackfill(
+			mgr.GetAPIReader(),
+			mgr.GetClient(),
+			discoveryClient,
+			ctrl.Log.WithName("webhooks").WithName("labeler").WithName("backfill"),
+		)); err != nil {
+			return fmt.Errorf("cannot add the labeler backfill as Runnable: %w", err)
+		}
+	}
+
+	if slices.Contains(hooks, WebhookWatchdog) {
+		mgr.GetWebhookServer().Register("/validate/watchdog", &ctrlwebhook.Admission{
+			Handler: watchdog.NewWatchdog(
+				mgr.GetClient(),
+				watchdogTrustedUsernames,
+				watchdogAdminGroups,
+				ctrl.Log.WithName("webhooks").WithName("watchdog"),
+			),
+		})
+	}
+
+	if slices.Contains(hooks, WebhookProxySettings) {
+		mgr.GetWebhookServer().Register("/validate/proxysettings", &ctrlwebhook.Admission{
+			Handler: proxysettings.NewValidator(
+				admission.NewDecoder(mgr.GetScheme()),
+				discoveryClient,
+				ctrl.Log.WithName("webhooks").WithName("proxysettings"),
+			),
+		})
+	}
+
+	return nil
+}
+
 const (
 	WebhookWatchdog WebhookType = iota
 	WebhookLabler
+	WebhookProxySettings
 )
 
 //nolint:cyclop,funlen,maintidx
@@ -91,7 +168,7 @@ func main() {
 		err                                                                                                                                error
 		mgr                                                                                                                                ctrl.Manager
 		namespace, certPath, keyPath, usernameClaimField, capsuleConfigurationName, impersonationGroupsRegexp, metricsAddr, xfccHeaderName string
-		capsuleUserGroups, ignoredUserGroups, ignoredUsernames, ignoreImpersonationGroups, allowedPaths, trustedProxyCIDRStrings           []string
+		ignoredUserGroups, ignoredUsernames, ignoreImpersonationGroups, allowedPaths, trustedProxyCIDRStrings                              []string
 		listeningPort                                                                                                                      uint
 		bindSsl, disableCaching, enablePprof, enableLeaderElection, roleBindingReflector                                                   bool
 		rolebindingsResyncPeriod                                                                                                           time.Duration
@@ -99,6 +176,16 @@ func main() {
 		clientConnectionBurst                                                                                                              int32
 		webhookPort                                                                                                                        int
 		hooks                                                                                                                              []WebhookType
+		oidcIssuerURLs, oidcAudiences                                                                                                      []string
+		oidcUsernamePrefix, oidcGroupsClaim, oidcGroupsPrefix, oidcCAFile                                                                  string
+		reviewCacheSize                                                                                                                    int
+		reviewCachePositiveTTL, reviewCacheNegativeTTL                                                                                     time.Duration
+		auditLogPath, auditWebhookURL                                                                                                      string
+		namespacedListStrategy                                                                                                             string
+		tracingEndpoint                                                                                                                    string
+		tracingInsecure                                                                                                                    bool
+		tracingSampleRatio                                                                                                                 float64
+		watchdogTrustedUsernames, watchdogAdminGroups                                                                                      []string
 	)
 
 	gates := featuregate.NewFeatureGate()
@@ -119,6 +206,16 @@ func main() {
 			LockToDefault: false,
 			PreRelease:    featuregate.Alpha,
 		},
+		features.ImpersonateFilteredRequests: {
+			Default:       false,
+			LockToDefault: false,
+			PreRelease:    featuregate.Alpha,
+		},
+		features.DiscoveryFilter: {
+			Default:       false,
+			LockToDefault: false,
+			PreRelease:    featuregate.Alpha,
+		},
 	}))
 
 	authTypes := []request.AuthType{
@@ -130,6 +227,13 @@ func main() {
 		request.BearerToken:          {request.BearerToken.String()},
 		request.TLSCertificate:       {request.TLSCertificate.String()},
 		request.XForwardedClientCert: {request.XForwardedClientCert.String()},
+		request.OIDC:                 {request.OIDC.String()},
+	}
+
+	hooksMap := map[WebhookType][]string{
+		WebhookWatchdog:      {"watchdog"},
+		WebhookLabler:        {"labeler"},
+		WebhookProxySettings: {"proxysettings"},
 	}
 
 	flag.IntVar(
@@ -152,7 +256,7 @@ func main() {
 		"The address the metric endpoint binds to.",
 	)
 	flag.StringSliceVar(
-		&capsuleUserGroups,
+		&allowedPaths,
 		"allowed-paths",
 		[]string{
 			"/api", "/apis", "/version",
@@ -189,6 +293,18 @@ func main() {
 		[]string{},
 		"Usernames whose requests must be ignored and proxy-passed to the upstream server",
 	)
+	flag.StringSliceVar(
+		&watchdogTrustedUsernames,
+		"watchdog-trusted-username",
+		[]string{},
+		"Usernames, such as the ones of service accounts, allowed by the watchdog webhook to change the labels and objects capsule-proxy relies on",
+	)
+	flag.StringSliceVar(
+		&watchdogAdminGroups,
+		"watchdog-admin-group",
+		[]string{},
+		"Names of the groups allowed by the watchdog webhook to change the labels and objects capsule-proxy relies on",
+	)
 	flag.StringSliceVar(
 		&ignoreImpersonationGroups,
 		"ignored-impersonation-group",
@@ -213,6 +329,96 @@ func main() {
 		"preferred_username",
 		"The OIDC field name used to identify the user (default: preferred_username)",
 	)
+	flag.StringSliceVar(
+		&oidcIssuerURLs,
+		"oidc-issuer-url",
+		[]string{},
+		"URLs of the OIDC issuers whose tokens are validated locally by the OIDC authentication type",
+	)
+	flag.StringSliceVar(
+		&oidcAudiences,
+		"oidc-audience",
+		[]string{},
+		"Audiences accepted in the aud claim of OIDC tokens, at least one must match",
+	)
+	flag.StringVar(
+		&oidcUsernamePrefix,
+		"oidc-username-prefix",
+		"",
+		"Prefix prepended to the OIDC username claim, it must match the API server --oidc-username-prefix",
+	)
+	flag.StringVar(
+		&oidcGroupsClaim,
+		"oidc-groups-claim",
+		"groups",
+		"The OIDC field name used to retrieve the user groups, it can be a string or an array of strings",
+	)
+	flag.StringVar(
+		&oidcGroupsPrefix,
+		"oidc-groups-prefix",
+		"",
+		"Prefix prepended to the OIDC groups, it must match the API server --oidc-groups-prefix",
+	)
+	flag.StringVar(
+		&oidcCAFile,
+		"oidc-ca-file",
+		"",
+		"Path to the CA bundle used to verify the OIDC issuers, the system roots are used when empty",
+	)
+	flag.IntVar(
+		&reviewCacheSize,
+		"review-cache-size",
+		reviewcache.DefaultSize,
+		"Maximum number of TokenReview and SubjectAccessReview results kept in memory, 0 disables the cache",
+	)
+	flag.DurationVar(
+		&reviewCachePositiveTTL,
+		"review-cache-positive-ttl",
+		reviewcache.DefaultPositiveTTL,
+		"How long authenticated tokens and allowed SubjectAccessReviews are cached",
+	)
+	flag.DurationVar(
+		&reviewCacheNegativeTTL,
+		"review-cache-negative-ttl",
+		reviewcache.DefaultNegativeTTL,
+		"How long rejected tokens and denied SubjectAccessReviews are cached",
+	)
+	flag.StringVar(
+		&auditLogPath,
+		"audit-log-path",
+		"",
+		"Path of the file the audit events of the proxied requests are appended to, '-' writes them to the standard output",
+	)
+	flag.StringVar(
+		&auditWebhookURL,
+		"audit-webhook-url",
+		"",
+		"URL the audit events of the proxied requests are posted to as an audit.k8s.io/v1 EventList",
+	)
+	flag.StringVar(
+		&tracingEndpoint,
+		"tracing-endpoint",
+		"",
+		"OTLP gRPC collector address the spans of the proxied requests are exported to, spans are not exported when empty",
+	)
+	flag.BoolVar(
+		&tracingInsecure,
+		"tracing-insecure",
+		false,
+		"Disable TLS towards the OTLP collector",
+	)
+	flag.Float64Var(
+		&tracingSampleRatio,
+		"tracing-sample-ratio",
+		tracing.DefaultSampleRatio,
+		"Ratio of the traces started by capsule-proxy which are sampled, the sampling decision of the caller is kept",
+	)
+	flag.StringVar(
+		&namespacedListStrategy,
+		"namespaced-list-strategy",
+		string(modules.ListStrategyLabel),
+		"How cross-namespace lists of namespaced resources are served: 'label' selects the objects by their Tenant label, 'fanout' lists each allowed Tenant namespace and merges the results",
+	)
 	flag.BoolVar(
 		&roleBindingReflector,
 		"enable-reflector",
@@ -251,8 +457,13 @@ func main() {
 	)
 	flag.Var(
 		enumflag.NewSlice(&authTypes, "string", authTypesMap, enumflag.EnumCaseSensitive), "auth-preferred-types",
-		`Authentication types to be used for requests. Possible Auth Types: [BearerToken, TLSCertificate, XForwardedClientCert]
+		`Authentication types to be used for requests. Possible Auth Types: [BearerToken, TLSCertificate, XForwardedClientCert, OIDC]
 First match is used and can be specified multiple times as comma separated values or by using the flag multiple times.`,
+	)
+	flag.Var(
+		enumflag.NewSlice(&hooks, "string", hooksMap, enumflag.EnumCaseInsensitive), "webhooks",
+		`Webhooks served by the webhook server. Possible Webhooks: [watchdog, labeler, proxysettings]
+Can be specified multiple times as comma separated values or by using the flag multiple times.`,
 	)
 	flag.BoolVar(
 		&disableCaching,
@@ -408,6 +619,72 @@ First match is used and can be specified multiple times as comma separated value
 		}
 	}
 
+	var tokenAuthenticator request.TokenAuthenticator
+
+	if slices.Contains(authTypes, request.OIDC) {
+		log.Info(fmt.Sprintf("Validating OIDC tokens locally for the issuers %v", oidcIssuerURLs))
+
+		var oidcAuthenticator *oidc.Authenticator
+
+		if oidcAuthenticator, err = oidc.NewAuthenticator(oidc.Options{
+			IssuerURLs:     oidcIssuerURLs,
+			Audiences:      oidcAudiences,
+			UsernameClaim:  usernameClaimField,
+			UsernamePrefix: oidcUsernamePrefix,
+			GroupsClaim:    oidcGroupsClaim,
+			GroupsPrefix:   oidcGroupsPrefix,
+			CAFile:         oidcCAFile,
+		}); err != nil {
+			log.Error(err, "cannot create OIDC authenticator")
+			os.Exit(1)
+		}
+
+		tokenAuthenticator = oidcAuthenticator
+	}
+
+	tracingProvider, err := tracing.Setup(ctx, tracing.Options{
+		Endpoint:    tracingEndpoint,
+		Insecure:    tracingInsecure,
+		SampleRatio: tracingSampleRatio,
+	})
+	if err != nil {
+		log.Error(err, "cannot set up tracing")
+		os.Exit(1)
+	}
+
+	if tracingProvider != nil {
+		if err = mgr.Add(tracingProvider); err != nil {
+			log.Error(err, "cannot add tracing provider as Runnable")
+			os.Exit(1)
+		}
+	}
+
+	var auditFileSink, auditWebhookSink audit.Sink
+
+	if len(auditLogPath) > 0 {
+		if auditFileSink, err = audit.NewFileSink(auditLogPath); err != nil {
+			log.Error(err, "cannot create audit log sink")
+			os.Exit(1)
+		}
+	}
+
+	if len(auditWebhookURL) > 0 {
+		webhookSink := audit.NewWebhookSink(auditWebhookURL, ctrl.Log.WithName("audit"))
+
+		if err = mgr.Add(webhookSink); err != nil {
+			log.Error(err, "cannot add audit webhook sink as Runnable")
+			os.Exit(1)
+		}
+
+		auditWebhookSink = webhookSink
+	}
+
+	listStrategy, err := modules.ParseListStrategy(namespacedListStrategy)
+	if err != nil {
+		log.Error(err, "cannot parse the namespaced list strategy")
+		os.Exit(1)
+	}
+
 	log.Info("Creating the NamespaceFilter runner")
 
 	var listenerOpts options.ListenerOpts
@@ -424,6 +701,14 @@ First match is used and can be specified multiple times as comma separated value
 		trustedProxyCIDRStrings,
 		xfccHeaderName,
 		allowedPaths,
+		tokenAuthenticator,
+		reviewcache.Options{
+			Size:        reviewCacheSize,
+			PositiveTTL: reviewCachePositiveTTL,
+			NegativeTTL: reviewCacheNegativeTTL,
+		},
+		audit.NewMultiSink(auditFileSink, auditWebhookSink),
+		listStrategy,
 	); err != nil {
 		log.Error(err, "cannot create Kubernetes options")
 		os.Exit(1)
@@ -444,12 +729,23 @@ First match is used and can be specified multiple times as comma separated value
 		clientOverride = mgr.GetClient()
 	}
 
+	// The discovery is cached in memory, shared by the proxy routes and the
+	// ProxySettings controllers: the routes refresh invalidates it.
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(mgr.GetConfig())
+	if err != nil {
+		log.Error(err, "cannot create discovery client")
+		os.Exit(1)
+	}
+
+	cachedDiscoveryClient := memory.NewMemCacheClient(discoveryClient)
+
 	r, err := webserver.NewKubeFilter(
 		listenerOpts,
 		serverOpts,
 		gates,
 		rbReflector,
 		clientOverride,
+		cachedDiscoveryClient,
 		mgr)
 	if err != nil {
 		log.Error(err, "cannot create NamespaceFilter runner")
@@ -461,6 +757,11 @@ First match is used and can be specified multiple times as comma separated value
 		os.Exit(1)
 	}
 
+	if err = (&controllers.APIResources{Refresh: r.RefreshRoutes}).SetupWithManager(mgr); err != nil {
+		log.Error(err, "cannot start the API resources controller refreshing the proxy routes")
+		os.Exit(1)
+	}
+
 	if err = (&controllers.CapsuleConfiguration{
 		Client:                   mgr.GetClient(),
 		CapsuleConfigurationName: capsuleConfigurationName,
@@ -469,8 +770,13 @@ First match is used and can be specified multiple times as comma separated value
 		os.Exit(1)
 	}
 
-	if err := setupObservedGenerationControllers(mgr); err != nil {
-		log.Error(err, "unable to set up observed generation controllers")
+	if err := setupProxySettingsControllers(mgr, cachedDiscoveryClient); err != nil {
+		log.Error(err, "unable to set up ProxySetting controllers")
+		os.Exit(1)
+	}
+
+	if err = setupWebhooks(mgr, hooks, watchdogTrustedUsernames, watchdogAdminGroups); err != nil {
+		log.Error(err, "cannot set up webhooks")
 		os.Exit(1)
 	}
 